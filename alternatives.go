@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// defaultAlternativesTool is the alternatives tool of Fedora and RHEL.
+const defaultAlternativesTool = "/usr/sbin/alternatives"
+
+// Alternative is a binary managed by the alternatives system, see AddAlternative.
+type Alternative struct {
+	// Link is the generic path, e.g. /usr/bin/editor.
+	Link string
+	// Name is the name of the alternative group, e.g. "editor". It defaults to the base name of Link.
+	Name string
+	// Path is the file of this package that Link points to, e.g. /usr/bin/vim.
+	Path string
+	// Priority decides which alternative is used in automatic mode, the highest wins.
+	Priority int
+	// Slaves are links which follow the master link, e.g. the man page.
+	Slaves []Alternative
+	// Tool is the alternatives command, defaulting to /usr/sbin/alternatives.
+	// Use /usr/sbin/update-alternatives on SUSE and Debian based distributions.
+	Tool string
+}
+
+// AddAlternative makes the package install an alternative for a binary, like the
+// alternatives handling of the Fedora packaging guidelines:
+//   - Link and the slave links are added as %ghost symlinks, so they are owned by the package.
+//   - The %post scriptlet installs the alternative, and %preun removes it when the package
+//     is erased (not on upgrades).
+//   - The package requires the alternatives tool for both scriptlets.
+//
+// The scriptlets are appended to existing postin and preun scriptlets, which must be run
+// by a shell.
+func (r *RPM) AddAlternative(a Alternative) error {
+	if err := r.checkShellScriptlets(ScriptletPostin, ScriptletPreun); err != nil {
+		return err
+	}
+	if a.Name == "" {
+		a.Name = path.Base(a.Link)
+	}
+	if a.Tool == "" {
+		a.Tool = defaultAlternativesTool
+	}
+	all := append([]Alternative{a}, a.Slaves...)
+	for _, alt := range all {
+		if !path.IsAbs(alt.Link) || !path.IsAbs(alt.Path) {
+			return fmt.Errorf("alternative %q: link %q and path %q must be absolute", a.Name, alt.Link, alt.Path)
+		}
+	}
+	install := []string{a.Tool, "--install", a.Link, a.Name, a.Path, fmt.Sprint(a.Priority)}
+	for i, alt := range all {
+		if i > 0 {
+			name := alt.Name
+			if name == "" {
+				name = path.Base(alt.Link)
+			}
+			install = append(install, "--slave", alt.Link, name, alt.Path)
+		}
+		r.AddFile(RPMFile{
+			Name:  alt.Link,
+			Body:  []byte(alt.Path),
+			Mode:  0120777,
+			Owner: "root",
+			Group: "root",
+			Type:  GhostFile,
+		})
+	}
+	quoted := make([]string, len(install))
+	for i, arg := range install {
+		quoted[i] = shellQuote(arg)
+	}
+	if err := r.appendScriptletBody(ScriptletPostin, strings.Join(quoted, " ")+"\n"); err != nil {
+		return err
+	}
+	if err := r.appendScriptletBody(ScriptletPreun, fmt.Sprintf("if [ $1 -eq 0 ]; then\n    %s --remove %s %s\nfi\n",
+		shellQuote(a.Tool), shellQuote(a.Name), shellQuote(a.Path))); err != nil {
+		return err
+	}
+	return r.AddScriptRequires(SenseScriptPost|SenseScriptPreUn, a.Tool)
+}
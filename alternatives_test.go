@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddAlternative(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "vim"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPostin("echo post")
+	err = r.AddAlternative(Alternative{
+		Link:     "/usr/bin/editor",
+		Path:     "/usr/bin/vim",
+		Priority: 50,
+		Slaves: []Alternative{{
+			Link: "/usr/share/man/man1/editor.1.gz",
+			Name: "editor.1.gz",
+			Path: "/usr/share/man/man1/vim.1.gz",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("AddAlternative returned error %v", err)
+	}
+	wantFiles := map[string]RPMFile{
+		"/usr/bin/editor":                 {Name: "/usr/bin/editor", Body: []byte("/usr/bin/vim"), Mode: 0120777, Owner: "root", Group: "root", Type: GhostFile},
+		"/usr/share/man/man1/editor.1.gz": {Name: "/usr/share/man/man1/editor.1.gz", Body: []byte("/usr/share/man/man1/vim.1.gz"), Mode: 0120777, Owner: "root", Group: "root", Type: GhostFile},
+	}
+	if d := cmp.Diff(wantFiles, r.files); d != "" {
+		t.Errorf("files differ (want->got):\n%v", d)
+	}
+	wantPost := "echo post\n'/usr/sbin/alternatives' '--install' '/usr/bin/editor' 'editor' '/usr/bin/vim' '50' " +
+		"'--slave' '/usr/share/man/man1/editor.1.gz' 'editor.1.gz' '/usr/share/man/man1/vim.1.gz'\n"
+	if d := cmp.Diff(wantPost, r.scriptlets[ScriptletPostin].body); d != "" {
+		t.Errorf("postin differs (want->got):\n%v", d)
+	}
+	wantPreun := "if [ $1 -eq 0 ]; then\n    '/usr/sbin/alternatives' --remove 'editor' '/usr/bin/vim'\nfi\n"
+	if d := cmp.Diff(wantPreun, r.scriptlets[ScriptletPreun].body); d != "" {
+		t.Errorf("preun differs (want->got):\n%v", d)
+	}
+	want := Relations{{Name: "/usr/sbin/alternatives", Sense: SenseScriptPost | SenseScriptPreUn}}
+	if d := cmp.Diff(want, r.Requires); d != "" {
+		t.Errorf("Requires differ (want->got):\n%v", d)
+	}
+	if err := r.AddAlternative(Alternative{Link: "editor", Path: "/usr/bin/vim"}); err == nil {
+		t.Errorf("AddAlternative with a relative link should have returned an error")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AppStreamProvides returns a DependencyGenerator for desktop applications, like the
+// desktop-file and metainfo generators of rpmbuild, so software centers can find them:
+//   - desktop entries (*/share/applications/*.desktop) provide "application()",
+//     "application(name.desktop)" and "mimehandler(type)" for each of their MimeType.
+//   - AppStream metadata (*/share/metainfo/*.xml and */share/appdata/*.xml) provides
+//     "metainfo()" and "metainfo(name.xml)".
+//
+// Files matching one of the exclude patterns (see path.Match) are skipped.
+func AppStreamProvides(exclude ...string) DependencyGenerator {
+	return func(f RPMFile) (Relations, Relations, error) {
+		if excludedPath(f.Name, exclude) {
+			return nil, nil, nil
+		}
+		dir, base := path.Split(f.Name)
+		dir = path.Clean(dir)
+		var provides Relations
+		switch {
+		case strings.HasSuffix(base, ".desktop") && strings.HasSuffix(dir, "/share/applications"):
+			provides = Relations{
+				&Relation{Name: "application()"},
+				&Relation{Name: fmt.Sprintf("application(%s)", base)},
+			}
+			for _, mime := range desktopMimeTypes(f.Body) {
+				provides.addIfMissing(&Relation{Name: fmt.Sprintf("mimehandler(%s)", mime)})
+			}
+		case strings.HasSuffix(base, ".xml") && (strings.HasSuffix(dir, "/share/metainfo") || strings.HasSuffix(dir, "/share/appdata")):
+			provides = Relations{
+				&Relation{Name: "metainfo()"},
+				&Relation{Name: fmt.Sprintf("metainfo(%s)", base)},
+			}
+		}
+		return provides, nil, nil
+	}
+}
+
+// desktopMimeTypes returns the MimeType entries of the [Desktop Entry] group of a desktop file.
+func desktopMimeTypes(body []byte) []string {
+	var types []string
+	inEntry := false
+	s := bufio.NewScanner(bytes.NewReader(body))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !inEntry || !ok || strings.TrimSpace(k) != "MimeType" {
+			continue
+		}
+		for _, t := range strings.Split(v, ";") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+)
+
+func TestAppStreamProvides(t *testing.T) {
+	desktop := []byte(`[Desktop Entry]
+Name=Hello
+Exec=hello %f
+MimeType=text/plain;image/png;
+
+[Desktop Action New]
+MimeType=ignored/type;
+`)
+	testCases := []struct {
+		name    string
+		file    RPMFile
+		exclude []string
+		want    string
+	}{{
+		name: "desktop entry",
+		file: RPMFile{Name: "/usr/share/applications/org.example.Hello.desktop", Body: desktop},
+		want: "application(),application(org.example.Hello.desktop),mimehandler(text/plain),mimehandler(image/png)",
+	}, {
+		name: "metainfo",
+		file: RPMFile{Name: "/usr/share/metainfo/org.example.Hello.metainfo.xml", Body: []byte("<component/>")},
+		want: "metainfo(),metainfo(org.example.Hello.metainfo.xml)",
+	}, {
+		name: "appdata",
+		file: RPMFile{Name: "/usr/share/appdata/hello.appdata.xml", Body: []byte("<component/>")},
+		want: "metainfo(),metainfo(hello.appdata.xml)",
+	}, {
+		name: "desktop file elsewhere",
+		file: RPMFile{Name: "/etc/xdg/autostart/hello.desktop", Body: desktop},
+	}, {
+		name:    "excluded",
+		file:    RPMFile{Name: "/usr/share/applications/org.example.Hello.desktop", Body: desktop},
+		exclude: []string{"/usr/share/applications/*"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			provides, _, err := AppStreamProvides(tc.exclude...)(tc.file)
+			if err != nil {
+				t.Fatalf("AppStreamProvides returned error %v", err)
+			}
+			if got := provides.String(); got != tc.want {
+				t.Errorf("AppStreamProvides provides = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownArch is returned by NewRPM and ForArch for an architecture rpm does not know,
+	// unless AllowUnknownArch is set.
+	ErrUnknownArch = errors.New("unknown architecture")
+	// ErrMixedArch is returned by DetectArch for ELF files of several architectures.
+	ErrMixedArch = errors.New("ELF files of several architectures")
+)
+
+// knownArches are the architectures of the rpmrc of rpm 4.19, and noarch.
+var knownArches = map[string]bool{
+	"noarch": true,
+	// x86
+	"i386": true, "i486": true, "i586": true, "i686": true, "athlon": true, "geode": true,
+	"pentium3": true, "pentium4": true,
+	"x86_64": true, "amd64": true, "ia32e": true, "x86_64_v2": true, "x86_64_v3": true, "x86_64_v4": true,
+	// arm
+	"aarch64": true, "armv3l": true, "armv4b": true, "armv4l": true, "armv5tel": true,
+	"armv5tejl": true, "armv6l": true, "armv6hl": true, "armv7l": true, "armv7hl": true,
+	"armv7hnl": true, "armv8l": true, "armv8hl": true, "armv8hnl": true, "armv8hcnl": true,
+	// power
+	"ppc": true, "ppc8260": true, "ppc8560": true, "ppc32dy4": true, "ppciseries": true,
+	"ppcpseries": true, "ppc64": true, "ppc64le": true, "ppc64p7": true, "ppc64iseries": true,
+	"ppc64pseries": true,
+	// others
+	"s390": true, "s390x": true, "ia64": true, "alpha": true, "alphaev5": true, "alphaev56": true,
+	"alphaev6": true, "alphaev67": true, "sparc": true, "sparcv8": true, "sparcv9": true,
+	"sparcv9v": true, "sparc64": true, "sparc64v": true, "mips": true, "mipsel": true,
+	"mipsr6": true, "mipsr6el": true, "mips64": true, "mips64el": true, "mips64r6": true,
+	"mips64r6el": true, "riscv64": true, "loongarch64": true, "m68k": true, "m68kmint": true,
+	"sh3": true, "sh4": true, "sh4a": true, "xtensa": true,
+}
+
+// checkArch checks that rpm knows the architecture.
+func checkArch(arch string) error {
+	if !knownArches[arch] {
+		return fmt.Errorf("%w %q, set AllowUnknownArch to use it anyway", ErrUnknownArch, arch)
+	}
+	return nil
+}
+
+// emLoongArch is elf.EM_LOONGARCH, which the debug/elf of older go versions lacks.
+const emLoongArch = elf.Machine(258)
+
+// elfArch returns the rpm architecture of an ELF file, the one rpmbuild of Fedora and
+// RHEL uses for it, e.g. i686 for 32 bit x86 and armv7hl for 32 bit arm.
+func elfArch(e *elf.File) (string, bool) {
+	is64 := e.Class == elf.ELFCLASS64
+	little := e.Data == elf.ELFDATA2LSB
+	switch e.Machine {
+	case elf.EM_X86_64:
+		return "x86_64", true
+	case elf.EM_386:
+		return "i686", true
+	case elf.EM_AARCH64:
+		return "aarch64", true
+	case elf.EM_ARM:
+		return "armv7hl", true
+	case elf.EM_PPC64:
+		if little {
+			return "ppc64le", true
+		}
+		return "ppc64", true
+	case elf.EM_PPC:
+		return "ppc", true
+	case elf.EM_S390:
+		if is64 {
+			return "s390x", true
+		}
+		return "s390", true
+	case elf.EM_RISCV:
+		if is64 {
+			return "riscv64", true
+		}
+	case emLoongArch:
+		if is64 {
+			return "loongarch64", true
+		}
+	case elf.EM_MIPS:
+		switch {
+		case is64 && little:
+			return "mips64el", true
+		case is64:
+			return "mips64", true
+		case little:
+			return "mipsel", true
+		default:
+			return "mips", true
+		}
+	case elf.EM_SPARCV9:
+		return "sparc64", true
+	case elf.EM_SPARC:
+		return "sparc", true
+	case elf.EM_IA_64:
+		return "ia64", true
+	case elf.EM_ALPHA:
+		return "alpha", true
+	case elf.EM_68K:
+		return "m68k", true
+	}
+	return "", false
+}
+
+// DetectArch returns the architecture of the ELF files among files, e.g. to set Arch
+// for the content of a tar. It returns "noarch" if there are no ELF files, and
+// ErrMixedArch if they are built for different architectures.
+func DetectArch(files []RPMFile) (string, error) {
+	arch, from := "noarch", ""
+	for _, f := range files {
+		if typ := f.Mode & 0170000; typ != 0 && typ != 0100000 {
+			continue // not a regular file
+		}
+		if !bytes.HasPrefix(f.Body, []byte(elf.ELFMAG)) {
+			continue
+		}
+		e, err := elf.NewFile(bytes.NewReader(f.Body))
+		if err != nil {
+			continue
+		}
+		a, ok := elfArch(e)
+		if !ok {
+			return "", fmt.Errorf("%w: %s is built for the ELF machine %v", ErrUnknownArch, f.Name, e.Machine)
+		}
+		if from != "" && a != arch {
+			return "", fmt.Errorf("%w: %s is built for %s, %s for %s", ErrMixedArch, from, arch, f.Name, a)
+		}
+		arch, from = a, f.Name
+	}
+	return arch, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"debug/elf"
+	"errors"
+	"testing"
+)
+
+func TestArchValidation(t *testing.T) {
+	for _, tc := range []struct {
+		arch    string
+		allow   bool
+		wantErr bool
+	}{
+		{arch: ""},
+		{arch: "noarch"},
+		{arch: "x86_64"},
+		{arch: "aarch64"},
+		{arch: "x86-64", wantErr: true},
+		{arch: "arm64", wantErr: true},
+		{arch: "arm64", allow: true},
+	} {
+		r, err := NewRPM(RPMMetaData{Name: "arch", Version: "1.0", Arch: tc.arch, AllowUnknownArch: tc.allow})
+		if tc.wantErr {
+			if !errors.Is(err, ErrUnknownArch) {
+				t.Errorf("NewRPM with arch %q returned %v, want ErrUnknownArch", tc.arch, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewRPM with arch %q returned error %v", tc.arch, err)
+			continue
+		}
+		if _, err := r.ForArch("amd64"); err != nil {
+			t.Errorf("ForArch(amd64) returned error %v", err)
+		}
+		_, err = r.ForArch("x64")
+		if tc.allow && err != nil {
+			t.Errorf("ForArch(x64) with AllowUnknownArch returned error %v", err)
+		}
+		if !tc.allow && !errors.Is(err, ErrUnknownArch) {
+			t.Errorf("ForArch(x64) returned %v, want ErrUnknownArch", err)
+		}
+	}
+}
+
+func TestDetectArch(t *testing.T) {
+	x86 := RPMFile{Name: "/usr/bin/x86", Body: testELF(t, elf.EM_X86_64, elf.ET_EXEC), Mode: 0100755}
+	arm := RPMFile{Name: "/usr/lib/libarm.so", Body: testELF(t, elf.EM_AARCH64, elf.ET_DYN), Mode: 0100644}
+	ppc := RPMFile{Name: "/usr/bin/ppc", Body: testELF(t, elf.EM_PPC64, elf.ET_EXEC), Mode: 0755}
+	script := RPMFile{Name: "/usr/bin/script", Body: []byte("#!/bin/sh\n"), Mode: 0100755}
+	link := RPMFile{Name: "/usr/bin/link", Body: x86.Body, Mode: 0120777}
+	for _, tc := range []struct {
+		name    string
+		files   []RPMFile
+		want    string
+		wantErr error
+	}{
+		{name: "no files", want: "noarch"},
+		{name: "no ELF files", files: []RPMFile{script, link}, want: "noarch"},
+		{name: "x86_64", files: []RPMFile{script, x86, x86}, want: "x86_64"},
+		{name: "aarch64", files: []RPMFile{arm}, want: "aarch64"},
+		{name: "ppc64le", files: []RPMFile{ppc}, want: "ppc64le"},
+		{name: "mixed", files: []RPMFile{x86, arm}, wantErr: ErrMixedArch},
+		{name: "unknown machine", files: []RPMFile{{Name: "/vax", Body: testELF(t, elf.EM_VAX, elf.ET_EXEC)}}, wantErr: ErrUnknownArch},
+	} {
+		got, err := DetectArch(tc.files)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s: DetectArch returned error %v, want %v", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DetectArch returned error %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: DetectArch = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
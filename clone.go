@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import "sync"
+
+// Clone returns a copy of r, which can be changed and written independently of r.
+// This allows building several variants (e.g. a different release, compressor or signer)
+// from one populated rpm.
+//
+// Metadata, relations, files, scriptlets and custom tags are copied. File bodies are
+// shared between the copies, as rpmpack never modifies them.
+// Clone returns ErrPayloadFinalized if r was already written.
+func (r *RPM) Clone() (*RPM, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.payloadFinalized {
+		return nil, ErrPayloadFinalized
+	}
+	c := r.copyMetadata()
+	c.sources = append([]string(nil), r.sources...)
+	c.patches = append([]string(nil), r.patches...)
+	c.di = newDirIndex()
+	if err := c.SetCompressor(r.compressorSetting); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// copyMetadata returns a copy of r with its own metadata, relations, custom tags and
+// files. The payload is shared with r, the header is generated anew. The caller must hold
+// r.mu.
+func (r *RPM) copyMetadata() *RPM {
+	c := *r
+	c.mu = &sync.Mutex{}
+	c.files = make(map[string]RPMFile, len(r.files))
+	for fn, f := range r.files {
+		c.files[fn] = f
+	}
+	c.Prefixes = append([]string(nil), r.Prefixes...)
+	c.Provides = append(Relations(nil), r.Provides...)
+	c.Obsoletes = append(Relations(nil), r.Obsoletes...)
+	c.Suggests = append(Relations(nil), r.Suggests...)
+	c.Recommends = append(Relations(nil), r.Recommends...)
+	c.Supplements = append(Relations(nil), r.Supplements...)
+	c.Enhances = append(Relations(nil), r.Enhances...)
+	c.Requires = append(Relations(nil), r.Requires...)
+	c.Conflicts = append(Relations(nil), r.Conflicts...)
+	if r.unexpandedRelations != nil {
+		// The header of r was generated, the copy expands the macros again.
+		for i, rels := range c.relationSets() {
+			*rels = append(Relations(nil), r.unexpandedRelations[i]...)
+		}
+		c.unexpandedRelations = nil
+	}
+	c.customTags = copyEntries(r.customTags)
+	c.customSigs = copyEntries(r.customSigs)
+	c.scriptlets = r.copyScriptlets()
+	c.macros = copyMacros(r.macros)
+	if r.customScriptletKinds != nil {
+		c.customScriptletKinds = make(map[string]ScriptletTags, len(r.customScriptletKinds))
+		for kind, tags := range r.customScriptletKinds {
+			c.customScriptletKinds[kind] = tags
+		}
+	}
+	if r.scriptletValidators != nil {
+		c.scriptletValidators = make(map[string][]ScriptletValidator, len(r.scriptletValidators))
+		for interpreter, v := range r.scriptletValidators {
+			c.scriptletValidators[interpreter] = append([]ScriptletValidator(nil), v...)
+		}
+	}
+	c.depGenerators = append([]DependencyGenerator(nil), r.depGenerators...)
+	c.headerHooks = append([]HeaderHook(nil), r.headerHooks...)
+	c.warnings = append([]error(nil), r.warnings...)
+	c.headerBytes = nil
+	c.signatureBytes = nil
+	return &c
+}
+
+func copyEntries(m map[int]IndexEntry) map[int]IndexEntry {
+	c := make(map[int]IndexEntry, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyMacros(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
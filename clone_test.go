@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClone(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "clone", Version: "1.0", Release: "1", Compressor: "gzip:1"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/clone.conf", Body: []byte("content")})
+	r.AddPrein("echo prein")
+
+	c, err := r.Clone()
+	if err != nil {
+		t.Fatalf("Clone returned error %v", err)
+	}
+	c.Release = "2"
+	if err := c.SetCompressor("xz"); err != nil {
+		t.Fatalf("SetCompressor returned error %v", err)
+	}
+	c.AddFile(RPMFile{Name: "/etc/clone.d/extra.conf", Body: []byte("extra")})
+
+	var b1, b2 bytes.Buffer
+	if err := r.Write(&b1); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if err := c.Write(&b2); err != nil {
+		t.Fatalf("clone Write returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"clone.conf"}, r.basenames); d != "" {
+		t.Errorf("original basenames differ (want->got):\n%v", d)
+	}
+	if d := cmp.Diff([]string{"clone.conf", "extra.conf"}, c.basenames); d != "" {
+		t.Errorf("clone basenames differ (want->got):\n%v", d)
+	}
+	if r.Release != "1" || r.Compressor != "gzip" || c.Compressor != "xz" {
+		t.Errorf("release/compressor = %s/%s and %s/%s, want 1/gzip and 2/xz", r.Release, r.Compressor, c.Release, c.Compressor)
+	}
+	if got := c.scriptlets[ScriptletPrein].body; got != "echo prein" {
+		t.Errorf("clone prein = %q, want the scriptlet of the original", got)
+	}
+	if _, err := r.Clone(); !errors.Is(err, ErrPayloadFinalized) {
+		t.Errorf("Clone after Write returned %v, want %v", err, ErrPayloadFinalized)
+	}
+	if err := c.Write(io.Discard); err != nil {
+		t.Errorf("second clone Write returned error %v", err)
+	}
+}
+
+func TestCloneConcurrentWrite(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "clone", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/clone.conf", Body: []byte("content")})
+	done := make(chan error)
+	go func() {
+		done <- r.Write(io.Discard)
+	}()
+	c, err := r.Clone()
+	if err := <-done; err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if errors.Is(err, ErrPayloadFinalized) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("Clone returned error %v", err)
+	}
+	c.AddFile(RPMFile{Name: "/etc/clone.d/extra.conf", Body: []byte("extra")})
+	if len(r.Files()) != 1 {
+		t.Errorf("adding a file to the clone changed the original: %v", r.Files())
+	}
+	if err := c.Write(io.Discard); err != nil {
+		t.Errorf("clone Write returned error %v", err)
+	}
+}
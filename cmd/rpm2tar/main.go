@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rpm2tar writes the payload of an rpm as a tar stream, the inverse of tar2rpm.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/google/rpmpack"
+)
+
+const (
+	// "Magic" filename: instead of reading/writing to that file use stdin/stdout (can still be used via './-').
+	DashStdinStdout = "-"
+)
+
+var outputfile = flag.String("file", "", "write tar to `TARFILE` instead of stdout")
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage:
+  %s [OPTION] [RPMFILE]
+        Read rpm from stdin, or RPMFILE if present. Write the rpm payload as a tar to stdout, or the
+        file given by -file TARFILE. If a filename is '%s' use stdin/stdout without printing a notice.
+Options:
+`, os.Args[0], DashStdinStdout)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	noticeStdinStdout := ""
+	var i io.Reader
+	switch flag.NArg() {
+	case 0:
+		// Only print notice if no explicit '-' is given:
+		noticeStdinStdout = "reading rpm from stdin"
+		i = os.Stdin
+	case 1:
+		if flag.Arg(0) == DashStdinStdout {
+			i = os.Stdin
+		} else {
+			f, err := os.Open(flag.Arg(0))
+			if err != nil {
+				log.Fatalf("Failed to open file %s for reading\n", flag.Arg(0))
+			}
+			defer f.Close()
+			i = f
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "expecting 0 or 1 positional arguments")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	w := os.Stdout
+	if *outputfile != DashStdinStdout {
+		if *outputfile != "" {
+			f, err := os.Create(*outputfile)
+			if err != nil {
+				log.Fatalf("Failed to open file %s for writing", *outputfile)
+			}
+			defer f.Close()
+			w = f
+		} else {
+			// Only print notice if no explicit '-' is given, merge with rpm notice:
+			if noticeStdinStdout != "" {
+				noticeStdinStdout += ", "
+			}
+			noticeStdinStdout += "writing tar to stdout"
+		}
+	}
+	if noticeStdinStdout != "" {
+		fmt.Fprintln(os.Stderr, "rpm2tar: "+noticeStdinStdout+".")
+	}
+	if err := rpmpack.ToTar(w, i); err != nil {
+		fmt.Fprintf(os.Stderr, "rpm2tar error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rpmdiff compares two rpms and prints their differences.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/rpmpack"
+)
+
+var variable = flag.Bool("variable", false, "also compare the fields which change on every build: buildtime, buildhost, file mtimes and signatures")
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage:
+  %s [OPTION] RPMFILE1 RPMFILE2
+        Compare the metadata, dependencies, files, modes, owners and digests of two rpms.
+        Print one difference per line, and exit with status 1 if there are differences.
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "expecting 2 positional arguments")
+		flag.Usage()
+		os.Exit(2)
+	}
+	a, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open file %s for reading\n", flag.Arg(0))
+	}
+	defer a.Close()
+	b, err := os.Open(flag.Arg(1))
+	if err != nil {
+		log.Fatalf("Failed to open file %s for reading\n", flag.Arg(1))
+	}
+	defer b.Close()
+
+	diffs, err := rpmpack.Diff(a, b, rpmpack.DiffOptions{Variable: *variable})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmdiff error: %v\n", err)
+		os.Exit(2)
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
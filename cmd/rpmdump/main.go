@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rpmdump prints the lead, signature header and header of an rpm as JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/google/rpmpack"
+)
+
+var queryFormat = flag.String("queryformat", "", "print the header with an rpm -q --queryformat `FORMAT`, e.g. '%{NAME}-%{VERSION}\\n', instead of JSON")
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage:
+  %s [RPMFILE]
+        Read rpm from stdin, or RPMFILE if present, and print its lead, signature header and
+        header tags as JSON, or the header in the format given by -queryformat.
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	var i io.Reader
+	switch flag.NArg() {
+	case 0:
+		i = os.Stdin
+	case 1:
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to open file %s for reading\n", flag.Arg(0))
+		}
+		defer f.Close()
+		i = f
+	default:
+		fmt.Fprintln(os.Stderr, "expecting 0 or 1 positional arguments")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pkg, err := rpmpack.ReadPackage(i)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmdump error: %v\n", err)
+		os.Exit(1)
+	}
+	if *queryFormat != "" {
+		out, err := pkg.QueryFormat(*queryFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpmdump error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(out)
+		return
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(pkg); err != nil {
+		fmt.Fprintf(os.Stderr, "rpmdump error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rpmpack builds an rpm from a manifest, a JSON or YAML document which declares the
+// metadata, the files and the scriptlets of the package, see rpmpack.Manifest, and
+// from local files given as arguments.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/rpmpack"
+	"github.com/google/rpmpack/internal/cliflags"
+)
+
+const (
+	// "Magic" filename: instead of writing to that file use stdout (can still be used via './-').
+	DashStdinStdout = "-"
+)
+
+// symlinks is a flag which collects symlinks given as NAME=TARGET.
+type symlinks []rpmpack.ManifestFile
+
+func (s *symlinks) String() string {
+	var val []string
+	for _, l := range *s {
+		val = append(val, l.Name+"="+l.LinkTo)
+	}
+	return strings.Join(val, ",")
+}
+
+func (s *symlinks) Set(value string) error {
+	name, target, ok := strings.Cut(value, "=")
+	if !ok || !path.IsAbs(name) || target == "" {
+		return fmt.Errorf("%q is not of the form /NAME=TARGET", value)
+	}
+	*s = append(*s, rpmpack.ManifestFile{Name: path.Clean(name), LinkTo: target})
+	return nil
+}
+
+var (
+	links       symlinks
+	configFiles cliflags.Globs
+	ghostFiles  cliflags.Ghosts
+
+	provides,
+	obsoletes,
+	suggests,
+	recommends,
+	requires,
+	conflicts rpmpack.Relations
+	name        = flag.String("name", "", "the package name")
+	version     = flag.String("version", "", "the package version")
+	release     = flag.String("release", "", "the rpm release")
+	epoch       = flag.Uint64("epoch", 0, "the rpm epoch")
+	arch        = flag.String("arch", "", "the rpm architecture (default noarch)")
+	osName      = flag.String("os", "", "the rpm os (default linux)")
+	summary     = flag.String("summary", "", "the rpm summary")
+	description = flag.String("description", "", "the rpm description")
+	license     = flag.String("license", "", "the rpm license name")
+	vendor      = flag.String("vendor", "", "the rpm vendor")
+	packager    = flag.String("packager", "", "the rpm packager")
+	group       = flag.String("group", "", "the rpm group")
+	url         = flag.String("url", "", "the rpm url")
+	buildHost   = flag.String("build_host", "", "the rpm build host")
+	buildTime   = flag.Int64("build_time", 0, "the build_time unix timestamp")
+
+	scriptlets = cliflags.NewScriptlets(flag.CommandLine)
+
+	manifest   = flag.String("manifest", "", "read the package from the JSON or YAML manifest `FILE`; the metadata flags override it")
+	prefix     = flag.String("prefix", "", "install the files of the manifest and the arguments below `DIR`, e.g. /opt/hello")
+	sources    = flag.String("sources", "", "read the sources and scriptlets of the manifest relative to `DIR` instead of the directory of the manifest")
+	compressor = flag.String("compressor", "", "the rpm compressor and an optional level, as `NAME[:LEVEL]` (eg. zstd:19 or gzip:6); one of gzip, lzma, xz or zstd; overrides the manifest, which defaults to gzip")
+	outputfile = flag.String("file", "", "write rpm to `RPMFILE` instead of stdout")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage:
+  %s [-manifest FILE] [OPTION] [FILE...]
+        Build the rpm declared by the flags and the manifest FILE, with the local FILEs and
+        the contents of local directories installed at their relative path below -prefix, or
+        below /. Write rpm to stdout, or the file given by -file RPMFILE. If a filename is '%s'
+        use stdout without printing a notice.
+Options:
+`, os.Args[0], DashStdinStdout)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Var(&provides, "provides", "rpm provides values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&obsoletes, "obsoletes", "rpm obsoletes values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&suggests, "suggests", "rpm suggests values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&recommends, "recommends", "rpm recommends values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&requires, "requires", "rpm requires values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&conflicts, "conflicts", "rpm conflicts values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&links, "symlink", "add a symlink given as `NAME=TARGET`, e.g. /usr/bin/hello=/opt/hello/bin/hello; NAME is not below -prefix; can be repeated")
+	flag.Var(&configFiles, "config", "mark the files matching the path `GLOB` as %config, e.g. /etc/hello/*.conf; GLOB is not below -prefix; can be repeated")
+	flag.Var(&ghostFiles, "ghost", "comma separated `PATHS` of %ghost files, which the rpm owns without content, e.g. /var/log/hello.log; a trailing slash marks a directory; PATHS are not below -prefix; can be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if *epoch > math.MaxUint32 {
+		fmt.Fprintf(os.Stderr, "epoch has to be less than %d\n", math.MaxUint32)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m := &rpmpack.Manifest{}
+	if *manifest != "" {
+		f, err := os.Open(*manifest)
+		if err != nil {
+			log.Fatalf("Failed to open file %s for reading\n", *manifest)
+		}
+		m, err = rpmpack.ReadManifest(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	metadataFromFlags(&m.RPMMetaData)
+	if m.Name == "" || m.Version == "" {
+		fmt.Fprintln(os.Stderr, "name and version are required, in the manifest or as flags")
+		flag.Usage()
+		os.Exit(2)
+	}
+	for i := range m.Files {
+		m.Files[i].Name = path.Join("/", *prefix, m.Files[i].Name)
+	}
+	m.Files = append(m.Files, links...)
+	var local []rpmpack.ManifestFile
+	for _, arg := range flag.Args() {
+		files, err := localFiles(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+			os.Exit(1)
+		}
+		local = append(local, files...)
+	}
+	dir := *sources
+	if dir == "" {
+		dir = filepath.Dir(*manifest)
+	}
+	r, err := m.RPM(os.DirFS(dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, mf := range local {
+		f, err := mf.RPMFile(os.DirFS("."))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+			os.Exit(1)
+		}
+		r.AddFile(f)
+	}
+	for _, warning := range r.Warnings() {
+		fmt.Fprintf(os.Stderr, "rpmpack warning: %v\n", warning)
+	}
+	markConfigFiles(r)
+	ghostFiles.AddTo(r)
+	given := map[string]string{}
+	for kind := range m.Scriptlets {
+		given[kind] = *manifest
+	}
+	if err := scriptlets.AddTo(r, given); err != nil {
+		fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := os.Stdout
+	if *outputfile != DashStdinStdout {
+		if *outputfile != "" {
+			f, err := os.Create(*outputfile)
+			if err != nil {
+				log.Fatalf("Failed to open file %s for writing", *outputfile)
+			}
+			defer f.Close()
+			w = f
+		} else {
+			// Only print notice if no explicit '-' is given.
+			fmt.Fprintln(os.Stderr, "rpmpack: writing rpm to stdout.")
+		}
+	}
+	if err := r.Write(w); err != nil {
+		fmt.Fprintf(os.Stderr, "rpm write error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// metadataFromFlags sets the fields of md, the metadata of the manifest, which were
+// given as flags, and adds the relations of the flags.
+func metadataFromFlags(md *rpmpack.RPMMetaData) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range []struct {
+		field *string
+		flag  string
+		value string
+	}{
+		{&md.Name, "name", *name},
+		{&md.Version, "version", *version},
+		{&md.Release, "release", *release},
+		{&md.Arch, "arch", *arch},
+		{&md.OS, "os", *osName},
+		{&md.Summary, "summary", *summary},
+		{&md.Description, "description", *description},
+		{&md.Vendor, "vendor", *vendor},
+		{&md.Packager, "packager", *packager},
+		{&md.Group, "group", *group},
+		{&md.URL, "url", *url},
+		{&md.BuildHost, "build_host", *buildHost},
+		{&md.Compressor, "compressor", *compressor},
+	} {
+		if set[s.flag] {
+			*s.field = s.value
+		}
+	}
+	if set["license"] {
+		// License is an alias of Licence, the manifest may have set either.
+		md.Licence, md.License = *license, ""
+	}
+	if set["epoch"] {
+		md.Epoch = uint32(*epoch)
+	}
+	if set["build_time"] {
+		md.BuildTime = time.Unix(*buildTime, 0)
+	}
+	md.Provides = append(md.Provides, provides...)
+	md.Obsoletes = append(md.Obsoletes, obsoletes...)
+	md.Suggests = append(md.Suggests, suggests...)
+	md.Recommends = append(md.Recommends, recommends...)
+	md.Requires = append(md.Requires, requires...)
+	md.Conflicts = append(md.Conflicts, conflicts...)
+}
+
+// markConfigFiles marks the files matching -config as config files. Directories are
+// never marked.
+func markConfigFiles(r *rpmpack.RPM) {
+	for _, f := range r.Files() {
+		if f.Mode&040000 == 0 && configFiles.Match(f.Name) && f.Type&rpmpack.ConfigFile == 0 {
+			f.Type |= rpmpack.ConfigFile
+			r.AddFile(f)
+		}
+	}
+}
+
+// localFiles returns the files to add for a relative path: the file, or the directory
+// and everything below it. They are installed at the path below -prefix, with the
+// permissions of the local files.
+func localFiles(name string) ([]rpmpack.ManifestFile, error) {
+	name = filepath.Clean(name)
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("file %q: must be a relative path below the current directory", name)
+	}
+	var files []rpmpack.ManifestFile
+	err := filepath.WalkDir(name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mf := rpmpack.ManifestFile{
+			Name: path.Join("/", *prefix, filepath.ToSlash(p)),
+			Mode: rpmpack.FileMode(info.Mode().Perm()),
+		}
+		switch {
+		case d.IsDir():
+			if p == "." {
+				return nil
+			}
+			mf.Dir = true
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			mf.LinkTo = target
+		case info.Mode().IsRegular():
+			mf.Source = filepath.ToSlash(p)
+		default:
+			return fmt.Errorf("file %q: unsupported file type %v", p, info.Mode().Type())
+		}
+		files = append(files, mf)
+		return nil
+	})
+	return files, err
+}
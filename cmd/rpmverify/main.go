@@ -0,0 +1,103 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rpmverify checks the digests and signatures of rpms, like rpm --checksig.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/rpmpack"
+)
+
+// files is a flag which can be given several times.
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+var keyFiles files
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage:
+  %s [OPTION] RPMFILE...
+        Check the lead, the header and payload digests and the file digests of each rpm and,
+        if keys are given, its OpenPGP signatures. Exit with status 1 if any check fails.
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Var(&keyFiles, "key", "check the signatures with the OpenPGP public key in `KEYFILE`, armored or binary; can be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "expecting at least 1 positional argument")
+		flag.Usage()
+		os.Exit(2)
+	}
+	var keys [][]byte
+	for _, fn := range keyFiles {
+		k, err := os.ReadFile(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpmverify error: %v\n", err)
+			os.Exit(2)
+		}
+		keys = append(keys, k)
+	}
+
+	failed := false
+	for _, fn := range flag.Args() {
+		if err := verify(fn, keys); err != nil {
+			fmt.Printf("%s: %v\n", fn, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// verify checks a single rpm and prints what was checked.
+func verify(fn string, keys [][]byte) error {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	if err := rpmpack.VerifyDigests(bytes.NewReader(b)); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		fmt.Printf("%s: digests OK\n", fn)
+		return nil
+	}
+	fingerprints, err := rpmpack.VerifySignatures(bytes.NewReader(b), keys...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: digests signatures OK (%s)\n", fn, strings.Join(fingerprints, ", "))
+	return nil
+}
@@ -16,16 +16,21 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"math"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/google/rpmpack"
+	"github.com/google/rpmpack/internal/cliflags"
 )
 
 const (
@@ -33,22 +38,65 @@ const (
 	DashStdinStdout = "-"
 )
 
+// relationsFile is a flag which adds the relations of a file, one per line, to rels.
+// Empty lines and lines starting with # are skipped.
+type relationsFile struct {
+	rels  *rpmpack.Relations
+	files []string
+}
+
+func (f *relationsFile) String() string {
+	return strings.Join(f.files, ",")
+}
+
+func (f *relationsFile) Set(fn string) error {
+	file, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scan := bufio.NewScanner(file)
+	for line := 1; scan.Scan(); line++ {
+		t := strings.TrimSpace(scan.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if err := f.rels.Set(t); err != nil {
+			return fmt.Errorf("%s line %d: %w", fn, line, err)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", fn, err)
+	}
+	f.files = append(f.files, fn)
+	return nil
+}
+
 var (
+	ghostFiles cliflags.Ghosts
+	configFiles,
+	noReplaceFiles,
+	docFiles,
+	licenseFiles cliflags.Globs
 	provides,
 	obsoletes,
 	suggests,
 	recommends,
+	supplements,
+	enhances,
 	requires,
 	conflicts rpmpack.Relations
 	name        = flag.String("name", "", "the package name")
 	version     = flag.String("version", "", "the package version")
 	release     = flag.String("release", "", "the rpm release")
 	epoch       = flag.Uint64("epoch", 0, "the rpm epoch")
-	arch        = flag.String("arch", "noarch", "the rpm architecture")
+	arch        = flag.String("arch", "noarch", "the rpm architecture, or auto to detect it from the ELF files")
+	unknownArch = flag.Bool("allow_unknown_arch", false, "allow an architecture which rpm does not know")
 	prefixes    = flag.String("prefixes", "", "comma separated prefixes for relocatable packages")
 	buildTime   = flag.Int64("build_time", 0, "the build_time unix timestamp")
-	compressor  = flag.String("compressor", "gzip", "the rpm compressor")
+	compressor  = flag.String("compressor", "gzip", "the rpm compressor and an optional level, as `NAME[:LEVEL]` (eg. zstd:19 or gzip:6); one of gzip, lzma, xz or zstd")
 	osName      = flag.String("os", "linux", "the rpm os")
+	target      = flag.String("target", "", "use the compressor and settings of the rpms of the `DISTRO`, one of "+strings.Join(rpmpack.Targets(), ", ")+"; other flags override them")
 	summary     = flag.String("summary", "", "the rpm summary")
 	description = flag.String("description", "", "the rpm description")
 	vendor      = flag.String("vendor", "", "the rpm vendor")
@@ -57,15 +105,22 @@ var (
 	url         = flag.String("url", "", "the rpm url")
 	licence     = flag.String("licence", "", "the rpm licence name")
 
-	prein  = flag.String("prein", "", "prein scriptlet contents (not filename)")
-	postin = flag.String("postin", "", "postin scriptlet contents (not filename)")
-	preun  = flag.String("preun", "", "preun scriptlet contents (not filename)")
-	postun = flag.String("postun", "", "postun scriptlet contents (not filename)")
+	summaryFile     = flag.String("summary-file", "", "read the rpm summary from `FILE`")
+	descriptionFile = flag.String("description-file", "", "read the rpm description from `FILE`")
+
+	scriptlets = cliflags.NewScriptlets(flag.CommandLine)
+	scripts    = flag.String("scripts", "", "a `DIR` with scriptlet files named after the scriptlet, e.g. prein.sh, postin.sh or posttrans.lua")
 
 	useDirAllowlist  = flag.Bool("use_dir_allowlist", false, "Only include dirs in the explicit allow list")
 	dirAllowlistFile = flag.String("dir_allowlist_file", "", "A file with one directory per line to include from the tar to the rpm")
 
+	fileMap  = flag.String("filemap", "", "override the attributes of files with the lines of `FILE`, each \"PATH MODE OWNER GROUP [TYPE]\", e.g. \"/etc/hello.conf 0600 root hello config,noreplace\"; PATH can be a glob and - keeps an attribute")
+	metadata = flag.String("metadata", "", "read the metadata, relations, scriptlets and extra files from the JSON or YAML manifest `FILE`; flags given as well override it")
+
+	lint = flag.Bool("lint", false, "check the rpm for common packaging problems, and fail on errors")
+
 	outputfile = flag.String("file", "", "write rpm to `RPMFILE` instead of stdout")
+	outdir     = flag.String("outdir", "", "write rpm to `DIR` as NAME-VERSION-RELEASE.ARCH.rpm instead of stdout")
 )
 
 func usage() {
@@ -84,13 +139,29 @@ func main() {
 	flag.Var(&obsoletes, "obsoletes", "rpm obsoletes values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&suggests, "suggests", "rpm suggests values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&recommends, "recommends", "rpm recommends values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&supplements, "supplements", "rpm supplements values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&enhances, "enhances", "rpm enhances values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&requires, "requires", "rpm requires values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&conflicts, "conflicts", "rpm provides values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&relationsFile{rels: &requires}, "requires-file", "add the requires in `FILE`, one per line; can be repeated")
+	flag.Var(&relationsFile{rels: &provides}, "provides-file", "add the provides in `FILE`, one per line; can be repeated")
+	flag.Var(&configFiles, "config", "mark the files matching the path `GLOB` as %config, e.g. /etc/hello/*.conf; can be repeated")
+	flag.Var(&noReplaceFiles, "config-noreplace", "mark the files matching the path `GLOB` as %config(noreplace); can be repeated")
+	flag.Var(&docFiles, "doc", "mark the files matching the path `GLOB` as %doc, e.g. /usr/share/doc/hello/*; can be repeated")
+	flag.Var(&licenseFiles, "license", "mark the files matching the path `GLOB` as %license; can be repeated")
+	flag.Var(&ghostFiles, "ghost", "comma separated `PATHS` of %ghost files, which the rpm owns without content, e.g. /var/log/hello.log; a trailing slash marks a directory; can be repeated")
 	flag.Usage = usage
 	flag.Parse()
-	if *name == "" || *version == "" {
-		fmt.Fprintln(os.Stderr, "name and version are required")
-		flag.Usage()
+	manifest := &rpmpack.Manifest{}
+	if *metadata != "" {
+		var err error
+		if manifest, err = readManifest(*metadata); err != nil {
+			fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := readTextFlags(flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
 		os.Exit(2)
 	}
 	if *epoch > math.MaxUint32 {
@@ -98,9 +169,19 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
-	var buildTimeStamp time.Time
-	if *buildTime != 0 {
-		buildTimeStamp = time.Unix(*buildTime, 0)
+	md := manifest.RPMMetaData
+	if *target != "" {
+		var err error
+		if md, err = rpmpack.ForTarget(*target, md); err != nil {
+			fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	md = metadataFromFlags(md)
+	if md.Name == "" || md.Version == "" {
+		fmt.Fprintln(os.Stderr, "name and version are required")
+		flag.Usage()
+		os.Exit(2)
 	}
 
 	noticeStdinStdout := ""
@@ -127,8 +208,13 @@ func main() {
 		os.Exit(2)
 	}
 
+	if *outdir != "" && *outputfile != "" {
+		fmt.Fprintln(os.Stderr, "-file and -outdir are mutually exclusive")
+		flag.Usage()
+		os.Exit(2)
+	}
 	w := os.Stdout
-	if *outputfile != DashStdinStdout {
+	if *outputfile != DashStdinStdout && *outdir == "" {
 		if *outputfile != "" {
 			f, err := os.Create(*outputfile)
 			if err != nil {
@@ -137,7 +223,7 @@ func main() {
 			defer f.Close()
 			w = f
 		} else {
-		        // Only print notice if no explicit '-' is given, merge with tar notice:
+			// Only print notice if no explicit '-' is given, merge with tar notice:
 			if noticeStdinStdout != "" {
 				noticeStdinStdout += ", "
 			}
@@ -148,36 +234,32 @@ func main() {
 	if noticeStdinStdout != "" {
 		fmt.Fprintln(os.Stderr, "tar2rpm: "+noticeStdinStdout+".")
 	}
-	r, err := rpmpack.FromTar(
-		i,
-		rpmpack.RPMMetaData{
-			Name:        *name,
-			Version:     *version,
-			Release:     *release,
-			Epoch:       uint32(*epoch),
-			BuildTime:   buildTimeStamp,
-			Prefixes:    strings.Split(*prefixes, ","),
-			Arch:        *arch,
-			OS:          *osName,
-			Vendor:      *vendor,
-			Packager:    *packager,
-			Group:       *group,
-			URL:         *url,
-			Licence:     *licence,
-			Description: *description,
-			Summary:     *summary,
-			Compressor:  *compressor,
-			Provides:    provides,
-			Obsoletes:   obsoletes,
-			Suggests:    suggests,
-			Recommends:  recommends,
-			Requires:    requires,
-			Conflicts:   conflicts,
-		})
+	// With -arch auto the rpm is built as noarch, and the architecture is set once all
+	// files were added.
+	autoArch := md.Arch == "auto"
+	if autoArch {
+		md.Arch = "noarch"
+	}
+	r, err := rpmpack.FromTar(i, md)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
 		os.Exit(1)
 	}
+	for _, warning := range r.Warnings() {
+		fmt.Fprintf(os.Stderr, "tar2rpm warning: %v\n", warning)
+	}
+	if err := manifest.AddTo(r, os.DirFS(filepath.Dir(*metadata))); err != nil {
+		fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+		os.Exit(1)
+	}
+	if *fileMap != "" {
+		if err := applyFileMap(r, *fileMap); err != nil {
+			fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	markFileTypes(r)
+	ghostFiles.AddTo(r)
 	if *useDirAllowlist {
 		al := map[string]bool{}
 		if *dirAllowlistFile != "" {
@@ -195,14 +277,322 @@ func main() {
 		r.AllowListDirs(al)
 	}
 
-	r.AddPrein(*prein)
-	r.AddPostin(*postin)
-	r.AddPreun(*preun)
-	r.AddPostun(*postun)
+	// given records where each scriptlet came from, a scriptlet must only be given once.
+	given := map[string]string{}
+	for kind := range manifest.Scriptlets {
+		given[kind] = *metadata
+	}
+	if err := scriptlets.AddTo(r, given); err != nil {
+		fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+		os.Exit(1)
+	}
+	if *scripts != "" {
+		if err := loadScripts(r, *scripts, given); err != nil {
+			fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if autoArch {
+		a, err := rpmpack.DetectArch(r.Files())
+		if err == nil && a != "noarch" {
+			r, err = r.ForArch(a)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
+	if *lint {
+		findings, err := rpmpack.Lint(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
+			os.Exit(1)
+		}
+		failed := false
+		for _, f := range findings {
+			fmt.Fprintln(os.Stderr, f)
+			failed = failed || f.Error
+		}
+		if failed {
+			os.Exit(1)
+		}
+	}
+
+	if *outdir != "" {
+		fn := filepath.Join(*outdir, fmt.Sprintf("%s-%s.%s.rpm", r.Name, r.FullVersion(), r.Arch))
+		f, err := os.Create(fn)
+		if err != nil {
+			log.Fatalf("Failed to open file %s for writing", fn)
+		}
+		defer f.Close()
+		w = f
+	}
 	if err := r.Write(w); err != nil {
 		fmt.Fprintf(os.Stderr, "rpm write error: %v\n", err)
 		os.Exit(1)
 	}
 
 }
+
+// markFileTypes sets the file types of the files matching -config, -config-noreplace,
+// -doc and -license. Directories are never marked.
+func markFileTypes(r *rpmpack.RPM) {
+	marks := []struct {
+		patterns cliflags.Globs
+		t        rpmpack.FileType
+	}{
+		{configFiles, rpmpack.ConfigFile},
+		{noReplaceFiles, rpmpack.ConfigFile | rpmpack.NoReplaceFile},
+		{docFiles, rpmpack.DocFile},
+		{licenseFiles, rpmpack.LicenceFile},
+	}
+	for _, f := range r.Files() {
+		if f.Mode&040000 != 0 {
+			continue
+		}
+		t := f.Type
+		for _, m := range marks {
+			if m.patterns.Match(f.Name) {
+				t |= m.t
+			}
+		}
+		if t != f.Type {
+			f.Type = t
+			r.AddFile(f)
+		}
+	}
+}
+
+// fileAttrs are the attributes of a line of the -filemap file. Empty fields are kept.
+type fileAttrs struct {
+	pattern      string
+	mode         string
+	owner, group string
+	fileType     string
+}
+
+// readFileMap reads the -filemap file. Empty lines and lines starting with # are skipped.
+func readFileMap(fn string) ([]fileAttrs, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var attrs []fileAttrs
+	scan := bufio.NewScanner(f)
+	for line := 1; scan.Scan(); line++ {
+		fields := strings.Fields(scan.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 4 || len(fields) > 5 {
+			return nil, fmt.Errorf("%s line %d: want PATH MODE OWNER GROUP [TYPE], got %q", fn, line, scan.Text())
+		}
+		for i, field := range fields {
+			if field == "-" {
+				fields[i] = ""
+			}
+		}
+		a := fileAttrs{pattern: path.Join("/", fields[0]), mode: fields[1], owner: fields[2], group: fields[3]}
+		if len(fields) == 5 {
+			a.fileType = fields[4]
+		}
+		if _, err := path.Match(a.pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid pattern %q: %w", fn, line, fields[0], err)
+		}
+		if a.mode != "" {
+			if _, err := rpmpack.ParseFileMode(a.mode); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", fn, line, err)
+			}
+		}
+		if _, err := rpmpack.ParseFileType(a.fileType); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", fn, line, err)
+		}
+		attrs = append(attrs, a)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fn, err)
+	}
+	return attrs, nil
+}
+
+// applyFileMap overrides the attributes of the files with those of the -filemap file.
+// Later lines override earlier ones, and every line must match a file.
+func applyFileMap(r *rpmpack.RPM, fn string) error {
+	attrs, err := readFileMap(fn)
+	if err != nil {
+		return err
+	}
+	files := r.Files()
+	changed := make([]bool, len(files))
+	for _, a := range attrs {
+		matched := false
+		for i := range files {
+			f := &files[i]
+			if ok, _ := path.Match(a.pattern, f.Name); !ok {
+				continue
+			}
+			matched, changed[i] = true, true
+			if a.mode != "" {
+				mode, _ := rpmpack.ParseFileMode(a.mode)
+				f.Mode = f.Mode&^07777 | uint(mode)&07777
+			}
+			if a.owner != "" {
+				f.Owner = a.owner
+			}
+			if a.group != "" {
+				f.Group = a.group
+			}
+			if a.fileType != "" {
+				f.Type, _ = rpmpack.ParseFileType(a.fileType)
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: %s matches no file", fn, a.pattern)
+		}
+	}
+	for i, f := range files {
+		if changed[i] {
+			r.AddFile(f)
+		}
+	}
+	return nil
+}
+
+// readManifest reads the manifest given by -metadata.
+func readManifest(fn string) (*rpmpack.Manifest, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return rpmpack.ReadManifest(f)
+}
+
+// readTextFlags sets -summary and -description of fs to the contents of -summary-file and
+// -description-file. The trailing newlines of the files are removed, and the summary
+// must be a single line.
+func readTextFlags(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range []string{"summary", "description"} {
+		file := fs.Lookup(name + "-file").Value.String()
+		if file == "" {
+			continue
+		}
+		if set[name] {
+			return fmt.Errorf("-%s and -%s-file are mutually exclusive", name, name)
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		text := strings.TrimRight(string(b), "\r\n")
+		if name == "summary" && strings.ContainsAny(text, "\r\n") {
+			return fmt.Errorf("summary in %s must be a single line", file)
+		}
+		if err := fs.Set(name, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metadataFromFlags returns md, the metadata of the manifest, with the values of the
+// flags. Flags given on the command line override the manifest, the defaults of the
+// other flags only fill in empty fields. Relations are added to those of the manifest.
+func metadataFromFlags(md rpmpack.RPMMetaData) rpmpack.RPMMetaData {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range []struct {
+		field *string
+		flag  string
+		value string
+	}{
+		{&md.Name, "name", *name},
+		{&md.Version, "version", *version},
+		{&md.Release, "release", *release},
+		{&md.Arch, "arch", *arch},
+		{&md.OS, "os", *osName},
+		{&md.Vendor, "vendor", *vendor},
+		{&md.Packager, "packager", *packager},
+		{&md.Group, "group", *group},
+		{&md.URL, "url", *url},
+		{&md.Licence, "licence", *licence},
+		{&md.Description, "description", *description},
+		{&md.Summary, "summary", *summary},
+		{&md.Compressor, "compressor", *compressor},
+	} {
+		if set[s.flag] || *s.field == "" {
+			*s.field = s.value
+		}
+	}
+	if set["epoch"] {
+		md.Epoch = uint32(*epoch)
+	}
+	if *buildTime != 0 {
+		md.BuildTime = time.Unix(*buildTime, 0)
+	}
+	if set["prefixes"] || len(md.Prefixes) == 0 {
+		md.Prefixes = strings.Split(*prefixes, ",")
+	}
+	md.AllowUnknownArch = md.AllowUnknownArch || *unknownArch
+	md.Provides = append(md.Provides, provides...)
+	md.Obsoletes = append(md.Obsoletes, obsoletes...)
+	md.Suggests = append(md.Suggests, suggests...)
+	md.Recommends = append(md.Recommends, recommends...)
+	md.Supplements = append(md.Supplements, supplements...)
+	md.Enhances = append(md.Enhances, enhances...)
+	md.Requires = append(md.Requires, requires...)
+	md.Conflicts = append(md.Conflicts, conflicts...)
+	return md
+}
+
+// scriptExtensions maps the extension of a scriptlet file to its interpreter.
+var scriptExtensions = map[string]string{
+	".sh":  "",
+	".lua": "<lua>",
+}
+
+// loadScripts adds the scriptlets found in dir, named <kind><extension>, e.g. prein.sh.
+// given holds where the scriptlets given otherwise came from, they must not be given twice.
+func loadScripts(r *rpmpack.RPM, dir string, given map[string]string) error {
+	kinds := []string{
+		rpmpack.ScriptletPretrans,
+		rpmpack.ScriptletPrein,
+		rpmpack.ScriptletPostin,
+		rpmpack.ScriptletPreun,
+		rpmpack.ScriptletPostun,
+		rpmpack.ScriptletPosttrans,
+		rpmpack.ScriptletVerify,
+	}
+	for _, kind := range kinds {
+		found := ""
+		for ext, interpreter := range scriptExtensions {
+			fn := filepath.Join(dir, kind+ext)
+			if _, err := os.Stat(fn); errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if found != "" {
+				return fmt.Errorf("both %s and %s found in %s", found, kind+ext, dir)
+			}
+			if given[kind] != "" {
+				return fmt.Errorf("%s scriptlet given both as %s and as %s", kind, given[kind], fn)
+			}
+			found = kind + ext
+			if err := r.AddScriptletFile(kind, fn); err != nil {
+				return err
+			}
+			if interpreter != "" {
+				if err := r.SetScriptletInterpreter(kind, interpreter); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/rpmpack"
+)
+
+// writeTemp writes content to a new file in a temporary directory, and returns its name.
+func writeTemp(t *testing.T, content string) string {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	return fn
+}
+
+func TestApplyFileMap(t *testing.T) {
+	files := []rpmpack.RPMFile{
+		{Name: "/etc/hello.conf", Mode: 0100644, Owner: "root", Group: "root"},
+		{Name: "/usr/bin/hello", Mode: 0100755, Owner: "root", Group: "root"},
+		{Name: "/var/lib/hello", Mode: 040755, Owner: "root", Group: "root"},
+	}
+	for _, tc := range []struct {
+		name    string
+		fileMap string
+		want    []rpmpack.RPMFile
+		wantErr bool
+	}{{
+		name:    "four fields",
+		fileMap: "# comment\n\n/etc/hello.conf 0600 hello hello\n",
+		want: []rpmpack.RPMFile{
+			{Name: "/etc/hello.conf", Mode: 0100600, Owner: "hello", Group: "hello"},
+			files[1],
+			files[2],
+		},
+	}, {
+		name:    "five fields",
+		fileMap: "etc/*.conf 640 root hello config,noreplace\n",
+		want: []rpmpack.RPMFile{
+			{Name: "/etc/hello.conf", Mode: 0100640, Owner: "root", Group: "hello", Type: rpmpack.ConfigFile | rpmpack.NoReplaceFile},
+			files[1],
+			files[2],
+		},
+	}, {
+		name:    "dash keeps attributes",
+		fileMap: "/var/lib/hello - hello - -\n/usr/bin/hello 4755 - - -\n",
+		want: []rpmpack.RPMFile{
+			files[0],
+			{Name: "/usr/bin/hello", Mode: 0104755, Owner: "root", Group: "root"},
+			{Name: "/var/lib/hello", Mode: 040755, Owner: "hello", Group: "root"},
+		},
+	}, {
+		name:    "later lines override",
+		fileMap: "/*/* 0600 - - -\n/usr/bin/hello 0755 - - -\n",
+		want: []rpmpack.RPMFile{
+			{Name: "/etc/hello.conf", Mode: 0100600, Owner: "root", Group: "root"},
+			files[1],
+			files[2],
+		},
+	}, {
+		name:    "too few fields",
+		fileMap: "/etc/hello.conf 0600 root\n",
+		wantErr: true,
+	}, {
+		name:    "too many fields",
+		fileMap: "/etc/hello.conf 0600 root root config extra\n",
+		wantErr: true,
+	}, {
+		name:    "bad mode",
+		fileMap: "/etc/hello.conf 0998 root root\n",
+		wantErr: true,
+	}, {
+		name:    "bad type",
+		fileMap: "/etc/hello.conf 0600 root root nonsense\n",
+		wantErr: true,
+	}, {
+		name:    "bad pattern",
+		fileMap: "/etc/[ 0600 root root\n",
+		wantErr: true,
+	}, {
+		name:    "no matching file",
+		fileMap: "/etc/other.conf 0600 root root\n",
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{Name: "hello", Version: "1.0"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error: %v", err)
+			}
+			for _, f := range files {
+				r.AddFile(f)
+			}
+			err = applyFileMap(r, writeTemp(t, tc.fileMap))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("applyFileMap returned no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyFileMap returned error: %v", err)
+			}
+			if d := cmp.Diff(tc.want, r.Files()); d != "" {
+				t.Errorf("applyFileMap unexpected files (want->got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestRelationsFile(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{{
+		name:    "relations",
+		content: "# comment\nfoo\n\n  bar >= 1.2  \n(baz or qux)\nfoo\n",
+		want:    "foo,bar>=1.2,(baz or qux)",
+	}, {
+		name:    "empty",
+		content: "\n# nothing\n",
+	}, {
+		name:    "invalid relation",
+		content: "foo\nbar >= a:1.2\n",
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var rels rpmpack.Relations
+			f := relationsFile{rels: &rels}
+			fn := writeTemp(t, tc.content)
+			err := f.Set(fn)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Set returned no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set returned error: %v", err)
+			}
+			if d := cmp.Diff(tc.want, rels.String()); d != "" {
+				t.Errorf("Set unexpected relations (want->got):\n%s", d)
+			}
+			if d := cmp.Diff(fn, f.String()); d != "" {
+				t.Errorf("String unexpected value (want->got):\n%s", d)
+			}
+		})
+	}
+	t.Run("missing file", func(t *testing.T) {
+		f := relationsFile{rels: &rpmpack.Relations{}}
+		if err := f.Set(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Error("Set returned no error, want an error")
+		}
+	})
+}
+
+func TestReadTextFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		args            []string
+		summaryFile     string
+		descriptionFile string
+		wantSummary     string
+		wantDescription string
+		wantErr         bool
+	}{{
+		name:            "files",
+		summaryFile:     "hello world\n",
+		descriptionFile: "hello\n\nworld\r\n\n",
+		wantSummary:     "hello world",
+		wantDescription: "hello\n\nworld",
+	}, {
+		name:            "flags only",
+		args:            []string{"-summary", "flag summary", "-description", "flag description"},
+		wantSummary:     "flag summary",
+		wantDescription: "flag description",
+	}, {
+		name:            "summary flag and description file",
+		args:            []string{"-summary", "flag summary"},
+		descriptionFile: "file description\n",
+		wantSummary:     "flag summary",
+		wantDescription: "file description",
+	}, {
+		name:        "multi-line summary",
+		summaryFile: "hello\nworld\n",
+		wantErr:     true,
+	}, {
+		name:        "summary flag and file",
+		args:        []string{"-summary", "flag summary"},
+		summaryFile: "file summary\n",
+		wantErr:     true,
+	}, {
+		name:            "description flag and file",
+		args:            []string{"-description", "flag description"},
+		descriptionFile: "file description\n",
+		wantErr:         true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("tar2rpm", flag.ContinueOnError)
+			summary := fs.String("summary", "", "")
+			description := fs.String("description", "", "")
+			fs.String("summary-file", "", "")
+			fs.String("description-file", "", "")
+			args := tc.args
+			if tc.summaryFile != "" {
+				args = append(args, "-summary-file", writeTemp(t, tc.summaryFile))
+			}
+			if tc.descriptionFile != "" {
+				args = append(args, "-description-file", writeTemp(t, tc.descriptionFile))
+			}
+			if err := fs.Parse(args); err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			err := readTextFlags(fs)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("readTextFlags returned no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readTextFlags returned error: %v", err)
+			}
+			if d := cmp.Diff(tc.wantSummary, *summary); d != "" {
+				t.Errorf("readTextFlags unexpected summary (want->got):\n%s", d)
+			}
+			if d := cmp.Diff(tc.wantDescription, *description); d != "" {
+				t.Errorf("readTextFlags unexpected description (want->got):\n%s", d)
+			}
+		})
+	}
+	t.Run("missing file", func(t *testing.T) {
+		fs := flag.NewFlagSet("tar2rpm", flag.ContinueOnError)
+		fs.String("summary", "", "")
+		fs.String("description", "", "")
+		fs.String("summary-file", filepath.Join(t.TempDir(), "missing"), "")
+		fs.String("description-file", "", "")
+		if err := readTextFlags(fs); err == nil {
+			t.Error("readTextFlags returned no error, want an error")
+		}
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v0.1"
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+)
+
+// CosignSigner makes sigstore signatures and attestations of rpm files, in the formats
+// written by cosign sign-blob and cosign attest-blob, for supply chain policies which
+// require sigstore in addition to the rpm signatures.
+//
+// For keyless signing, Signer is the ephemeral key and Certificate is its short-lived
+// Fulcio certificate, which the caller obtains; uploading to a transparency log (Rekor)
+// is left to cosign or the caller.
+type CosignSigner struct {
+	// Signer holds the private key, ECDSA, RSA or ed25519.
+	Signer crypto.Signer
+	// Certificate is the PEM certificate of the key. It may be nil when signing with a
+	// key pair, in which case the signatures are verified with the public key.
+	Certificate []byte
+}
+
+// SignBlob returns the base64 signature of the rpm, like cosign sign-blob. It is
+// verified with cosign verify-blob --signature.
+func (c CosignSigner) SignBlob(rpm []byte) ([]byte, error) {
+	sig, err := c.sign(rpm)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// Attest returns a DSSE envelope of an in-toto statement with the given predicate about
+// the rpm, like cosign attest-blob. name is the subject name of the rpm, usually its
+// file name. It is verified with cosign verify-blob-attestation.
+func (c CosignSigner) Attest(name string, rpm []byte, predicateType string, predicate json.RawMessage) ([]byte, error) {
+	if predicate == nil {
+		predicate = json.RawMessage("{}")
+	}
+	statement, err := json.Marshal(struct {
+		Type          string          `json:"_type"`
+		PredicateType string          `json:"predicateType"`
+		Subject       []inTotoSubject `json:"subject"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}{
+		Type:          inTotoStatementType,
+		PredicateType: predicateType,
+		Subject: []inTotoSubject{{
+			Name:   name,
+			Digest: map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256(rpm))},
+		}},
+		Predicate: predicate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal in-toto statement: %w", err)
+	}
+	sig, err := c.sign(dssePAE(inTotoPayloadType, statement))
+	if err != nil {
+		return nil, err
+	}
+	type signature struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	}
+	return json.Marshal(struct {
+		PayloadType string      `json:"payloadType"`
+		Payload     string      `json:"payload"`
+		Signatures  []signature `json:"signatures"`
+	}{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statement),
+		Signatures:  []signature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+}
+
+// WriteSidecars signs the rpm file at rpmPath, and writes the signature to rpmPath.sig
+// and the certificate, if any, to rpmPath.pem. If predicateType is not empty, an
+// attestation with the predicate is written to rpmPath.intoto.jsonl.
+func (c CosignSigner) WriteSidecars(rpmPath, predicateType string, predicate json.RawMessage) error {
+	rpm, err := os.ReadFile(rpmPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rpm: %w", err)
+	}
+	sig, err := c.SignBlob(rpm)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(rpmPath+".sig", sig, 0o644); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	if c.Certificate != nil {
+		if err := os.WriteFile(rpmPath+".pem", c.Certificate, 0o644); err != nil {
+			return fmt.Errorf("failed to write certificate: %w", err)
+		}
+	}
+	if predicateType == "" {
+		return nil
+	}
+	att, err := c.Attest(filepath.Base(rpmPath), rpm, predicateType, predicate)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(rpmPath+".intoto.jsonl", append(att, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write attestation: %w", err)
+	}
+	return nil
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// sign signs the sha256 digest of message, or message itself for ed25519 keys, like the
+// sigstore signers do.
+func (c CosignSigner) sign(message []byte) ([]byte, error) {
+	if c.Signer == nil {
+		return nil, fmt.Errorf("no signer")
+	}
+	var (
+		sig []byte
+		err error
+	)
+	if _, ok := c.Signer.Public().(ed25519.PublicKey); ok {
+		sig, err = c.Signer.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		sig, err = c.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return sig, nil
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of a payload, which is what is signed.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCosignSignBlob(t *testing.T) {
+	rpm := []byte("the rpm")
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned error %v", err)
+	}
+	sig, err := CosignSigner{Signer: ecdsaKey}.SignBlob(rpm)
+	if err != nil {
+		t.Fatalf("SignBlob returned error %v", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(string(sig))
+	if err != nil {
+		t.Fatalf("signature is not base64: %v", err)
+	}
+	digest := sha256.Sum256(rpm)
+	if !ecdsa.VerifyASN1(&ecdsaKey.PublicKey, digest[:], der) {
+		t.Errorf("ecdsa signature does not verify")
+	}
+
+	pub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned error %v", err)
+	}
+	sig, err = CosignSigner{Signer: edKey}.SignBlob(rpm)
+	if err != nil {
+		t.Fatalf("SignBlob returned error %v", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(sig))
+	if err != nil {
+		t.Fatalf("signature is not base64: %v", err)
+	}
+	if !ed25519.Verify(pub, rpm, raw) {
+		t.Errorf("ed25519 signature does not verify")
+	}
+
+	if _, err := (CosignSigner{}).SignBlob(rpm); err == nil {
+		t.Errorf("SignBlob without a signer should have returned an error")
+	}
+}
+
+func TestCosignAttest(t *testing.T) {
+	rpm := []byte("the rpm")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned error %v", err)
+	}
+	env, err := CosignSigner{Signer: key}.Attest("hello.rpm", rpm, "https://slsa.dev/provenance/v0.2", json.RawMessage(`{"builder":{"id":"ci"}}`))
+	if err != nil {
+		t.Fatalf("Attest returned error %v", err)
+	}
+	var envelope struct {
+		PayloadType string
+		Payload     string
+		Signatures  []struct{ Sig string }
+	}
+	if err := json.Unmarshal(env, &envelope); err != nil {
+		t.Fatalf("envelope is not JSON: %v", err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatalf("payload is not base64: %v", err)
+	}
+	if len(envelope.Signatures) != 1 {
+		t.Fatalf("envelope has %d signatures, want 1", len(envelope.Signatures))
+	}
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	if err != nil {
+		t.Fatalf("signature is not base64: %v", err)
+	}
+	digest := sha256.Sum256(dssePAE(envelope.PayloadType, payload))
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Errorf("attestation signature does not verify")
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("statement is not JSON: %v", err)
+	}
+	want := map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://slsa.dev/provenance/v0.2",
+		"subject": []interface{}{map[string]interface{}{
+			"name":   "hello.rpm",
+			"digest": map[string]interface{}{"sha256": fmt.Sprintf("%x", sha256.Sum256(rpm))},
+		}},
+		"predicate": map[string]interface{}{"builder": map[string]interface{}{"id": "ci"}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("unexpected statement (want->got):\n%s", d)
+	}
+}
+
+func TestCosignWriteSidecars(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned error %v", err)
+	}
+	rpmPath := filepath.Join(t.TempDir(), "hello.rpm")
+	if err := os.WriteFile(rpmPath, []byte("the rpm"), 0o644); err != nil {
+		t.Fatalf("WriteFile returned error %v", err)
+	}
+	c := CosignSigner{Signer: key, Certificate: []byte("-----BEGIN CERTIFICATE-----\n")}
+	if err := c.WriteSidecars(rpmPath, "https://slsa.dev/provenance/v0.2", nil); err != nil {
+		t.Fatalf("WriteSidecars returned error %v", err)
+	}
+	for _, ext := range []string{".sig", ".pem", ".intoto.jsonl"} {
+		if _, err := os.Stat(rpmPath + ext); err != nil {
+			t.Errorf("sidecar %s was not written: %v", ext, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	newcMagic = []byte("070701")
+	crcMagic  = []byte("070702")
+)
+
+// cpioHeaderSize is the size of a newc or crc cpio header, without the file name.
+const cpioHeaderSize = 110
+
+// crcWriter writes the newc cpio headers written by cpio.Writer in the crc format, with
+// the crc magic and the checksum of the file. The checksum is not set in cpio.Header: for
+// a non-zero checksum, cpio.Writer writes the crc magic, but also keeps it for all later
+// headers, of all archives. cpio.Writer writes each header with a single Write, which
+// TestCPIOHeaderWrite checks.
+type crcWriter struct {
+	w io.Writer
+	// header is set when the next write, other than padding, is a cpio header.
+	header   bool
+	checksum uint32
+}
+
+// nextHeader marks the next write as the header of a file with the given checksum. It is
+// a no-op for a nil crcWriter.
+func (c *crcWriter) nextHeader(checksum uint32) {
+	if c != nil {
+		c.header = true
+		c.checksum = checksum
+	}
+}
+
+func (c *crcWriter) Write(p []byte) (int, error) {
+	// Padding is at most 3 bytes.
+	if !c.header || len(p) < 4 {
+		return c.w.Write(p)
+	}
+	c.header = false
+	if len(p) < cpioHeaderSize || !bytes.HasPrefix(p, newcMagic) {
+		return 0, fmt.Errorf("expected a cpio header, got %d bytes %q", len(p), p[:len(newcMagic)])
+	}
+	q := append([]byte(nil), p...)
+	copy(q, crcMagic)
+	copy(q[cpioHeaderSize-8:], fmt.Sprintf("%08X", c.checksum))
+	return c.w.Write(q)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archiveSizeEntry returns the signature tag with the size of the uncompressed payload:
+// PAYLOADSIZE, or LONGARCHIVESIZE for payloads of 4 GiB and more, like rpmbuild.
+func archiveSizeEntry(size int64) (int, IndexEntry) {
+	if size >= math.MaxUint32 {
+		return sigLongArchive, EntryInt64([]int64{size})
+	}
+	return sigPayloadSize, EntryUint32([]uint32{uint32(size)})
+}
+
+// cpioChecksum returns the checksum of the crc cpio format, the sum of all bytes.
+func cpioChecksum(b []byte) uint32 {
+	var sum uint32
+	for _, c := range b {
+		sum += uint32(c)
+	}
+	return sum
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/cavaliergopher/cpio"
+)
+
+func TestCPIOFormat(t *testing.T) {
+	// crc is first, to check that it does not change the magic of the later archives.
+	for _, format := range []string{"crc", "", "newc"} {
+		t.Run(format, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "cpio", Version: "1.0", CPIOFormat: format})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/cpio", Mode: 040755})
+			r.AddFile(RPMFile{Name: "/usr/share/cpio/empty"})
+			r.AddFile(RPMFile{Name: "/usr/share/cpio/file", Body: []byte("content of the file")})
+			r.AddFile(RPMFile{Name: "/usr/share/cpio/link", Body: []byte("file"), Mode: 0120777})
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+				t.Errorf("VerifyDigests returned error %v", err)
+			}
+			pkg, err := ReadPackage(&b)
+			if err != nil {
+				t.Fatalf("ReadPackage returned error %v", err)
+			}
+			if got, _ := pkg.Header.String(tagPayloadFormat); got != "cpio" {
+				t.Errorf("PAYLOADFORMAT is %q, want cpio", got)
+			}
+			z, err := pkg.PayloadReader()
+			if err != nil {
+				t.Fatalf("PayloadReader returned error %v", err)
+			}
+			defer z.Close()
+			payload, err := io.ReadAll(z)
+			if err != nil {
+				t.Fatalf("reading the payload returned error %v", err)
+			}
+			magic, otherMagic := newcMagic, crcMagic
+			if format == "crc" {
+				magic, otherMagic = crcMagic, newcMagic
+			}
+			// The four files and the trailer.
+			if got := bytes.Count(payload, magic); got != 5 || bytes.Contains(payload, otherMagic) {
+				t.Errorf("payload has %d headers with magic %s, want 5 and no %s", got, magic, otherMagic)
+			}
+
+			c := cpio.NewReader(bytes.NewReader(payload))
+			for {
+				hdr, err := c.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("reading the payload returned error %v", err)
+				}
+				body, err := io.ReadAll(c)
+				if err != nil {
+					t.Fatalf("reading the payload returned error %v", err)
+				}
+				var want uint32
+				if format == "crc" && hdr.Mode.IsRegular() {
+					want = cpioChecksum(body)
+				}
+				if hdr.Checksum != want {
+					t.Errorf("%s has checksum %d, want %d", hdr.Name, hdr.Checksum, want)
+				}
+			}
+		})
+	}
+
+	if _, err := NewRPM(RPMMetaData{Name: "cpio", Version: "1.0", CPIOFormat: "odc"}); err == nil {
+		t.Errorf("NewRPM with an unknown cpio format should have returned an error")
+	}
+}
+
+// writesRecorder records the writes of cpio.Writer.
+type writesRecorder struct {
+	writes [][]byte
+}
+
+func (w *writesRecorder) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// TestCPIOHeaderWrite checks that cpio.Writer writes each header with a single Write,
+// which crcWriter relies on.
+func TestCPIOHeaderWrite(t *testing.T) {
+	w := &writesRecorder{}
+	c := cpio.NewWriter(w)
+	for _, name := range []string{"./a", "./usr/share/doc/cpio"} {
+		w.writes = nil
+		if err := c.WriteHeader(&cpio.Header{Name: name, Mode: 0644, Size: 3}); err != nil {
+			t.Fatalf("WriteHeader returned error %v", err)
+		}
+		// The padding of the previous file comes first.
+		writes := w.writes
+		for len(writes) > 0 && len(writes[0]) < 4 {
+			writes = writes[1:]
+		}
+		if len(writes) == 0 || len(writes[0]) != cpioHeaderSize || !bytes.HasPrefix(writes[0], newcMagic) {
+			t.Fatalf("WriteHeader wrote %q, want a %d bytes header after the padding", w.writes, cpioHeaderSize)
+		}
+		if _, err := c.Write([]byte("abc")); err != nil {
+			t.Fatalf("Write returned error %v", err)
+		}
+	}
+
+	// A header which is not written at once is an error, not a newc header in a crc archive.
+	crc := &crcWriter{w: io.Discard}
+	crc.nextHeader(1)
+	if _, err := crc.Write([]byte("0707010000")); err == nil {
+		t.Errorf("crcWriter.Write of a partial header should have returned an error")
+	}
+}
+
+func TestArchiveSize(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "archive", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/archive", Body: []byte("content of the file")})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	z, err := pkg.PayloadReader()
+	if err != nil {
+		t.Fatalf("PayloadReader returned error %v", err)
+	}
+	defer z.Close()
+	payload, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatalf("reading the payload returned error %v", err)
+	}
+	if got, err := pkg.Signature.Uint32s(sigPayloadSize); err != nil || len(got) != 1 || int(got[0]) != len(payload) {
+		t.Errorf("PAYLOADSIZE is %v, %v, want %d", got, err, len(payload))
+	}
+
+	for _, tc := range []struct {
+		size    int64
+		wantTag int
+	}{
+		{size: math.MaxUint32 - 1, wantTag: sigPayloadSize},
+		{size: math.MaxUint32, wantTag: sigLongArchive},
+		{size: 5 << 30, wantTag: sigLongArchive},
+	} {
+		tag, e := archiveSizeEntry(tc.size)
+		h := &Header{entries: map[int]IndexEntry{tag: e}}
+		var got int64
+		if tag == sigLongArchive {
+			v, err := h.Int64s(tag)
+			if err != nil || len(v) != 1 {
+				t.Fatalf("Int64s returned %v, %v", v, err)
+			}
+			got = v[0]
+		} else {
+			v, err := h.Uint32s(tag)
+			if err != nil || len(v) != 1 {
+				t.Fatalf("Uint32s returned %v, %v", v, err)
+			}
+			got = int64(v[0])
+		}
+		if tag != tc.wantTag || got != tc.size {
+			t.Errorf("archiveSizeEntry(%d) returned tag %d with %d, want tag %d", tc.size, tag, got, tc.wantTag)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	pgpecdsa "github.com/ProtonMail/go-crypto/openpgp/ecdsa"
+	pgpeddsa "github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// CryptoSigner signs rpms with a crypto.Signer, so keys held in an HSM, a TPM or a
+// cloud KMS (e.g. through a PKCS#11 module) can sign packages without being exported.
+// RSA, ECDSA (NIST curves) and ed25519 keys are supported.
+// Use it with r.SetPGPReaderSigner(c.SignReader).
+type CryptoSigner struct {
+	// Signer holds the private key.
+	Signer crypto.Signer
+	// KeyCreated is the creation time of the OpenPGP key. It is part of the key
+	// fingerprint, so it must be the same for all signatures and the public key.
+	KeyCreated time.Time
+}
+
+// Sign returns a binary detached v4 OpenPGP signature of data with a sha256 digest.
+func (c CryptoSigner) Sign(data []byte) ([]byte, error) {
+	return c.SignReader(bytes.NewReader(data))
+}
+
+// SignReader returns a binary detached v4 OpenPGP signature of the data read from r, see
+// Sign.
+func (c CryptoSigner) SignReader(r io.Reader) ([]byte, error) {
+	key, err := c.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	sig := &packet.Signature{
+		Version:      4,
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   key.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &key.KeyId,
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to read the signed data: %w", err)
+	}
+	if err := sig.Sign(h, key, nil); err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	var b bytes.Buffer
+	if err := sig.Serialize(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// PublicKey returns the binary OpenPGP public key of the signer with the given user id,
+// e.g. "Example <packages@example.com>", to be imported with rpm --import.
+func (c CryptoSigner) PublicKey(userID string) ([]byte, error) {
+	key, err := c.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	sig := &packet.Signature{
+		Version:      4,
+		SigType:      packet.SigTypePositiveCert,
+		PubKeyAlgo:   key.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: c.KeyCreated,
+		IssuerKeyId:  &key.KeyId,
+		FlagsValid:   true,
+		FlagCertify:  true,
+		FlagSign:     true,
+	}
+	if err := sig.SignUserId(userID, &key.PublicKey, key, nil); err != nil {
+		return nil, fmt.Errorf("failed to certify the user id: %w", err)
+	}
+	var b bytes.Buffer
+	if err := key.PublicKey.Serialize(&b); err != nil {
+		return nil, err
+	}
+	if err := (&packet.UserId{Id: userID}).Serialize(&b); err != nil {
+		return nil, err
+	}
+	if err := sig.Serialize(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// privateKey returns the OpenPGP key of the signer. go-crypto signs with an RSA
+// crypto.Signer, the ECDSA and ed25519 keys use a curve signing with c.Signer.
+func (c CryptoSigner) privateKey() (*packet.PrivateKey, error) {
+	if c.Signer == nil {
+		return nil, errors.New("no signer")
+	}
+	switch pub := c.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		return &packet.PrivateKey{PublicKey: *packet.NewRSAPublicKey(c.KeyCreated, pub), PrivateKey: c.Signer}, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return nil, fmt.Errorf("unsupported ecdsa curve %s", pub.Curve.Params().Name)
+		}
+		key := pgpecdsa.NewPublicKey(signerCurve{pub.Curve, c.Signer})
+		key.X, key.Y = pub.X, pub.Y
+		return packet.NewSignerPrivateKey(c.KeyCreated, pgpecdsa.NewPrivateKey(*key)), nil
+	case ed25519.PublicKey:
+		key := pgpeddsa.NewPublicKey(signerEd25519{c.Signer})
+		key.X = pub
+		return packet.NewSignerPrivateKey(c.KeyCreated, pgpeddsa.NewPrivateKey(*key)), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", c.Signer.Public())
+}
+
+// signerCurve is a NIST curve for go-crypto's ECDSA keys which signs with a
+// crypto.Signer, as go-crypto only signs with ECDSA keys it holds itself.
+type signerCurve struct {
+	elliptic.Curve
+	signer crypto.Signer
+}
+
+func (c signerCurve) GetCurveName() string {
+	return c.Params().Name
+}
+
+func (c signerCurve) MarshalIntegerPoint(x, y *big.Int) []byte {
+	return elliptic.Marshal(c.Curve, x, y)
+}
+
+func (c signerCurve) UnmarshalIntegerPoint(b []byte) (x, y *big.Int) {
+	return elliptic.Unmarshal(c.Curve, b)
+}
+
+// Sign signs the sha256 digest hash, the private key d is held by the signer.
+func (c signerCurve) Sign(rand io.Reader, x, y, d *big.Int, hash []byte) (r, s *big.Int, err error) {
+	der, err := c.signer.Sign(rand, hash, crypto.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ecdsa signature: %w", err)
+	}
+	return sig.R, sig.S, nil
+}
+
+func (c signerCurve) Verify(x, y *big.Int, hash []byte, r, s *big.Int) bool {
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: c.Curve, X: x, Y: y}, hash, r, s)
+}
+
+// The private key is not available, it is not needed to sign.
+
+func (c signerCurve) MarshalIntegerSecret(d *big.Int) []byte           { return nil }
+func (c signerCurve) UnmarshalIntegerSecret(d []byte) *big.Int         { return nil }
+func (c signerCurve) ValidateECDSA(x, y *big.Int, secret []byte) error { return nil }
+func (c signerCurve) GenerateECDSA(rand io.Reader) (x, y, secret *big.Int, err error) {
+	return nil, nil, nil, errors.New("can not generate keys")
+}
+
+// signerEd25519 is the ed25519 curve for go-crypto's EdDSA keys which signs with a
+// crypto.Signer.
+type signerEd25519 struct {
+	signer crypto.Signer
+}
+
+func (c signerEd25519) GetCurveName() string {
+	return "ed25519"
+}
+
+// MarshalBytePoint prefixes the point with 0x40 for the native format, like go-crypto.
+func (c signerEd25519) MarshalBytePoint(x []byte) []byte {
+	return append([]byte{0x40}, x...)
+}
+
+func (c signerEd25519) UnmarshalBytePoint(point []byte) []byte {
+	if len(point) != ed25519.PublicKeySize+1 {
+		return nil
+	}
+	return point[1:]
+}
+
+func (c signerEd25519) MarshalSignature(sig []byte) (r, s []byte) {
+	return sig[:ed25519.SignatureSize/2], sig[ed25519.SignatureSize/2:]
+}
+
+func (c signerEd25519) UnmarshalSignature(r, s []byte) []byte {
+	if len(r) > ed25519.SignatureSize/2 || len(s) > ed25519.SignatureSize/2 {
+		return nil
+	}
+	sig := make([]byte, ed25519.SignatureSize)
+	copy(sig[ed25519.SignatureSize/2-len(r):], r)
+	copy(sig[ed25519.SignatureSize-len(s):], s)
+	return sig
+}
+
+// Sign signs message, the digest of the signed data, with the signer.
+func (c signerEd25519) Sign(publicKey, privateKey, message []byte) ([]byte, error) {
+	sig, err := c.signer.Sign(rand.Reader, message, crypto.Hash(0))
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("ed25519 signature has %d bytes", len(sig))
+	}
+	return sig, nil
+}
+
+func (c signerEd25519) Verify(publicKey, message, sig []byte) bool {
+	return ed25519.Verify(publicKey, message, sig)
+}
+
+func (c signerEd25519) MarshalByteSecret(d []byte) []byte                { return nil }
+func (c signerEd25519) UnmarshalByteSecret(d []byte) []byte              { return nil }
+func (c signerEd25519) ValidateEdDSA(publicKey, privateKey []byte) error { return nil }
+func (c signerEd25519) GenerateEdDSA(rand io.Reader) (pub, priv []byte, err error) {
+	return nil, nil, errors.New("can not generate keys")
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func TestCryptoSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned error %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned error %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned error %v", err)
+	}
+	data := []byte("header and payload")
+	for _, tc := range []struct {
+		name           string
+		signer         crypto.Signer
+		wantHeaderTag  int
+		wantPayloadTag int
+	}{
+		{name: "rsa", signer: rsaKey, wantHeaderTag: sigRSA, wantPayloadTag: sigPGP},
+		{name: "ecdsa", signer: ecdsaKey, wantHeaderTag: sigDSA, wantPayloadTag: sigGPG},
+		{name: "ed25519", signer: ed25519Key, wantHeaderTag: sigDSA, wantPayloadTag: sigGPG},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := CryptoSigner{Signer: tc.signer, KeyCreated: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+			pub, err := c.PublicKey("rpmpack test <test@example.com>")
+			if err != nil {
+				t.Fatalf("PublicKey returned error %v", err)
+			}
+			keyring, err := openpgp.ReadKeyRing(bytes.NewReader(pub))
+			if err != nil {
+				t.Fatalf("ReadKeyRing returned error %v", err)
+			}
+			if len(keyring) != 1 || keyring[0].Identities["rpmpack test <test@example.com>"] == nil {
+				t.Fatalf("public key has unexpected identities")
+			}
+			sig, err := c.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign returned error %v", err)
+			}
+			if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig), nil); err != nil {
+				t.Errorf("CheckDetachedSignature returned error %v", err)
+			}
+			if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader([]byte("other data")), bytes.NewReader(sig), nil); err == nil {
+				t.Errorf("CheckDetachedSignature of other data should have returned an error")
+			}
+			if headerTag, payloadTag := signatureTags(sig); headerTag != tc.wantHeaderTag || payloadTag != tc.wantPayloadTag {
+				t.Errorf("signatureTags returned %d, %d, want %d, %d", headerTag, payloadTag, tc.wantHeaderTag, tc.wantPayloadTag)
+			}
+		})
+	}
+}
+
+func TestCryptoSignerGPG(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not available")
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned error %v", err)
+	}
+	c := CryptoSigner{Signer: key, KeyCreated: time.Now().Add(-time.Hour)}
+	pub, err := c.PublicKey("rpmpack test <test@example.com>")
+	if err != nil {
+		t.Fatalf("PublicKey returned error %v", err)
+	}
+	data := []byte("header and payload")
+	sig, err := c.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign returned error %v", err)
+	}
+
+	home, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		t.Fatalf("MkdirTemp returned error %v", err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		os.RemoveAll(home)
+	})
+	files := map[string][]byte{"pub": pub, "sig": sig, "data": data}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(home, name), b, 0o600); err != nil {
+			t.Fatalf("WriteFile returned error %v", err)
+		}
+	}
+	if out, err := exec.Command("gpg", "--homedir", home, "--batch", "--import", filepath.Join(home, "pub")).CombinedOutput(); err != nil {
+		t.Fatalf("gpg --import failed: %v: %s", err, out)
+	}
+	if out, err := exec.Command("gpg", "--homedir", home, "--verify", filepath.Join(home, "sig"), filepath.Join(home, "data")).CombinedOutput(); err != nil {
+		t.Errorf("gpg --verify failed: %v: %s", err, out)
+	}
+}
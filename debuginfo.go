@@ -0,0 +1,370 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	debugDir        = "/usr/lib/debug"
+	debugBuildIDDir = "/usr/lib/debug/.build-id"
+	debugSourceDir  = "/usr/src/debug"
+)
+
+// DebugInfoOptions controls how DebugPackages creates the -debuginfo and -debugsource packages.
+type DebugInfoOptions struct {
+	// Strip removes the debug sections from the binaries of the main package.
+	// The debug file then contains the complete unstripped binary, which
+	// debuggers accept as a separate debug file.
+	Strip bool
+	// DebugFiles holds pre-split debug files, keyed by the path of the binary
+	// they belong to. These binaries are used as-is and never stripped.
+	DebugFiles map[string][]byte
+	// SourceDir is the build directory as recorded in the DWARF line tables,
+	// e.g. "/home/builder/hello-1.0".
+	SourceDir string
+	// Sources is the source tree rooted at SourceDir. Source files referenced
+	// by the DWARF data of the binaries are copied from it into the
+	// -debugsource package. If nil, no -debugsource package is created.
+	Sources fs.FS
+}
+
+// DebugPackages creates the companion -debuginfo and -debugsource packages for the ELF
+// binaries of r. Binaries with DWARF data (or with a pre-split debug file) get a debug file
+// under /usr/lib/debug and build-id symlinks under /usr/lib/debug/.build-id.
+//
+// debugsource is nil if no source files were found. Call this after all files were added
+// to r, and before r is written; afterwards it returns ErrPayloadFinalized. With Strip, the
+// binaries of r are only replaced once both packages were created, so r is unchanged on error.
+//
+// Note that the debug data is not rewritten to point to /usr/src/debug, so debuggers
+// have to be told about the new source location (e.g. gdb's "set substitute-path").
+func (r *RPM) DebugPackages(opts DebugInfoOptions) (debuginfo, debugsource *RPM, err error) {
+	r.mu.Lock()
+	if r.payloadFinalized {
+		r.mu.Unlock()
+		return nil, nil, ErrPayloadFinalized
+	}
+	fnames := r.sortedFileNames()
+	files := make(map[string]RPMFile, len(r.files))
+	for fn, f := range r.files {
+		files[fn] = f
+	}
+	r.mu.Unlock()
+
+	nvra := fmt.Sprintf("%s-%s.%s", r.Name, r.FullVersion(), r.Arch)
+	md := r.RPMMetaData
+	md.Name = r.Name + "-debuginfo"
+	md.Summary = fmt.Sprintf("Debug information for package %s", r.Name)
+	md.Description = fmt.Sprintf("This package provides debug information for package %s.", r.Name)
+	md.Provides, md.Obsoletes, md.Suggests, md.Recommends, md.Requires, md.Conflicts = nil, nil, nil, nil, nil, nil
+	md.Supplements, md.Enhances = nil, nil
+	md.Prefixes = nil
+	debuginfo, err = NewRPM(md)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create debuginfo package: %w", err)
+	}
+
+	sources := map[string]bool{}
+	stripped := map[string]RPMFile{}
+	for _, fn := range fnames {
+		f := files[fn]
+		if f.Mode&0170000 != 0 && f.Mode&0170000 != 0100000 {
+			// Only regular files can be binaries.
+			continue
+		}
+		debug, hasSplit := opts.DebugFiles[fn]
+		e, err := elf.NewFile(bytes.NewReader(f.Body))
+		if err != nil {
+			if hasSplit {
+				return nil, nil, fmt.Errorf("debug file given for %q, which is not an ELF file: %w", fn, err)
+			}
+			continue
+		}
+		if !hasSplit {
+			if !hasDebugSections(e) {
+				continue
+			}
+			debug = f.Body
+		}
+		if opts.Sources != nil {
+			for _, s := range dwarfSourceFiles(e, opts.SourceDir) {
+				sources[s] = true
+			}
+		}
+		buildID, err := elfBuildID(e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read build-id of %q: %w", fn, err)
+		}
+		if !hasSplit && opts.Strip {
+			body, err := stripDebug(f.Body)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to strip %q: %w", fn, err)
+			}
+			f.Body = body
+			stripped[fn] = f
+		}
+
+		debugName := debugDir + fn + ".debug"
+		debuginfo.AddFile(RPMFile{Name: debugName, Body: debug, Mode: 0100644, Owner: "root", Group: "root", MTime: f.MTime})
+		if buildID == "" {
+			continue
+		}
+		linkDir := path.Join(debugBuildIDDir, buildID[:2])
+		link := path.Join(linkDir, buildID[2:])
+		debuginfo.AddFile(RPMFile{Name: link, Body: []byte(relativeLink(linkDir, fn)), Mode: 0120777, Owner: "root", Group: "root", MTime: f.MTime})
+		debuginfo.AddFile(RPMFile{Name: link + ".debug", Body: []byte(relativeLink(linkDir, debugName)), Mode: 0120777, Owner: "root", Group: "root", MTime: f.MTime})
+		debuginfo.Provides.addIfMissing(&Relation{Name: "debuginfo(build-id)", Version: buildID, Sense: SenseEqual})
+	}
+
+	if len(sources) > 0 {
+		md.Name = r.Name + "-debugsource"
+		md.Summary = fmt.Sprintf("Debug sources for package %s", r.Name)
+		md.Description = fmt.Sprintf("This package provides debug sources for package %s.", r.Name)
+		debugsource, err = NewRPM(md)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create debugsource package: %w", err)
+		}
+		for s := range sources {
+			body, err := fs.ReadFile(opts.Sources, s)
+			if err != nil {
+				// Generated or system sources are not part of the source tree.
+				continue
+			}
+			debugsource.AddFile(RPMFile{Name: path.Join(debugSourceDir, nvra, s), Body: body, Mode: 0100644, Owner: "root", Group: "root"})
+		}
+		debuginfo.Recommends.addIfMissing(&Relation{Name: md.Name, Version: r.FullVersion(), Sense: SenseEqual})
+	}
+
+	if len(stripped) > 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// r may have been written while the debug packages were created.
+		if r.payloadFinalized {
+			return nil, nil, ErrPayloadFinalized
+		}
+		for fn, f := range stripped {
+			r.files[fn] = f
+		}
+	}
+	return debuginfo, debugsource, nil
+}
+
+// sortedFileNames returns the names of all files, sorted alphabetically.
+func (r *RPM) sortedFileNames() []string {
+	fnames := make([]string, 0, len(r.files))
+	for fn := range r.files {
+		fnames = append(fnames, fn)
+	}
+	sort.Strings(fnames)
+	return fnames
+}
+
+// relativeLink returns the symlink body pointing from a link in dir to target.
+func relativeLink(dir, target string) string {
+	up := strings.Count(strings.Trim(dir, "/"), "/") + 1
+	return strings.Repeat("../", up) + strings.TrimPrefix(target, "/")
+}
+
+func isDebugSection(name string) bool {
+	return strings.HasPrefix(name, ".debug_") || strings.HasPrefix(name, ".zdebug_")
+}
+
+func hasDebugSections(e *elf.File) bool {
+	for _, s := range e.Sections {
+		if isDebugSection(s.Name) && s.Type != elf.SHT_NOBITS {
+			return true
+		}
+	}
+	return false
+}
+
+// elfBuildID returns the hex encoded GNU build-id, or "" if the binary has none.
+func elfBuildID(e *elf.File) (string, error) {
+	for _, s := range e.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return "", err
+		}
+		for len(data) >= 12 {
+			namesz := e.ByteOrder.Uint32(data[0:])
+			descsz := e.ByteOrder.Uint32(data[4:])
+			typ := e.ByteOrder.Uint32(data[8:])
+			nameEnd := 12 + (int(namesz)+3)&^3
+			descEnd := nameEnd + (int(descsz)+3)&^3
+			if nameEnd > len(data) || nameEnd+int(descsz) > len(data) {
+				break
+			}
+			if typ == 3 && string(bytes.TrimRight(data[12:12+namesz], "\x00")) == "GNU" && descsz > 1 {
+				return hex.EncodeToString(data[nameEnd : nameEnd+int(descsz)]), nil
+			}
+			if descEnd > len(data) {
+				break
+			}
+			data = data[descEnd:]
+		}
+	}
+	return "", nil
+}
+
+// dwarfSourceFiles returns the source files below sourceDir referenced by the line tables
+// of e, relative to sourceDir.
+func dwarfSourceFiles(e *elf.File, sourceDir string) []string {
+	d, err := e.DWARF()
+	if err != nil {
+		return nil
+	}
+	prefix := strings.TrimSuffix(sourceDir, "/") + "/"
+	var files []string
+	rd := d.Reader()
+	for {
+		cu, err := rd.Next()
+		if err != nil || cu == nil {
+			break
+		}
+		rd.SkipChildren()
+		lr, err := d.LineReader(cu)
+		if err != nil || lr == nil {
+			continue
+		}
+		for _, lf := range lr.Files() {
+			if lf == nil || !strings.HasPrefix(lf.Name, prefix) {
+				continue
+			}
+			files = append(files, path.Clean(strings.TrimPrefix(lf.Name, prefix)))
+		}
+	}
+	return files
+}
+
+// stripDebug removes the contents of the debug sections from an ELF binary.
+// The section headers are kept (as SHT_NOBITS) so that section indices stay valid.
+func stripDebug(body []byte) ([]byte, error) {
+	e, err := elf.NewFile(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	is64 := e.Class == elf.ELFCLASS64
+	bo := e.ByteOrder
+	// The ELF header and the program header table.
+	var shoff, ehsize, loadEnd uint64
+	if is64 {
+		shoff = bo.Uint64(body[0x28:])
+		ehsize = uint64(bo.Uint16(body[0x34:]))
+		loadEnd = bo.Uint64(body[0x20:]) + uint64(bo.Uint16(body[0x36:]))*uint64(bo.Uint16(body[0x38:]))
+	} else {
+		shoff = uint64(bo.Uint32(body[0x20:]))
+		ehsize = uint64(bo.Uint16(body[0x28:]))
+		loadEnd = uint64(bo.Uint32(body[0x1c:])) + uint64(bo.Uint16(body[0x2a:]))*uint64(bo.Uint16(body[0x2c:]))
+	}
+	if ehsize > loadEnd {
+		loadEnd = ehsize
+	}
+	headers := make([]elf.Section64, len(e.Sections))
+	rd := bytes.NewReader(body[shoff:])
+	for i := range headers {
+		if is64 {
+			err = binary.Read(rd, bo, &headers[i])
+		} else {
+			var h elf.Section32
+			err = binary.Read(rd, bo, &h)
+			headers[i] = elf.Section64{Name: h.Name, Type: h.Type, Flags: uint64(h.Flags), Addr: uint64(h.Addr),
+				Off: uint64(h.Off), Size: uint64(h.Size), Link: h.Link, Info: h.Info,
+				Addralign: uint64(h.Addralign), Entsize: uint64(h.Entsize)}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read section header %d: %w", i, err)
+		}
+	}
+
+	// Everything needed to load the binary stays where it is.
+	for _, p := range e.Progs {
+		if end := p.Off + p.Filesz; end > loadEnd {
+			loadEnd = end
+		}
+	}
+	for i, s := range e.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 && s.Type != elf.SHT_NOBITS {
+			if end := headers[i].Off + headers[i].Size; end > loadEnd {
+				loadEnd = end
+			}
+		}
+	}
+	if loadEnd > uint64(len(body)) {
+		return nil, fmt.Errorf("segments extend beyond the end of the file")
+	}
+	out := append([]byte{}, body[:loadEnd]...)
+	for i, s := range e.Sections {
+		h := &headers[i]
+		switch {
+		case isDebugSection(s.Name) && s.Type != elf.SHT_NOBITS:
+			h.Type = uint32(elf.SHT_NOBITS)
+		case s.Type == elf.SHT_NULL || s.Type == elf.SHT_NOBITS || s.Flags&elf.SHF_ALLOC != 0:
+		case h.Off+h.Size <= loadEnd:
+		default:
+			if h.Off+h.Size > uint64(len(body)) {
+				return nil, fmt.Errorf("section %q extends beyond the end of the file", s.Name)
+			}
+			out = alignBytes(out, h.Addralign)
+			data := body[h.Off : h.Off+h.Size]
+			h.Off = uint64(len(out))
+			out = append(out, data...)
+		}
+	}
+
+	if is64 {
+		out = alignBytes(out, 8)
+		bo.PutUint64(out[0x28:], uint64(len(out)))
+	} else {
+		out = alignBytes(out, 4)
+		bo.PutUint32(out[0x20:], uint32(len(out)))
+	}
+	w := bytes.NewBuffer(out)
+	for _, h := range headers {
+		if is64 {
+			err = binary.Write(w, bo, h)
+		} else {
+			err = binary.Write(w, bo, elf.Section32{Name: h.Name, Type: h.Type, Flags: uint32(h.Flags), Addr: uint32(h.Addr),
+				Off: uint32(h.Off), Size: uint32(h.Size), Link: h.Link, Info: h.Info,
+				Addralign: uint32(h.Addralign), Entsize: uint32(h.Entsize)})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write section header: %w", err)
+		}
+	}
+	return w.Bytes(), nil
+}
+
+func alignBytes(b []byte, align uint64) []byte {
+	if align <= 1 {
+		return b
+	}
+	if rem := uint64(len(b)) % align; rem != 0 {
+		b = append(b, make([]byte, align-rem)...)
+	}
+	return b
+}
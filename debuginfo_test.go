@@ -0,0 +1,218 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testSection struct {
+	name  string
+	typ   elf.SectionType
+	flags elf.SectionFlag
+	link  uint32
+	data  []byte
+}
+
+// testELF creates a minimal little endian ELF64 file with the given sections.
+// The section header string table is appended as the last section.
+func testELF(t *testing.T, machine elf.Machine, typ elf.Type, sections ...testSection) []byte {
+	t.Helper()
+	shstrtab := []byte{0}
+	names := make([]uint32, len(sections))
+	for i, s := range sections {
+		names[i] = uint32(len(shstrtab))
+		shstrtab = append(append(shstrtab, s.name...), 0)
+	}
+	names = append(names, uint32(len(shstrtab)))
+	shstrtab = append(shstrtab, ".shstrtab\x00"...)
+	sections = append(sections, testSection{name: ".shstrtab", typ: elf.SHT_STRTAB, data: shstrtab})
+
+	body := make([]byte, 64)
+	headers := []elf.Section64{{}}
+	for i, s := range sections {
+		body = alignBytes(body, 8)
+		headers = append(headers, elf.Section64{
+			Name:      names[i],
+			Type:      uint32(s.typ),
+			Flags:     uint64(s.flags),
+			Off:       uint64(len(body)),
+			Size:      uint64(len(s.data)),
+			Link:      s.link,
+			Addralign: 1,
+		})
+		body = append(body, s.data...)
+	}
+	body = alignBytes(body, 8)
+	hdr := elf.Header64{
+		Type:      uint16(typ),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(len(body)),
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(len(headers) - 1),
+	}
+	copy(hdr.Ident[:], []byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)})
+	b := bytes.NewBuffer(nil)
+	if err := binary.Write(b, binary.LittleEndian, hdr); err != nil {
+		t.Fatalf("failed to write ELF header: %v", err)
+	}
+	copy(body, b.Bytes())
+	w := bytes.NewBuffer(body)
+	if err := binary.Write(w, binary.LittleEndian, headers); err != nil {
+		t.Fatalf("failed to write section headers: %v", err)
+	}
+	return w.Bytes()
+}
+
+func buildIDNote(id []byte) []byte {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint32(b[0:], 4)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(id)))
+	binary.LittleEndian.PutUint32(b[8:], 3)
+	return append(append(b, "GNU\x00"...), id...)
+}
+
+func TestDebugPackages(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello", Version: "1.0", Release: "1", Arch: "x86_64"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	bin := testELF(t, elf.EM_X86_64, elf.ET_EXEC,
+		testSection{name: ".text", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR, data: bytes.Repeat([]byte{0x90}, 16)},
+		testSection{name: ".note.gnu.build-id", typ: elf.SHT_NOTE, flags: elf.SHF_ALLOC, data: buildIDNote([]byte{0xab, 0xcd, 0xef, 0x01})},
+		testSection{name: ".debug_info", typ: elf.SHT_PROGBITS, data: bytes.Repeat([]byte("debug"), 100)},
+	)
+	r.AddFile(RPMFile{Name: "/usr/bin/hello", Body: bin, Mode: 0100755})
+	r.AddFile(RPMFile{Name: "/usr/share/hello/README", Body: []byte("readme"), Mode: 0100644})
+
+	debuginfo, debugsource, err := r.DebugPackages(DebugInfoOptions{Strip: true})
+	if err != nil {
+		t.Fatalf("DebugPackages returned error %v", err)
+	}
+	if debugsource != nil {
+		t.Errorf("DebugPackages returned a debugsource package without sources")
+	}
+	if debuginfo.Name != "hello-debuginfo" {
+		t.Errorf("debuginfo name = %q, want hello-debuginfo", debuginfo.Name)
+	}
+	gotLinks := map[string]string{}
+	for fn, f := range debuginfo.files {
+		gotLinks[fn] = string(f.Body)
+	}
+	wantLinks := map[string]string{
+		"/usr/lib/debug/usr/bin/hello.debug":       string(bin),
+		"/usr/lib/debug/.build-id/ab/cdef01":       "../../../../../usr/bin/hello",
+		"/usr/lib/debug/.build-id/ab/cdef01.debug": "../../../../../usr/lib/debug/usr/bin/hello.debug",
+	}
+	if d := cmp.Diff(wantLinks, gotLinks); d != "" {
+		t.Errorf("debuginfo files differ (want->got):\n%v", d)
+	}
+	if !strings.Contains(debuginfo.Provides.String(), "debuginfo(build-id)=abcdef01") {
+		t.Errorf("debuginfo provides %q, want debuginfo(build-id)", debuginfo.Provides.String())
+	}
+
+	stripped := r.files["/usr/bin/hello"].Body
+	if len(stripped) >= len(bin) {
+		t.Errorf("stripped binary has %d bytes, want less than %d", len(stripped), len(bin))
+	}
+	e, err := elf.NewFile(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("stripped binary is not a valid ELF file: %v", err)
+	}
+	if s := e.Section(".debug_info"); s == nil || s.Type != elf.SHT_NOBITS {
+		t.Errorf("stripped binary still contains .debug_info: %v", s)
+	}
+	text, err := e.Section(".text").Data()
+	if err != nil || !bytes.Equal(text, bytes.Repeat([]byte{0x90}, 16)) {
+		t.Errorf("stripped binary .text = %x, %v", text, err)
+	}
+	if err := debuginfo.Write(io.Discard); err != nil {
+		t.Errorf("debuginfo.Write returned error %v", err)
+	}
+}
+
+func TestDebugPackagesErrors(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello", Version: "1.0", Release: "1", Arch: "x86_64"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	bin := testELF(t, elf.EM_X86_64, elf.ET_EXEC,
+		testSection{name: ".debug_info", typ: elf.SHT_PROGBITS, data: bytes.Repeat([]byte("debug"), 100)},
+	)
+	r.AddFile(RPMFile{Name: "/usr/bin/a", Body: bin, Mode: 0100755})
+	r.AddFile(RPMFile{Name: "/usr/bin/b", Body: []byte("#!/bin/sh\n"), Mode: 0100755})
+
+	// /usr/bin/a is stripped before the debug file for the script /usr/bin/b fails.
+	opts := DebugInfoOptions{Strip: true, DebugFiles: map[string][]byte{"/usr/bin/b": []byte("debug")}}
+	if _, _, err := r.DebugPackages(opts); err == nil {
+		t.Errorf("DebugPackages with a debug file for a script should have returned an error")
+	}
+	if !bytes.Equal(r.files["/usr/bin/a"].Body, bin) {
+		t.Errorf("failed DebugPackages changed /usr/bin/a")
+	}
+
+	if err := r.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if _, _, err := r.DebugPackages(DebugInfoOptions{Strip: true}); !errors.Is(err, ErrPayloadFinalized) {
+		t.Errorf("DebugPackages after Write returned %v, want %v", err, ErrPayloadFinalized)
+	}
+}
+
+func TestDebugPackagesRelations(t *testing.T) {
+	md := RPMMetaData{Name: "hello", Version: "1.0", Release: "1", Arch: "x86_64"}
+	for _, rels := range []*Relations{&md.Provides, &md.Obsoletes, &md.Suggests, &md.Recommends, &md.Supplements, &md.Enhances, &md.Requires, &md.Conflicts} {
+		if err := rels.Set("other"); err != nil {
+			t.Fatalf("Set returned error %v", err)
+		}
+	}
+	r, err := NewRPM(md)
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/hello", Mode: 0100755, Body: testELF(t, elf.EM_X86_64, elf.ET_EXEC,
+		testSection{name: ".note.gnu.build-id", typ: elf.SHT_NOTE, flags: elf.SHF_ALLOC, data: buildIDNote([]byte{0xab, 0xcd, 0xef, 0x01})},
+		testSection{name: ".debug_info", typ: elf.SHT_PROGBITS, data: []byte("debug")},
+	)})
+	debuginfo, _, err := r.DebugPackages(DebugInfoOptions{})
+	if err != nil {
+		t.Fatalf("DebugPackages returned error %v", err)
+	}
+	got := map[string]string{}
+	for _, kind := range []string{"provides", "obsoletes", "suggests", "recommends", "supplements", "enhances", "requires", "conflicts"} {
+		rels, err := debuginfo.Relations(kind)
+		if err != nil {
+			t.Fatalf("Relations(%q) returned error %v", kind, err)
+		}
+		if len(rels) > 0 {
+			got[kind] = rels.String()
+		}
+	}
+	want := map[string]string{"provides": "hello-debuginfo=1.0-1,debuginfo(build-id)=abcdef01"}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("debuginfo relations differ (want->got):\n%v", d)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"path"
+)
+
+// DependencyGenerator inspects a single packaged file and returns the relations it implies,
+// similar to the dependency generators of rpmbuild. Generators are only run on files
+// with content (not on directories, symlinks and ghost files).
+type DependencyGenerator func(f RPMFile) (provides, requires Relations, err error)
+
+// AddDependencyGenerator registers a DependencyGenerator. All generators are run on all
+// files when the rpm is written, and their relations are added to Provides and Requires.
+// EstimateSize runs them too, on a copy of the rpm.
+func (r *RPM) AddDependencyGenerator(g DependencyGenerator) {
+	r.depGenerators = append(r.depGenerators, g)
+}
+
+func (r *RPM) runDependencyGenerators() error {
+	if len(r.depGenerators) == 0 {
+		return nil
+	}
+	for _, fn := range r.sortedFileNames() {
+		f := r.files[fn]
+		if f.Type&GhostFile != 0 || (f.Mode&0170000 != 0 && f.Mode&0170000 != 0100000) {
+			continue
+		}
+		for _, g := range r.depGenerators {
+			provides, requires, err := g(f)
+			if err != nil {
+				return fmt.Errorf("dependency generator failed on %q: %w", fn, err)
+			}
+			for _, p := range provides {
+				r.Provides.addIfMissing(p)
+			}
+			for _, q := range requires {
+				r.Requires.addIfMissing(q)
+			}
+		}
+	}
+	return nil
+}
+
+// excludedPath reports if name matches one of the path.Match patterns.
+func excludedPath(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
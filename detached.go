@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// SigningManifest describes what must be signed to sign an rpm in two phases, e.g. on
+// an air-gapped machine: the rpm is written unsigned, the manifest is exported with
+// NewSigningManifest, and the signatures made elsewhere are attached with AttachSignatures.
+//
+// Like rpmsign, two detached OpenPGP signatures are needed: one of the header, and one of
+// the header followed by the payload, which runs to the end of the file.
+type SigningManifest struct {
+	// HeaderOffset is the offset of the header in the rpm file.
+	HeaderOffset int64 `json:"header_offset"`
+	// HeaderSize is the size of the header, the data of the header-only signature.
+	HeaderSize int64 `json:"header_size"`
+	// PayloadSize is the size of the payload, which follows the header.
+	PayloadSize int64 `json:"payload_size"`
+	// HeaderSHA256 is the hex sha256 digest of the header.
+	HeaderSHA256 string `json:"header_sha256"`
+	// HeaderPayloadSHA256 is the hex sha256 digest of the header and the payload.
+	HeaderPayloadSHA256 string `json:"header_payload_sha256"`
+}
+
+// NewSigningManifest reads an rpm and returns its SigningManifest.
+func NewSigningManifest(rpm io.Reader) (*SigningManifest, error) {
+	pkg, err := ReadPackage(rpm)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(pkg.Header.raw)
+	headerDigest := h.Sum(nil)
+	h.Write(pkg.payload)
+	return &SigningManifest{
+		HeaderOffset:        int64(pkg.headerOffset()),
+		HeaderSize:          int64(len(pkg.Header.raw)),
+		PayloadSize:         int64(len(pkg.payload)),
+		HeaderSHA256:        fmt.Sprintf("%x", headerDigest),
+		HeaderPayloadSHA256: fmt.Sprintf("%x", h.Sum(nil)),
+	}, nil
+}
+
+// AttachSignatures reads an rpm, and writes it to w with the given detached OpenPGP
+// signatures of the header and of the header and payload, replacing any existing
+// signatures. The header and the payload are copied unchanged.
+func AttachSignatures(w io.Writer, rpm io.Reader, headerSig, headerPayloadSig []byte) error {
+	pkg, err := ReadPackage(rpm)
+	if err != nil {
+		return err
+	}
+	s, err := pkg.signedIndex(headerSig, headerPayloadSig)
+	if err != nil {
+		return err
+	}
+	sb, err := s.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve signatures header: %w", err)
+	}
+	pkg.Signature.raw = sb
+	return pkg.write(w)
+}
+
+// SignInPlace signs an rpm file which was written with RPMMetaData.ReservedSpace, like
+// rpmsign does: the signatures take the place of some of the reserved space, so only
+// the signature header is rewritten, and the header and the payload do not move.
+// signer is called like the function of RPM.SetPGPSigner.
+func SignInPlace(f io.ReadWriteSeeker, signer func([]byte) ([]byte, error)) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek: %w", err)
+	}
+	pkg, err := ReadPackage(f)
+	if err != nil {
+		return err
+	}
+	if _, ok := pkg.Signature.entries[sigReservedSpace]; !ok {
+		return fmt.Errorf("the rpm has no reserved space to sign in place")
+	}
+	headerSig, err := signer(pkg.Header.raw)
+	if err != nil {
+		return fmt.Errorf("call to signer failed: %w", err)
+	}
+	headerPayloadSig, err := signer(append(append([]byte{}, pkg.Header.raw...), pkg.payload...))
+	if err != nil {
+		return fmt.Errorf("call to signer failed: %w", err)
+	}
+	s, err := pkg.signedIndex(headerSig, headerPayloadSig)
+	if err != nil {
+		return err
+	}
+	// The signature header must keep its padded size. The reserved space is the last
+	// entry, so shrinking it by n bytes shrinks the header by n bytes.
+	want := len(pkg.Signature.raw) + (8-len(pkg.Signature.raw)%8)%8
+	delete(s.entries, sigReservedSpace)
+	sb, err := s.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve signatures header: %w", err)
+	}
+	// The reserved space entry itself takes 16 bytes in the index.
+	reserved := want - len(sb) - 16
+	if reserved < 1 {
+		return fmt.Errorf("the signatures need %d bytes more than the reserved space", 1-reserved)
+	}
+	s.Add(sigReservedSpace, EntryBytes(make([]byte, reserved)))
+	if sb, err = s.Bytes(); err != nil {
+		return fmt.Errorf("failed to retrieve signatures header: %w", err)
+	}
+	if len(sb) != want {
+		return fmt.Errorf("signature header of %d bytes does not fit in %d bytes", len(sb), want)
+	}
+	if _, err := f.Seek(int64(len(pkg.lead)), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek: %w", err)
+	}
+	if _, err := f.Write(sb); err != nil {
+		return fmt.Errorf("failed to write signature bytes: %w", err)
+	}
+	return nil
+}
+
+// signedIndex returns the signature header of the rpm with the given signatures,
+// replacing any existing signatures.
+func (pkg *Package) signedIndex(headerSig, headerPayloadSig []byte) (*index, error) {
+	if len(headerSig) == 0 || len(headerPayloadSig) == 0 {
+		return nil, fmt.Errorf("both a header and a header+payload signature are required")
+	}
+	s := pkg.signatureIndex()
+	for _, tag := range []int{sigRSA, sigDSA, sigOpenPGP, sigPGP, sigGPG} {
+		delete(s.entries, tag)
+	}
+	headerTag, _ := signatureTags(headerSig)
+	s.Add(headerTag, EntryBytes(headerSig))
+	_, bodyTag := signatureTags(headerPayloadSig)
+	s.Add(bodyTag, EntryBytes(headerPayloadSig))
+	return s, nil
+}
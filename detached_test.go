@@ -0,0 +1,199 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func testDetachedRPM(t *testing.T, signer func([]byte) ([]byte, error)) []byte {
+	t.Helper()
+	r, err := NewRPM(RPMMetaData{Name: "detached", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+	if signer != nil {
+		r.SetPGPSigner(signer)
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestSigningManifest(t *testing.T) {
+	unsigned := testDetachedRPM(t, nil)
+	m, err := NewSigningManifest(bytes.NewReader(unsigned))
+	if err != nil {
+		t.Fatalf("NewSigningManifest returned error %v", err)
+	}
+	if m.HeaderOffset+m.HeaderSize+m.PayloadSize != int64(len(unsigned)) {
+		t.Fatalf("manifest %+v does not cover the %d bytes of the rpm", m, len(unsigned))
+	}
+	header := unsigned[m.HeaderOffset : m.HeaderOffset+m.HeaderSize]
+	headerPayload := unsigned[m.HeaderOffset:]
+	if got := fmt.Sprintf("%x", sha256.Sum256(header)); got != m.HeaderSHA256 {
+		t.Errorf("header digest is %s, the manifest has %s", got, m.HeaderSHA256)
+	}
+	if got := fmt.Sprintf("%x", sha256.Sum256(headerPayload)); got != m.HeaderPayloadSHA256 {
+		t.Errorf("header+payload digest is %s, the manifest has %s", got, m.HeaderPayloadSHA256)
+	}
+
+	entity, err := openpgp.NewEntity("rpmpack test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("NewEntity returned error %v", err)
+	}
+	k := &KeySigner{entity: entity}
+	headerSig, err := k.Sign(header)
+	if err != nil {
+		t.Fatalf("Sign returned error %v", err)
+	}
+	headerPayloadSig, err := k.Sign(headerPayload)
+	if err != nil {
+		t.Fatalf("Sign returned error %v", err)
+	}
+	var signed bytes.Buffer
+	if err := AttachSignatures(&signed, bytes.NewReader(unsigned), headerSig, headerPayloadSig); err != nil {
+		t.Fatalf("AttachSignatures returned error %v", err)
+	}
+	if err := VerifyDigests(bytes.NewReader(signed.Bytes())); err != nil {
+		t.Errorf("VerifyDigests returned error %v", err)
+	}
+	pkg, err := ReadPackage(bytes.NewReader(signed.Bytes()))
+	if err != nil {
+		t.Fatalf("readRPM returned error %v", err)
+	}
+	if !bytes.Equal(pkg.Header.raw, header) {
+		t.Errorf("AttachSignatures changed the header")
+	}
+	for tag, data := range map[int][]byte{sigDSA: header, sigGPG: headerPayload} {
+		sig := pkg.Signature.entries[tag].data
+		if _, err := openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(data), bytes.NewReader(sig), nil); err != nil {
+			t.Errorf("signature tag %d: CheckDetachedSignature returned error %v", tag, err)
+		}
+	}
+
+	if err := AttachSignatures(&signed, bytes.NewReader(unsigned), headerSig, nil); err == nil {
+		t.Errorf("AttachSignatures without a header+payload signature should have returned an error")
+	}
+}
+
+func TestAttachSignaturesMatchesWrite(t *testing.T) {
+	signer := func(b []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("signature of %d bytes", len(b))), nil
+	}
+	want := testDetachedRPM(t, signer)
+	unsigned := testDetachedRPM(t, nil)
+	m, err := NewSigningManifest(bytes.NewReader(unsigned))
+	if err != nil {
+		t.Fatalf("NewSigningManifest returned error %v", err)
+	}
+	headerSig, _ := signer(unsigned[m.HeaderOffset : m.HeaderOffset+m.HeaderSize])
+	headerPayloadSig, _ := signer(unsigned[m.HeaderOffset:])
+	var got bytes.Buffer
+	if err := AttachSignatures(&got, bytes.NewReader(unsigned), headerSig, headerPayloadSig); err != nil {
+		t.Fatalf("AttachSignatures returned error %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("AttachSignatures wrote a different rpm than Write with a signer")
+	}
+}
+
+func TestSignInPlace(t *testing.T) {
+	entity, err := openpgp.NewEntity("rpmpack test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048})
+	if err != nil {
+		t.Fatalf("NewEntity returned error %v", err)
+	}
+	k := &KeySigner{entity: entity}
+	for _, tc := range []struct {
+		name     string
+		reserved uint
+		wantErr  bool
+	}{
+		{name: "rpmbuild default", reserved: 4096},
+		{name: "too small", reserved: 64, wantErr: true},
+		{name: "no reserved space", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "inplace", Version: "1.0", ReservedSpace: tc.reserved})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+			f, err := os.Create(filepath.Join(t.TempDir(), "inplace.rpm"))
+			if err != nil {
+				t.Fatalf("Create returned error %v", err)
+			}
+			defer f.Close()
+			if err := r.Write(f); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			before, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("ReadFile returned error %v", err)
+			}
+
+			err = SignInPlace(f, k.Sign)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("SignInPlace should have returned an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SignInPlace returned error %v", err)
+			}
+			after, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("ReadFile returned error %v", err)
+			}
+			if len(after) != len(before) {
+				t.Fatalf("SignInPlace changed the size of the rpm from %d to %d", len(before), len(after))
+			}
+			m, err := NewSigningManifest(bytes.NewReader(before))
+			if err != nil {
+				t.Fatalf("NewSigningManifest returned error %v", err)
+			}
+			if !bytes.Equal(after[m.HeaderOffset:], before[m.HeaderOffset:]) {
+				t.Errorf("SignInPlace changed the header or the payload")
+			}
+			if err := VerifyDigests(bytes.NewReader(after)); err != nil {
+				t.Errorf("VerifyDigests returned error %v", err)
+			}
+			pkg, err := ReadPackage(bytes.NewReader(after))
+			if err != nil {
+				t.Fatalf("readRPM returned error %v", err)
+			}
+			for tag, data := range map[int][]byte{sigRSA: after[m.HeaderOffset : m.HeaderOffset+m.HeaderSize], sigPGP: after[m.HeaderOffset:]} {
+				if _, err := openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(data), bytes.NewReader(pkg.Signature.entries[tag].data), nil); err != nil {
+					t.Errorf("signature tag %d: CheckDetachedSignature returned error %v", tag, err)
+				}
+			}
+			if got := pkg.Signature.entries[sigReservedSpace].count; got >= int(tc.reserved) {
+				t.Errorf("reserved space is %d bytes, want less than %d", got, tc.reserved)
+			}
+		})
+	}
+}
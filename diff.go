@@ -0,0 +1,294 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DiffOptions controls what Diff compares.
+type DiffOptions struct {
+	// Variable also compares the fields which change on every build of the same sources:
+	// the build time and host, the file mtimes and the signature header.
+	Variable bool
+}
+
+// Difference is a difference between two rpms, found by Diff.
+type Difference struct {
+	// What is e.g. "version", "requires" or "file /usr/bin/hello mode".
+	What string
+	// A and B are the values in each rpm, empty if missing.
+	A, B string
+}
+
+// String returns the difference in the form "what: a -> b".
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %q -> %q", d.What, d.A, d.B)
+}
+
+// diffTags are the metadata tags compared by Diff.
+var diffTags = []struct {
+	name     string
+	tag      int
+	variable bool
+}{
+	{"name", tagName, false},
+	{"epoch", tagEpoch, false},
+	{"version", tagVersion, false},
+	{"release", tagRelease, false},
+	{"arch", tagArch, false},
+	{"os", tagOS, false},
+	{"summary", tagSummary, false},
+	{"description", tagDescription, false},
+	{"vendor", tagVendor, false},
+	{"license", tagLicence, false},
+	{"packager", tagPackager, false},
+	{"group", tagGroup, false},
+	{"url", tagURL, false},
+	{"sourcerpm", tagSourceRPM, false},
+	{"prefixes", tagPrefixes, false},
+	{"payload compressor", tagPayloadCompressor, false},
+	{"pretrans", tagPretrans, false},
+	{"pretrans interpreter", tagPretransProg, false},
+	{"prein", tagPrein, false},
+	{"prein interpreter", tagPreinProg, false},
+	{"postin", tagPostin, false},
+	{"postin interpreter", tagPostinProg, false},
+	{"preun", tagPreun, false},
+	{"preun interpreter", tagPreunProg, false},
+	{"postun", tagPostun, false},
+	{"postun interpreter", tagPostunProg, false},
+	{"posttrans", tagPosttrans, false},
+	{"posttrans interpreter", tagPosttransProg, false},
+	{"verifyscript", tagVerifyScript, false},
+	{"verifyscript interpreter", tagVerifyScriptProg, false},
+	{"buildtime", tagBuildTime, true},
+	{"buildhost", tagBuildHost, true},
+}
+
+// diffRelationKinds are the relations compared by Diff, see Package.Relations.
+var diffRelationKinds = []string{"provides", "requires", "conflicts", "obsoletes", "recommends", "suggests", "supplements", "enhances"}
+
+// Diff reads two rpms and returns their differences in metadata, dependencies, file
+// lists, file modes, owners and content digests. The fields which change on every
+// build, like the build time and the signatures, are only compared with opts.Variable.
+func Diff(a, b io.Reader, opts DiffOptions) ([]Difference, error) {
+	pkgA, err := ReadPackage(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read first rpm: %w", err)
+	}
+	pkgB, err := ReadPackage(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read second rpm: %w", err)
+	}
+	var diffs []Difference
+	add := func(what, a, b string) {
+		if a != b {
+			diffs = append(diffs, Difference{What: what, A: a, B: b})
+		}
+	}
+
+	for _, t := range diffTags {
+		if t.variable && !opts.Variable {
+			continue
+		}
+		add(t.name, formatEntry(pkgA.Header.entries[t.tag]), formatEntry(pkgB.Header.entries[t.tag]))
+	}
+
+	for _, kind := range diffRelationKinds {
+		relsA, err := pkgA.Relations(kind)
+		if err != nil {
+			return nil, err
+		}
+		relsB, err := pkgB.Relations(kind)
+		if err != nil {
+			return nil, err
+		}
+		inA, inB := relationSet(relsA), relationSet(relsB)
+		for _, r := range sortedKeys(inA) {
+			if !inB[r] {
+				add(kind, r, "")
+			}
+		}
+		for _, r := range sortedKeys(inB) {
+			if !inA[r] {
+				add(kind, "", r)
+			}
+		}
+	}
+
+	filesA, err := pkgA.files()
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := pkgB.files()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for name := range filesA {
+		names[name] = true
+	}
+	for name := range filesB {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		fa, okA := filesA[name]
+		fb, okB := filesB[name]
+		if !okA || !okB {
+			add("file "+name, fa.summary(okA), fb.summary(okB))
+			continue
+		}
+		add("file "+name+" mode", fmt.Sprintf("%o", fa.mode), fmt.Sprintf("%o", fb.mode))
+		add("file "+name+" owner", fa.owner, fb.owner)
+		add("file "+name+" group", fa.group, fb.group)
+		add("file "+name+" size", fmt.Sprint(fa.size), fmt.Sprint(fb.size))
+		add("file "+name+" digest", fa.digest, fb.digest)
+		add("file "+name+" link", fa.linkTo, fb.linkTo)
+		add("file "+name+" flags", fmt.Sprint(fa.flags), fmt.Sprint(fb.flags))
+		if opts.Variable {
+			add("file "+name+" mtime", fmt.Sprint(fa.mtime), fmt.Sprint(fb.mtime))
+		}
+	}
+
+	if opts.Variable {
+		tags := make(map[int]bool)
+		for _, tag := range append(pkgA.Signature.Tags(), pkgB.Signature.Tags()...) {
+			tags[tag] = true
+		}
+		sorted := make([]int, 0, len(tags))
+		for tag := range tags {
+			sorted = append(sorted, tag)
+		}
+		sort.Ints(sorted)
+		for _, tag := range sorted {
+			add(fmt.Sprintf("signature tag %d", tag),
+				formatEntry(pkgA.Signature.entries[tag]), formatEntry(pkgB.Signature.entries[tag]))
+		}
+	}
+	return diffs, nil
+}
+
+// fileAttrs are the attributes of a file in the header of a Package.
+type fileAttrs struct {
+	mode         uint16
+	owner, group string
+	size         uint32
+	digest       string
+	linkTo       string
+	flags        uint32
+	mtime        uint32
+}
+
+// summary describes a whole file, or returns "" if it does not exist.
+func (f fileAttrs) summary(exists bool) string {
+	if !exists {
+		return ""
+	}
+	return fmt.Sprintf("%o %s:%s %d", f.mode, f.owner, f.group, f.size)
+}
+
+// files returns the attributes of the files in the header, by path.
+func (pkg *Package) files() (map[string]fileAttrs, error) {
+	names, err := pkg.Header.fileNames()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		h       = pkg.Header.entries
+		owners  = h[tagFileUserName].strings()
+		groups  = h[tagFileGroupName].strings()
+		sizes   = h[tagFileSizes].int32s()
+		digests = h[tagFileDigests].strings()
+		linkTos = h[tagFileLinkTos].strings()
+		flags   = h[tagFileFlags].int32s()
+		mtimes  = h[tagFileMTimes].int32s()
+	)
+	modes, err := pkg.Header.Int16s(tagFileModes)
+	if err != nil && len(names) > 0 {
+		return nil, err
+	}
+	for _, n := range []int{len(owners), len(groups), len(sizes), len(digests), len(linkTos), len(flags), len(mtimes), len(modes)} {
+		if n != len(names) {
+			return nil, fmt.Errorf("%w: header has %d files but %d values of a file tag", ErrInconsistentFileIndex, len(names), n)
+		}
+	}
+	files := make(map[string]fileAttrs, len(names))
+	for i, name := range names {
+		files[name] = fileAttrs{
+			mode:   uint16(modes[i]),
+			owner:  owners[i],
+			group:  groups[i],
+			size:   uint32(sizes[i]),
+			digest: digests[i],
+			linkTo: linkTos[i],
+			flags:  uint32(flags[i]),
+			mtime:  uint32(mtimes[i]),
+		}
+	}
+	return files, nil
+}
+
+// formatEntry formats the value of an entry for Diff, or returns "" if it is missing.
+func formatEntry(e IndexEntry) string {
+	if e.count == 0 {
+		return ""
+	}
+	switch e.rpmtype {
+	case typeString, typeStringArray, typeI18NString:
+		return strings.Join(e.strings(), ", ")
+	case typeInt16:
+		v := make([]string, e.count)
+		for i := range v {
+			v[i] = fmt.Sprint(binary.BigEndian.Uint16(e.data[2*i:]))
+		}
+		return strings.Join(v, ", ")
+	case typeInt32:
+		v := make([]string, e.count)
+		for i, n := range e.int32s() {
+			v[i] = fmt.Sprint(uint32(n))
+		}
+		return strings.Join(v, ", ")
+	case typeInt64:
+		v := make([]string, e.count)
+		for i := range v {
+			v[i] = fmt.Sprint(binary.BigEndian.Uint64(e.data[8*i:]))
+		}
+		return strings.Join(v, ", ")
+	default:
+		return fmt.Sprintf("%x", e.data)
+	}
+}
+
+func relationSet(rels Relations) map[string]bool {
+	set := make(map[string]bool, len(rels))
+	for _, r := range rels {
+		set[r.String()] = true
+	}
+	return set
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
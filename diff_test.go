@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testDiffRPM(t *testing.T, md RPMMetaData, files ...RPMFile) *bytes.Reader {
+	t.Helper()
+	r, err := NewRPM(md)
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range files {
+		r.AddFile(f)
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestDiff(t *testing.T) {
+	md := RPMMetaData{
+		Name:      "diff",
+		Version:   "1.0",
+		Release:   "1",
+		Requires:  Relations{{Name: "bash"}},
+		BuildTime: time.Unix(1000, 0),
+	}
+	files := []RPMFile{
+		{Name: "/usr/bin/diff-tool", Body: []byte("binary"), Mode: 0755, Owner: "root", Group: "root", MTime: 1},
+		{Name: "/etc/diff.conf", Body: []byte("a=1\n"), Mode: 0644, Owner: "root", Group: "root", MTime: 1},
+	}
+	md2 := md
+	md2.Release = "2"
+	md2.Requires = Relations{{Name: "bash"}, {Name: "glibc", Version: "2.28", Sense: SenseGreater | SenseEqual}}
+	md2.BuildTime = time.Unix(2000, 0)
+	files2 := []RPMFile{
+		{Name: "/usr/bin/diff-tool", Body: []byte("binary"), Mode: 0750, Owner: "root", Group: "diff", MTime: 2},
+		{Name: "/usr/share/doc/diff/README", Body: []byte("readme"), Mode: 0644, Owner: "root", Group: "root", MTime: 2},
+	}
+
+	testCases := []struct {
+		name string
+		opts DiffOptions
+		want []Difference
+	}{{
+		name: "default",
+		want: []Difference{
+			{"release", "1", "2"},
+			{"sourcerpm", "diff-1.0-1.src.rpm", "diff-1.0-2.src.rpm"},
+			{"provides", "diff=1.0-1", ""},
+			{"provides", "", "diff=1.0-2"},
+			{"requires", "", "glibc>=2.28"},
+			{"file /etc/diff.conf", "100644 root:root 4", ""},
+			{"file /usr/bin/diff-tool mode", "100755", "100750"},
+			{"file /usr/bin/diff-tool group", "root", "diff"},
+			{"file /usr/share/doc/diff/README", "", "100644 root:root 6"},
+		},
+	}, {
+		name: "variable",
+		opts: DiffOptions{Variable: true},
+		want: []Difference{
+			{"release", "1", "2"},
+			{"sourcerpm", "diff-1.0-1.src.rpm", "diff-1.0-2.src.rpm"},
+			{"buildtime", "1000", "2000"},
+			{"provides", "diff=1.0-1", ""},
+			{"provides", "", "diff=1.0-2"},
+			{"requires", "", "glibc>=2.28"},
+			{"file /etc/diff.conf", "100644 root:root 4", ""},
+			{"file /usr/bin/diff-tool mode", "100755", "100750"},
+			{"file /usr/bin/diff-tool group", "root", "diff"},
+			{"file /usr/bin/diff-tool mtime", "1", "2"},
+			{"file /usr/share/doc/diff/README", "", "100644 root:root 6"},
+		},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Diff(testDiffRPM(t, md, files...), testDiffRPM(t, md2, files2...), tc.opts)
+			if err != nil {
+				t.Fatalf("Diff returned error %v", err)
+			}
+			if tc.opts.Variable {
+				// The signature header digests differ too.
+				var filtered []Difference
+				for _, d := range got {
+					if !strings.HasPrefix(d.What, "signature ") {
+						filtered = append(filtered, d)
+					}
+				}
+				if len(filtered) == len(got) {
+					t.Errorf("Diff with Variable did not compare the signature headers")
+				}
+				got = filtered
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("Diff returned unexpected differences (want->got):\n%s", d)
+			}
+		})
+	}
+
+	got, err := Diff(testDiffRPM(t, md, files...), testDiffRPM(t, md, files...), DiffOptions{Variable: true})
+	if err != nil {
+		t.Fatalf("Diff returned error %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Diff of identical rpms returned %v, want none", got)
+	}
+}
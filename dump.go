@@ -0,0 +1,249 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// headerTagNames are the names of the header tags, as used by rpm --querytags.
+var headerTagNames = map[int]string{
+	tagHeaderI18NTable:   "HEADERI18NTABLE",
+	tagName:              "NAME",
+	tagVersion:           "VERSION",
+	tagRelease:           "RELEASE",
+	tagEpoch:             "EPOCH",
+	tagSummary:           "SUMMARY",
+	tagDescription:       "DESCRIPTION",
+	tagBuildTime:         "BUILDTIME",
+	tagBuildHost:         "BUILDHOST",
+	tagSize:              "SIZE",
+	tagVendor:            "VENDOR",
+	tagLicence:           "LICENSE",
+	tagPackager:          "PACKAGER",
+	tagGroup:             "GROUP",
+	tagSource:            "SOURCE",
+	tagPatch:             "PATCH",
+	tagURL:               "URL",
+	tagOS:                "OS",
+	tagArch:              "ARCH",
+	tagPrein:             "PREIN",
+	tagPostin:            "POSTIN",
+	tagPreun:             "PREUN",
+	tagPostun:            "POSTUN",
+	tagFileSizes:         "FILESIZES",
+	tagFileModes:         "FILEMODES",
+	tagFileRDevs:         "FILERDEVS",
+	tagFileMTimes:        "FILEMTIMES",
+	tagFileDigests:       "FILEDIGESTS",
+	tagFileLinkTos:       "FILELINKTOS",
+	tagFileFlags:         "FILEFLAGS",
+	tagFileUserName:      "FILEUSERNAME",
+	tagFileGroupName:     "FILEGROUPNAME",
+	tagSourceRPM:         "SOURCERPM",
+	tagRPMVersion:        "RPMVERSION",
+	tagFileVerifyFlags:   "FILEVERIFYFLAGS",
+	tagProvides:          "PROVIDENAME",
+	tagRequireFlags:      "REQUIREFLAGS",
+	tagRequires:          "REQUIRENAME",
+	tagRequireVersion:    "REQUIREVERSION",
+	tagConflictFlags:     "CONFLICTFLAGS",
+	tagConflicts:         "CONFLICTNAME",
+	tagConflictVersion:   "CONFLICTVERSION",
+	tagVerifyScript:      "VERIFYSCRIPT",
+	tagPreinProg:         "PREINPROG",
+	tagPostinProg:        "POSTINPROG",
+	tagPreunProg:         "PREUNPROG",
+	tagPostunProg:        "POSTUNPROG",
+	tagObsoletes:         "OBSOLETENAME",
+	tagVerifyScriptProg:  "VERIFYSCRIPTPROG",
+	tagFileDevices:       "FILEDEVICES",
+	tagFileINodes:        "FILEINODES",
+	tagFileLangs:         "FILELANGS",
+	tagPrefixes:          "PREFIXES",
+	tagSourcePackage:     "SOURCEPACKAGE",
+	tagProvideFlags:      "PROVIDEFLAGS",
+	tagProvideVersion:    "PROVIDEVERSION",
+	tagObsoleteFlags:     "OBSOLETEFLAGS",
+	tagObsoleteVersion:   "OBSOLETEVERSION",
+	tagDirindexes:        "DIRINDEXES",
+	tagBasenames:         "BASENAMES",
+	tagDirnames:          "DIRNAMES",
+	tagPayloadFormat:     "PAYLOADFORMAT",
+	tagPayloadCompressor: "PAYLOADCOMPRESSOR",
+	tagPayloadFlags:      "PAYLOADFLAGS",
+	tagPretrans:          "PRETRANS",
+	tagPosttrans:         "POSTTRANS",
+	tagPretransProg:      "PRETRANSPROG",
+	tagPosttransProg:     "POSTTRANSPROG",
+	tagOldSuggests:       "OLDSUGGESTSNAME",
+	tagOldSuggestVersion: "OLDSUGGESTSVERSION",
+	tagOldSuggestFlags:   "OLDSUGGESTSFLAGS",
+	tagOldEnhances:       "OLDENHANCESNAME",
+	tagOldEnhanceVersion: "OLDENHANCESVERSION",
+	tagOldEnhanceFlags:   "OLDENHANCESFLAGS",
+	tagFileDigestAlgo:    "FILEDIGESTALGO",
+	tagPreinFlags:        "PREINFLAGS",
+	tagPostinFlags:       "POSTINFLAGS",
+	tagPreunFlags:        "PREUNFLAGS",
+	tagPostunFlags:       "POSTUNFLAGS",
+	tagPretransFlags:     "PRETRANSFLAGS",
+	tagPosttransFlags:    "POSTTRANSFLAGS",
+	tagVerifyScriptFlags: "VERIFYSCRIPTFLAGS",
+	tagRecommends:        "RECOMMENDNAME",
+	tagRecommendVersion:  "RECOMMENDVERSION",
+	tagRecommendFlags:    "RECOMMENDFLAGS",
+	tagSuggests:          "SUGGESTNAME",
+	tagSuggestVersion:    "SUGGESTVERSION",
+	tagSuggestFlags:      "SUGGESTFLAGS",
+	tagSupplements:       "SUPPLEMENTNAME",
+	tagSupplementVersion: "SUPPLEMENTVERSION",
+	tagSupplementFlags:   "SUPPLEMENTFLAGS",
+	tagEnhances:          "ENHANCENAME",
+	tagEnhanceVersion:    "ENHANCEVERSION",
+	tagEnhanceFlags:      "ENHANCEFLAGS",
+	tagEncoding:          "ENCODING",
+	tagPayloadDigest:     "PAYLOADDIGEST",
+	tagPayloadDigestAlgo: "PAYLOADDIGESTALGO",
+	tagPayloadDigestAlt:  "PAYLOADDIGESTALT",
+	tagRPMFormat:         "RPMFORMAT",
+}
+
+// signatureTagNames are the names of the signature header tags.
+var signatureTagNames = map[int]string{
+	sigDSA:           "DSAHEADER",
+	sigRSA:           "RSAHEADER",
+	sigSHA1:          "SHA1HEADER",
+	sigLongArchive:   "LONGARCHIVESIZE",
+	sigSHA256:        "SHA256HEADER",
+	sigOpenPGP:       "OPENPGP",
+	sigSize:          "SIGSIZE",
+	sigPGP:           "SIGPGP",
+	sigMD5:           "SIGMD5",
+	sigGPG:           "SIGGPG",
+	sigPayloadSize:   "PAYLOADSIZE",
+	sigReservedSpace: "RESERVEDSPACE",
+}
+
+var typeNames = map[int]string{
+	typeChar:        "CHAR",
+	typeInt8:        "INT8",
+	typeInt16:       "INT16",
+	typeInt32:       "INT32",
+	typeInt64:       "INT64",
+	typeString:      "STRING",
+	typeBinary:      "BIN",
+	typeStringArray: "STRING_ARRAY",
+	typeI18NString:  "I18NSTRING",
+}
+
+// DumpEntry is a tag of a header in the JSON dump of a Package.
+type DumpEntry struct {
+	Tag int `json:"tag"`
+	// Name is the symbolic name of the tag, e.g. "NAME", or empty for unknown tags.
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// Value is a string for STRING tags, a hex string for BIN tags, and an array otherwise,
+	// e.g. []uint16 for INT16 tags.
+	Value interface{} `json:"value"`
+}
+
+// Dump returns the tags of the signature header and of the header, in tag order, as they
+// are written by MarshalJSON.
+func (pkg *Package) Dump() (signature, header []DumpEntry) {
+	return pkg.Signature.dump(signatureTagNames), pkg.Header.dump(headerTagNames)
+}
+
+// MarshalJSON dumps the lead and the tags of the signature header and the header, e.g.
+//
+//	{"lead": {...}, "signature": [{"tag": 1000, "name": "SIGSIZE", "type": "INT32", "value": [1234]}, ...], "header": [...]}
+//
+// It is meant to debug what was written in an rpm.
+func (pkg *Package) MarshalJSON() ([]byte, error) {
+	signature, header := pkg.Dump()
+	return json.Marshal(struct {
+		Lead      Lead        `json:"lead"`
+		Signature []DumpEntry `json:"signature"`
+		Header    []DumpEntry `json:"header"`
+	}{pkg.Lead, signature, header})
+}
+
+// dump returns the entries of the header, in tag order.
+func (h *Header) dump(names map[int]string) []DumpEntry {
+	tags := h.Tags()
+	entries := make([]DumpEntry, len(tags))
+	for i, tag := range tags {
+		e := h.entries[tag]
+		typ, ok := typeNames[e.rpmtype]
+		if !ok {
+			typ = fmt.Sprint(e.rpmtype)
+		}
+		entries[i] = DumpEntry{Tag: tag, Name: names[tag], Type: typ, Value: e.value()}
+	}
+	return entries
+}
+
+// value returns the value of an entry as a JSON friendly value.
+func (e IndexEntry) value() interface{} {
+	switch e.rpmtype {
+	case typeString:
+		s := e.strings()
+		if len(s) == 1 {
+			return s[0]
+		}
+		return s
+	case typeStringArray, typeI18NString:
+		return e.strings()
+	case typeChar, typeInt8:
+		// Not []byte, which encoding/json writes as base64.
+		v := make([]int, e.count)
+		for i := range v {
+			v[i] = int(e.data[i])
+		}
+		return v
+	case typeInt16:
+		v := make([]uint16, e.count)
+		for i := range v {
+			v[i] = binary.BigEndian.Uint16(e.data[2*i:])
+		}
+		return v
+	case typeInt32:
+		v := make([]uint32, e.count)
+		for i := range v {
+			v[i] = binary.BigEndian.Uint32(e.data[4*i:])
+		}
+		return v
+	case typeInt64:
+		v := make([]uint64, e.count)
+		for i := range v {
+			v[i] = binary.BigEndian.Uint64(e.data[8*i:])
+		}
+		return v
+	default:
+		return hex.EncodeToString(e.data)
+	}
+}
+
+// headerTagNumbers maps the names of headerTagNames to the tags.
+var headerTagNumbers = func() map[string]int {
+	m := make(map[string]int, len(headerTagNames))
+	for tag, name := range headerTagNames {
+		m[name] = tag
+	}
+	return m
+}()
@@ -0,0 +1,76 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPackageMarshalJSON(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "dump", Version: "1.0", Compressor: "zstd"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file"), Mode: 0644})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	out, err := json.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("json.Marshal returned error %v", err)
+	}
+	var got struct {
+		Lead      Lead
+		Signature []DumpEntry
+		Header    []DumpEntry
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("json.Unmarshal returned error %v", err)
+	}
+	if d := cmp.Diff(pkg.Lead, got.Lead); d != "" {
+		t.Errorf("unexpected lead (want->got):\n%s", d)
+	}
+	if len(got.Signature) != 3 || got.Signature[1].Name != "SIGSIZE" || got.Signature[1].Type != "INT32" {
+		t.Errorf("unexpected signature entries %+v", got.Signature)
+	}
+
+	want := map[string]DumpEntry{
+		"NAME":              {Tag: tagName, Name: "NAME", Type: "STRING", Value: "dump"},
+		"DIRNAMES":          {Tag: tagDirnames, Name: "DIRNAMES", Type: "STRING_ARRAY", Value: []interface{}{"/usr/local/"}},
+		"FILEMODES":         {Tag: tagFileModes, Name: "FILEMODES", Type: "INT16", Value: []interface{}{float64(0100644)}},
+		"FILESIZES":         {Tag: tagFileSizes, Name: "FILESIZES", Type: "INT32", Value: []interface{}{float64(19)}},
+		"PAYLOADCOMPRESSOR": {Tag: tagPayloadCompressor, Name: "PAYLOADCOMPRESSOR", Type: "STRING", Value: "zstd"},
+	}
+	for _, e := range got.Header {
+		if w, ok := want[e.Name]; ok {
+			if d := cmp.Diff(w, e); d != "" {
+				t.Errorf("unexpected %s entry (want->got):\n%s", e.Name, d)
+			}
+			delete(want, e.Name)
+		}
+	}
+	for name := range want {
+		t.Errorf("the dump has no %s entry", name)
+	}
+}
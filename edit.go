@@ -0,0 +1,228 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnknownRelationKind is returned for a relation kind other than "provides",
+// "requires", "conflicts", "obsoletes", "recommends", "suggests", "supplements" or
+// "enhances".
+var ErrUnknownRelationKind = errors.New("unknown relation kind")
+
+// relationTags are the name, version and flags tags of each kind of relation.
+var relationTags = map[string][3]int{
+	"provides":    {tagProvides, tagProvideVersion, tagProvideFlags},
+	"requires":    {tagRequires, tagRequireVersion, tagRequireFlags},
+	"conflicts":   {tagConflicts, tagConflictVersion, tagConflictFlags},
+	"obsoletes":   {tagObsoletes, tagObsoleteVersion, tagObsoleteFlags},
+	"recommends":  {tagRecommends, tagRecommendVersion, tagRecommendFlags},
+	"suggests":    {tagSuggests, tagSuggestVersion, tagSuggestFlags},
+	"supplements": {tagSupplements, tagSupplementVersion, tagSupplementFlags},
+	"enhances":    {tagEnhances, tagEnhanceVersion, tagEnhanceFlags},
+}
+
+// Set sets the entry of a tag, e.g. h.Set(1011, EntryString("Example")) for the vendor.
+// The changes are written by Package.Write.
+func (h *Header) Set(tag int, e IndexEntry) {
+	h.entries[tag] = e
+	h.modified = true
+}
+
+// Delete removes a tag.
+func (h *Header) Delete(tag int) {
+	if _, ok := h.entries[tag]; ok {
+		delete(h.entries, tag)
+		h.modified = true
+	}
+}
+
+// SetRelease changes the release, e.g. to bump a package without rebuilding it. The
+// provide of the package itself and the source rpm name are changed too.
+func (pkg *Package) SetRelease(release string) error {
+	if err := checkNEVR("", "", release); err != nil {
+		return err
+	}
+	name, err := pkg.Header.String(tagName)
+	if err != nil {
+		return err
+	}
+	version, err := pkg.Header.String(tagVersion)
+	if err != nil {
+		return err
+	}
+	oldRelease, _ := pkg.Header.String(tagRelease)
+	fullVersion := func(release string) string {
+		if release == "" {
+			return version
+		}
+		return version + "-" + release
+	}
+	oldVersion, newVersion := fullVersion(oldRelease), fullVersion(release)
+	epochPrefix := ""
+	if epoch, err := pkg.Header.Int32s(tagEpoch); err == nil && len(epoch) == 1 {
+		epochPrefix = fmt.Sprintf("%d:", epoch[0])
+	}
+
+	provides, err := pkg.Relations("provides")
+	if err != nil {
+		return err
+	}
+	for _, p := range provides {
+		if p.Name == name && p.Sense&senseCompareMask == SenseEqual {
+			switch p.Version {
+			case oldVersion:
+				p.Version = newVersion
+			case epochPrefix + oldVersion:
+				p.Version = epochPrefix + newVersion
+			}
+		}
+	}
+	if err := pkg.SetRelations("provides", provides); err != nil {
+		return err
+	}
+	if release == "" {
+		pkg.Header.Delete(tagRelease)
+	} else {
+		pkg.Header.Set(tagRelease, EntryString(release))
+	}
+	if _, ok := pkg.Header.entries[tagSourceRPM]; ok {
+		pkg.Header.Set(tagSourceRPM, EntryString(fmt.Sprintf("%s-%s.src.rpm", name, newVersion)))
+	}
+	return nil
+}
+
+// SetVendor changes the vendor.
+func (pkg *Package) SetVendor(vendor string) {
+	pkg.Header.Set(tagVendor, EntryString(vendor))
+}
+
+// SetURL changes the URL.
+func (pkg *Package) SetURL(url string) {
+	pkg.Header.Set(tagURL, EntryString(url))
+}
+
+// Relations returns the relations of a kind: "provides", "requires", "conflicts",
+// "obsoletes", "recommends", "suggests", "supplements" or "enhances".
+func (pkg *Package) Relations(kind string) (Relations, error) {
+	tags, ok := relationTags[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRelationKind, kind)
+	}
+	names, err := pkg.Header.Strings(tags[0])
+	if errors.Is(err, ErrTagNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions, _ := pkg.Header.Strings(tags[1])
+	flags, _ := pkg.Header.Uint32s(tags[2])
+	if len(versions) != len(names) || len(flags) != len(names) {
+		return nil, fmt.Errorf("%w: %s have %d names, %d versions and %d flags", ErrInvalidHeader, kind, len(names), len(versions), len(flags))
+	}
+	rels := make(Relations, len(names))
+	for i := range names {
+		rels[i] = &Relation{Name: names[i], Version: versions[i], Sense: rpmSense(flags[i])}
+	}
+	return rels, nil
+}
+
+// SetRelations replaces the relations of a kind, see Relations.
+func (pkg *Package) SetRelations(kind string, rels Relations) error {
+	tags, ok := relationTags[kind]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownRelationKind, kind)
+	}
+	for _, tag := range tags {
+		pkg.Header.Delete(tag)
+	}
+	h := newIndex(immutable)
+	if err := rels.AddToIndex(h, tags[0], tags[1], tags[2]); err != nil {
+		return fmt.Errorf("failed to add %s: %w", kind, err)
+	}
+	for tag, e := range h.entries {
+		pkg.Header.Set(tag, e)
+	}
+	return nil
+}
+
+// Write writes the rpm. If the header was changed, its digests are computed again, and
+// the signatures are removed as they are no longer valid; sign it again with
+// AttachSignatures or SignInPlace. The payload is written unchanged.
+func (pkg *Package) Write(w io.Writer) error {
+	if pkg.Header.modified {
+		if err := pkg.reseal(); err != nil {
+			return err
+		}
+	}
+	return pkg.write(w)
+}
+
+// reseal writes the changed header, and the signature header and the lead which
+// depend on it.
+func (pkg *Package) reseal() error {
+	h := newIndex(immutable)
+	h.AddEntries(pkg.Header.entries)
+	delete(h.entries, immutable)
+	hb, err := h.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve header: %w", err)
+	}
+	if pkg.Header.raw, pkg.Header.entries, err = readIndex(bytes.NewReader(hb)); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	pkg.Header.modified = false
+
+	s := pkg.signatureIndex()
+	for _, tag := range []int{sigRSA, sigDSA, sigOpenPGP, sigPGP, sigGPG} {
+		delete(s.entries, tag)
+	}
+	s.Add(sigSize, EntryInt32([]int32{int32(len(hb) + len(pkg.payload))}))
+	s.Add(sigSHA256, EntryString(fmt.Sprintf("%x", sha256.Sum256(hb))))
+	if _, ok := s.entries[sigSHA1]; ok {
+		s.Add(sigSHA1, EntryString(fmt.Sprintf("%x", sha1.Sum(hb))))
+	}
+	if _, ok := s.entries[sigMD5]; ok {
+		m := md5.New()
+		m.Write(hb)
+		m.Write(pkg.payload)
+		s.Add(sigMD5, EntryBytes(m.Sum(nil)))
+	}
+	sb, err := s.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve signatures header: %w", err)
+	}
+	if pkg.Signature.raw, pkg.Signature.entries, err = readIndex(bytes.NewReader(sb)); err != nil {
+		return fmt.Errorf("failed to read signature header: %w", err)
+	}
+
+	name, _ := pkg.Header.String(tagName)
+	version, _ := pkg.Header.String(tagVersion)
+	if release, _ := pkg.Header.String(tagRelease); release != "" {
+		version += "-" + release
+	}
+	n := lead(name, version, false)[10:76]
+	copy(pkg.lead[10:76], n)
+	pkg.Lead.Name = string(bytes.TrimRight(n, "\x00"))
+	return nil
+}
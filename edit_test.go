@@ -0,0 +1,128 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testEditRPM(t *testing.T) []byte {
+	t.Helper()
+	r, err := NewRPM(RPMMetaData{
+		Name:     "edit",
+		Version:  "1.0",
+		Release:  "1",
+		Vendor:   "Old Vendor",
+		Requires: relations(t, "bash"),
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+	r.SetPGPSigner(func([]byte) ([]byte, error) { return []byte("signature"), nil })
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestPackageWriteUnchanged(t *testing.T) {
+	orig := testEditRPM(t)
+	pkg, err := ReadPackage(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	var b bytes.Buffer
+	if err := pkg.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if !bytes.Equal(b.Bytes(), orig) {
+		t.Errorf("Write of an unchanged package changed the rpm")
+	}
+}
+
+func TestPackageEdit(t *testing.T) {
+	orig := testEditRPM(t)
+	pkg, err := ReadPackage(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if err := pkg.SetRelease("2-1"); !errors.Is(err, ErrInvalidNEVR) {
+		t.Errorf("SetRelease with a dash returned %v, want ErrInvalidNEVR", err)
+	}
+	if err := pkg.SetRelease("2"); err != nil {
+		t.Fatalf("SetRelease returned error %v", err)
+	}
+	pkg.SetVendor("New Vendor")
+	pkg.SetURL("https://example.com")
+	requires, err := pkg.Relations("requires")
+	if err != nil {
+		t.Fatalf("Relations returned error %v", err)
+	}
+	if err := pkg.SetRelations("requires", append(requires, relations(t, "glibc>=2.28")...)); err != nil {
+		t.Fatalf("SetRelations returned error %v", err)
+	}
+	if err := pkg.SetRelations("weak", nil); err == nil {
+		t.Errorf("SetRelations of an unknown kind should have returned an error")
+	}
+	var b bytes.Buffer
+	if err := pkg.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+
+	if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("VerifyDigests returned error %v", err)
+	}
+	if _, err := VerifySignatures(bytes.NewReader(b.Bytes())); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("VerifySignatures returned %v, want ErrNotSigned as the old signatures are invalid", err)
+	}
+	edited, err := ReadPackage(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if !bytes.Equal(edited.RawPayload(), pkg.RawPayload()) {
+		t.Errorf("Write changed the payload")
+	}
+	if edited.Lead.Name != "edit-1.0-2" {
+		t.Errorf("lead name is %q, want edit-1.0-2", edited.Lead.Name)
+	}
+	for tag, want := range map[int]string{
+		tagRelease:   "2",
+		tagVendor:    "New Vendor",
+		tagURL:       "https://example.com",
+		tagSourceRPM: "edit-1.0-2.src.rpm",
+	} {
+		if got, err := edited.Header.String(tag); err != nil || got != want {
+			t.Errorf("tag %d is %q, %v, want %q", tag, got, err, want)
+		}
+	}
+	for kind, want := range map[string]string{
+		"provides": "edit=1.0-2",
+		"requires": "bash,glibc>=2.28",
+	} {
+		rels, err := edited.Relations(kind)
+		if err != nil {
+			t.Fatalf("Relations returned error %v", err)
+		}
+		if d := cmp.Diff(want, rels.String()); d != "" {
+			t.Errorf("unexpected %s (want->got):\n%s", kind, d)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"path"
+)
+
+const verFlagBase = 0x1 // VER_FLG_BASE
+
+// elfInfo holds the dependency relevant parts of an ELF file.
+type elfInfo struct {
+	file   *elf.File
+	marker string
+	soname string
+	isDSO  bool
+}
+
+// readELFInfo parses f, returning nil if it is not an executable ELF file.
+// Like rpmbuild, only files with an executable bit are considered.
+func readELFInfo(f RPMFile) *elfInfo {
+	if f.Mode&0111 == 0 || !bytes.HasPrefix(f.Body, []byte(elf.ELFMAG)) {
+		return nil
+	}
+	e, err := elf.NewFile(bytes.NewReader(f.Body))
+	if err != nil {
+		return nil
+	}
+	ei := &elfInfo{file: e}
+	if e.Class == elf.ELFCLASS64 && e.Machine != elf.EM_ALPHA {
+		// alpha doesn't traditionally have 64bit markers
+		ei.marker = "(64bit)"
+	}
+	if sonames, err := e.DynString(elf.DT_SONAME); err == nil && len(sonames) > 0 {
+		ei.soname = sonames[0]
+	}
+	hasInterp := false
+	for _, p := range e.Progs {
+		if p.Type == elf.PT_INTERP {
+			hasInterp = true
+		}
+	}
+	// Position independent executables are ET_DYN too, but have an interpreter and no soname.
+	ei.isDSO = e.Type == elf.ET_DYN && (ei.soname != "" || !hasInterp)
+	if ei.isDSO && ei.soname == "" {
+		ei.soname = path.Base(f.Name)
+	}
+	return ei
+}
+
+// dep returns the rpm dependency name of a library, e.g. "libc.so.6(GLIBC_2.2.5)(64bit)".
+func (ei *elfInfo) dep(soname, version string) *Relation {
+	if version == "" && ei.marker == "" {
+		return &Relation{Name: soname}
+	}
+	return &Relation{Name: fmt.Sprintf("%s(%s)%s", soname, version, ei.marker)}
+}
+
+// ELFProvides returns a DependencyGenerator which adds the soname provides of shared
+// libraries, like rpmbuild's elfdeps: "libfoo.so.1()(64bit)", plus one provide per
+// symbol version, e.g. "libfoo.so.1(FOO_1.0)(64bit)". Files matching one of the
+// exclude patterns (see path.Match) are skipped.
+func ELFProvides(exclude ...string) DependencyGenerator {
+	return func(f RPMFile) (Relations, Relations, error) {
+		if excludedPath(f.Name, exclude) {
+			return nil, nil, nil
+		}
+		ei := readELFInfo(f)
+		if ei == nil || !ei.isDSO {
+			return nil, nil, nil
+		}
+		provides := Relations{ei.dep(ei.soname, "")}
+		verdefs, err := elfVersionDefinitions(ei.file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range verdefs {
+			provides.addIfMissing(ei.dep(ei.soname, v))
+		}
+		return provides, nil, nil
+	}
+}
+
+// elfSectionStrings returns the string table linked from s.
+func elfSectionStrings(e *elf.File, s *elf.Section) ([]byte, []byte, error) {
+	data, err := s.Data()
+	if err != nil {
+		return nil, nil, err
+	}
+	if int(s.Link) >= len(e.Sections) {
+		return nil, nil, fmt.Errorf("section %s links to invalid section %d", s.Name, s.Link)
+	}
+	strs, err := e.Sections[s.Link].Data()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, strs, nil
+}
+
+func elfString(strs []byte, off uint32) string {
+	if int(off) >= len(strs) {
+		return ""
+	}
+	s := strs[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// elfVersionDefinitions returns the symbol versions defined by e (.gnu.version_d),
+// without the base version.
+func elfVersionDefinitions(e *elf.File) ([]string, error) {
+	var versions []string
+	for _, s := range e.Sections {
+		if s.Type != elf.SHT_GNU_VERDEF {
+			continue
+		}
+		data, strs, err := elfSectionStrings(e, s)
+		if err != nil {
+			return nil, err
+		}
+		bo := e.ByteOrder
+		for off := 0; off+20 <= len(data); {
+			// Elf_Verdef: version, flags, ndx, cnt (uint16), hash, aux, next (uint32)
+			flags := bo.Uint16(data[off+2:])
+			aux := int(bo.Uint32(data[off+12:]))
+			next := int(bo.Uint32(data[off+16:]))
+			if flags&verFlagBase == 0 && off+aux+8 <= len(data) {
+				// Elf_Verdaux: name, next (uint32)
+				versions = append(versions, elfString(strs, bo.Uint32(data[off+aux:])))
+			}
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+	return versions, nil
+}
+
+// ELFRequires returns a DependencyGenerator which adds requires on the shared libraries
+// needed by ELF binaries (DT_NEEDED), like rpmbuild's elfdeps: "libc.so.6()(64bit)",
+// plus one require per needed symbol version, e.g. "libc.so.6(GLIBC_2.34)(64bit)".
+// Files matching one of the exclude patterns (see path.Match) are skipped.
+func ELFRequires(exclude ...string) DependencyGenerator {
+	return func(f RPMFile) (Relations, Relations, error) {
+		if excludedPath(f.Name, exclude) {
+			return nil, nil, nil
+		}
+		ei := readELFInfo(f)
+		if ei == nil {
+			return nil, nil, nil
+		}
+		needed, err := ei.file.ImportedLibraries()
+		if err != nil {
+			return nil, nil, err
+		}
+		var requires Relations
+		for _, lib := range needed {
+			requires.addIfMissing(ei.dep(lib, ""))
+		}
+		verneeds, err := elfVersionNeeds(ei.file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range verneeds {
+			requires.addIfMissing(ei.dep(v.lib, v.version))
+		}
+		return nil, requires, nil
+	}
+}
+
+type elfVersionNeed struct {
+	lib, version string
+}
+
+// elfVersionNeeds returns the symbol versions needed by e (.gnu.version_r).
+func elfVersionNeeds(e *elf.File) ([]elfVersionNeed, error) {
+	var needs []elfVersionNeed
+	for _, s := range e.Sections {
+		if s.Type != elf.SHT_GNU_VERNEED {
+			continue
+		}
+		data, strs, err := elfSectionStrings(e, s)
+		if err != nil {
+			return nil, err
+		}
+		bo := e.ByteOrder
+		for off := 0; off+16 <= len(data); {
+			// Elf_Verneed: version, cnt (uint16), file, aux, next (uint32)
+			cnt := int(bo.Uint16(data[off+2:]))
+			lib := elfString(strs, bo.Uint32(data[off+4:]))
+			aux := off + int(bo.Uint32(data[off+8:]))
+			next := int(bo.Uint32(data[off+12:]))
+			for i := 0; i < cnt && aux+16 <= len(data); i++ {
+				// Elf_Vernaux: hash (uint32), flags, other (uint16), name, next (uint32)
+				needs = append(needs, elfVersionNeed{lib: lib, version: elfString(strs, bo.Uint32(data[aux+8:]))})
+				auxNext := int(bo.Uint32(data[aux+12:]))
+				if auxNext == 0 {
+					break
+				}
+				aux += auxNext
+			}
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+	return needs, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testStrtab builds a string table, returning it and the offsets of the strings.
+func testStrtab(strs ...string) ([]byte, map[string]uint32) {
+	b := []byte{0}
+	offsets := map[string]uint32{}
+	for _, s := range strs {
+		offsets[s] = uint32(len(b))
+		b = append(append(b, s...), 0)
+	}
+	return b, offsets
+}
+
+func testDynamic(entries ...uint64) []byte {
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.LittleEndian, append(entries, uint64(elf.DT_NULL), 0))
+	return b.Bytes()
+}
+
+// testVerdef builds a .gnu.version_d section, the first version is the base version.
+func testVerdef(offsets []uint32) []byte {
+	b := &bytes.Buffer{}
+	for i, off := range offsets {
+		flags, next := uint16(0), uint32(28)
+		if i == 0 {
+			flags = verFlagBase
+		}
+		if i == len(offsets)-1 {
+			next = 0
+		}
+		binary.Write(b, binary.LittleEndian, []uint16{1, flags, uint16(i + 1), 1})
+		binary.Write(b, binary.LittleEndian, []uint32{0, 20, next, off, 0})
+	}
+	return b.Bytes()
+}
+
+func testSharedLibrary(t *testing.T) []byte {
+	t.Helper()
+	strs, off := testStrtab("libfoo.so.1", "FOO_1.0", "FOO_1.1")
+	return testELF(t, elf.EM_X86_64, elf.ET_DYN,
+		testSection{name: ".dynstr", typ: elf.SHT_STRTAB, flags: elf.SHF_ALLOC, data: strs},
+		testSection{name: ".dynamic", typ: elf.SHT_DYNAMIC, flags: elf.SHF_ALLOC, link: 1,
+			data: testDynamic(uint64(elf.DT_SONAME), uint64(off["libfoo.so.1"]))},
+		testSection{name: ".gnu.version_d", typ: elf.SHT_GNU_VERDEF, flags: elf.SHF_ALLOC, link: 1,
+			data: testVerdef([]uint32{off["libfoo.so.1"], off["FOO_1.0"], off["FOO_1.1"]})},
+	)
+}
+
+func TestELFProvides(t *testing.T) {
+	lib := testSharedLibrary(t)
+	testCases := []struct {
+		name    string
+		file    RPMFile
+		exclude []string
+		want    string
+	}{{
+		name: "shared library",
+		file: RPMFile{Name: "/usr/lib64/libfoo.so.1.2", Body: lib, Mode: 0100755},
+		want: "libfoo.so.1()(64bit),libfoo.so.1(FOO_1.0)(64bit),libfoo.so.1(FOO_1.1)(64bit)",
+	}, {
+		name: "not executable",
+		file: RPMFile{Name: "/usr/lib64/libfoo.so.1.2", Body: lib, Mode: 0100644},
+	}, {
+		name:    "excluded",
+		file:    RPMFile{Name: "/usr/lib64/plugins/libfoo.so.1.2", Body: lib, Mode: 0100755},
+		exclude: []string{"/usr/lib64/plugins/*"},
+	}, {
+		name: "not an ELF file",
+		file: RPMFile{Name: "/usr/bin/script", Body: []byte("#!/bin/sh\n"), Mode: 0100755},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			provides, requires, err := ELFProvides(tc.exclude...)(tc.file)
+			if err != nil {
+				t.Fatalf("ELFProvides returned error %v", err)
+			}
+			if got := provides.String(); got != tc.want {
+				t.Errorf("ELFProvides provides = %q, want %q", got, tc.want)
+			}
+			if len(requires) != 0 {
+				t.Errorf("ELFProvides returned requires %q", requires.String())
+			}
+		})
+	}
+}
+
+func TestDependencyGenerator(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "foo", Version: "1.2"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/lib64/libfoo.so.1.2", Body: testSharedLibrary(t), Mode: 0100755})
+	r.AddDependencyGenerator(ELFProvides())
+	if err := r.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if got := r.Provides.String(); !strings.Contains(got, "libfoo.so.1()(64bit)") {
+		t.Errorf("Provides = %q, want the soname provide", got)
+	}
+}
+
+// testVerneed builds a .gnu.version_r section for a single library.
+func testVerneed(lib uint32, versions []uint32) []byte {
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.LittleEndian, []uint16{1, uint16(len(versions))})
+	binary.Write(b, binary.LittleEndian, []uint32{lib, 16, 0})
+	for i, v := range versions {
+		next := uint32(16)
+		if i == len(versions)-1 {
+			next = 0
+		}
+		binary.Write(b, binary.LittleEndian, []uint32{0})
+		binary.Write(b, binary.LittleEndian, []uint16{0, uint16(i + 2)})
+		binary.Write(b, binary.LittleEndian, []uint32{v, next})
+	}
+	return b.Bytes()
+}
+
+func TestELFRequires(t *testing.T) {
+	strs, off := testStrtab("libc.so.6", "libfoo.so.1", "GLIBC_2.2.5", "GLIBC_2.34")
+	bin := testELF(t, elf.EM_X86_64, elf.ET_EXEC,
+		testSection{name: ".dynstr", typ: elf.SHT_STRTAB, flags: elf.SHF_ALLOC, data: strs},
+		testSection{name: ".dynamic", typ: elf.SHT_DYNAMIC, flags: elf.SHF_ALLOC, link: 1,
+			data: testDynamic(uint64(elf.DT_NEEDED), uint64(off["libc.so.6"]), uint64(elf.DT_NEEDED), uint64(off["libfoo.so.1"]))},
+		testSection{name: ".gnu.version_r", typ: elf.SHT_GNU_VERNEED, flags: elf.SHF_ALLOC, link: 1,
+			data: testVerneed(off["libc.so.6"], []uint32{off["GLIBC_2.2.5"], off["GLIBC_2.34"]})},
+	)
+	testCases := []struct {
+		name    string
+		file    RPMFile
+		exclude []string
+		want    string
+	}{{
+		name: "executable",
+		file: RPMFile{Name: "/usr/bin/foo", Body: bin, Mode: 0100755},
+		want: "libc.so.6()(64bit),libfoo.so.1()(64bit),libc.so.6(GLIBC_2.2.5)(64bit),libc.so.6(GLIBC_2.34)(64bit)",
+	}, {
+		name:    "excluded",
+		file:    RPMFile{Name: "/usr/bin/foo", Body: bin, Mode: 0100755},
+		exclude: []string{"/usr/bin/*"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			provides, requires, err := ELFRequires(tc.exclude...)(tc.file)
+			if err != nil {
+				t.Fatalf("ELFRequires returned error %v", err)
+			}
+			if got := requires.String(); got != tc.want {
+				t.Errorf("ELFRequires requires = %q, want %q", got, tc.want)
+			}
+			if len(provides) != 0 {
+				t.Errorf("ELFRequires returned provides %q", provides.String())
+			}
+		})
+	}
+}
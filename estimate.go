@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cavaliergopher/cpio"
+)
+
+const (
+	// estimateSampleSize is the size of the start of the payload which EstimateSize
+	// compresses to estimate the compression ratio of the whole payload.
+	estimateSampleSize = 1 << 20
+	// estimateSignatureSize is the size assumed for each OpenPGP signature, a bit more
+	// than an RSA 4096 signature.
+	estimateSignatureSize = 560
+)
+
+// EstimateSize estimates the size in bytes of the rpm before it is written, e.g. to
+// reject an oversized package before compressing all of it. The header is built like
+// Write does, so the dependency generators and the header hooks are run on a copy of
+// the rpm, and run again by Write. Only the first MiB of the payload is compressed and
+// the compression ratio is extrapolated to the rest. Signers are not called, a typical
+// signature size is assumed instead. The estimate is exact for unsigned rpms with a
+// payload smaller than a MiB, and once the rpm was written. The rpm itself is not
+// changed.
+func (r *RPM) EstimateSize() (int64, error) {
+	if r.headerBytes != nil {
+		return int64(leadSize + len(r.signatureBytes) + (8-len(r.signatureBytes)%8)%8 + len(r.headerBytes) + r.payload.Len()), nil
+	}
+	c, err := r.Clone()
+	if err != nil {
+		return 0, err
+	}
+	c.pgpSigner = nil
+	c.pgpReaderSigner = nil
+	c.pgpCoSigners = nil
+	sample := &bytes.Buffer{}
+	z, _, err := setupCompressor(r.compressorSetting, sample)
+	if err != nil {
+		return 0, err
+	}
+	s := &sampleWriter{w: z, limit: estimateSampleSize}
+	c.compressedPayload = z
+	c.archive = &countingWriter{w: s}
+	c.cpio = cpio.NewWriter(c.archive)
+	if err := c.finalize(); err != nil {
+		return 0, err
+	}
+
+	payload := int64(sample.Len())
+	if s.n > s.limit {
+		payload = payload * s.n / s.limit
+	}
+	var signatures int64
+	if r.pgpSigner != nil {
+		// The header and the header and payload signatures, and the base64 encoded
+		// OPENPGP signatures of the signer and co-signers, each with an index entry.
+		signatures = 2 * (estimateSignatureSize + 16)
+		if len(r.pgpCoSigners) > 0 {
+			signatures += int64(len(r.pgpCoSigners)+1)*(estimateSignatureSize*4/3+1) + 16
+		}
+	}
+	sigLen := int64(len(c.signatureBytes)) + signatures
+	return leadSize + sigLen + (8-sigLen%8)%8 + int64(len(c.headerBytes)) + payload, nil
+}
+
+// sampleWriter writes the first limit bytes to w, and counts all bytes written.
+type sampleWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (s *sampleWriter) Write(p []byte) (int, error) {
+	if rest := s.limit - s.n; rest > 0 {
+		q := p
+		if int64(len(q)) > rest {
+			q = q[:rest]
+		}
+		if _, err := s.w.Write(q); err != nil {
+			return 0, err
+		}
+	}
+	s.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestEstimateSize(t *testing.T) {
+	entity, err := openpgp.NewEntity("estimate", "", "estimate@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048})
+	if err != nil {
+		t.Fatalf("NewEntity returned error %v", err)
+	}
+	// Half of the large payload compresses well and half does not.
+	rnd := rand.New(rand.NewSource(1))
+	large := make(map[string][]byte)
+	for i := 0; i < 8; i++ {
+		body := make([]byte, 512<<10)
+		if i%2 == 0 {
+			rnd.Read(body)
+		}
+		large[fmt.Sprintf("/usr/share/estimate/%d", i)] = body
+	}
+
+	for _, tc := range []struct {
+		name     string
+		md       RPMMetaData
+		files    map[string][]byte
+		sign     bool
+		maxError int64
+	}{
+		{name: "small", md: RPMMetaData{Compressor: "gzip"}, files: map[string][]byte{"/etc/estimate.conf": []byte("a=1\n")}},
+		{name: "rpmbuild layout", md: RPMMetaData{Compressor: "xz", RPMBuildVersion: "4.18.0"}, files: map[string][]byte{"/etc/estimate.conf": []byte("a=1\n")}},
+		{name: "signed", md: RPMMetaData{Compressor: "zstd"}, files: map[string][]byte{"/etc/estimate.conf": []byte("a=1\n")}, sign: true, maxError: 2 * estimateSignatureSize},
+		{name: "large", md: RPMMetaData{Compressor: "gzip"}, files: large, maxError: 100 << 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.md.Name = "estimate"
+			tc.md.Version = "1.0"
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for name, body := range tc.files {
+				r.AddFile(RPMFile{Name: name, Body: body})
+			}
+			if tc.sign {
+				r.SetPGPSigner((&KeySigner{entity: entity}).Sign)
+			}
+			estimate, err := r.EstimateSize()
+			if err != nil {
+				t.Fatalf("EstimateSize returned error %v", err)
+			}
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+				t.Errorf("VerifyDigests after EstimateSize returned error %v", err)
+			}
+			size := int64(b.Len())
+			if estimate-size > tc.maxError || size-estimate > tc.maxError {
+				t.Errorf("EstimateSize returned %d, the rpm has %d bytes", estimate, size)
+			}
+			if written, err := r.EstimateSize(); err != nil || written != size {
+				t.Errorf("EstimateSize of the written rpm returned %d, %v, want %d", written, err, size)
+			}
+		})
+	}
+}
+
+func TestEstimateSizeHooks(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "estimate", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/estimate", Body: []byte("binary")})
+	var generated, hooked int
+	r.AddDependencyGenerator(func(f RPMFile) (Relations, Relations, error) {
+		generated++
+		return nil, Relations{{Name: "libestimate.so"}}, nil
+	})
+	r.AddHeaderHook(func(entries map[int]IndexEntry, signature bool) error {
+		if !signature {
+			hooked++
+		}
+		return nil
+	})
+	if _, err := r.EstimateSize(); err != nil {
+		t.Fatalf("EstimateSize returned error %v", err)
+	}
+	if generated != 1 || hooked != 1 {
+		t.Errorf("EstimateSize ran the generator %d times and the hook %d times, want 1 and 1", generated, hooked)
+	}
+	if len(r.Requires) != 0 {
+		t.Errorf("EstimateSize added requires %v to the rpm", r.Requires)
+	}
+	if err := r.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if generated != 2 || hooked != 2 {
+		t.Errorf("Write ran the generator %d times and the hook %d times, want 2 and 2", generated, hooked)
+	}
+}
@@ -1,5 +1,11 @@
 package rpmpack
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // FileType is the type of a file inside a RPM package.
 type FileType int32
 
@@ -35,13 +41,89 @@ const (
 	ExcludeFile
 )
 
+// ErrUnknownFileType is returned when parsing an unknown file type name.
+var ErrUnknownFileType = errors.New("unknown file type")
+
+var fileTypeNames = []struct {
+	t    FileType
+	name string
+}{
+	{ConfigFile, "config"},
+	{DocFile, "doc"},
+	{DoNotUseFile, "donotuse"},
+	{MissingOkFile, "missingok"},
+	{NoReplaceFile, "noreplace"},
+	{SpecFile, "spec"},
+	{GhostFile, "ghost"},
+	{LicenceFile, "licence"},
+	{ReadmeFile, "readme"},
+	{ExcludeFile, "exclude"},
+}
+
+// String returns the comma separated names of the flags of the FileType, e.g. "config,noreplace".
+func (t FileType) String() string {
+	var names []string
+	for _, n := range fileTypeNames {
+		if t&n.t != 0 {
+			names = append(names, n.name)
+			t &^= n.t
+		}
+	}
+	if t != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(t)))
+	}
+	return strings.Join(names, ",")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t FileType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts the format of String.
+func (t *FileType) UnmarshalText(text []byte) error {
+	ft, err := ParseFileType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = ft
+	return nil
+}
+
+// ParseFileType parses a comma separated list of file type names, e.g. "config,noreplace".
+// "license" is accepted as an alias of "licence".
+func ParseFileType(s string) (FileType, error) {
+	var t FileType
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "license" {
+			name = "licence"
+		}
+		found := false
+		for _, n := range fileTypeNames {
+			if n.name == name {
+				t |= n.t
+				found = true
+				break
+			}
+		}
+		if !found {
+			return GenericFile, fmt.Errorf("%w: %q", ErrUnknownFileType, name)
+		}
+	}
+	return t, nil
+}
+
 // RPMFile contains a particular file's entry and data.
 type RPMFile struct {
-	Name  string
-	Body  []byte
-	Mode  uint
-	Owner string
-	Group string
-	MTime uint32
-	Type  FileType
+	Name  string   `json:"name"`
+	Body  []byte   `json:"body,omitempty"`
+	Mode  uint     `json:"mode,omitempty"`
+	Owner string   `json:"owner,omitempty"`
+	Group string   `json:"group,omitempty"`
+	MTime uint32   `json:"mtime,omitempty"`
+	Type  FileType `json:"type,omitempty"`
 }
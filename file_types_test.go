@@ -1,6 +1,7 @@
 package rpmpack
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -26,3 +27,35 @@ func TestFileTypeCombining(t *testing.T) {
 		t.Error("Combining file types should have the bitmask of both")
 	}
 }
+
+func TestParseFileType(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    FileType
+		wantErr bool
+	}{
+		{input: "", want: GenericFile},
+		{input: "config", want: ConfigFile},
+		{input: "config,noreplace", want: ConfigFile | NoReplaceFile},
+		{input: "Doc, License", want: DocFile | LicenceFile},
+		{input: "ghost,bogus", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseFileType(tc.input)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseFileType(%q) returned error %v, want error %v", tc.input, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr && !errors.Is(err, ErrUnknownFileType) {
+			t.Errorf("ParseFileType(%q) returned error %v, want %v", tc.input, err, ErrUnknownFileType)
+		}
+		if got != tc.want {
+			t.Errorf("ParseFileType(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+		if !tc.wantErr {
+			if back, _ := ParseFileType(got.String()); back != got {
+				t.Errorf("ParseFileType(%q.String()) = %v, want %v", got, back, got)
+			}
+		}
+	}
+}
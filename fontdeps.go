@@ -0,0 +1,240 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+// fontLangs approximates the fontconfig orthographies: a font provides a language
+// if it covers all of its runes.
+var fontLangs = []struct {
+	lang  string
+	runes []rune
+}{
+	{"en", runeRanges('A', 'Z', 'a', 'z')},
+	{"de", append(runeRanges('A', 'Z', 'a', 'z'), []rune("ÄÖÜäöüß")...)},
+	{"fr", append(runeRanges('A', 'Z', 'a', 'z'), []rune("ÀÂÆÇÉÈÊËÎÏÔŒÙÛÜŸàâæçéèêëîïôœùûüÿ")...)},
+	{"es", append(runeRanges('A', 'Z', 'a', 'z'), []rune("ÁÉÍÑÓÚÜáéíñóúü¡¿")...)},
+	{"ru", append(runeRanges('А', 'я'), 'Ё', 'ё')},
+	{"el", runeRanges('Α', 'Ρ', 'Σ', 'Ω', 'α', 'ω')},
+	{"he", runeRanges('א', 'ת')},
+	{"ar", runeRanges('ء', 'غ', 'ف', 'ي')},
+}
+
+func runeRanges(bounds ...rune) []rune {
+	var runes []rune
+	for i := 0; i+1 < len(bounds); i += 2 {
+		for r := bounds[i]; r <= bounds[i+1]; r++ {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+// FontProvides returns a DependencyGenerator for TrueType and OpenType fonts (*.ttf, *.otf),
+// like the fontconfig generator of Fedora. Each font provides "font(family)" for its family
+// names (lower case, without spaces) and "font(:lang=xx)" for the languages it covers.
+// Language coverage is checked against a small built-in set of languages
+// (en, de, fr, es, ru, el, he and ar) rather than the full fontconfig orthographies.
+// Files matching one of the exclude patterns (see path.Match) are skipped.
+func FontProvides(exclude ...string) DependencyGenerator {
+	return func(f RPMFile) (Relations, Relations, error) {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if (ext != ".ttf" && ext != ".otf") || excludedPath(f.Name, exclude) {
+			return nil, nil, nil
+		}
+		font, err := parseSFNT(f.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse font: %w", err)
+		}
+		var provides Relations
+		for _, family := range font.families {
+			provides.addIfMissing(&Relation{Name: fmt.Sprintf("font(%s)", strings.ToLower(strings.ReplaceAll(family, " ", "")))})
+		}
+	langs:
+		for _, l := range fontLangs {
+			for _, r := range l.runes {
+				if !font.covers(r) {
+					continue langs
+				}
+			}
+			provides.addIfMissing(&Relation{Name: fmt.Sprintf("font(:lang=%s)", l.lang)})
+		}
+		return provides, nil, nil
+	}
+}
+
+var errBadSFNT = errors.New("truncated or invalid sfnt data")
+
+// sfnt holds the parts of a TrueType or OpenType font relevant for its provides.
+type sfnt struct {
+	families []string
+	// cmap ranges, pairs of first and last rune.
+	ranges []rune
+}
+
+func (s *sfnt) covers(r rune) bool {
+	for i := 0; i+1 < len(s.ranges); i += 2 {
+		if r >= s.ranges[i] && r <= s.ranges[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSFNT(b []byte) (*sfnt, error) {
+	if len(b) < 12 {
+		return nil, errBadSFNT
+	}
+	tables := map[string][]byte{}
+	n := int(binary.BigEndian.Uint16(b[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(b) {
+			return nil, errBadSFNT
+		}
+		off := int(binary.BigEndian.Uint32(b[rec+8:]))
+		length := int(binary.BigEndian.Uint32(b[rec+12:]))
+		if off < 0 || length < 0 || off+length > len(b) {
+			return nil, errBadSFNT
+		}
+		tables[string(b[rec:rec+4])] = b[off : off+length]
+	}
+	s := &sfnt{}
+	var err error
+	if s.families, err = sfntFamilies(tables["name"]); err != nil {
+		return nil, err
+	}
+	if s.ranges, err = sfntRanges(tables["cmap"]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sfntFamilies returns the typographic (16) and legacy (1) family names of the name table.
+func sfntFamilies(t []byte) ([]string, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	if len(t) < 6 {
+		return nil, errBadSFNT
+	}
+	count := int(binary.BigEndian.Uint16(t[2:]))
+	strOff := int(binary.BigEndian.Uint16(t[4:]))
+	byID := map[uint16][]string{}
+	for i := 0; i < count; i++ {
+		rec := 6 + 12*i
+		if rec+12 > len(t) {
+			return nil, errBadSFNT
+		}
+		platform := binary.BigEndian.Uint16(t[rec:])
+		lang := binary.BigEndian.Uint16(t[rec+4:])
+		id := binary.BigEndian.Uint16(t[rec+6:])
+		length := int(binary.BigEndian.Uint16(t[rec+8:]))
+		off := strOff + int(binary.BigEndian.Uint16(t[rec+10:]))
+		if id != 1 && id != 16 {
+			continue
+		}
+		if off+length > len(t) {
+			return nil, errBadSFNT
+		}
+		raw := t[off : off+length]
+		var name string
+		switch {
+		case platform == 0 || platform == 3:
+			u := make([]uint16, len(raw)/2)
+			for j := range u {
+				u[j] = binary.BigEndian.Uint16(raw[2*j:])
+			}
+			name = string(utf16.Decode(u))
+		case platform == 1 && lang == 0:
+			name = string(raw)
+		default:
+			continue
+		}
+		byID[id] = append(byID[id], name)
+	}
+	return append(byID[16], byID[1]...), nil
+}
+
+// sfntRanges returns the rune ranges of the best unicode subtable of the cmap table.
+// Only formats 4 and 12 are supported.
+func sfntRanges(t []byte) ([]rune, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	if len(t) < 4 {
+		return nil, errBadSFNT
+	}
+	best, bestOff := -1, 0
+	for i := 0; i < int(binary.BigEndian.Uint16(t[2:])); i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(t) {
+			return nil, errBadSFNT
+		}
+		platform := binary.BigEndian.Uint16(t[rec:])
+		encoding := binary.BigEndian.Uint16(t[rec+2:])
+		off := int(binary.BigEndian.Uint32(t[rec+4:]))
+		if off+2 > len(t) {
+			return nil, errBadSFNT
+		}
+		format := int(binary.BigEndian.Uint16(t[off:]))
+		if (platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10))) || (format != 4 && format != 12) {
+			continue
+		}
+		if format > best {
+			best, bestOff = format, off
+		}
+	}
+	sub := t[bestOff:]
+	var ranges []rune
+	switch best {
+	case 4:
+		if len(sub) < 14 {
+			return nil, errBadSFNT
+		}
+		segs := int(binary.BigEndian.Uint16(sub[6:])) / 2
+		if len(sub) < 16+4*segs {
+			return nil, errBadSFNT
+		}
+		for i := 0; i < segs; i++ {
+			end := rune(binary.BigEndian.Uint16(sub[14+2*i:]))
+			start := rune(binary.BigEndian.Uint16(sub[16+2*segs+2*i:]))
+			if start == 0xffff {
+				continue
+			}
+			ranges = append(ranges, start, end)
+		}
+	case 12:
+		if len(sub) < 16 {
+			return nil, errBadSFNT
+		}
+		groups := int(binary.BigEndian.Uint32(sub[12:]))
+		if groups < 0 || len(sub) < 16+12*groups {
+			return nil, errBadSFNT
+		}
+		for i := 0; i < groups; i++ {
+			g := sub[16+12*i:]
+			ranges = append(ranges, rune(binary.BigEndian.Uint32(g)), rune(binary.BigEndian.Uint32(g[4:])))
+		}
+	}
+	return ranges, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// testFont builds a minimal sfnt with a name table holding family and a
+// format 4 cmap table covering the given ranges.
+func testFont(family string, ranges ...uint16) []byte {
+	be := binary.BigEndian
+	name := &bytes.Buffer{}
+	fam := utf16.Encode([]rune(family))
+	binary.Write(name, be, []uint16{0, 1, 18})
+	binary.Write(name, be, []uint16{3, 1, 0x409, 1, uint16(2 * len(fam)), 0})
+	binary.Write(name, be, fam)
+
+	ranges = append(ranges, 0xffff, 0xffff)
+	segs := len(ranges) / 2
+	sub := &bytes.Buffer{}
+	binary.Write(sub, be, []uint16{4, uint16(16 + 8*segs), 0, uint16(2 * segs), 0, 0, 0})
+	for i := 0; i < segs; i++ {
+		binary.Write(sub, be, ranges[2*i+1])
+	}
+	binary.Write(sub, be, uint16(0))
+	for i := 0; i < segs; i++ {
+		binary.Write(sub, be, ranges[2*i])
+	}
+	binary.Write(sub, be, make([]uint16, 2*segs))
+	cmap := &bytes.Buffer{}
+	binary.Write(cmap, be, []uint16{0, 1, 3, 1})
+	binary.Write(cmap, be, uint32(12))
+	cmap.Write(sub.Bytes())
+
+	b := &bytes.Buffer{}
+	binary.Write(b, be, []uint32{0x00010000})
+	binary.Write(b, be, []uint16{2, 0, 0, 0})
+	off := uint32(12 + 2*16)
+	b.WriteString("cmap")
+	binary.Write(b, be, []uint32{0, off, uint32(cmap.Len())})
+	b.WriteString("name")
+	binary.Write(b, be, []uint32{0, off + uint32(cmap.Len()), uint32(name.Len())})
+	b.Write(cmap.Bytes())
+	b.Write(name.Bytes())
+	return b.Bytes()
+}
+
+func TestFontProvides(t *testing.T) {
+	font := testFont("DejaVu Sans", 0x20, 0x7e, 0xc0, 0x17f)
+	testCases := []struct {
+		name    string
+		file    RPMFile
+		exclude []string
+		want    string
+	}{{
+		name: "ttf",
+		file: RPMFile{Name: "/usr/share/fonts/dejavu/DejaVuSans.ttf", Body: font, Mode: 0100644},
+		want: "font(dejavusans),font(:lang=en),font(:lang=de),font(:lang=fr)",
+	}, {
+		name: "not a font",
+		file: RPMFile{Name: "/usr/share/fonts/dejavu/README", Body: font, Mode: 0100644},
+	}, {
+		name:    "excluded",
+		file:    RPMFile{Name: "/usr/share/fonts/dejavu/DejaVuSans.ttf", Body: font, Mode: 0100644},
+		exclude: []string{"/usr/share/fonts/*/*"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			provides, _, err := FontProvides(tc.exclude...)(tc.file)
+			if err != nil {
+				t.Fatalf("FontProvides returned error %v", err)
+			}
+			if got := provides.String(); got != tc.want {
+				t.Errorf("FontProvides provides = %q, want %q", got, tc.want)
+			}
+		})
+	}
+	if _, _, err := FontProvides()(RPMFile{Name: "/a.ttf", Body: []byte("bad")}); err == nil {
+		t.Errorf("FontProvides should have returned an error on a truncated font")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedFormat is returned by NewRPM for a PackageFormat other than 4 or 6.
+var ErrUnsupportedFormat = errors.New("unsupported package format")
+
+// checkPackageFormat checks that the package format is supported, and consistent with
+// the rpmbuild layout.
+func checkPackageFormat(m RPMMetaData) error {
+	switch m.PackageFormat {
+	case 0, 4:
+		return nil
+	case 6:
+		if m.NoPayloadDigest {
+			return fmt.Errorf("%w: v6 packages require the payload digest", ErrUnsupportedFormat)
+		}
+		if m.RPMBuildVersion != "" && rpmvercmp(m.RPMBuildVersion, "6") < 0 {
+			return fmt.Errorf("%w: rpmbuild %s does not write v6 packages", ErrUnsupportedFormat, m.RPMBuildVersion)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w %d, use 4 or 6", ErrUnsupportedFormat, m.PackageFormat)
+}
+
+// writeFormatIndexes adds the header tags of the v6 format.
+func (r *RPM) writeFormatIndexes(h *index) {
+	h.Add(tagRPMFormat, EntryInt32([]int32{6}))
+	h.Add(tagPayloadDigestAlt, EntryStringSlice([]string{fmt.Sprintf("%x", r.uncompressedPayload.Sum(nil))}))
+}
+
+// Format returns the version of the package format, 6 for packages with the RPMFORMAT tag
+// of rpm 6, and 4 otherwise.
+func (pkg *Package) Format() int {
+	if v, err := pkg.Header.Int32s(tagRPMFormat); err == nil && len(v) == 1 {
+		return int(v[0])
+	}
+	return 4
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestPackageFormat(t *testing.T) {
+	for _, format := range []int{0, 4, 6} {
+		t.Run(fmt.Sprint(format), func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "format", Version: "1.0", PackageFormat: format})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/format", Body: []byte("content")})
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+				t.Errorf("VerifyDigests returned error %v", err)
+			}
+			pkg, err := ReadPackage(&b)
+			if err != nil {
+				t.Fatalf("ReadPackage returned error %v", err)
+			}
+			want := format
+			if want == 0 {
+				want = 4
+			}
+			if got := pkg.Format(); got != want {
+				t.Errorf("Format returned %d, want %d", got, want)
+			}
+			alt, err := pkg.Header.Strings(tagPayloadDigestAlt)
+			if format != 6 {
+				if !errors.Is(err, ErrTagNotFound) {
+					t.Errorf("a v4 package has PAYLOADDIGESTALT %v", alt)
+				}
+				return
+			}
+			z, err := pkg.PayloadReader()
+			if err != nil {
+				t.Fatalf("PayloadReader returned error %v", err)
+			}
+			defer z.Close()
+			h := sha256.New()
+			if _, err := io.Copy(h, z); err != nil {
+				t.Fatalf("reading the payload returned error %v", err)
+			}
+			if wantAlt := fmt.Sprintf("%x", h.Sum(nil)); len(alt) != 1 || alt[0] != wantAlt {
+				t.Errorf("PAYLOADDIGESTALT is %v, want %s", alt, wantAlt)
+			}
+		})
+	}
+
+	for _, md := range []RPMMetaData{
+		{Name: "format", Version: "1.0", PackageFormat: 5},
+		{Name: "format", Version: "1.0", PackageFormat: 6, RPMBuildVersion: "4.19.1"},
+		{Name: "format", Version: "1.0", PackageFormat: 6, NoPayloadDigest: true},
+	} {
+		if _, err := NewRPM(md); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("NewRPM with format %d and rpmbuild %q returned %v, want ErrUnsupportedFormat", md.PackageFormat, md.RPMBuildVersion, err)
+		}
+	}
+}
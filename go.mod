@@ -3,9 +3,18 @@ module github.com/google/rpmpack
 go 1.18
 
 require (
+	github.com/ProtonMail/go-crypto v1.0.0
 	github.com/cavaliergopher/cpio v1.0.1
-	github.com/google/go-cmp v0.3.1
+	github.com/google/go-cmp v0.5.9
 	github.com/klauspost/compress v1.16.6
 	github.com/klauspost/pgzip v1.2.6
 	github.com/ulikunitz/xz v0.5.11
+	github.com/yuin/gopher-lua v1.1.1
+	sigs.k8s.io/yaml v1.4.0
+)
+
+require (
+	github.com/cloudflare/circl v1.3.3 // indirect
+	golang.org/x/crypto v0.7.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
 )
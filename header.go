@@ -15,8 +15,8 @@
 package rpmpack
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sort"
 )
@@ -25,18 +25,32 @@ const (
 	signatures = 0x3e
 	immutable  = 0x3f
 
+	typeChar        = 0x01
+	typeInt8        = 0x02
 	typeInt16       = 0x03
 	typeInt32       = 0x04
+	typeInt64       = 0x05
 	typeString      = 0x06
 	typeBinary      = 0x07
 	typeStringArray = 0x08
+	typeI18NString  = 0x09
+
+	// The limits rpm enforces when reading a header, see hdrblobRead in rpm's header.c.
+	headerMaxTags    = 0xffff
+	headerMaxData    = 0x0fffffff
+	signatureMaxTags = 32
+	signatureMaxData = 64 << 20
 )
 
+// ErrHeaderTooLarge is returned when a header has more entries or data than rpm reads.
+var ErrHeaderTooLarge = errors.New("header too large")
+
 // Only integer types are aligned. This is not just an optimization - some versions
 // of rpm fail when integers are not aligned. Other versions fail when non-integers are aligned.
 var boundaries = map[int]int{
 	typeInt16: 2,
 	typeInt32: 4,
+	typeInt64: 8,
 }
 
 type IndexEntry struct {
@@ -45,51 +59,88 @@ type IndexEntry struct {
 }
 
 func (e IndexEntry) indexBytes(tag, contentOffset int) []byte {
-	b := &bytes.Buffer{}
-	if err := binary.Write(b, binary.BigEndian, []int32{int32(tag), int32(e.rpmtype), int32(contentOffset), int32(e.count)}); err != nil {
-		// binary.Write can fail if the underlying Write fails, or the types are invalid.
-		// bytes.Buffer's write never error out, it can only panic with OOM.
-		panic(err)
-	}
-	return b.Bytes()
+	b := make([]byte, 16)
+	putIndexEntry(b, tag, e.rpmtype, contentOffset, e.count)
+	return b
 }
 
-func intEntry(rpmtype, size int, value interface{}) IndexEntry {
-	b := &bytes.Buffer{}
-	if err := binary.Write(b, binary.BigEndian, value); err != nil {
-		// binary.Write can fail if the underlying Write fails, or the types are invalid.
-		// bytes.Buffer's write never error out, it can only panic with OOM.
-		panic(err)
-	}
-	return IndexEntry{rpmtype, size, b.Bytes()}
+// putIndexEntry writes a 16 byte index entry to the start of b.
+func putIndexEntry(b []byte, tag, rpmtype, offset, count int) {
+	binary.BigEndian.PutUint32(b, uint32(tag))
+	binary.BigEndian.PutUint32(b[4:], uint32(rpmtype))
+	binary.BigEndian.PutUint32(b[8:], uint32(offset))
+	binary.BigEndian.PutUint32(b[12:], uint32(count))
 }
 
+// The integer entries are encoded directly instead of through binary.Write, which
+// allocates an intermediate buffer for every slice. Packages with many files have
+// several of those entries with one value per file.
+
 func EntryInt16(value []int16) IndexEntry {
-	return intEntry(typeInt16, len(value), value)
+	b := make([]byte, 2*len(value))
+	for i, v := range value {
+		binary.BigEndian.PutUint16(b[2*i:], uint16(v))
+	}
+	return IndexEntry{typeInt16, len(value), b}
 }
 func EntryUint16(value []uint16) IndexEntry {
-	return intEntry(typeInt16, len(value), value)
+	b := make([]byte, 2*len(value))
+	for i, v := range value {
+		binary.BigEndian.PutUint16(b[2*i:], v)
+	}
+	return IndexEntry{typeInt16, len(value), b}
 }
 func EntryInt32(value []int32) IndexEntry {
-	return intEntry(typeInt32, len(value), value)
+	b := make([]byte, 4*len(value))
+	for i, v := range value {
+		binary.BigEndian.PutUint32(b[4*i:], uint32(v))
+	}
+	return IndexEntry{typeInt32, len(value), b}
 }
 func EntryUint32(value []uint32) IndexEntry {
-	return intEntry(typeInt32, len(value), value)
+	b := make([]byte, 4*len(value))
+	for i, v := range value {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return IndexEntry{typeInt32, len(value), b}
+}
+func EntryInt64(value []int64) IndexEntry {
+	b := make([]byte, 8*len(value))
+	for i, v := range value {
+		binary.BigEndian.PutUint64(b[8*i:], uint64(v))
+	}
+	return IndexEntry{typeInt64, len(value), b}
 }
 func EntryString(value string) IndexEntry {
 	return IndexEntry{typeString, 1, append([]byte(value), byte(00))}
 }
+
+// entryI18NString is a string in the "C" locale of the HEADERI18NTABLE, as rpmbuild
+// writes the summary, description and group.
+func entryI18NString(value string) IndexEntry {
+	return IndexEntry{typeI18NString, 1, append([]byte(value), byte(00))}
+}
 func EntryBytes(value []byte) IndexEntry {
 	return IndexEntry{typeBinary, len(value), value}
 }
 
 func EntryStringSlice(value []string) IndexEntry {
-	b := [][]byte{}
-	for _, v := range value {
-		b = append(b, []byte(v))
+	size := 1
+	for i, v := range value {
+		if i > 0 {
+			size++
+		}
+		size += len(v)
+	}
+	b := make([]byte, 0, size)
+	for i, v := range value {
+		if i > 0 {
+			b = append(b, 00)
+		}
+		b = append(b, v...)
 	}
-	bb := append(bytes.Join(b, []byte{00}), byte(00))
-	return IndexEntry{typeStringArray, len(value), bb}
+	b = append(b, 00)
+	return IndexEntry{typeStringArray, len(value), b}
 }
 
 type index struct {
@@ -110,7 +161,7 @@ func (i *index) AddEntries(m map[int]IndexEntry) {
 }
 
 func (i *index) sortedTags() []int {
-	t := []int{}
+	t := make([]int, 0, len(i.entries))
 	for k := range i.entries {
 		t = append(t, k)
 	}
@@ -118,50 +169,73 @@ func (i *index) sortedTags() []int {
 	return t
 }
 
-func pad(w *bytes.Buffer, rpmtype, offset int) {
-	// We need to align integer entries...
-	if b, ok := boundaries[rpmtype]; ok && offset%b != 0 {
-		if _, err := w.Write(make([]byte, b-offset%b)); err != nil {
-			// binary.Write can fail if the underlying Write fails, or the types are invalid.
-			// bytes.Buffer's write never error out, it can only panic with OOM.
-			panic(err)
+// layout returns the sorted tags, the offset of each entry in the data region and the
+// length of the data region, including the alignment padding and the eigenHeader.
+func (i *index) layout() (tags, offsets []int, dataLen int) {
+	tags = i.sortedTags()
+	offsets = make([]int, len(tags))
+	for ii, tag := range tags {
+		e := i.entries[tag]
+		// We need to align integer entries...
+		if b, ok := boundaries[e.rpmtype]; ok && dataLen%b != 0 {
+			dataLen += b - dataLen%b
 		}
+		offsets[ii] = dataLen
+		dataLen += len(e.data)
 	}
+	return tags, offsets, dataLen + 0x10
+}
+
+// Len returns the length of the serialized index, which is the length of the slice
+// returned by Bytes.
+func (i *index) Len() int {
+	_, _, dataLen := i.layout()
+	return 0x10 + 0x10*(len(i.entries)+1) + dataLen
 }
 
 // Bytes returns the bytes of the index.
 func (i *index) Bytes() ([]byte, error) {
-	w := &bytes.Buffer{}
 	// Even the header has three parts: The lead, the index entries, and the entries.
-	// Because of alignment, we can only tell the actual size and offset after writing
-	// the entries.
-	entryData := &bytes.Buffer{}
-	tags := i.sortedTags()
-	offsets := make([]int, len(tags))
-	for ii, tag := range tags {
-		e := i.entries[tag]
-		pad(entryData, e.rpmtype, entryData.Len())
-		offsets[ii] = entryData.Len()
-		entryData.Write(e.data)
+	// The offsets and the size of the entries are computed upfront, so everything is
+	// written in a single pass to a buffer of the final size.
+	tags, offsets, dataLen := i.layout()
+	if err := i.checkLimits(dataLen); err != nil {
+		return nil, err
 	}
-	entryData.Write(i.eigenHeader().data)
-
+	n := len(i.entries) + 1 // with the pseudo-entry "eigenHeader"
+	b := make([]byte, 0x10+0x10*n+dataLen)
 	// 4 magic and 4 reserved
-	w.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	copy(b, []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
 	// 4 count and 4 size
-	// We add the pseudo-entry "eigenHeader" to count.
-	if err := binary.Write(w, binary.BigEndian, []int32{int32(len(i.entries)) + 1, int32(entryData.Len())}); err != nil {
-		return nil, fmt.Errorf("failed to write eigenHeader: %w", err)
-	}
-	// Write the eigenHeader index entry
-	w.Write(i.eigenHeader().indexBytes(i.h, entryData.Len()-0x10))
-	// Write all of the other index entries
+	binary.BigEndian.PutUint32(b[8:], uint32(n))
+	binary.BigEndian.PutUint32(b[12:], uint32(dataLen))
+	// The eigenHeader index entry, followed by all of the other index entries.
+	putIndexEntry(b[0x10:], i.h, typeBinary, dataLen-0x10, 0x10)
+	data := b[0x10+0x10*n:]
 	for ii, tag := range tags {
 		e := i.entries[tag]
-		w.Write(e.indexBytes(tag, offsets[ii]))
+		putIndexEntry(b[0x10+0x10*(ii+1):], tag, e.rpmtype, offsets[ii], e.count)
+		copy(data[offsets[ii]:], e.data)
 	}
-	w.Write(entryData.Bytes())
-	return w.Bytes(), nil
+	copy(data[dataLen-0x10:], i.eigenHeader().data)
+	return b, nil
+}
+
+// checkLimits checks the number of entries and the data size against the limits of rpm,
+// which are lower for the signature header.
+func (i *index) checkLimits(dataLen int) error {
+	what, maxTags, maxData := "header", headerMaxTags, headerMaxData
+	if i.h == signatures {
+		what, maxTags, maxData = "signature header", signatureMaxTags, signatureMaxData
+	}
+	// The eigenHeader counts as an entry.
+	if n := len(i.entries) + 1; n > maxTags {
+		return fmt.Errorf("%w: the %s has %d entries, rpm reads at most %d", ErrHeaderTooLarge, what, n, maxTags)
+	}
+	if dataLen > maxData {
+		return fmt.Errorf("%w: the %s has %d bytes of data, rpm reads at most %d", ErrHeaderTooLarge, what, dataLen, maxData)
+	}
+	return nil
 }
 
 // the eigenHeader is a weird entry. Its index entry is sorted first, but its content
@@ -170,20 +244,15 @@ func (i *index) Bytes() ([]byte, error) {
 // Which is always 0x10 * number of entries.
 // I kid you not.
 func (i *index) eigenHeader() IndexEntry {
-	b := &bytes.Buffer{}
-	if err := binary.Write(b, binary.BigEndian, []int32{int32(i.h), int32(typeBinary), -int32(0x10 * (len(i.entries) + 1)), int32(0x10)}); err != nil {
-		// binary.Write can fail if the underlying Write fails, or the types are invalid.
-		// bytes.Buffer's write never error out, it can only panic with OOM.
-		panic(err)
-	}
-
-	return EntryBytes(b.Bytes())
+	b := make([]byte, 0x10)
+	putIndexEntry(b, i.h, typeBinary, -0x10*(len(i.entries)+1), 0x10)
+	return EntryBytes(b)
 }
 
-func lead(name, fullVersion string) []byte {
+func lead(name, fullVersion string, source bool) []byte {
 	// RPM format = 0xedabeedb
 	// version 3.0 = 0x0300
-	// type binary = 0x0000
+	// type binary = 0x0000, type source = 0x0001
 	// machine archnum (i386?) = 0x0001
 	// name ( 66 bytes, with null termination)
 	// osnum (linux?) = 0x0001
@@ -195,6 +264,9 @@ func lead(name, fullVersion string) []byte {
 	}
 	n = append(n, make([]byte, 66-len(n))...)
 	b := []byte{0xed, 0xab, 0xee, 0xdb, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01}
+	if source {
+		b[7] = 0x01
+	}
 	b = append(b, n...)
 	b = append(b, []byte{0x00, 0x01, 0x00, 0x05}...)
 	b = append(b, make([]byte, 16)...)
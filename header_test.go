@@ -15,6 +15,7 @@
 package rpmpack
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -32,7 +33,7 @@ func TestLead(t *testing.T) {
 		"abcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabc",
 	}
 	for _, n := range names {
-		if got := len(lead(n, "1-2")); got != 0x60 {
+		if got := len(lead(n, "1-2", false)); got != 0x60 {
 			t.Errorf("len(lead(%s)) = %#x, want %#x", n, got, 0x60)
 		}
 	}
@@ -67,6 +68,27 @@ func TestEntry(t *testing.T) {
 		offset:         0x222,
 		wantIndexBytes: "0000010f000000080000022200000002",
 		wantData:       "737472696e6700617272617900",
+	}, {
+		name:           "empty string array",
+		value:          []string{},
+		tag:            0x0110,
+		offset:         0x10,
+		wantIndexBytes: "00000110000000080000001000000000",
+		wantData:       "00",
+	}, {
+		name:           "int16 array",
+		value:          []int16{1, -2},
+		tag:            0x0111,
+		offset:         0x20,
+		wantIndexBytes: "00000111000000030000002000000002",
+		wantData:       "0001fffe",
+	}, {
+		name:           "int64 array",
+		value:          []int64{0x100000000, -1},
+		tag:            0x0112,
+		offset:         0x30,
+		wantIndexBytes: "00000112000000050000003000000002",
+		wantData:       "0000000100000000ffffffffffffffff",
 	}}
 	for _, tc := range testCases {
 		tc := tc
@@ -77,8 +99,12 @@ func TestEntry(t *testing.T) {
 				e = EntryStringSlice(v)
 			case string:
 				e = EntryString(v)
+			case []int16:
+				e = EntryInt16(v)
 			case []int32:
 				e = EntryInt32(v)
+			case []int64:
+				e = EntryInt64(v)
 			}
 			gotBytes := e.indexBytes(tc.tag, tc.offset)
 			if d := cmp.Diff(tc.wantIndexBytes, fmt.Sprintf("%x", gotBytes)); d != "" {
@@ -111,4 +137,41 @@ func TestIndex(t *testing.T) {
 	if d := cmp.Diff(want, fmt.Sprintf("%x", got)); d != "" {
 		t.Errorf("i.Bytes() unexpected value (want-> got): \n%s", d)
 	}
+	if i.Len() != len(got) {
+		t.Errorf("i.Len() = %d, want %d", i.Len(), len(got))
+	}
+}
+
+func TestIndexLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		h       int
+		entries int
+		data    int
+		wantErr bool
+	}{
+		{name: "header", h: immutable, entries: headerMaxTags - 1},
+		{name: "too many header entries", h: immutable, entries: headerMaxTags, wantErr: true},
+		{name: "signatures", h: signatures, entries: signatureMaxTags - 1},
+		{name: "too many signatures", h: signatures, entries: signatureMaxTags, wantErr: true},
+		{name: "signature data", h: signatures, data: signatureMaxData - 16},
+		{name: "too much signature data", h: signatures, data: signatureMaxData - 15, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			i := newIndex(tc.h)
+			for tag := 0; tag < tc.entries; tag++ {
+				i.Add(1000+tag, EntryBytes([]byte{1}))
+			}
+			if tc.data > 0 {
+				i.Add(1000, EntryBytes(make([]byte, tc.data)))
+			}
+			_, err := i.Bytes()
+			if tc.wantErr && !errors.Is(err, ErrHeaderTooLarge) {
+				t.Errorf("Bytes returned %v, want ErrHeaderTooLarge", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Bytes returned error %v", err)
+			}
+		})
+	}
 }
@@ -0,0 +1,38 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import "fmt"
+
+// HeaderHook can add, remove or replace the tags of a header just before it is
+// serialized, e.g. to add tags of an organization to every package. It is called with
+// signature false for the header, after the custom tags were added, and with signature
+// true for the signature header, which is built from the serialized header.
+type HeaderHook func(entries map[int]IndexEntry, signature bool) error
+
+// AddHeaderHook registers a HeaderHook. Hooks are called in the order they were added,
+// by Write and by EstimateSize, which builds the headers of a copy of the rpm.
+func (r *RPM) AddHeaderHook(f HeaderHook) {
+	r.headerHooks = append(r.headerHooks, f)
+}
+
+func (r *RPM) runHeaderHooks(h *index) error {
+	for i, f := range r.headerHooks {
+		if err := f(h.entries, h.h == signatures); err != nil {
+			return fmt.Errorf("header hook %d failed: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestHeaderHook(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hooks", Version: "1.0", Vendor: "Example"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddHeaderHook(func(entries map[int]IndexEntry, signature bool) error {
+		if signature {
+			entries[sigReservedSpace] = EntryBytes(make([]byte, 16))
+			return nil
+		}
+		entries[tagURL] = EntryString("https://example.com")
+		delete(entries, tagVendor)
+		return nil
+	})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if got, err := pkg.Header.String(tagURL); err != nil || got != "https://example.com" {
+		t.Errorf("URL is %q, %v, want https://example.com", got, err)
+	}
+	if _, err := pkg.Header.String(tagVendor); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("Vendor returned error %v, want %v", err, ErrTagNotFound)
+	}
+	if _, ok := pkg.Signature.entries[sigReservedSpace]; !ok {
+		t.Errorf("signature header has no reserved space")
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "hooks", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	errHook := errors.New("hook error")
+	r.AddHeaderHook(func(map[int]IndexEntry, bool) error { return errHook })
+	if err := r.Write(io.Discard); !errors.Is(err, errHook) {
+		t.Errorf("Write returned error %v, want %v", err, errHook)
+	}
+}
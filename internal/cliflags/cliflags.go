@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cliflags has the flag types shared by the rpmpack and tar2rpm commands.
+package cliflags
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/rpmpack"
+)
+
+// Globs is a flag with path patterns, e.g. /etc/hello/*.conf, which can be given several
+// times. Relative patterns are made absolute.
+type Globs []string
+
+func (g *Globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *Globs) Set(value string) error {
+	pattern := path.Join("/", value)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", value, err)
+	}
+	*g = append(*g, pattern)
+	return nil
+}
+
+// Match reports whether name matches any of the patterns.
+func (g Globs) Match(name string) bool {
+	for _, pattern := range g {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Ghosts is a flag with the ghost files, which can be given several times and as a comma
+// separated list. A trailing slash marks a directory.
+type Ghosts []string
+
+func (g *Ghosts) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *Ghosts) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*g = append(*g, name)
+		}
+	}
+	return nil
+}
+
+// AddTo adds the ghost files to r. Files of r with the same name are marked as ghost
+// files, which removes their content from the payload.
+func (g Ghosts) AddTo(r *rpmpack.RPM) {
+	if len(g) == 0 {
+		return
+	}
+	existing := map[string]rpmpack.RPMFile{}
+	for _, f := range r.Files() {
+		existing[f.Name] = f
+	}
+	for _, name := range g {
+		f, ok := existing[path.Join("/", name)]
+		if !ok {
+			f = rpmpack.RPMFile{Name: path.Join("/", name), Mode: 0100644, Owner: "root", Group: "root"}
+			if strings.HasSuffix(name, "/") {
+				f.Mode = 040755
+			}
+		}
+		f.Type |= rpmpack.GhostFile
+		r.AddFile(f)
+	}
+}
+
+// scriptletKinds are the scriptlets which can be given as flags.
+var scriptletKinds = []string{
+	rpmpack.ScriptletPretrans,
+	rpmpack.ScriptletPrein,
+	rpmpack.ScriptletPostin,
+	rpmpack.ScriptletPreun,
+	rpmpack.ScriptletPostun,
+	rpmpack.ScriptletPosttrans,
+}
+
+// Scriptlets are the scriptlet flags, e.g. -prein with the contents of the prein scriptlet
+// and -prein-file with its file name.
+type Scriptlets struct {
+	bodies, files map[string]*string
+}
+
+// NewScriptlets defines the scriptlet flags in fs.
+func NewScriptlets(fs *flag.FlagSet) *Scriptlets {
+	s := &Scriptlets{bodies: map[string]*string{}, files: map[string]*string{}}
+	for _, kind := range scriptletKinds {
+		s.bodies[kind] = fs.String(kind, "", kind+" scriptlet contents (not filename)")
+		s.files[kind] = fs.String(kind+"-file", "", "read the "+kind+" scriptlet from `FILE`")
+	}
+	return s
+}
+
+// AddTo adds the scriptlets given as flags to r. A scriptlet must only be given once:
+// given maps the kinds of the scriptlets given otherwise, e.g. in a manifest, to where
+// they came from. The kinds added by AddTo are recorded in given as "flag".
+func (s *Scriptlets) AddTo(r *rpmpack.RPM, given map[string]string) error {
+	for _, kind := range scriptletKinds {
+		body, file := *s.bodies[kind], *s.files[kind]
+		switch {
+		case body == "" && file == "":
+			continue
+		case body != "" && file != "":
+			return fmt.Errorf("%s scriptlet given both as flag and as %s", kind, file)
+		case given[kind] != "":
+			return fmt.Errorf("%s scriptlet given both as flag and in %s", kind, given[kind])
+		}
+		given[kind] = "flag"
+		var err error
+		if file != "" {
+			err = r.AddScriptletFile(kind, file)
+		} else {
+			err = r.AddScriptlet(kind, body)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
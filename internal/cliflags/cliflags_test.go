@@ -0,0 +1,149 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliflags
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/rpmpack"
+)
+
+func TestGlobs(t *testing.T) {
+	var g Globs
+	for _, value := range []string{"/etc/hello/*.conf", "usr/share/doc/hello/*"} {
+		if err := g.Set(value); err != nil {
+			t.Fatalf("Set(%q) returned error: %v", value, err)
+		}
+	}
+	if err := g.Set("/etc/["); err == nil {
+		t.Error("Set(/etc/[) returned no error, want an error")
+	}
+	if d := cmp.Diff("/etc/hello/*.conf,/usr/share/doc/hello/*", g.String()); d != "" {
+		t.Errorf("String unexpected value (want->got):\n%s", d)
+	}
+	for name, want := range map[string]bool{
+		"/etc/hello/hello.conf":        true,
+		"/etc/hello/sub/hello.conf":    false,
+		"/usr/share/doc/hello/README":  true,
+		"/usr/share/doc/other/README":  false,
+		"/opt/hello/etc/hello.conf":    false,
+		"/etc/hello/hello.conf.rpmnew": false,
+	} {
+		if got := g.Match(name); got != want {
+			t.Errorf("Match(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestGhosts(t *testing.T) {
+	var g Ghosts
+	for _, value := range []string{"/var/log/hello.log, var/lib/hello/", "/etc/hello.conf,,"} {
+		if err := g.Set(value); err != nil {
+			t.Fatalf("Set(%q) returned error: %v", value, err)
+		}
+	}
+	r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{Name: "hello", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error: %v", err)
+	}
+	r.AddFile(rpmpack.RPMFile{Name: "/etc/hello.conf", Body: []byte("hello"), Mode: 0100600, Owner: "hello", Group: "hello"})
+	g.AddTo(r)
+	want := []rpmpack.RPMFile{
+		{Name: "/etc/hello.conf", Body: []byte("hello"), Mode: 0100600, Owner: "hello", Group: "hello", Type: rpmpack.GhostFile},
+		{Name: "/var/lib/hello", Mode: 040755, Owner: "root", Group: "root", Type: rpmpack.GhostFile},
+		{Name: "/var/log/hello.log", Mode: 0100644, Owner: "root", Group: "root", Type: rpmpack.GhostFile},
+	}
+	if d := cmp.Diff(want, r.Files()); d != "" {
+		t.Errorf("AddTo unexpected files (want->got):\n%s", d)
+	}
+}
+
+func TestScriptlets(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "postin.sh")
+	if err := os.WriteFile(fn, []byte("echo postin"), 0644); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	for _, tc := range []struct {
+		name    string
+		args    []string
+		given   map[string]string
+		want    map[string]string
+		wantErr bool
+	}{{
+		name: "body and file",
+		args: []string{"-prein", "echo prein", "-postin-file", fn},
+		want: map[string]string{"prein": "echo prein", "postin": "echo postin"},
+	}, {
+		name:  "given elsewhere",
+		args:  []string{"-prein", "echo prein"},
+		given: map[string]string{"postun": "hello.yaml"},
+		want:  map[string]string{"prein": "echo prein"},
+	}, {
+		name:    "body and file of a scriptlet",
+		args:    []string{"-postin", "echo postin", "-postin-file", fn},
+		wantErr: true,
+	}, {
+		name:    "scriptlet given twice",
+		args:    []string{"-prein", "echo prein"},
+		given:   map[string]string{"prein": "hello.yaml"},
+		wantErr: true,
+	}, {
+		name:    "missing file",
+		args:    []string{"-postin-file", filepath.Join(t.TempDir(), "missing")},
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			s := NewScriptlets(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{Name: "hello", Version: "1.0"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error: %v", err)
+			}
+			given := map[string]string{}
+			for kind, from := range tc.given {
+				given[kind] = from
+			}
+			err = s.AddTo(r, given)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("AddTo returned no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddTo returned error: %v", err)
+			}
+			got := map[string]string{}
+			for _, sc := range r.Scriptlets() {
+				got[sc.Kind] = sc.Body
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("AddTo unexpected scriptlets (want->got):\n%s", d)
+			}
+			for kind := range tc.want {
+				if given[kind] != "flag" {
+					t.Errorf("given[%q] = %q, want flag", kind, given[kind])
+				}
+			}
+		})
+	}
+}
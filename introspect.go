@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Scriptlet is a scriptlet of an RPM, as returned by RPM.Scriptlets.
+type Scriptlet struct {
+	// Kind is e.g. ScriptletPostin.
+	Kind string
+	// Body is the body as it was added, before any expansion.
+	Body string
+	// Interpreter is e.g. "/bin/sh" or "<lua>".
+	Interpreter string
+	Flags       ScriptletFlags
+}
+
+// Metadata returns a copy of the metadata of the rpm, including the relations added
+// after NewRPM.
+func (r *RPM) Metadata() RPMMetaData {
+	md := r.RPMMetaData
+	md.Prefixes = append([]string(nil), r.Prefixes...)
+	md.Provides = copyRelations(r.Provides)
+	md.Obsoletes = copyRelations(r.Obsoletes)
+	md.Suggests = copyRelations(r.Suggests)
+	md.Recommends = copyRelations(r.Recommends)
+	md.Supplements = copyRelations(r.Supplements)
+	md.Enhances = copyRelations(r.Enhances)
+	md.Requires = copyRelations(r.Requires)
+	md.Conflicts = copyRelations(r.Conflicts)
+	return md
+}
+
+// Files returns the files added to the rpm, sorted by name. Changing them does not
+// change the rpm, use AddFile.
+func (r *RPM) Files() []RPMFile {
+	files := make([]RPMFile, 0, len(r.files))
+	for _, fn := range r.sortedFileNames() {
+		files = append(files, r.files[fn])
+	}
+	return files
+}
+
+// Relations returns a copy of the relations of a kind: "provides", "requires",
+// "conflicts", "obsoletes", "recommends", "suggests", "supplements" or "enhances".
+// Relations added when the rpm is written, e.g. by dependency generators, are not
+// included before Write.
+func (r *RPM) Relations(kind string) (Relations, error) {
+	rels, ok := map[string]Relations{
+		"provides":    r.Provides,
+		"requires":    r.Requires,
+		"conflicts":   r.Conflicts,
+		"obsoletes":   r.Obsoletes,
+		"recommends":  r.Recommends,
+		"suggests":    r.Suggests,
+		"supplements": r.Supplements,
+		"enhances":    r.Enhances,
+	}[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRelationKind, kind)
+	}
+	return copyRelations(rels), nil
+}
+
+// Scriptlets returns the scriptlets of the rpm, sorted by kind. Scriptlets without a body
+// and interpreter are not returned.
+func (r *RPM) Scriptlets() []Scriptlet {
+	var scriptlets []Scriptlet
+	for kind, s := range r.scriptlets {
+		if s.body == "" && s.interpreter == "" {
+			continue
+		}
+		interpreter := s.interpreter
+		if interpreter == "" {
+			interpreter = defaultInterpreter
+		}
+		scriptlets = append(scriptlets, Scriptlet{Kind: kind, Body: s.body, Interpreter: interpreter, Flags: s.flags})
+	}
+	sort.Slice(scriptlets, func(i, j int) bool { return scriptlets[i].Kind < scriptlets[j].Kind })
+	return scriptlets
+}
+
+// copyRelations returns a copy of rels which does not share the relations.
+func copyRelations(rels Relations) Relations {
+	if rels == nil {
+		return nil
+	}
+	c := make(Relations, len(rels))
+	for i, rel := range rels {
+		relCopy := *rel
+		c[i] = &relCopy
+	}
+	return c
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIntrospection(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:     "introspect",
+		Version:  "1.0",
+		Requires: Relations{{Name: "bash"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/b", Body: []byte("b")})
+	r.AddFile(RPMFile{Name: "/usr/bin/a", Body: []byte("a")})
+	r.Requires.Set("glibc >= 2.28")
+	r.AddPrein("")
+	r.AddPostin("echo installed")
+	if err := r.AddScriptlet(ScriptletPosttrans, "print(1)"); err != nil {
+		t.Fatalf("AddScriptlet returned error %v", err)
+	}
+	if err := r.SetScriptletInterpreter(ScriptletPosttrans, "<lua>"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+
+	md := r.Metadata()
+	if md.Name != "introspect" || len(md.Requires) != 2 {
+		t.Errorf("Metadata returned %+v, want the name and both requires", md)
+	}
+	md.Requires[0].Name = "changed"
+	if r.Requires[0].Name != "bash" {
+		t.Errorf("changing the metadata changed the rpm")
+	}
+
+	if d := cmp.Diff([]RPMFile{{Name: "/usr/bin/a", Body: []byte("a")}, {Name: "/usr/bin/b", Body: []byte("b")}}, r.Files()); d != "" {
+		t.Errorf("Files returned unexpected files (want->got):\n%s", d)
+	}
+
+	requires, err := r.Relations("requires")
+	if err != nil {
+		t.Fatalf("Relations returned error %v", err)
+	}
+	if got := requires.String(); got != "bash,glibc>=2.28" {
+		t.Errorf("Relations(requires) = %q, want \"bash,glibc>=2.28\"", got)
+	}
+	requires[0].Name = "changed"
+	if r.Requires[0].Name != "bash" {
+		t.Errorf("changing the relations changed the rpm")
+	}
+	if _, err := r.Relations("wants"); err == nil {
+		t.Errorf("Relations of an unknown kind should have returned an error")
+	}
+
+	want := []Scriptlet{
+		{Kind: ScriptletPostin, Body: "echo installed", Interpreter: "/bin/sh"},
+		{Kind: ScriptletPosttrans, Body: "print(1)", Interpreter: "<lua>"},
+	}
+	if d := cmp.Diff(want, r.Scriptlets()); d != "" {
+		t.Errorf("Scriptlets returned unexpected scriptlets (want->got):\n%s", d)
+	}
+}
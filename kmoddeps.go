@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// KernelModules returns a DependencyGenerator for kernel modules (*.ko files), like the
+// kmod generators of rpmbuild. Each module provides "kmod(name.ko)" and one
+// "modalias(alias)" per alias in its .modinfo section, and requires
+// "kernel-uname-r = version" of the kernel it was built for (from its vermagic).
+// Files matching one of the exclude patterns (see path.Match) are skipped.
+func KernelModules(exclude ...string) DependencyGenerator {
+	return func(f RPMFile) (Relations, Relations, error) {
+		if !strings.HasSuffix(f.Name, ".ko") || excludedPath(f.Name, exclude) {
+			return nil, nil, nil
+		}
+		if !bytes.HasPrefix(f.Body, []byte(elf.ELFMAG)) {
+			return nil, nil, nil
+		}
+		e, err := elf.NewFile(bytes.NewReader(f.Body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse kernel module: %w", err)
+		}
+		provides := Relations{&Relation{Name: fmt.Sprintf("kmod(%s)", path.Base(f.Name))}}
+		var requires Relations
+		s := e.Section(".modinfo")
+		if s == nil {
+			return provides, nil, nil
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read .modinfo: %w", err)
+		}
+		for _, kv := range bytes.Split(data, []byte{0}) {
+			k, v, ok := strings.Cut(string(kv), "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "alias":
+				provides.addIfMissing(&Relation{Name: fmt.Sprintf("modalias(%s)", v)})
+			case "vermagic":
+				if fields := strings.Fields(v); len(fields) > 0 {
+					requires.addIfMissing(&Relation{Name: "kernel-uname-r", Version: fields[0], Sense: SenseEqual})
+				}
+			}
+		}
+		return provides, requires, nil
+	}
+}
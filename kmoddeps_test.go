@@ -0,0 +1,61 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"debug/elf"
+	"testing"
+)
+
+func TestKernelModules(t *testing.T) {
+	modinfo := []byte("license=GPL\x00alias=pci:v00008086d00001234sv*sd*bc*sc*i*\x00alias=foo\x00vermagic=5.14.0-70.el9.x86_64 SMP mod_unload modversions \x00")
+	ko := testELF(t, elf.EM_X86_64, elf.ET_REL,
+		testSection{name: ".modinfo", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC, data: modinfo},
+	)
+	testCases := []struct {
+		name         string
+		file         RPMFile
+		exclude      []string
+		wantProvides string
+		wantRequires string
+	}{{
+		name:         "module",
+		file:         RPMFile{Name: "/lib/modules/5.14.0-70.el9.x86_64/extra/foo.ko", Body: ko, Mode: 0100644},
+		wantProvides: "kmod(foo.ko),modalias(pci:v00008086d00001234sv*sd*bc*sc*i*),modalias(foo)",
+		wantRequires: "kernel-uname-r=5.14.0-70.el9.x86_64",
+	}, {
+		name: "not a module",
+		file: RPMFile{Name: "/usr/lib64/foo.so", Body: ko, Mode: 0100755},
+	}, {
+		name:    "excluded",
+		file:    RPMFile{Name: "/lib/modules/5.14.0-70.el9.x86_64/extra/foo.ko", Body: ko, Mode: 0100644},
+		exclude: []string{"/lib/modules/*/extra/*"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			provides, requires, err := KernelModules(tc.exclude...)(tc.file)
+			if err != nil {
+				t.Fatalf("KernelModules returned error %v", err)
+			}
+			if got := provides.String(); got != tc.wantProvides {
+				t.Errorf("KernelModules provides = %q, want %q", got, tc.wantProvides)
+			}
+			if got := requires.String(); got != tc.wantRequires {
+				t.Errorf("KernelModules requires = %q, want %q", got, tc.wantRequires)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"path"
+	"strings"
+)
+
+const ldconfig = "/sbin/ldconfig"
+
+// ldconfigLua runs ldconfig from a <lua> scriptlet.
+const ldconfigLua = `rpm.execute("` + ldconfig + `")` + "\n"
+
+// ldconfigDirs are the directories searched by the dynamic linker without configuration.
+var ldconfigDirs = map[string]bool{
+	"/lib":       true,
+	"/lib64":     true,
+	"/usr/lib":   true,
+	"/usr/lib64": true,
+}
+
+// hasLibraries reports if the rpm has shared libraries (lib*.so*) in the standard library
+// directories.
+func (r *RPM) hasLibraries() bool {
+	for fn, f := range r.files {
+		dir, base := path.Split(fn)
+		if !ldconfigDirs[path.Clean(dir)] || f.Type&GhostFile != 0 || f.Mode&040000 != 0 {
+			continue
+		}
+		if strings.HasPrefix(base, "lib") && (strings.HasSuffix(base, ".so") || strings.Contains(base, ".so.")) {
+			return true
+		}
+	}
+	return false
+}
+
+// addLdconfigScriptlets runs ldconfig after installing and removing the package if it has
+// shared libraries and RPMMetaData.Ldconfig is set, like %ldconfig_scriptlets in a spec file.
+// Empty postin and postun scriptlets run ldconfig directly as their interpreter, otherwise
+// ldconfig is appended to their body: as a command to shell scriptlets, and with
+// rpm.execute (rpm >= 4.15) to <lua> scriptlets. Scriptlets run by other interpreters
+// fail with ErrNotShellScriptlet.
+func (r *RPM) addLdconfigScriptlets() error {
+	if !r.Ldconfig || !r.hasLibraries() {
+		return nil
+	}
+	for _, kind := range []string{ScriptletPostin, ScriptletPostun} {
+		s, err := r.scriptlet(kind)
+		if err != nil {
+			return err
+		}
+		switch {
+		case s.body == "" && s.interpreter == "":
+			s.interpreter = ldconfig
+		case s.interpreter == ldconfig || strings.HasSuffix(s.body, ldconfig+"\n") || strings.HasSuffix(s.body, ldconfigLua):
+			// ldconfig already runs, e.g. in a copy made by ForArch.
+		case s.interpreter == luaInterpreter:
+			if s.body != "" && !strings.HasSuffix(s.body, "\n") {
+				s.body += "\n"
+			}
+			s.body += ldconfigLua
+		default:
+			if err := r.appendScriptletBody(kind, ldconfig+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return r.AddScriptRequires(SenseScriptPost|SenseScriptPostUn, ldconfig)
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLdconfig(t *testing.T) {
+	testCases := []struct {
+		name            string
+		file            string
+		ldconfig        bool
+		postin          string
+		postinProg      string
+		wantErr         error
+		wantPostin      string
+		wantPostinProg  string
+		wantPostunProg  string
+		wantNoScriptlet bool
+	}{{
+		name:           "library",
+		file:           "/usr/lib64/libfoo.so.1.2",
+		ldconfig:       true,
+		wantPostinProg: ldconfig,
+		wantPostunProg: ldconfig,
+	}, {
+		name:           "existing postin",
+		file:           "/usr/lib64/libfoo.so.1.2",
+		ldconfig:       true,
+		postin:         "echo hi",
+		wantPostin:     "echo hi\n/sbin/ldconfig\n",
+		wantPostunProg: ldconfig,
+	}, {
+		name:           "shell postin with arguments",
+		file:           "/usr/lib64/libfoo.so.1.2",
+		ldconfig:       true,
+		postin:         "echo hi",
+		postinProg:     "/bin/sh -e",
+		wantPostin:     "echo hi\n/sbin/ldconfig\n",
+		wantPostinProg: "/bin/sh -e",
+		wantPostunProg: ldconfig,
+	}, {
+		name:           "lua postin",
+		file:           "/usr/lib64/libfoo.so.1.2",
+		ldconfig:       true,
+		postin:         `print("hi")`,
+		postinProg:     "<lua>",
+		wantPostin:     "print(\"hi\")\nrpm.execute(\"/sbin/ldconfig\")\n",
+		wantPostinProg: "<lua>",
+		wantPostunProg: ldconfig,
+	}, {
+		name:       "python postin",
+		file:       "/usr/lib64/libfoo.so.1.2",
+		ldconfig:   true,
+		postin:     "print('hi')",
+		postinProg: "/usr/bin/python3",
+		wantErr:    ErrNotShellScriptlet,
+	}, {
+		name:            "not in a library directory",
+		file:            "/usr/lib64/foo/libfoo.so.1",
+		ldconfig:        true,
+		wantNoScriptlet: true,
+	}, {
+		name:            "disabled",
+		file:            "/usr/lib64/libfoo.so.1.2",
+		wantNoScriptlet: true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "libfoo", Version: "1.0", Ldconfig: tc.ldconfig})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: tc.file, Body: []byte("lib"), Mode: 0100755})
+			if tc.postin != "" {
+				r.AddPostin(tc.postin)
+			}
+			if tc.postinProg != "" {
+				if err := r.SetScriptletInterpreter(ScriptletPostin, tc.postinProg); err != nil {
+					t.Fatalf("SetScriptletInterpreter returned error %v", err)
+				}
+			}
+			if err := r.Write(io.Discard); tc.wantErr != nil || err != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Write returned error %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if tc.wantNoScriptlet {
+				if len(r.scriptlets) != 0 || len(r.Requires) != 0 {
+					t.Errorf("unexpected ldconfig scriptlets %v and requires %q", r.scriptlets, r.Requires.String())
+				}
+				return
+			}
+			post, postun := r.scriptlets[ScriptletPostin], r.scriptlets[ScriptletPostun]
+			if post.body != tc.wantPostin || post.interpreter != tc.wantPostinProg {
+				t.Errorf("postin = %q with %q, want %q with %q", post.body, post.interpreter, tc.wantPostin, tc.wantPostinProg)
+			}
+			if postun.interpreter != tc.wantPostunProg {
+				t.Errorf("postun interpreter = %q, want %q", postun.interpreter, tc.wantPostunProg)
+			}
+			if got := r.Requires.String(); got != ldconfig {
+				t.Errorf("Requires = %q, want %q", got, ldconfig)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrLimitExceeded is returned by Write when the rpm exceeds MaxFiles or MaxPayloadSize,
+// or a size which does not fit the 32 bit size tags rpmpack writes.
+var ErrLimitExceeded = errors.New("rpm size limit exceeded")
+
+// maxSize32 is the largest value of the 32 bit size tags. rpmbuild switches to the
+// LONGFILESIZES, LONGSIZE and LONGSIGSIZE tags above it, rpmpack fails instead of
+// writing a wrapped size.
+const maxSize32 = math.MaxUint32
+
+// checkFileLimits checks the files before they are written to the payload.
+func (r *RPM) checkFileLimits(names []string) error {
+	if r.MaxFiles > 0 && len(names) > r.MaxFiles {
+		return fmt.Errorf("%w: the rpm has %d files, at most %d are allowed", ErrLimitExceeded, len(names), r.MaxFiles)
+	}
+	var total uint64
+	for _, fn := range names {
+		size := uint64(len(r.files[fn].Body))
+		if size > maxSize32 {
+			return fmt.Errorf("%w: file %q has %d bytes, the file sizes hold at most %d", ErrLimitExceeded, fn, size, uint64(maxSize32))
+		}
+		total += size
+	}
+	if total > maxSize32 {
+		return fmt.Errorf("%w: the files have %d bytes, the SIZE tag holds at most %d", ErrLimitExceeded, total, uint64(maxSize32))
+	}
+	return nil
+}
+
+// checkPayloadLimit checks the size of the compressed payload. It is called after every
+// file, so Write fails as soon as the limit is exceeded, and after the compressor was
+// closed.
+func (r *RPM) checkPayloadLimit() error {
+	if r.MaxPayloadSize > 0 && int64(r.payload.Len()) > r.MaxPayloadSize {
+		return fmt.Errorf("%w: the payload has more than %d bytes", ErrLimitExceeded, r.MaxPayloadSize)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	body := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(body)
+	for _, tc := range []struct {
+		name    string
+		md      RPMMetaData
+		wantErr bool
+	}{
+		{name: "unlimited"},
+		{name: "files", md: RPMMetaData{MaxFiles: 4}},
+		{name: "too many files", md: RPMMetaData{MaxFiles: 3}, wantErr: true},
+		{name: "payload", md: RPMMetaData{MaxPayloadSize: 1 << 20}},
+		{name: "payload too large", md: RPMMetaData{MaxPayloadSize: 128 << 10}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.md.Name, tc.md.Version = "limits", "1.0"
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for i := 0; i < 4; i++ {
+				r.AddFile(RPMFile{Name: fmt.Sprintf("/random%d", i), Body: body, Mode: 0644})
+			}
+			err = r.Write(io.Discard)
+			if tc.wantErr && !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("Write returned error %v, want %v", err, ErrLimitExceeded)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Write returned error %v", err)
+			}
+		})
+	}
+}
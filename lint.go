@@ -0,0 +1,124 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	// Check is the name of the check, like the rpmlint check, e.g. "setuid-binary".
+	Check string
+	// Error is set for problems which break the package or are not allowed by common
+	// packaging guidelines. Other findings are warnings.
+	Error bool
+	// Path is the file with the problem, if any.
+	Path string
+	// Message describes the problem.
+	Message string
+}
+
+// String formats the finding like rpmlint, e.g. "E: setuid-binary /usr/bin/su: ...".
+func (f Finding) String() string {
+	level := "W"
+	if f.Error {
+		level = "E"
+	}
+	s := level + ": " + f.Check
+	if f.Path != "" {
+		s += " " + f.Path
+	}
+	return s + ": " + f.Message
+}
+
+// Lint checks the rpm for common problems, like rpmlint does for built packages:
+//
+//   - file names which are not absolute or not clean, e.g. "usr/bin/x" or "/usr//bin/x"
+//   - setuid and setgid files
+//   - a missing summary or license
+//   - symlinks to a file which is missing from a directory of the package
+//   - executable text files without a #! interpreter line
+//
+// The findings are sorted by path, and the rpm is not changed.
+func Lint(r *RPM) ([]Finding, error) {
+	var findings []Finding
+	add := func(check string, isError bool, path, format string, args ...interface{}) {
+		findings = append(findings, Finding{Check: check, Error: isError, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if r.Summary == "" {
+		add("no-summary-tag", true, "", "the package has no summary")
+	}
+	if r.Licence == "" {
+		add("no-license", true, "", "the package has no license")
+	}
+
+	dirs := make(map[string]bool)
+	for name, f := range r.files {
+		if f.Mode&0170000 == 040000 {
+			dirs[name] = true
+		}
+	}
+	names := make([]string, 0, len(r.files))
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.files[name]
+		if !path.IsAbs(name) {
+			add("relative-path", true, name, "file names must be absolute")
+		} else if path.Clean(name) != name {
+			add("non-canonical-path", true, name, "the file name is not clean, use %s", path.Clean(name))
+		}
+		switch f.Mode & 0170000 {
+		case 0120000:
+			target := string(f.Body)
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			target = path.Clean(target)
+			if _, ok := r.files[target]; !ok && dirs[path.Dir(target)] {
+				add("dangling-symlink", false, name, "the target %s is not in the package", target)
+			}
+		case 0, 0100000:
+			if f.Mode&04000 != 0 {
+				add("setuid-binary", true, name, "the file is setuid, mode %o", f.Mode)
+			}
+			if f.Mode&02000 != 0 {
+				add("setgid-binary", true, name, "the file is setgid, mode %o", f.Mode)
+			}
+			if f.Mode&0111 != 0 && f.Type&GhostFile == 0 && isTextScript(f.Body) {
+				add("script-without-shebang", true, name, "the executable text file has no #! interpreter line")
+			}
+		}
+	}
+	return findings, nil
+}
+
+// isTextScript reports whether an executable body looks like text without a #! line.
+func isTextScript(body []byte) bool {
+	if len(body) == 0 || bytes.HasPrefix(body, []byte("#!")) {
+		return false
+	}
+	head := body
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return bytes.IndexByte(head, 0) < 0
+}
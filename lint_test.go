@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		name  string
+		md    RPMMetaData
+		files []RPMFile
+		want  []Finding
+	}{{
+		name: "clean",
+		md:   RPMMetaData{Name: "lint", Version: "1.0", Summary: "A package", Licence: "MIT"},
+		files: []RPMFile{
+			{Name: "/usr/lib/lint", Mode: 040755},
+			{Name: "/usr/lib/lint/liblint.so.1", Body: []byte("\x7fELF\x00"), Mode: 0755},
+			{Name: "/usr/lib/lint/liblint.so", Body: []byte("liblint.so.1"), Mode: 0120777},
+			{Name: "/usr/bin/lint", Body: []byte("#!/bin/sh\necho lint\n"), Mode: 0755},
+			{Name: "/usr/bin/ls", Body: []byte("/bin/ls"), Mode: 0120777},
+		},
+	}, {
+		name: "problems",
+		md:   RPMMetaData{Name: "lint", Version: "1.0"},
+		files: []RPMFile{
+			{Name: "usr/bin/relative", Body: []byte("\x00"), Mode: 0644},
+			{Name: "/usr/bin/./unclean", Body: []byte("\x00"), Mode: 0644},
+			{Name: "/usr/bin/su", Body: []byte("\x7fELF\x00"), Mode: 04755},
+			{Name: "/usr/bin/write", Body: []byte("\x7fELF\x00"), Mode: 02755},
+			{Name: "/usr/bin/script", Body: []byte("echo lint\n"), Mode: 0755},
+			{Name: "/usr/lib/lint", Mode: 040755},
+			{Name: "/usr/lib/lint/liblint.so", Body: []byte("liblint.so.1"), Mode: 0120777},
+		},
+		want: []Finding{
+			{Check: "no-summary-tag", Error: true, Message: "the package has no summary"},
+			{Check: "no-license", Error: true, Message: "the package has no license"},
+			{Check: "non-canonical-path", Error: true, Path: "/usr/bin/./unclean", Message: "the file name is not clean, use /usr/bin/unclean"},
+			{Check: "script-without-shebang", Error: true, Path: "/usr/bin/script", Message: "the executable text file has no #! interpreter line"},
+			{Check: "setuid-binary", Error: true, Path: "/usr/bin/su", Message: "the file is setuid, mode 4755"},
+			{Check: "setgid-binary", Error: true, Path: "/usr/bin/write", Message: "the file is setgid, mode 2755"},
+			{Check: "dangling-symlink", Path: "/usr/lib/lint/liblint.so", Message: "the target /usr/lib/lint/liblint.so.1 is not in the package"},
+			{Check: "relative-path", Error: true, Path: "usr/bin/relative", Message: "file names must be absolute"},
+		},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for _, f := range tc.files {
+				r.AddFile(f)
+			}
+			got, err := Lint(r)
+			if err != nil {
+				t.Fatalf("Lint returned error %v", err)
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("Lint returned unexpected findings (want->got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestFindingString(t *testing.T) {
+	f := Finding{Check: "setuid-binary", Error: true, Path: "/usr/bin/su", Message: "the file is setuid"}
+	if got, want := f.String(), "E: setuid-binary /usr/bin/su: the file is setuid"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	f = Finding{Check: "no-url-tag", Message: "the package has no url"}
+	if got, want := f.String(), "W: no-url-tag: the package has no url"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxMacroDepth limits the recursion of macro expansion, like rpm's max_macro_depth.
+const maxMacroDepth = 64
+
+// ErrMacroRecursion is returned when macros expand to themselves.
+var ErrMacroRecursion = errors.New("too many levels of macro recursion")
+
+var macroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinMacros are the directory macros of rpm which do not depend on the package.
+var builtinMacros = map[string]string{
+	"_prefix":         "/usr",
+	"_exec_prefix":    "%{_prefix}",
+	"_bindir":         "%{_exec_prefix}/bin",
+	"_sbindir":        "%{_exec_prefix}/sbin",
+	"_libexecdir":     "%{_exec_prefix}/libexec",
+	"_datadir":        "%{_prefix}/share",
+	"_includedir":     "%{_prefix}/include",
+	"_sysconfdir":     "/etc",
+	"_localstatedir":  "/var",
+	"_sharedstatedir": "/var/lib",
+	"_docdir":         "%{_datadir}/doc",
+	"_mandir":         "%{_datadir}/man",
+	"_infodir":        "%{_datadir}/info",
+	"_unitdir":        "/usr/lib/systemd/system",
+	"_tmpfilesdir":    "/usr/lib/tmpfiles.d",
+	"_sysusersdir":    sysusersDir,
+}
+
+// lib64Arches are the architectures using /usr/lib64 as %{_libdir}.
+var lib64Arches = map[string]bool{
+	"x86_64":  true,
+	"aarch64": true,
+	"ppc64":   true,
+	"ppc64le": true,
+	"s390x":   true,
+	"riscv64": true,
+}
+
+// DefineMacro defines a macro, and enables macro expansion in the file names, relations
+// and scriptlets of the rpm when it is written, similar to %define in a spec file.
+//
+// Macros are used as %name or %{name}; %{?name} expands to nothing if the macro is
+// undefined, and "%%" is a literal "%". Undefined macros are kept as they are.
+// Values may use other macros. Besides the user defined macros, the package macros
+// %{name}, %{version}, %{release}, %{epoch}, %{prefix} and %{_arch} and the common
+// directory macros (%{_bindir}, %{_libdir}, %{_datadir}, %{_sysconfdir}, ...) are defined.
+// %{epoch} is undefined if the Epoch is NoEpoch.
+func (r *RPM) DefineMacro(name, value string) error {
+	if !macroName.MatchString(name) {
+		return fmt.Errorf("invalid macro name %q", name)
+	}
+	if r.macros == nil {
+		r.macros = make(map[string]string)
+	}
+	r.macros[name] = value
+	return nil
+}
+
+// macroTable returns all macros, or nil if macro expansion is not enabled.
+func (r *RPM) macroTable() map[string]string {
+	if r.macros == nil {
+		return nil
+	}
+	m := make(map[string]string, len(builtinMacros)+len(r.macros)+8)
+	for k, v := range builtinMacros {
+		m[k] = v
+	}
+	m["_lib"] = "lib"
+	if lib64Arches[r.Arch] {
+		m["_lib"] = "lib64"
+	}
+	m["_libdir"] = "%{_exec_prefix}/%{_lib}"
+	m["_arch"] = r.Arch
+	for k, v := range r.scriptletVariables() {
+		m[k] = v
+	}
+	for k, v := range r.macros {
+		m[k] = v
+	}
+	return m
+}
+
+// expandMacros expands the macros in s.
+func expandMacros(s string, macros map[string]string) (string, error) {
+	return expandMacrosDepth(s, macros, 0)
+}
+
+func expandMacrosDepth(s string, macros map[string]string, depth int) (string, error) {
+	if depth > maxMacroDepth {
+		return "", ErrMacroRecursion
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		var (
+			name, literal string
+			optional      bool
+		)
+		switch {
+		case s[1] == '%':
+			b.WriteByte('%')
+			s = s[2:]
+			continue
+		case s[1] == '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				b.WriteString(s)
+				return b.String(), nil
+			}
+			name, literal, s = s[2:end], s[:end+1], s[end+1:]
+			if strings.HasPrefix(name, "?") {
+				name, optional = name[1:], true
+			}
+		default:
+			n := 1
+			for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 1 && s[n] >= '0' && s[n] <= '9') {
+				n++
+			}
+			name, literal, s = s[1:n], s[:n], s[n:]
+		}
+		v, ok := macros[name]
+		switch {
+		case ok:
+			expanded, err := expandMacrosDepth(v, macros, depth+1)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(expanded)
+		case !optional:
+			b.WriteString(literal)
+		}
+	}
+}
+
+// expandRelationMacros expands the macros in the names and versions of relations.
+// The relations are replaced, as they may be shared with copies of the rpm.
+func expandRelationMacros(rels Relations, macros map[string]string) error {
+	for i, rel := range rels {
+		name, err := expandMacros(rel.Name, macros)
+		if err != nil {
+			return fmt.Errorf("failed to expand %q: %w", rel.Name, err)
+		}
+		version, err := expandMacros(rel.Version, macros)
+		if err != nil {
+			return fmt.Errorf("failed to expand %q: %w", rel.Version, err)
+		}
+		rels[i] = &Relation{Name: name, Version: version, Sense: rel.Sense}
+	}
+	return nil
+}
+
+// expandMacrosInFiles expands the macros in file names, before the files are written to
+// the payload. The expanded names are normalized like in AddFile, and two files expanding
+// to the same name fail with ErrDuplicateFile. The names with macros are kept in
+// r.fileNameMacros, see ForArch.
+func (r *RPM) expandMacrosInFiles() error {
+	macros := r.macroTable()
+	if macros == nil {
+		return nil
+	}
+	files := make(map[string]RPMFile, len(r.files))
+	origins := make(map[string]string, len(r.files))
+	r.fileNameMacros = make(map[string]string)
+	for _, fn := range r.sortedFileNames() {
+		name, err := expandMacros(fn, macros)
+		if err != nil {
+			return fmt.Errorf("failed to expand file name %q: %w", fn, err)
+		}
+		name = normalizePath(name)
+		if origin, ok := origins[name]; ok {
+			return fmt.Errorf("%w: %q and %q both expand to %q", ErrDuplicateFile, origin, fn, name)
+		}
+		origins[name] = fn
+		if name != fn {
+			r.fileNameMacros[name] = fn
+		}
+		f := r.files[fn]
+		f.Name = name
+		files[name] = f
+	}
+	r.files = files
+	return nil
+}
+
+// expandMacrosInRelations expands the macros in the relations when the header is
+// generated. The relations with macros are kept for the variants made by ForArch, which
+// expand them with their own architecture.
+func (r *RPM) expandMacrosInRelations() error {
+	macros := r.macroTable()
+	if macros == nil {
+		return nil
+	}
+	sets := r.relationSets()
+	r.unexpandedRelations = make([]Relations, len(sets))
+	for i, rels := range sets {
+		r.unexpandedRelations[i] = append(Relations(nil), *rels...)
+		if err := expandRelationMacros(*rels, macros); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relationSets returns the relation fields of r.
+func (r *RPM) relationSets() []*Relations {
+	return []*Relations{&r.Provides, &r.Obsoletes, &r.Suggests, &r.Recommends, &r.Supplements, &r.Enhances, &r.Requires, &r.Conflicts}
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandMacros(t *testing.T) {
+	macros := map[string]string{
+		"name":   "hello",
+		"dir":    "/opt/%{name}",
+		"self":   "%{self}",
+		"_lib":   "lib64",
+		"libdir": "/usr/%_lib",
+	}
+	testCases := []struct {
+		input, want string
+		wantErr     error
+	}{
+		{input: "%{dir}/bin", want: "/opt/hello/bin"},
+		{input: "%libdir/%name.so", want: "/usr/lib64/hello.so"},
+		{input: "%{?missing}x%{?name}", want: "xhello"},
+		{input: `printf "%s" 100%%`, want: `printf "%s" 100%`},
+		{input: "%{unknown} %unknown %{open", want: "%{unknown} %unknown %{open"},
+		{input: "trailing %", want: "trailing %"},
+		{input: "%{self}", wantErr: ErrMacroRecursion},
+	}
+	for _, tc := range testCases {
+		got, err := expandMacros(tc.input, macros)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("expandMacros(%q) returned error %v, want %v", tc.input, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("expandMacros(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestDefineMacro(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:     "hello",
+		Version:  "1.0",
+		Arch:     "x86_64",
+		Requires: Relations{{Name: "%{name}-libs", Version: "%{version}", Sense: SenseEqual}},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.DefineMacro("confdir", "%{_sysconfdir}/%{name}"); err != nil {
+		t.Fatalf("DefineMacro returned error %v", err)
+	}
+	if err := r.DefineMacro("bad name", ""); err == nil {
+		t.Errorf("DefineMacro with an invalid name should have returned an error")
+	}
+	r.AddFile(RPMFile{Name: "%{_libdir}/libhello.so.1", Body: []byte("lib")})
+	r.AddFile(RPMFile{Name: "%{confdir}/hello.conf", Body: []byte("conf")})
+	r.AddPostin("echo %{name} %{_bindir}")
+	if err := r.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"/etc/hello/", "/usr/lib64/"}, r.di.AllDirs()); d != "" {
+		t.Errorf("dirs differ (want->got):\n%v", d)
+	}
+	if got := r.Requires.String(); got != "hello-libs=1.0" {
+		t.Errorf("Requires = %q, want hello-libs=1.0", got)
+	}
+	h := newIndex(immutable)
+	if err := r.writeScriptletIndexes(h); err != nil {
+		t.Fatalf("writeScriptletIndexes returned error %v", err)
+	}
+	if d := cmp.Diff(EntryString("echo hello /usr/bin"), h.entries[tagPostin], cmp.AllowUnexported(IndexEntry{})); d != "" {
+		t.Errorf("postin differs (want->got):\n%v", d)
+	}
+}
+
+func TestMacroFileNames(t *testing.T) {
+	testCases := []struct {
+		name    string
+		files   []string
+		strict  bool
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "normalized",
+			files: []string{"%{dir}/a", "%{dir}//b/"},
+			want:  []string{"/opt/hello/a", "/opt/hello/b"},
+		},
+		{
+			name:    "collision",
+			files:   []string{"%{_bindir}/hello", "/usr/bin/hello"},
+			wantErr: ErrDuplicateFile,
+		},
+		{
+			name:    "strict paths",
+			files:   []string{"%{dir}/../etc/passwd"},
+			strict:  true,
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "hello", Version: "1.0", StrictPaths: tc.strict})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			if err := r.DefineMacro("dir", "/opt/%{name}/"); err != nil {
+				t.Fatalf("DefineMacro returned error %v", err)
+			}
+			for _, fn := range tc.files {
+				r.AddFile(RPMFile{Name: fn, Body: []byte(fn)})
+			}
+			err = r.Write(io.Discard)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Write returned error %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if d := cmp.Diff(tc.want, r.sortedFileNames()); d != "" {
+				t.Errorf("file names differ (want->got):\n%v", d)
+			}
+		})
+	}
+}
+
+func TestMacrosForArch(t *testing.T) {
+	newRPM := func(file string) *RPM {
+		r, err := NewRPM(RPMMetaData{
+			Name:     "hello",
+			Version:  "1.0",
+			Arch:     "x86_64",
+			Requires: Relations{{Name: "hello-libs(%{_arch})"}, {Name: "%{_libdir}/libhello.so.1"}},
+		})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: file, Body: []byte("data")})
+		r.AddPostin("echo %{_arch}")
+		if err := r.DefineMacro("datadir", "%{_datadir}/%{name}"); err != nil {
+			t.Fatalf("DefineMacro returned error %v", err)
+		}
+		return r
+	}
+
+	r := newRPM("%{datadir}/data")
+	if err := r.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	for _, tc := range []struct {
+		arch, requires, postin string
+	}{
+		{"aarch64", "hello-libs(aarch64),/usr/lib64/libhello.so.1", "echo aarch64"},
+		{"i686", "hello-libs(i686),/usr/lib/libhello.so.1", "echo i686"},
+	} {
+		v, err := r.ForArch(tc.arch)
+		if err != nil {
+			t.Fatalf("ForArch(%s) returned error %v", tc.arch, err)
+		}
+		if err := v.Write(io.Discard); err != nil {
+			t.Fatalf("Write of the %s variant returned error %v", tc.arch, err)
+		}
+		if got := v.Requires.String(); got != tc.requires {
+			t.Errorf("Requires of the %s variant = %q, want %q", tc.arch, got, tc.requires)
+		}
+		h := newIndex(immutable)
+		if err := v.writeScriptletIndexes(h); err != nil {
+			t.Fatalf("writeScriptletIndexes returned error %v", err)
+		}
+		if d := cmp.Diff(EntryString(tc.postin), h.entries[tagPostin], cmp.AllowUnexported(IndexEntry{})); d != "" {
+			t.Errorf("postin of the %s variant differs (want->got):\n%v", tc.arch, d)
+		}
+	}
+	if got, want := r.Requires.String(), "hello-libs(x86_64),/usr/lib64/libhello.so.1"; got != want {
+		t.Errorf("Requires = %q, want %q", got, want)
+	}
+
+	r = newRPM("%{_libdir}/libhello.so.1")
+	if _, err := r.ForArch("aarch64"); err != nil {
+		t.Errorf("ForArch(aarch64) with the same %%{_libdir} returned error %v", err)
+	}
+	if _, err := r.ForArch("i686"); !errors.Is(err, ErrArchDependentFile) {
+		t.Errorf("ForArch(i686) with a %%{_libdir} file returned error %v, want %v", err, ErrArchDependentFile)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Manifest declares a whole package: the metadata and the files.
+// It is usually read from a JSON or YAML document with ReadManifest, e.g.
+//
+//	name: hello
+//	version: "1.0"
+//	requires: ["bash", "glibc >= 2.28"]
+//	files:
+//	  - name: /usr/bin/hello
+//	    source: build/hello
+//	    mode: "0755"
+//	  - name: /etc/hello.conf
+//	    body: "greeting=hi\n"
+//	    type: config,noreplace
+//	scriptlets:
+//	  postin: scripts/postin.sh
+type Manifest struct {
+	RPMMetaData
+	Files []ManifestFile `json:"files,omitempty"`
+	// Scriptlets maps scriptlet kinds, e.g. prein or posttrans, to the path of their
+	// body, read from the fs.FS given to Manifest.RPM.
+	Scriptlets map[string]string `json:"scriptlets,omitempty"`
+}
+
+// ManifestFile declares a single file of a Manifest. Exactly one of Source, Body,
+// LinkTo and Dir should be set.
+type ManifestFile struct {
+	// Name is the destination path of the file in the rpm.
+	Name string `json:"name"`
+	// Source is the path of the file content, read from the fs.FS given to Manifest.RPM.
+	Source string `json:"source,omitempty"`
+	// Body is the inline content of the file.
+	Body string `json:"body,omitempty"`
+	// LinkTo makes the file a symlink to the given target.
+	LinkTo string `json:"linkto,omitempty"`
+	// Dir makes the file a directory.
+	Dir bool `json:"dir,omitempty"`
+	// Mode holds the permission bits. It defaults to 0644 for files,
+	// 0755 for directories and 0777 for symlinks.
+	Mode  FileMode `json:"mode,omitempty"`
+	Owner string   `json:"owner,omitempty"`
+	Group string   `json:"group,omitempty"`
+	MTime uint32   `json:"mtime,omitempty"`
+	Type  FileType `json:"type,omitempty"`
+}
+
+// FileMode holds unix file mode bits. It is read from JSON and YAML either as a number
+// or as an octal string (e.g. "0755"), and written as an octal string.
+type FileMode uint
+
+// MarshalJSON implements json.Marshaler.
+func (m FileMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%#o", uint(m)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *FileMode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n uint
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("file mode must be a number or an octal string: %s", b)
+		}
+		*m = FileMode(n)
+		return nil
+	}
+	mode, err := ParseFileMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// ParseFileMode parses an octal file mode, e.g. "0755" or "755".
+func ParseFileMode(s string) (FileMode, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid octal file mode %q: %w", s, err)
+	}
+	return FileMode(n), nil
+}
+
+// ReadManifest reads a Manifest from a JSON or YAML document. Unknown fields are rejected,
+// and the epoch is NoEpoch unless the document sets one.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	// A manifest without an epoch builds a package without one, not with epoch 0.
+	m := &Manifest{RPMMetaData: RPMMetaData{Epoch: NoEpoch}}
+	if err := yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return m, nil
+}
+
+// RPM creates an rpm from the manifest. The Source of the files is read from fsys,
+// which may be nil if no file has a Source.
+func (m *Manifest) RPM(fsys fs.FS) (*RPM, error) {
+	r, err := NewRPM(m.RPMMetaData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RPM structure: %w", err)
+	}
+	if err := m.AddTo(r, fsys); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// AddTo adds the files and scriptlets of the manifest to an existing rpm, e.g. one
+// created by FromTar. The metadata of the manifest is not used.
+func (m *Manifest) AddTo(r *RPM, fsys fs.FS) error {
+	for _, mf := range m.Files {
+		f, err := mf.RPMFile(fsys)
+		if err != nil {
+			return err
+		}
+		r.AddFile(f)
+	}
+	kinds := make([]string, 0, len(m.Scriptlets))
+	for kind := range m.Scriptlets {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		if fsys == nil {
+			return fmt.Errorf("%s scriptlet %q: no file system given", kind, m.Scriptlets[kind])
+		}
+		b, err := fs.ReadFile(fsys, strings.TrimPrefix(path.Clean(m.Scriptlets[kind]), "/"))
+		if err != nil {
+			return fmt.Errorf("failed to read %s scriptlet: %w", kind, err)
+		}
+		if err := r.AddScriptletFromReader(kind, bytes.NewReader(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RPMFile converts the ManifestFile to an RPMFile, reading its Source from fsys.
+func (mf ManifestFile) RPMFile(fsys fs.FS) (RPMFile, error) {
+	f := RPMFile{
+		Name:  mf.Name,
+		Mode:  uint(mf.Mode),
+		Owner: mf.Owner,
+		Group: mf.Group,
+		MTime: mf.MTime,
+		Type:  mf.Type,
+	}
+	if f.Owner == "" {
+		f.Owner = "root"
+	}
+	if f.Group == "" {
+		f.Group = "root"
+	}
+	set := 0
+	for _, b := range []bool{mf.Source != "", mf.Body != "", mf.LinkTo != "", mf.Dir} {
+		if b {
+			set++
+		}
+	}
+	if set > 1 {
+		return RPMFile{}, fmt.Errorf("file %q: only one of source, body, linkto and dir may be set", mf.Name)
+	}
+	switch {
+	case mf.Dir:
+		f.Mode = defaultMode(f.Mode, 0755) | 040000
+	case mf.LinkTo != "":
+		f.Body = []byte(mf.LinkTo)
+		f.Mode = defaultMode(f.Mode, 0777) | 0120000
+	case mf.Source != "":
+		if fsys == nil {
+			return RPMFile{}, fmt.Errorf("file %q: no file system to read source %q from", mf.Name, mf.Source)
+		}
+		b, err := fs.ReadFile(fsys, strings.TrimPrefix(path.Clean(mf.Source), "/"))
+		if err != nil {
+			return RPMFile{}, fmt.Errorf("file %q: failed to read source: %w", mf.Name, err)
+		}
+		f.Body = b
+		f.Mode = defaultMode(f.Mode, 0644)
+	default:
+		f.Body = []byte(mf.Body)
+		f.Mode = defaultMode(f.Mode, 0644)
+	}
+	return f, nil
+}
+
+func defaultMode(mode, def uint) uint {
+	if mode&07777 == 0 {
+		return mode | def
+	}
+	return mode
+}
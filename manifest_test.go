@@ -0,0 +1,139 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testManifest = `
+name: hello
+version: "1.0"
+release: "1"
+requires: ["bash", "glibc >= 2.28"]
+files:
+  - name: /usr/bin/hello
+    source: build/hello
+    mode: 0755
+  - name: /etc/hello.conf
+    body: "greeting=hi\n"
+    mode: "0600"
+    type: config,noreplace
+  - name: /usr/lib/hello
+    dir: true
+  - name: /usr/bin/hi
+    linkto: hello
+scriptlets:
+  postin: scripts/postin.sh
+`
+
+func TestReadManifest(t *testing.T) {
+	m, err := ReadManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatalf("ReadManifest returned error %v", err)
+	}
+	if m.Name != "hello" || m.Version != "1.0" || m.Release != "1" {
+		t.Errorf("ReadManifest metadata = %s-%s-%s, want hello-1.0-1", m.Name, m.Version, m.Release)
+	}
+	if got := m.Requires.String(); got != "bash,glibc>=2.28" {
+		t.Errorf("ReadManifest requires = %q, want %q", got, "bash,glibc>=2.28")
+	}
+
+	r, err := m.RPM(fstest.MapFS{
+		"build/hello":       {Data: []byte("binary")},
+		"scripts/postin.sh": {Data: []byte("echo installed\n")},
+	})
+	if err != nil {
+		t.Fatalf("Manifest.RPM returned error %v", err)
+	}
+	want := map[string]RPMFile{
+		"/usr/bin/hello":  {Name: "/usr/bin/hello", Body: []byte("binary"), Mode: 0755, Owner: "root", Group: "root"},
+		"/etc/hello.conf": {Name: "/etc/hello.conf", Body: []byte("greeting=hi\n"), Mode: 0600, Owner: "root", Group: "root", Type: ConfigFile | NoReplaceFile},
+		"/usr/lib/hello":  {Name: "/usr/lib/hello", Mode: 040755, Owner: "root", Group: "root"},
+		"/usr/bin/hi":     {Name: "/usr/bin/hi", Body: []byte("hello"), Mode: 0120777, Owner: "root", Group: "root"},
+	}
+	if d := cmp.Diff(want, r.files); d != "" {
+		t.Errorf("Manifest.RPM files differ (want->got):\n%v", d)
+	}
+	if got := r.scriptlets[ScriptletPostin].body; got != "echo installed" {
+		t.Errorf("postin scriptlet is %q, want %q", got, "echo installed")
+	}
+	if err := r.Write(io.Discard); err != nil {
+		t.Errorf("Write returned error %v", err)
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	for _, input := range []string{
+		"name: hello\nbogus: field\n",
+		"requires: [\"python >< 3\"]\n",
+		"files:\n  - name: /a\n    mode: \"9\"\n",
+		"files:\n  - name: /a\n    type: weird\n",
+		"scriptlets:\n  postin: [1]\n",
+	} {
+		if _, err := ReadManifest(strings.NewReader(input)); err == nil {
+			t.Errorf("ReadManifest(%q) should have returned an error", input)
+		}
+	}
+}
+
+func TestReadManifestEpoch(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  uint32
+	}{
+		{input: "name: hello\n", want: NoEpoch},
+		{input: "name: hello\nepoch: 0\n", want: 0},
+		{input: "{\"name\": \"hello\", \"epoch\": 2}", want: 2},
+	} {
+		m, err := ReadManifest(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatalf("ReadManifest(%q) returned error %v", tc.input, err)
+		}
+		if m.Epoch != tc.want {
+			t.Errorf("ReadManifest(%q) epoch = %d, want %d", tc.input, m.Epoch, tc.want)
+		}
+	}
+}
+
+func TestMetadataJSONRoundTrip(t *testing.T) {
+	for _, md := range []RPMMetaData{
+		{
+			Name:     "hello",
+			Version:  "1.0",
+			Epoch:    NoEpoch,
+			Requires: Relations{{Name: "bash", Version: "5", Sense: SenseGreater | SenseEqual}},
+		},
+		{Name: "hello", Epoch: 0},
+	} {
+		b, err := json.Marshal(md)
+		if err != nil {
+			t.Fatalf("json.Marshal returned error %v", err)
+		}
+		got := RPMMetaData{Epoch: NoEpoch}
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("json.Unmarshal(%s) returned error %v", b, err)
+		}
+		if d := cmp.Diff(md, got); d != "" {
+			t.Errorf("metadata differs after a JSON round trip (want->got):\n%v", d)
+		}
+	}
+}
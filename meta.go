@@ -0,0 +1,34 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import "errors"
+
+// ErrFilesInMetaPackage is returned when a meta package created with NewMetaRPM contains files.
+var ErrFilesInMetaPackage = errors.New("meta package must not contain files")
+
+// NewMetaRPM creates and returns a new RPM struct for a meta package: a package without
+// any files, which only carries dependencies (Requires, Recommends, ...).
+//
+// rpm does not accept empty file arrays, so a meta package has no file related tags at all.
+// Write fails with ErrFilesInMetaPackage if files were added anyway.
+func NewMetaRPM(m RPMMetaData) (*RPM, error) {
+	r, err := NewRPM(m)
+	if err != nil {
+		return nil, err
+	}
+	r.metaPackage = true
+	return r, nil
+}
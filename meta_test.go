@@ -0,0 +1,49 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMetaRPM(t *testing.T) {
+	r, err := NewMetaRPM(RPMMetaData{
+		Name:     "meta",
+		Version:  "1.0",
+		Requires: Relations{{Name: "bash"}, {Name: "coreutils"}},
+	})
+	if err != nil {
+		t.Fatalf("NewMetaRPM returned error %v", err)
+	}
+	if err := r.Write(io.Discard); err != nil {
+		t.Errorf("Write returned error %v", err)
+	}
+	if len(r.basenames) != 0 {
+		t.Errorf("meta package has file entries: %v", r.basenames)
+	}
+}
+
+func TestMetaRPMWithFiles(t *testing.T) {
+	r, err := NewMetaRPM(RPMMetaData{Name: "meta", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewMetaRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/meta", Body: []byte("content")})
+	if err := r.Write(io.Discard); !errors.Is(err, ErrFilesInMetaPackage) {
+		t.Errorf("Write returned error %v, want %v", err, ErrFilesInMetaPackage)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrArchDependentFile is returned by ForArch when the name of a file depends on the
+// architecture through a macro, e.g. %{_libdir}, as the variants share the payload.
+var ErrArchDependentFile = errors.New("file name depends on the architecture")
+
+// ForArch returns a variant of r for another architecture, e.g. to build the same content
+// for x86_64 and aarch64. The variant shares the payload of r: the files are archived,
+// compressed and digested only once, and only the header is generated for each variant.
+//
+// ForArch finalizes the payload of r, files added to r or to the variant afterwards
+// are not written. Metadata other than the architecture may still be changed on the variant.
+// Macros in the relations and scriptlets are expanded for the architecture of the variant,
+// file names which would expand differently fail with ErrArchDependentFile.
+func (r *RPM) ForArch(arch string) (*RPM, error) {
+	if !r.AllowUnknownArch {
+		if err := checkArch(arch); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.finalizePayload(); err != nil {
+		return nil, err
+	}
+	v := r.copyMetadata()
+	v.Arch = arch
+	if err := v.checkFileNameMacros(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// checkFileNameMacros checks that the file names with macros expand to the names in the
+// payload.
+func (r *RPM) checkFileNameMacros() error {
+	if len(r.fileNameMacros) == 0 {
+		return nil
+	}
+	macros := r.macroTable()
+	names := make([]string, 0, len(r.fileNameMacros))
+	for name := range r.fileNameMacros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expanded, err := expandMacros(r.fileNameMacros[name], macros)
+		if err != nil {
+			return fmt.Errorf("failed to expand file name %q: %w", r.fileNameMacros[name], err)
+		}
+		if normalizePath(expanded) != name {
+			return fmt.Errorf("%w: %q is %q for %s, but %q in the payload", ErrArchDependentFile, r.fileNameMacros[name], expanded, r.Arch, name)
+		}
+	}
+	return nil
+}
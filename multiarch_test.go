@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestForArch(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "multi", Version: "1.0", Arch: "x86_64"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/multi/data", Body: []byte("shared content")})
+
+	v, err := r.ForArch("aarch64")
+	if err != nil {
+		t.Fatalf("ForArch returned error %v", err)
+	}
+	if err := v.Requires.Set("glibc"); err != nil {
+		t.Fatalf("Requires.Set returned error %v", err)
+	}
+	if len(r.Requires) != 0 {
+		t.Errorf("changing the variant's relations changed the original: %v", r.Requires.String())
+	}
+
+	var b1, b2 bytes.Buffer
+	if err := r.Write(&b1); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if err := v.Write(&b2); err != nil {
+		t.Fatalf("variant Write returned error %v", err)
+	}
+	if r.Arch != "x86_64" || v.Arch != "aarch64" {
+		t.Errorf("arch = %q and %q, want x86_64 and aarch64", r.Arch, v.Arch)
+	}
+	payload := r.payload.Bytes()
+	if !bytes.HasSuffix(b1.Bytes(), payload) || !bytes.HasSuffix(b2.Bytes(), payload) {
+		t.Errorf("both rpms should end with the shared payload")
+	}
+	if !bytes.Contains(b2.Bytes(), []byte("aarch64\x00")) {
+		t.Errorf("variant header does not contain its arch")
+	}
+	if len(r.basenames) != 1 {
+		t.Errorf("files were written %d times to the index, want 1", len(r.basenames))
+	}
+}
+
+func TestForArchFiles(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "multi", Version: "1.0", Arch: "x86_64"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/multi/data", Body: []byte("shared content")})
+	v, err := r.ForArch("aarch64")
+	if err != nil {
+		t.Fatalf("ForArch returned error %v", err)
+	}
+	var wg sync.WaitGroup
+	for _, rpm := range []*RPM{r, v} {
+		wg.Add(1)
+		go func(rpm *RPM) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				rpm.AddFile(RPMFile{Name: fmt.Sprintf("/usr/share/multi/%s-%d", rpm.Arch, i)})
+			}
+		}(rpm)
+	}
+	wg.Wait()
+	for _, rpm := range []*RPM{r, v} {
+		for _, f := range rpm.Files() {
+			if f.Name != "/usr/share/multi/data" && !strings.HasPrefix(f.Name, "/usr/share/multi/"+rpm.Arch+"-") {
+				t.Errorf("%s has the file %q added to the other rpm", rpm.Arch, f.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidNEVR is returned by NewRPM and Write when the name, version or release of
+// the rpm is missing or has characters rpm does not accept.
+var ErrInvalidNEVR = errors.New("invalid name, version or release")
+
+const (
+	// nameChars and versionChars are the characters rpmbuild accepts besides letters and
+	// digits. A dash separates the name, version and release, so it is not allowed in the
+	// version and the release.
+	nameChars    = "._+-"
+	versionChars = "._+~^"
+)
+
+// checkNEVR checks the characters of the name, version and release. Empty values are
+// accepted, they are checked by requireNEVR when the rpm is written.
+func checkNEVR(name, version, release string) error {
+	for _, f := range []struct {
+		field, value, chars string
+	}{
+		{"name", name, nameChars},
+		{"version", version, versionChars},
+		{"release", release, versionChars},
+	} {
+		for _, c := range f.value {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune(f.chars, c)) {
+				return fmt.Errorf("%w: %s %q has the illegal character %q, use letters, digits or one of %q", ErrInvalidNEVR, f.field, f.value, c, f.chars)
+			}
+		}
+	}
+	return nil
+}
+
+// requireNEVR checks that the rpm has a valid name and version, and a valid release if any.
+func (r *RPM) requireNEVR() error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("%w: the name is empty", ErrInvalidNEVR)
+	case r.Version == "":
+		return fmt.Errorf("%w: the version is empty", ErrInvalidNEVR)
+	}
+	return checkNEVR(r.Name, r.Version, r.Release)
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNEVRValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		md           RPMMetaData
+		wantNewErr   bool
+		wantWriteErr bool
+	}{
+		{name: "valid", md: RPMMetaData{Name: "python3-foo_bar+extra", Version: "1.2.3~rc1^git5", Release: "1.el9"}},
+		{name: "space in name", md: RPMMetaData{Name: "foo bar", Version: "1.0"}, wantNewErr: true},
+		{name: "slash in name", md: RPMMetaData{Name: "foo/bar", Version: "1.0"}, wantNewErr: true},
+		{name: "dash in version", md: RPMMetaData{Name: "foo", Version: "1.0-1"}, wantNewErr: true},
+		{name: "dash in release", md: RPMMetaData{Name: "foo", Version: "1.0", Release: "1-2"}, wantNewErr: true},
+		{name: "colon in version", md: RPMMetaData{Name: "foo", Version: "1:1.0"}, wantNewErr: true},
+		{name: "empty name", md: RPMMetaData{Version: "1.0"}, wantWriteErr: true},
+		{name: "empty version", md: RPMMetaData{Name: "foo"}, wantWriteErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(tc.md)
+			if tc.wantNewErr {
+				if !errors.Is(err, ErrInvalidNEVR) {
+					t.Errorf("NewRPM returned %v, want ErrInvalidNEVR", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			err = r.Write(io.Discard)
+			if tc.wantWriteErr && !errors.Is(err, ErrInvalidNEVR) {
+				t.Errorf("Write returned %v, want ErrInvalidNEVR", err)
+			}
+			if !tc.wantWriteErr && err != nil {
+				t.Errorf("Write returned error %v", err)
+			}
+		})
+	}
+
+	r, err := NewRPM(RPMMetaData{Name: "foo", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.Release = "1 2"
+	if err := r.Write(io.Discard); !errors.Is(err, ErrInvalidNEVR) {
+		t.Errorf("Write after changing the release returned %v, want ErrInvalidNEVR", err)
+	}
+}
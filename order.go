@@ -0,0 +1,38 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"path"
+	"sort"
+)
+
+// sortByExtension returns the file names sorted by extension, then by base name and
+// then by the full name. Compressors find more repetitions when similar files, like
+// all .py or all .so files, follow each other in the payload.
+func sortByExtension(names []string) []string {
+	sorted := append([]string{}, names...)
+	sort.Slice(sorted, func(i, j int) bool {
+		bi, bj := path.Base(sorted[i]), path.Base(sorted[j])
+		if ei, ej := path.Ext(bi), path.Ext(bj); ei != ej {
+			return ei < ej
+		}
+		if bi != bj {
+			return bi < bj
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSortByExtension(t *testing.T) {
+	names := []string{
+		"/usr/bin/hello",
+		"/usr/lib/b/__init__.py",
+		"/usr/lib/a/util.py",
+		"/usr/lib/a/__init__.py",
+		"/usr/lib/libhello.so",
+		"/usr/share/doc/README",
+	}
+	want := []string{
+		"/usr/share/doc/README",
+		"/usr/bin/hello",
+		"/usr/lib/a/__init__.py",
+		"/usr/lib/b/__init__.py",
+		"/usr/lib/a/util.py",
+		"/usr/lib/libhello.so",
+	}
+	if d := cmp.Diff(want, sortByExtension(names)); d != "" {
+		t.Errorf("sortByExtension returned unexpected names (want->got):\n%s", d)
+	}
+}
+
+func TestPayloadOrder(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "order", Version: "1.0", PayloadOrder: "extension"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, name := range []string{"/a.txt", "/b.py", "/c.txt", "/d.py"} {
+		r.AddFile(RPMFile{Name: name, Body: []byte(name), Mode: 0644})
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"a.txt", "b.py", "c.txt", "d.py"}, r.basenames); d != "" {
+		t.Errorf("header basenames unexpected (want->got):\n%s", d)
+	}
+	z, err := pkg.PayloadReader()
+	if err != nil {
+		t.Fatalf("PayloadReader returned error %v", err)
+	}
+	defer z.Close()
+	c := cpio.NewReader(z)
+	var got []string
+	for {
+		hdr, err := c.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, path.Base(hdr.Name))
+	}
+	if d := cmp.Diff([]string{"b.py", "d.py", "a.txt", "c.txt"}, got); d != "" {
+		t.Errorf("payload order unexpected (want->got):\n%s", d)
+	}
+	if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("VerifyDigests returned error %v", err)
+	}
+
+	if _, err := NewRPM(RPMMetaData{Name: "order", Version: "1.0", PayloadOrder: "random"}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("NewRPM with an unknown payload order returned error %v, want %v", err, ErrInvalidMetadata)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxPathLen and maxNameLen are PATH_MAX and NAME_MAX on Linux.
+	maxPathLen = 4096
+	maxNameLen = 255
+)
+
+// ErrInvalidPath is returned by ValidatePath, and by Write with StrictPaths, for a file
+// name which rpm does not handle.
+var ErrInvalidPath = errors.New("invalid file path")
+
+// normalizePath removes the trailing and duplicate slashes of a file name, so that
+// "/etc/foo/" and "/etc//foo" name the same file as "/etc/foo". Unlike path.Clean, it
+// keeps "." and ".." components, which are rejected by ValidatePath.
+func normalizePath(name string) string {
+	for strings.Contains(name, "//") {
+		name = strings.ReplaceAll(name, "//", "/")
+	}
+	if len(name) > 1 {
+		name = strings.TrimSuffix(name, "/")
+	}
+	return name
+}
+
+// ValidatePath checks that a file name can be installed by rpm: it must be absolute and
+// clean, without empty, "." or ".." components, without NUL bytes, at most 4096 bytes
+// long, and with components of at most 255 bytes.
+func ValidatePath(name string) error {
+	switch {
+	case !strings.HasPrefix(name, "/"):
+		return fmt.Errorf("%w: %q is not absolute", ErrInvalidPath, name)
+	case name == "/":
+		return fmt.Errorf("%w: the root directory can not be packaged", ErrInvalidPath)
+	case strings.IndexByte(name, 0) >= 0:
+		return fmt.Errorf("%w: %q contains a NUL byte", ErrInvalidPath, name)
+	case len(name) > maxPathLen:
+		return fmt.Errorf("%w: %.32q... is longer than %d bytes", ErrInvalidPath, name, maxPathLen)
+	}
+	for _, c := range strings.Split(name[1:], "/") {
+		switch {
+		case c == "":
+			return fmt.Errorf("%w: %q has an empty component", ErrInvalidPath, name)
+		case c == "." || c == "..":
+			return fmt.Errorf("%w: %q has a %q component", ErrInvalidPath, name, c)
+		case len(c) > maxNameLen:
+			return fmt.Errorf("%w: %q has a component longer than %d bytes", ErrInvalidPath, name, maxNameLen)
+		}
+	}
+	return nil
+}
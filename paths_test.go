@@ -0,0 +1,100 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		valid bool
+	}{
+		{name: "/usr/bin/hello", valid: true},
+		{name: "/etc/.hidden/..config", valid: true},
+		{name: "/usr/share/" + strings.Repeat("a", 255), valid: true},
+		{name: "usr/bin/hello"},
+		{name: "./usr/bin/hello"},
+		{name: "/"},
+		{name: "/usr//bin"},
+		{name: "/usr/bin/"},
+		{name: "/usr/./bin"},
+		{name: "/usr/../etc/passwd"},
+		{name: "/usr/bin/hel\x00lo"},
+		{name: "/usr/share/" + strings.Repeat("a", 256)},
+		{name: strings.Repeat("/abc", 1025)},
+	} {
+		err := ValidatePath(tc.name)
+		if tc.valid && err != nil {
+			t.Errorf("ValidatePath(%.40q) returned error %v", tc.name, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("ValidatePath(%.40q) returned %v, want ErrInvalidPath", tc.name, err)
+		}
+	}
+}
+
+func TestStrictPaths(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		r, err := NewRPM(RPMMetaData{Name: "paths", Version: "1.0", StrictPaths: strict})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/bin/hello", Body: []byte("hello")})
+		r.AddFile(RPMFile{Name: "/usr/../etc/hello", Body: []byte("hello")})
+		err = r.Write(&bytes.Buffer{})
+		if strict && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Write with StrictPaths returned %v, want ErrInvalidPath", err)
+		}
+		if !strict && err != nil {
+			t.Errorf("Write without StrictPaths returned error %v", err)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	for name, want := range map[string]string{
+		"/etc/foo":      "/etc/foo",
+		"/etc/foo/":     "/etc/foo",
+		"/etc//foo":     "/etc/foo",
+		"//etc///foo//": "/etc/foo",
+		"/":             "/",
+		"//":            "/",
+		"/etc/../foo/":  "/etc/../foo",
+		"etc/foo/":      "etc/foo",
+	} {
+		if got := normalizePath(name); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	r, err := NewRPM(RPMMetaData{Name: "paths", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/foo", Mode: 040755})
+	r.AddFile(RPMFile{Name: "/etc/foo/", Mode: 040750})
+	r.AddFile(RPMFile{Name: "/etc//bar/", Mode: 040755})
+	r.AddFile(RPMFile{Name: "//", Mode: 040755})
+	r.AllowListDirs(map[string]bool{"/etc/foo/": true})
+	files := r.Files()
+	if len(files) != 1 || files[0].Name != "/etc/foo" || files[0].Mode != 040750 {
+		t.Errorf("AddFile and AllowListDirs kept %v, want only /etc/foo with mode 040750", files)
+	}
+}
@@ -0,0 +1,492 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queryTagAliases are the other names rpm accepts for some tags.
+var queryTagAliases = map[string]string{
+	"PROVIDES":    "PROVIDENAME",
+	"REQUIRES":    "REQUIRENAME",
+	"CONFLICTS":   "CONFLICTNAME",
+	"OBSOLETES":   "OBSOLETENAME",
+	"RECOMMENDS":  "RECOMMENDNAME",
+	"SUGGESTS":    "SUGGESTNAME",
+	"SUPPLEMENTS": "SUPPLEMENTNAME",
+	"ENHANCES":    "ENHANCENAME",
+	"FILEMD5S":    "FILEDIGESTS",
+	"COPYRIGHT":   "LICENSE",
+}
+
+// QueryFormat formats the header like rpm -q --queryformat, so that scripts written
+// against rpm -q can use rpmpack, e.g.
+//
+//	%{NAME}-%{VERSION}-%{RELEASE}\n
+//	[%{FILEMODES:perms} %{FILEUSERNAME} %{FILENAMES}\n]
+//	%|EPOCH?{%{EPOCH}:}|%{VERSION}
+//
+// Tags are named like in rpm --querytags, case-insensitively, and the virtual tags
+// FILENAMES, EPOCHNUM, EVR, NVR, NEVR, NVRA and NEVRA are supported. Outside of [] an
+// array tag gives its first value; inside, the arrays are iterated in parallel and
+// %{=TAG} repeats the first value. The formats are :octal, :hex, :date, :day (in UTC),
+// :shescape, :perms, :depflags and :arraysize. Missing tags are printed as "(none)".
+func (pkg *Package) QueryFormat(format string) (string, error) {
+	nodes, rest, err := parseQueryFormat(format, 0)
+	if err != nil {
+		return "", err
+	}
+	if rest != "" {
+		return "", fmt.Errorf("query format: unexpected %q", rest)
+	}
+	q := &queryFormatter{pkg: pkg, values: make(map[string][]interface{})}
+	var out strings.Builder
+	if err := q.eval(&out, nodes, -1); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// qfNode is a part of a parsed query format: a string, a *qfTag, a qfArray or a *qfCond.
+type qfNode interface{}
+
+// qfTag is %{TAG}, with an optional width (%-20{TAG}), format (%{TAG:octal}) and "=" prefix.
+type qfTag struct {
+	name   string
+	width  string
+	format string
+	first  bool
+}
+
+// qfArray is [...], iterated over the array tags it contains.
+type qfArray []qfNode
+
+// qfCond is %|TAG?{present}:{missing}|.
+type qfCond struct {
+	name             string
+	present, missing []qfNode
+}
+
+// parseQueryFormat parses format until the closing character of the given depth, ']' or
+// '}', and returns the nodes and the rest of the format, starting at the closing character.
+func parseQueryFormat(format string, end byte) ([]qfNode, string, error) {
+	var (
+		nodes []qfNode
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, text.String())
+			text.Reset()
+		}
+	}
+	for len(format) > 0 {
+		c := format[0]
+		switch {
+		case end != 0 && c == end:
+			flush()
+			return nodes, format, nil
+		case c == '\\' && len(format) > 1:
+			text.WriteString(unescapeQueryFormat(format[1]))
+			format = format[2:]
+		case c == '[':
+			flush()
+			children, rest, err := parseQueryFormat(format[1:], ']')
+			if err != nil {
+				return nil, "", err
+			}
+			if rest == "" {
+				return nil, "", fmt.Errorf("query format: missing ]")
+			}
+			nodes = append(nodes, qfArray(children))
+			format = rest[1:]
+		case c == '%' && strings.HasPrefix(format, "%%"):
+			text.WriteByte('%')
+			format = format[2:]
+		case c == '%' && strings.HasPrefix(format, "%|"):
+			flush()
+			cond, rest, err := parseQueryCond(format[2:])
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, cond)
+			format = rest
+		case c == '%':
+			flush()
+			tag, rest, err := parseQueryTag(format[1:])
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, tag)
+			format = rest
+		default:
+			text.WriteByte(c)
+			format = format[1:]
+		}
+	}
+	flush()
+	return nodes, "", nil
+}
+
+// parseQueryTag parses a tag after the '%': [width]{[=]NAME[:format]}.
+func parseQueryTag(format string) (*qfTag, string, error) {
+	i := strings.IndexByte(format, '{')
+	if i < 0 {
+		return nil, "", fmt.Errorf("query format: missing { after %%")
+	}
+	t := &qfTag{width: format[:i]}
+	if strings.Trim(t.width, "-0123456789") != "" {
+		return nil, "", fmt.Errorf("query format: invalid width %q", t.width)
+	}
+	format = format[i+1:]
+	j := strings.IndexByte(format, '}')
+	if j < 0 {
+		return nil, "", fmt.Errorf("query format: missing } after %%{")
+	}
+	name := format[:j]
+	if strings.HasPrefix(name, "=") {
+		t.first, name = true, name[1:]
+	}
+	t.name, t.format, _ = strings.Cut(name, ":")
+	if t.name == "" {
+		return nil, "", fmt.Errorf("query format: empty tag name")
+	}
+	return t, format[j+1:], nil
+}
+
+// parseQueryCond parses a condition after the "%|": NAME?{present}[:{missing}]|.
+func parseQueryCond(format string) (*qfCond, string, error) {
+	i := strings.IndexByte(format, '?')
+	if i < 0 {
+		return nil, "", fmt.Errorf("query format: missing ? after %%|")
+	}
+	cond := &qfCond{name: format[:i]}
+	branch := func(format string) ([]qfNode, string, error) {
+		if !strings.HasPrefix(format, "{") {
+			return nil, "", fmt.Errorf("query format: missing { in %%|%s?", cond.name)
+		}
+		nodes, rest, err := parseQueryFormat(format[1:], '}')
+		if err != nil {
+			return nil, "", err
+		}
+		if rest == "" {
+			return nil, "", fmt.Errorf("query format: missing } in %%|%s?", cond.name)
+		}
+		return nodes, rest[1:], nil
+	}
+	var err error
+	if cond.present, format, err = branch(format[i+1:]); err != nil {
+		return nil, "", err
+	}
+	if strings.HasPrefix(format, ":") {
+		if cond.missing, format, err = branch(format[1:]); err != nil {
+			return nil, "", err
+		}
+	}
+	if !strings.HasPrefix(format, "|") {
+		return nil, "", fmt.Errorf("query format: missing | after %%|%s?", cond.name)
+	}
+	return cond, format[1:], nil
+}
+
+func unescapeQueryFormat(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case 'a':
+		return "\a"
+	case 'b':
+		return "\b"
+	case 'f':
+		return "\f"
+	case 'v':
+		return "\v"
+	default:
+		return string(c)
+	}
+}
+
+// queryFormatter evaluates a parsed query format.
+type queryFormatter struct {
+	pkg *Package
+	// values caches the values of the tags by name, nil for missing tags.
+	values map[string][]interface{}
+}
+
+// eval writes the nodes, with the element idx of array tags, or -1 outside of arrays.
+func (q *queryFormatter) eval(out *strings.Builder, nodes []qfNode, idx int) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case string:
+			out.WriteString(n)
+		case *qfTag:
+			values, err := q.lookup(n.name)
+			if err != nil {
+				return err
+			}
+			i := idx
+			if i < 0 || n.first {
+				i = 0
+			}
+			s := "(none)"
+			switch {
+			case n.format == "arraysize":
+				s = fmt.Sprint(len(values))
+			case i < len(values):
+				if s, err = formatQueryValue(values[i], n.format); err != nil {
+					return err
+				}
+			}
+			if n.width != "" {
+				s = fmt.Sprintf("%"+n.width+"s", s)
+			}
+			out.WriteString(s)
+		case qfArray:
+			count, err := q.arrayCount(n)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < count; i++ {
+				if err := q.eval(out, n, i); err != nil {
+					return err
+				}
+			}
+		case *qfCond:
+			values, err := q.lookup(n.name)
+			if err != nil {
+				return err
+			}
+			branch := n.missing
+			if len(values) > 0 {
+				branch = n.present
+			}
+			if err := q.eval(out, branch, idx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// arrayCount returns the number of iterations of an array: the size of the arrays it
+// contains, which must all have the same size.
+func (q *queryFormatter) arrayCount(nodes []qfNode) (int, error) {
+	count, name := 0, ""
+	var walk func([]qfNode) error
+	walk = func(nodes []qfNode) error {
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *qfTag:
+				if n.first {
+					continue
+				}
+				values, err := q.lookup(n.name)
+				if err != nil {
+					return err
+				}
+				if len(values) == 0 {
+					continue
+				}
+				if name != "" && len(values) != count {
+					return fmt.Errorf("query format: array iterator used with different sized arrays %s (%d) and %s (%d)",
+						name, count, n.name, len(values))
+				}
+				count, name = len(values), n.name
+			case *qfCond:
+				if err := walk(n.present); err != nil {
+					return err
+				}
+				if err := walk(n.missing); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk(nodes)
+	return count, err
+}
+
+// lookup returns the values of a tag, each a string or an uint64, or nil if it is missing.
+func (q *queryFormatter) lookup(name string) ([]interface{}, error) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "RPMTAG_")
+	if alias, ok := queryTagAliases[name]; ok {
+		name = alias
+	}
+	if values, ok := q.values[name]; ok {
+		return values, nil
+	}
+	values, err := q.pkg.queryValues(name)
+	if err != nil {
+		return nil, err
+	}
+	q.values[name] = values
+	return values, nil
+}
+
+// queryValues returns the values of a tag or virtual tag by its upper case name.
+func (pkg *Package) queryValues(name string) ([]interface{}, error) {
+	h := pkg.Header
+	str := func(tag int) string {
+		s, _ := h.String(tag)
+		return s
+	}
+	epoch, hasEpoch := "", false
+	if e, err := h.Int32s(tagEpoch); err == nil && len(e) == 1 {
+		epoch, hasEpoch = fmt.Sprint(uint32(e[0])), true
+	}
+	vr := str(tagVersion)
+	if release := str(tagRelease); release != "" {
+		vr += "-" + release
+	}
+	evr := vr
+	if hasEpoch {
+		evr = epoch + ":" + vr
+	}
+	switch name {
+	case "FILENAMES":
+		files, err := pkg.Header.fileNames()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(files))
+		for i, f := range files {
+			values[i] = f
+		}
+		return values, nil
+	case "EPOCHNUM":
+		if !hasEpoch {
+			return []interface{}{uint64(0)}, nil
+		}
+		return pkg.queryValues("EPOCH")
+	case "EVR":
+		return []interface{}{evr}, nil
+	case "NVR":
+		return []interface{}{str(tagName) + "-" + vr}, nil
+	case "NEVR":
+		return []interface{}{str(tagName) + "-" + evr}, nil
+	case "NVRA":
+		return []interface{}{str(tagName) + "-" + vr + "." + str(tagArch)}, nil
+	case "NEVRA":
+		return []interface{}{str(tagName) + "-" + evr + "." + str(tagArch)}, nil
+	}
+	tag, ok := headerTagNumbers[name]
+	if !ok {
+		return nil, fmt.Errorf("query format: unknown tag %q", name)
+	}
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil, nil
+	}
+	switch e.rpmtype {
+	case typeString, typeStringArray, typeI18NString:
+		s := e.strings()
+		values := make([]interface{}, len(s))
+		for i := range s {
+			values[i] = s[i]
+		}
+		return values, nil
+	case typeChar, typeInt8, typeInt16, typeInt32, typeInt64:
+		size := map[int]int{typeChar: 1, typeInt8: 1, typeInt16: 2, typeInt32: 4, typeInt64: 8}[e.rpmtype]
+		values := make([]interface{}, e.count)
+		for i := range values {
+			b := make([]byte, 8)
+			copy(b[8-size:], e.data[size*i:size*(i+1)])
+			values[i] = binary.BigEndian.Uint64(b)
+		}
+		return values, nil
+	default:
+		return []interface{}{fmt.Sprintf("%x", e.data)}, nil
+	}
+}
+
+// formatQueryValue formats a value with a query format, like rpm's :octal.
+func formatQueryValue(v interface{}, format string) (string, error) {
+	n, isNumber := v.(uint64)
+	switch format {
+	case "":
+		return fmt.Sprint(v), nil
+	case "shescape":
+		return shellQuote(fmt.Sprint(v)), nil
+	case "octal", "hex", "date", "day", "perms", "depflags":
+	default:
+		return "", fmt.Errorf("query format: unknown format %q", format)
+	}
+	if !isNumber {
+		return "(not a number)", nil
+	}
+	switch format {
+	case "octal":
+		return fmt.Sprintf("%o", n), nil
+	case "hex":
+		return fmt.Sprintf("%x", n), nil
+	case "date":
+		return time.Unix(int64(n), 0).UTC().Format("Mon Jan _2 15:04:05 2006"), nil
+	case "day":
+		return time.Unix(int64(n), 0).UTC().Format("Mon Jan _2 2006"), nil
+	case "perms":
+		return permString(n), nil
+	default: // depflags
+		return rpmSense(n).String(), nil
+	}
+}
+
+// permString formats a file mode like ls -l, e.g. "-rwxr-xr-x".
+func permString(mode uint64) string {
+	b := []byte("?rwxrwxrwx")
+	switch mode & 0170000 {
+	case 0100000:
+		b[0] = '-'
+	case 040000:
+		b[0] = 'd'
+	case 0120000:
+		b[0] = 'l'
+	case 020000:
+		b[0] = 'c'
+	case 060000:
+		b[0] = 'b'
+	case 010000:
+		b[0] = 'p'
+	case 0140000:
+		b[0] = 's'
+	}
+	for i := 0; i < 9; i++ {
+		if mode&(1<<(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+	special := func(bit uint64, i int, set, unset byte) {
+		if mode&bit == 0 {
+			return
+		}
+		if b[i] == '-' {
+			b[i] = unset
+		} else {
+			b[i] = set
+		}
+	}
+	special(04000, 3, 's', 'S')
+	special(02000, 6, 's', 'S')
+	special(01000, 9, 't', 'T')
+	return string(b)
+}
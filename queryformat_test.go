@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestQueryFormat(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:      "query",
+		Version:   "1.0",
+		Release:   "2",
+		Epoch:     3,
+		Arch:      "x86_64",
+		Requires:  Relations{{Name: "bash"}, {Name: "glibc", Version: "2.28", Sense: SenseGreater | SenseEqual}},
+		BuildTime: time.Unix(1600000000, 0),
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/query", Body: []byte("binary"), Mode: 04755, Owner: "root", Group: "root"})
+	r.AddFile(RPMFile{Name: "/etc/query.conf", Body: []byte("it's"), Mode: 0640, Owner: "root", Group: "query"})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+
+	testCases := []struct {
+		format string
+		want   string
+	}{
+		{`%{NAME}-%{VERSION}-%{RELEASE}\n`, "query-1.0-2\n"},
+		{`%{name}.%{RPMTAG_ARCH}`, "query.x86_64"},
+		{`%{NEVRA} %{NVR} %{EVR} %{EPOCHNUM}`, "query-3:1.0-2.x86_64 query-1.0-2 3:1.0-2 3"},
+		{`%|EPOCH?{%{EPOCH}:}|%{VERSION}`, "3:1.0"},
+		{`%|VENDOR?{%{VENDOR}}:{no vendor}|`, "no vendor"},
+		{`%{VENDOR}`, "(none)"},
+		{`%-8{NAME}|%8{VERSION}|`, "query   |     1.0|"},
+		{`[%{FILEMODES:perms} %{FILEGROUPNAME} %{FILENAMES}\n]`, "-rw-r----- query /etc/query.conf\n-rwsr-xr-x root /usr/bin/query\n"},
+		{`[%{FILEMODES:octal} ]`, "100640 104755 "},
+		{`[%{=NAME}:%{BASENAMES} ]`, "query:query.conf query:query "},
+		{`[%{REQUIRES}%{REQUIREFLAGS:depflags}%{REQUIREVERSION},]`, "bash,glibc>=2.28,"},
+		{`%{REQUIRES} %{REQUIRES:arraysize}`, "bash 2"},
+		{`%{BUILDTIME:date} %{BUILDTIME:day} %{BUILDTIME:hex}`, "Sun Sep 13 12:26:40 2020 Sun Sep 13 2020 5f5e1000"},
+		{`%{NAME:octal} %{BASENAMES:shescape}`, "(not a number) 'query.conf'"},
+		{`100%% \[%{NAME}\]\t`, "100% [query]\t"},
+	}
+	for _, tc := range testCases {
+		got, err := pkg.QueryFormat(tc.format)
+		if err != nil {
+			t.Errorf("QueryFormat(%q) returned error %v", tc.format, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("QueryFormat(%q) = %q, want %q", tc.format, got, tc.want)
+		}
+	}
+
+	for _, format := range []string{
+		`%{NAME`,
+		`%{}`,
+		`[%{NAME}`,
+		`%|NAME?{x`,
+		`%|NAME?{x}`,
+		`%{NOSUCHTAG}`,
+		`%{NAME:nosuchformat}`,
+		`[%{FILENAMES} %{PROVIDES}]`,
+		`%x{NAME}`,
+	} {
+		if _, err := pkg.QueryFormat(format); err == nil {
+			t.Errorf("QueryFormat(%q) should have returned an error", format)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+var (
+	// ErrNotRPM is returned when reading something which is not an rpm.
+	ErrNotRPM = errors.New("not an rpm")
+	// ErrTagNotFound is returned when reading a tag which is not in a header.
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrInvalidHeader is returned when reading a header which is malformed.
+	ErrInvalidHeader = errors.New("invalid header")
+)
+
+const (
+	leadSize = 96
+	// maxIndexSize limits the size of a header, like rpm's HEADER_DATA_MAX.
+	maxIndexSize = 256 << 20
+)
+
+var (
+	leadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// Package is an rpm read with ReadPackage. The header and signature entries can be read
+// by tag number, e.g. p.Header.String(1000) for the name, see
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmtag.h
+type Package struct {
+	Lead      Lead
+	Signature *Header
+	Header    *Header
+	lead      []byte
+	// payload is the compressed payload.
+	payload []byte
+}
+
+// Lead is the obsolete lead of an rpm, which rpm still writes and checks.
+type Lead struct {
+	Major         byte   `json:"major"`
+	Minor         byte   `json:"minor"`
+	Type          uint16 `json:"type"`
+	Arch          uint16 `json:"arch"`
+	Name          string `json:"name"`
+	OS            uint16 `json:"os"`
+	SignatureType uint16 `json:"signature_type"`
+}
+
+// Header is a header structure of a Package, the signature header or the main header.
+type Header struct {
+	entries map[int]IndexEntry
+	// raw holds the exact bytes of the header, which are signed.
+	raw []byte
+	// modified is set when the entries were changed after the header was read.
+	modified bool
+}
+
+// ReadPackage reads a whole rpm. The payload is kept compressed, see Package.PayloadReader.
+func ReadPackage(r io.Reader) (*Package, error) {
+	pkg := &Package{lead: make([]byte, leadSize), Signature: &Header{}, Header: &Header{}}
+	if _, err := io.ReadFull(r, pkg.lead); err != nil {
+		return nil, fmt.Errorf("failed to read lead: %w", err)
+	}
+	if !bytes.Equal(pkg.lead[:4], leadMagic) {
+		return nil, ErrNotRPM
+	}
+	pkg.Lead = Lead{
+		Major:         pkg.lead[4],
+		Minor:         pkg.lead[5],
+		Type:          binary.BigEndian.Uint16(pkg.lead[6:]),
+		Arch:          binary.BigEndian.Uint16(pkg.lead[8:]),
+		Name:          string(bytes.TrimRight(pkg.lead[10:76], "\x00")),
+		OS:            binary.BigEndian.Uint16(pkg.lead[76:]),
+		SignatureType: binary.BigEndian.Uint16(pkg.lead[78:]),
+	}
+	var err error
+	if pkg.Signature.raw, pkg.Signature.entries, err = readIndex(r); err != nil {
+		return nil, fmt.Errorf("failed to read signature header: %w", err)
+	}
+	// The signature header is padded to 8-byte boundaries.
+	if _, err := io.ReadFull(r, make([]byte, (8-len(pkg.Signature.raw)%8)%8)); err != nil {
+		return nil, fmt.Errorf("failed to read signature padding: %w", err)
+	}
+	if pkg.Header.raw, pkg.Header.entries, err = readIndex(r); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if pkg.payload, err = io.ReadAll(r); err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	return pkg, nil
+}
+
+// PayloadReader returns a reader of the uncompressed payload, a cpio archive, which
+// must be closed.
+func (pkg *Package) PayloadReader() (io.ReadCloser, error) {
+	compressor := ""
+	if v := pkg.Header.entries[tagPayloadCompressor].strings(); len(v) > 0 {
+		compressor = v[0]
+	}
+	z, err := decompressor(compressor, bytes.NewReader(pkg.payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return z, nil
+}
+
+// RawPayload returns the compressed payload.
+func (pkg *Package) RawPayload() []byte {
+	return pkg.payload
+}
+
+// Files returns the files of the package, in header order, with their content read from
+// the payload. Like for RPM.AddFile, the body of a symlink is its target. Ghost files have
+// no body.
+func (pkg *Package) Files() ([]RPMFile, error) {
+	names, err := pkg.Header.fileNames()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		h       = pkg.Header.entries
+		owners  = h[tagFileUserName].strings()
+		groups  = h[tagFileGroupName].strings()
+		mtimes  = h[tagFileMTimes].int32s()
+		flags   = h[tagFileFlags].int32s()
+		linkTos = h[tagFileLinkTos].strings()
+	)
+	modes, err := pkg.Header.Int16s(tagFileModes)
+	if err != nil && len(names) > 0 {
+		return nil, err
+	}
+	for _, n := range []int{len(owners), len(groups), len(mtimes), len(flags), len(linkTos), len(modes)} {
+		if n != len(names) {
+			return nil, fmt.Errorf("%w: header has %d files but %d values of a file tag", ErrInconsistentFileIndex, len(names), n)
+		}
+	}
+	files := make([]RPMFile, len(names))
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		files[i] = RPMFile{
+			Name:  name,
+			Mode:  uint(uint16(modes[i])),
+			Owner: owners[i],
+			Group: groups[i],
+			MTime: uint32(mtimes[i]),
+			Type:  FileType(flags[i]),
+		}
+		if files[i].Mode&0170000 == 0120000 {
+			files[i].Body = []byte(linkTos[i])
+		}
+		index[name] = i
+	}
+
+	z, err := pkg.PayloadReader()
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	c := cpio.NewReader(z)
+	// Only the last entry of a set of hard links has the content.
+	links := make(map[int64][]int)
+	for {
+		hdr, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload: %w", err)
+		}
+		i, ok := index[headerFileName(hdr.Name)]
+		if !ok || !hdr.Mode.IsRegular() {
+			continue
+		}
+		if hdr.Links > 1 {
+			links[hdr.Inode] = append(links[hdr.Inode], i)
+		}
+		if hdr.Size == 0 {
+			continue
+		}
+		body, err := io.ReadAll(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload file %q: %w", files[i].Name, err)
+		}
+		files[i].Body = body
+		for _, j := range links[hdr.Inode] {
+			files[j].Body = body
+		}
+	}
+	return files, nil
+}
+
+// Tags returns the tags of the header in increasing order, without the region tag.
+func (h *Header) Tags() []int {
+	tags := make([]int, 0, len(h.entries))
+	for tag := range h.entries {
+		if tag != signatures && tag != immutable {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Ints(tags)
+	return tags
+}
+
+// Entry returns the raw entry of a tag.
+func (h *Header) Entry(tag int) (IndexEntry, bool) {
+	e, ok := h.entries[tag]
+	return e, ok
+}
+
+// Raw returns the exact bytes of the header.
+func (h *Header) Raw() []byte {
+	return h.raw
+}
+
+func (h *Header) entry(tag int, types ...int) (IndexEntry, error) {
+	e, ok := h.entries[tag]
+	if !ok {
+		return IndexEntry{}, fmt.Errorf("tag %d: %w", tag, ErrTagNotFound)
+	}
+	for _, t := range types {
+		if e.rpmtype == t {
+			return e, nil
+		}
+	}
+	return IndexEntry{}, fmt.Errorf("tag %d has type %d, want one of %v", tag, e.rpmtype, types)
+}
+
+// String returns the value of a string tag. For an array, it returns the first value.
+func (h *Header) String(tag int) (string, error) {
+	v, err := h.Strings(tag)
+	if err != nil {
+		return "", err
+	}
+	if len(v) == 0 {
+		return "", nil
+	}
+	return v[0], nil
+}
+
+// Strings returns the value of a string, string array or i18n string tag.
+func (h *Header) Strings(tag int) ([]string, error) {
+	e, err := h.entry(tag, typeString, typeStringArray, typeI18NString)
+	if err != nil {
+		return nil, err
+	}
+	return e.strings(), nil
+}
+
+// Int16s returns the value of an int16 tag.
+func (h *Header) Int16s(tag int) ([]int16, error) {
+	e, err := h.entry(tag, typeInt16)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]int16, e.count)
+	for i := range v {
+		v[i] = int16(binary.BigEndian.Uint16(e.data[2*i:]))
+	}
+	return v, nil
+}
+
+// Int32s returns the value of an int32 tag.
+func (h *Header) Int32s(tag int) ([]int32, error) {
+	e, err := h.entry(tag, typeInt32)
+	if err != nil {
+		return nil, err
+	}
+	return e.int32s(), nil
+}
+
+// Uint32s returns the value of an int32 tag as unsigned integers, e.g. sizes and flags.
+func (h *Header) Uint32s(tag int) ([]uint32, error) {
+	v, err := h.Int32s(tag)
+	if err != nil {
+		return nil, err
+	}
+	u := make([]uint32, len(v))
+	for i, n := range v {
+		u[i] = uint32(n)
+	}
+	return u, nil
+}
+
+// Int64s returns the value of an int64 tag.
+func (h *Header) Int64s(tag int) ([]int64, error) {
+	e, err := h.entry(tag, typeInt64)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]int64, e.count)
+	for i := range v {
+		v[i] = int64(binary.BigEndian.Uint64(e.data[8*i:]))
+	}
+	return v, nil
+}
+
+// Bytes returns the value of a binary, char or int8 tag.
+func (h *Header) Bytes(tag int) ([]byte, error) {
+	e, err := h.entry(tag, typeBinary, typeChar, typeInt8)
+	if err != nil {
+		return nil, err
+	}
+	return e.data, nil
+}
+
+// fileNames returns the paths of the files in the header, joining their basenames and
+// dirnames.
+func (h *Header) fileNames() ([]string, error) {
+	var (
+		basenames  = h.entries[tagBasenames].strings()
+		dirnames   = h.entries[tagDirnames].strings()
+		dirindexes = h.entries[tagDirindexes].int32s()
+	)
+	if len(dirindexes) != len(basenames) {
+		return nil, fmt.Errorf("%w: header has %d basenames and %d dirindexes", ErrInconsistentFileIndex, len(basenames), len(dirindexes))
+	}
+	files := make([]string, len(basenames))
+	for i, base := range basenames {
+		if int(dirindexes[i]) >= len(dirnames) || dirindexes[i] < 0 {
+			return nil, fmt.Errorf("%w: file %q has dirindex %d out of range", ErrInconsistentFileIndex, base, dirindexes[i])
+		}
+		files[i] = dirnames[dirindexes[i]] + base
+	}
+	return files, nil
+}
+
+// headerFileName returns the name in the header of a file of the payload: "./usr/bin/hello"
+// and "/usr/bin/hello" are "/usr/bin/hello", and the files of source rpms, e.g.
+// "hello.spec", have no directory.
+func headerFileName(payloadName string) string {
+	switch {
+	case payloadName == ".":
+		return "/"
+	case strings.HasPrefix(payloadName, "./"):
+		return path.Clean(payloadName[1:])
+	case strings.HasPrefix(payloadName, "/"):
+		return path.Clean(payloadName)
+	}
+	return payloadName
+}
+
+// readIndex reads a header structure, as written by index.Bytes, and returns its bytes
+// and its entries. The region entry (the "eigenHeader") is part of the entries.
+func readIndex(r io.Reader) ([]byte, map[int]IndexEntry, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(intro[:4], headerMagic) {
+		return nil, nil, fmt.Errorf("%w: bad header magic %x", ErrInvalidHeader, intro[:4])
+	}
+	count := binary.BigEndian.Uint32(intro[8:12])
+	size := binary.BigEndian.Uint32(intro[12:16])
+	if uint64(count)*16+uint64(size) > maxIndexSize {
+		return nil, nil, fmt.Errorf("%w: header of %d entries and %d bytes is too large", ErrInvalidHeader, count, size)
+	}
+	b := make([]byte, 16+int(count)*16+int(size))
+	copy(b, intro)
+	if _, err := io.ReadFull(r, b[16:]); err != nil {
+		return nil, nil, err
+	}
+	data := b[16+count*16:]
+	entries := make(map[int]IndexEntry, count)
+	for i := 0; i < int(count); i++ {
+		ib := b[16+i*16 : 32+i*16]
+		tag := int(int32(binary.BigEndian.Uint32(ib[0:4])))
+		rpmtype := int(binary.BigEndian.Uint32(ib[4:8]))
+		offset := int(binary.BigEndian.Uint32(ib[8:12]))
+		n := int(binary.BigEndian.Uint32(ib[12:16]))
+		if offset < 0 || offset > len(data) {
+			return nil, nil, fmt.Errorf("%w: tag %d: offset %d out of range", ErrInvalidHeader, tag, offset)
+		}
+		l, err := entryLen(rpmtype, n, data[offset:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("tag %d: %w", tag, err)
+		}
+		entries[tag] = IndexEntry{rpmtype: rpmtype, count: n, data: data[offset : offset+l]}
+	}
+	return b, entries, nil
+}
+
+// entryLen returns the length of the data of an entry of the given type and count.
+func entryLen(rpmtype, count int, data []byte) (int, error) {
+	var l int
+	switch rpmtype {
+	case typeChar, typeInt8, typeBinary:
+		l = count
+	case typeInt16:
+		l = 2 * count
+	case typeInt32:
+		l = 4 * count
+	case typeInt64:
+		l = 8 * count
+	case typeString, typeStringArray, typeI18NString:
+		if rpmtype == typeString {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			n := bytes.IndexByte(data[l:], 0)
+			if n < 0 {
+				return 0, errors.New("unterminated string")
+			}
+			l += n + 1
+		}
+	default:
+		return 0, fmt.Errorf("%w: unknown type %d", ErrInvalidHeader, rpmtype)
+	}
+	if l < 0 || l > len(data) {
+		return 0, fmt.Errorf("%w: %d bytes of data out of range", ErrInvalidHeader, l)
+	}
+	return l, nil
+}
+
+// strings returns the value of a string, string array or i18n string entry.
+func (e IndexEntry) strings() []string {
+	switch e.rpmtype {
+	case typeString, typeStringArray, typeI18NString:
+	default:
+		return nil
+	}
+	s := make([]string, 0, e.count)
+	for _, b := range bytes.SplitN(e.data, []byte{0}, e.count+1)[:e.count] {
+		s = append(s, string(b))
+	}
+	return s
+}
+
+// int32s returns the value of an int32 entry.
+func (e IndexEntry) int32s() []int32 {
+	if e.rpmtype != typeInt32 {
+		return nil
+	}
+	v := make([]int32, e.count)
+	for i := range v {
+		v[i] = int32(binary.BigEndian.Uint32(e.data[4*i:]))
+	}
+	return v
+}
+
+// decompressor returns a reader of the uncompressed payload, which must be closed.
+func decompressor(compressor string, payload io.Reader) (io.ReadCloser, error) {
+	switch compressor {
+	case "gzip", "":
+		return gzip.NewReader(payload)
+	case "lzma":
+		r, err := lzma.NewReader(payload)
+		return io.NopCloser(r), err
+	case "xz":
+		r, err := xz.NewReader(payload)
+		return io.NopCloser(r), err
+	case "zstd":
+		d, err := zstd.NewReader(payload)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown compressor type: %s", ErrUnsupportedCompressor, compressor)
+	}
+}
+
+// headerOffset returns the offset of the header in the rpm file.
+func (pkg *Package) headerOffset() int {
+	return len(pkg.lead) + len(pkg.Signature.raw) + (8-len(pkg.Signature.raw)%8)%8
+}
+
+// signatureIndex returns a copy of the signature header, without the region entry.
+func (pkg *Package) signatureIndex() *index {
+	s := newIndex(signatures)
+	s.AddEntries(pkg.Signature.entries)
+	delete(s.entries, signatures)
+	return s
+}
+
+// write writes the rpm, like RPM.Write.
+func (pkg *Package) write(w io.Writer) error {
+	if _, err := w.Write(pkg.lead); err != nil {
+		return fmt.Errorf("failed to write lead: %w", err)
+	}
+	if _, err := w.Write(pkg.Signature.raw); err != nil {
+		return fmt.Errorf("failed to write signature bytes: %w", err)
+	}
+	if _, err := w.Write(make([]byte, (8-len(pkg.Signature.raw)%8)%8)); err != nil {
+		return fmt.Errorf("failed to write signature padding: %w", err)
+	}
+	if _, err := w.Write(pkg.Header.raw); err != nil {
+		return fmt.Errorf("failed to write header body: %w", err)
+	}
+	if _, err := w.Write(pkg.payload); err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadIndex(t *testing.T) {
+	h := newIndex(immutable)
+	h.Add(tagName, EntryString("hello"))
+	h.Add(tagDirnames, EntryStringSlice([]string{"/usr/", "/etc/"}))
+	h.Add(tagFileModes, EntryUint16([]uint16{0100644, 040755, 0120777}))
+	h.Add(tagFileSizes, EntryUint32([]uint32{1, 2}))
+	h.Add(sigPGP, EntryBytes([]byte{1, 2, 3}))
+	b, err := h.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes returned error %v", err)
+	}
+	gotBytes, got, err := readIndex(bytes.NewReader(append(b, "trailing data"...)))
+	if err != nil {
+		t.Fatalf("readIndex returned error %v", err)
+	}
+	if !bytes.Equal(gotBytes, b) {
+		t.Errorf("readIndex read %d bytes, want %d", len(gotBytes), len(b))
+	}
+	want := h.entries
+	want[immutable] = h.eigenHeader()
+	if d := cmp.Diff(want, got, cmp.AllowUnexported(IndexEntry{})); d != "" {
+		t.Errorf("readIndex returned unexpected entries (want->got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{"/usr/", "/etc/"}, got[tagDirnames].strings()); d != "" {
+		t.Errorf("strings returned unexpected value (want->got):\n%s", d)
+	}
+	if d := cmp.Diff([]int32{1, 2}, got[tagFileSizes].int32s()); d != "" {
+		t.Errorf("int32s returned unexpected value (want->got):\n%s", d)
+	}
+
+	if _, _, err := readIndex(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Errorf("readIndex of a truncated header should have returned an error")
+	}
+}
+
+func TestReadPackage(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "read", Version: "1.0", Compressor: "zstd"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if !bytes.Equal(pkg.Header.Raw(), r.headerBytes) || !bytes.Equal(pkg.Signature.Raw(), r.signatureBytes) {
+		t.Errorf("ReadPackage did not read the header and signature bytes that were written")
+	}
+	if !bytes.Equal(pkg.RawPayload(), r.payload.Bytes()) {
+		t.Errorf("ReadPackage did not read the payload that was written")
+	}
+	if d := cmp.Diff(Lead{Major: 3, Arch: 1, Name: "read-1.0", OS: 1, SignatureType: 5}, pkg.Lead); d != "" {
+		t.Errorf("unexpected lead (want->got):\n%s", d)
+	}
+
+	if got, err := pkg.Header.String(tagName); err != nil || got != "read" {
+		t.Errorf("String(tagName) returned %q, %v, want \"read\"", got, err)
+	}
+	if got, err := pkg.Header.Uint32s(tagFileSizes); err != nil || !reflect.DeepEqual(got, []uint32{19}) {
+		t.Errorf("Uint32s(tagFileSizes) returned %v, %v, want [19]", got, err)
+	}
+	if got, err := pkg.Header.Int16s(tagFileModes); err != nil || len(got) != 1 || uint16(got[0]) != 0100000 {
+		t.Errorf("Int16s(tagFileModes) returned %v, %v, want a regular file", got, err)
+	}
+	if _, err := pkg.Header.Int32s(tagName); err == nil {
+		t.Errorf("Int32s of a string tag should have returned an error")
+	}
+	if _, err := pkg.Header.String(tagVendor); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("String of a missing tag returned %v, want ErrTagNotFound", err)
+	}
+	tags := pkg.Signature.Tags()
+	if d := cmp.Diff([]int{sigSHA256, sigSize, sigPayloadSize}, tags); d != "" {
+		t.Errorf("unexpected signature tags (want->got):\n%s", d)
+	}
+
+	z, err := pkg.PayloadReader()
+	if err != nil {
+		t.Fatalf("PayloadReader returned error %v", err)
+	}
+	defer z.Close()
+	c := cpio.NewReader(z)
+	hdr, err := c.Next()
+	if err != nil {
+		t.Fatalf("reading the payload returned error %v", err)
+	}
+	body, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("reading the payload returned error %v", err)
+	}
+	if hdr.Name != "./usr/local/hello" || string(body) != "content of the file" {
+		t.Errorf("payload has %s with %q, want ./usr/local/hello", hdr.Name, body)
+	}
+
+	if _, err := ReadPackage(bytes.NewReader(make([]byte, 200))); !errors.Is(err, ErrNotRPM) {
+		t.Errorf("ReadPackage of zeros returned %v, want ErrNotRPM", err)
+	}
+}
+
+func TestPackageFiles(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "files", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	want := []RPMFile{
+		{Name: "/etc/files", Mode: 040750, Owner: "root", Group: "wheel", MTime: 1},
+		{Name: "/etc/files/config", Body: []byte("a=1\n"), Mode: 0100640, Owner: "files", Group: "files", MTime: 2, Type: ConfigFile | NoReplaceFile},
+		{Name: "/etc/files/link", Body: []byte("config"), Mode: 0120777, Owner: "root", Group: "root", MTime: 3},
+		{Name: "/var/log/files.log", Mode: 0100644, Owner: "root", Group: "root", MTime: 4, Type: GhostFile},
+	}
+	for _, f := range want {
+		r.AddFile(f)
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	got, err := pkg.Files()
+	if err != nil {
+		t.Fatalf("Files returned error %v", err)
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("Files returned unexpected files (want->got):\n%s", d)
+	}
+}
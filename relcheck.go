@@ -0,0 +1,160 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrContradictoryRelations is returned when a package conflicts with every version it
+	// requires.
+	ErrContradictoryRelations = errors.New("contradictory relations")
+	// ErrOverlappingRelations is reported by Warnings when a package conflicts with some of
+	// the versions it requires, e.g. requires foo >= 2 and conflicts with foo < 3.
+	ErrOverlappingRelations = errors.New("overlapping relations")
+)
+
+// evrBound is one end of the version range of a relation.
+type evrBound struct {
+	evr       string
+	inclusive bool
+	set       bool
+}
+
+// relationRange returns the versions matched by the relation. Unset bounds are unlimited.
+func relationRange(rel *Relation) (lo, hi evrBound) {
+	if rel.Version == "" {
+		return lo, hi
+	}
+	s := rel.Sense & senseCompareMask
+	if s&SenseGreater != 0 || s == SenseEqual {
+		lo = evrBound{evr: rel.Version, inclusive: s&SenseEqual != 0, set: true}
+	}
+	if s&SenseLess != 0 || s == SenseEqual {
+		hi = evrBound{evr: rel.Version, inclusive: s&SenseEqual != 0, set: true}
+	}
+	return lo, hi
+}
+
+// rangeContains reports if every version matched by inner is also matched by outer.
+func rangeContains(outer, inner *Relation) bool {
+	olo, ohi := relationRange(outer)
+	ilo, ihi := relationRange(inner)
+	if olo.set {
+		if !ilo.set {
+			return false
+		}
+		c := compareEVR(olo.evr, ilo.evr)
+		if c > 0 || (c == 0 && !olo.inclusive && ilo.inclusive) {
+			return false
+		}
+	}
+	if ohi.set {
+		if !ihi.set {
+			return false
+		}
+		c := compareEVR(ohi.evr, ihi.evr)
+		if c < 0 || (c == 0 && !ohi.inclusive && ihi.inclusive) {
+			return false
+		}
+	}
+	return true
+}
+
+// rangesOverlap reports if some version is matched by both relations.
+func rangesOverlap(a, b *Relation) bool {
+	alo, ahi := relationRange(a)
+	blo, bhi := relationRange(b)
+	return boundsMeet(alo, bhi) && boundsMeet(blo, ahi)
+}
+
+// boundsMeet reports if some version is above the lower bound lo and below the upper
+// bound hi.
+func boundsMeet(lo, hi evrBound) bool {
+	if !lo.set || !hi.set {
+		return true
+	}
+	c := compareEVR(lo.evr, hi.evr)
+	return c < 0 || (c == 0 && lo.inclusive && hi.inclusive)
+}
+
+// sameTarget reports if the relations are about the same name, with the same scope flags.
+// Rich dependencies are never comparable.
+func (r *Relation) sameTarget(o *Relation) bool {
+	return r.Name == o.Name && !strings.HasPrefix(r.Name, "(") &&
+		r.Sense&^senseCompareMask == o.Sense&^senseCompareMask
+}
+
+// normalize removes duplicate and redundant relations, keeping the first of equivalent
+// ones. If keepNarrow is set (requires), a relation is redundant if another one of the
+// same name only matches a subset of its versions, e.g. "foo" next to "foo >= 2".
+// Otherwise (conflicts and obsoletes), the broader relation is kept.
+func (r Relations) normalize(keepNarrow bool) Relations {
+	var out Relations
+	for i, rel := range r {
+		redundant := false
+		for j, o := range r {
+			if i == j || !rel.sameTarget(o) {
+				continue
+			}
+			narrow, broad := o, rel
+			if !keepNarrow {
+				narrow, broad = rel, o
+			}
+			if rangeContains(broad, narrow) {
+				// For equivalent relations, only the first one is kept.
+				if !rangeContains(narrow, broad) || j < i {
+					redundant = true
+					break
+				}
+			}
+		}
+		if !redundant {
+			out = append(out, rel)
+		}
+	}
+	return out
+}
+
+// normalizeRelations removes duplicate provides, merges the redundant requires, conflicts
+// and obsoletes of the rpm, and checks that it does not conflict with all versions of one
+// of its requires. Conflicts with some of the required versions are returned as warnings.
+func (r *RPM) normalizeRelations() (warnings []error, err error) {
+	var provides Relations
+	for _, p := range r.Provides {
+		provides.addIfMissing(p)
+	}
+	r.Provides = provides
+	r.Requires = r.Requires.normalize(true)
+	r.Conflicts = r.Conflicts.normalize(false)
+	r.Obsoletes = r.Obsoletes.normalize(false)
+	for _, req := range r.Requires {
+		for _, c := range r.Conflicts {
+			if req.Name != c.Name || strings.HasPrefix(c.Name, "(") {
+				continue
+			}
+			if rangeContains(c, req) {
+				return nil, fmt.Errorf("%w: requires %s but conflicts with %s", ErrContradictoryRelations, req, c)
+			}
+			if rangesOverlap(c, req) {
+				warnings = append(warnings, fmt.Errorf("%w: requires %s but conflicts with %s, which matches some of the required versions", ErrOverlappingRelations, req, c))
+			}
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func relations(t *testing.T, rels ...string) Relations {
+	t.Helper()
+	var r Relations
+	for _, s := range rels {
+		rel, err := NewRelation(s)
+		if err != nil {
+			t.Fatalf("NewRelation(%q) returned error %v", s, err)
+		}
+		r = append(r, rel)
+	}
+	return r
+}
+
+func TestNormalizeRelations(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		requires, conflicts   []string
+		wantReq, wantConflict string
+		wantErr               bool
+		wantWarning           bool
+	}{{
+		name:     "duplicates",
+		requires: []string{"foo", "foo", "bar >= 1"},
+		wantReq:  "foo,bar>=1",
+	}, {
+		name:     "unversioned require is redundant",
+		requires: []string{"foo", "foo >= 1.2"},
+		wantReq:  "foo>=1.2",
+	}, {
+		name:     "stricter lower bound wins",
+		requires: []string{"foo >= 1.2", "foo >= 1.10", "foo < 2"},
+		wantReq:  "foo>=1.10,foo<2",
+	}, {
+		name:     "equivalent versions keep the first",
+		requires: []string{"foo >= 0:1.2", "foo >= 1.2"},
+		wantReq:  "foo>=0:1.2",
+	}, {
+		name:         "broad conflict wins",
+		conflicts:    []string{"foo < 1", "foo < 2", "foo"},
+		wantConflict: "foo",
+	}, {
+		name:         "conflict with newer versions",
+		requires:     []string{"foo >= 2"},
+		conflicts:    []string{"foo >= 3"},
+		wantReq:      "foo>=2",
+		wantConflict: "foo>=3",
+		wantWarning:  true,
+	}, {
+		name:         "disjoint require and conflict",
+		requires:     []string{"foo >= 2"},
+		conflicts:    []string{"foo < 2"},
+		wantReq:      "foo>=2",
+		wantConflict: "foo<2",
+	}, {
+		name:         "partial overlap",
+		requires:     []string{"foo >= 2", "foo < 4"},
+		conflicts:    []string{"foo <= 2.5"},
+		wantReq:      "foo>=2,foo<4",
+		wantConflict: "foo<=2.5",
+		wantWarning:  true,
+	}, {
+		name:         "conflict with the upper bound",
+		requires:     []string{"foo <= 2"},
+		conflicts:    []string{"foo >= 2"},
+		wantReq:      "foo<=2",
+		wantConflict: "foo>=2",
+		wantWarning:  true,
+	}, {
+		name:         "conflict above the upper bound",
+		requires:     []string{"foo < 2"},
+		conflicts:    []string{"foo >= 2"},
+		wantReq:      "foo<2",
+		wantConflict: "foo>=2",
+	}, {
+		name:      "contradictory",
+		requires:  []string{"foo >= 2"},
+		conflicts: []string{"foo > 1"},
+		wantErr:   true,
+	}, {
+		name:      "contradictory unversioned conflict",
+		requires:  []string{"foo = 2"},
+		conflicts: []string{"foo"},
+		wantErr:   true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{
+				Name:      "test",
+				Version:   "1.0",
+				Requires:  relations(t, tc.requires...),
+				Conflicts: relations(t, tc.conflicts...),
+			})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			var handled []error
+			r.SetWarningHandler(func(err error) {
+				// The handler may use the rpm.
+				handled = append(handled, r.Warnings()...)
+			})
+			err = r.Write(io.Discard)
+			if tc.wantErr {
+				if !errors.Is(err, ErrContradictoryRelations) {
+					t.Errorf("Write returned error %v, want ErrContradictoryRelations", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if got := r.Requires.String(); got != tc.wantReq {
+				t.Errorf("Requires = %q, want %q", got, tc.wantReq)
+			}
+			if got := r.Conflicts.String(); got != tc.wantConflict {
+				t.Errorf("Conflicts = %q, want %q", got, tc.wantConflict)
+			}
+			warned := false
+			for _, w := range r.Warnings() {
+				warned = warned || errors.Is(w, ErrOverlappingRelations)
+			}
+			if warned != tc.wantWarning {
+				t.Errorf("Warnings = %v, want an ErrOverlappingRelations warning: %v", r.Warnings(), tc.wantWarning)
+			}
+			if tc.wantWarning && len(handled) == 0 {
+				t.Error("the warning handler was not called")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RemoteSigner is a crypto.Signer whose private key is held by an HTTP signing service,
+// so central signing infrastructure can sign rpms built on CI builders. Only digests are
+// sent to the service. Use it with CryptoSigner to make OpenPGP signatures, e.g.
+//
+//	r.SetPGPReaderSigner(CryptoSigner{Signer: &RemoteSigner{URL: url, PublicKey: pub}, KeyCreated: created}.SignReader)
+//
+// Each signature is a POST of a JSON request to URL:
+//
+//	{"digest": "<base64 digest>", "hash": "SHA-256"}
+//
+// where hash is empty for ed25519 keys, which sign the digest as the message. The service
+// answers with the raw signature: PKCS #1 v1.5 for RSA, ASN.1 DER for ECDSA, or the 64
+// bytes of an ed25519 signature:
+//
+//	{"signature": "<base64 signature>"}
+type RemoteSigner struct {
+	// URL is the signing endpoint.
+	URL string
+	// PublicKey is the public key of the service key, *rsa.PublicKey,
+	// *ecdsa.PublicKey or ed25519.PublicKey.
+	PublicKey crypto.PublicKey
+	// Client makes the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Authorize is called before each request is sent, e.g. to add an Authorization
+	// header or to sign the request.
+	Authorize func(*http.Request) error
+}
+
+type remoteSignRequest struct {
+	Digest []byte `json:"digest"`
+	Hash   string `json:"hash"`
+}
+
+type remoteSignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// Public implements crypto.Signer.
+func (s *RemoteSigner) Public() crypto.PublicKey {
+	return s.PublicKey
+}
+
+// Sign implements crypto.Signer by sending the digest to the signing service.
+func (s *RemoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := remoteSignRequest{Digest: digest}
+	if h := opts.HashFunc(); h != 0 {
+		req.Hash = h.String()
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing request: %w", err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if s.Authorize != nil {
+		if err := s.Authorize(httpReq); err != nil {
+			return nil, fmt.Errorf("failed to authorize signing request: %w", err)
+		}
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("signing request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// Signatures are small, a larger response is not a signature.
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signing service returned %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	var sig remoteSignResponse
+	if err := json.Unmarshal(b, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse signing response: %w", err)
+	}
+	if len(sig.Signature) == 0 {
+		return nil, fmt.Errorf("signing service returned no signature")
+	}
+	return sig.Signature, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// testSigningService returns a signing service with the key, which requires the token.
+func testSigningService(t *testing.T, key crypto.Signer, token string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var req remoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var opts crypto.SignerOpts = crypto.Hash(0)
+		if req.Hash == crypto.SHA256.String() {
+			opts = crypto.SHA256
+		}
+		sig, err := key.Sign(rand.Reader, req.Digest, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(remoteSignResponse{Signature: sig})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRemoteSigner(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned error %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned error %v", err)
+	}
+	data := []byte("header and payload")
+	for _, tc := range []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{name: "ecdsa", key: ecdsaKey},
+		{name: "ed25519", key: ed25519Key},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := testSigningService(t, tc.key, "secret")
+			remote := &RemoteSigner{
+				URL:       srv.URL,
+				PublicKey: tc.key.Public(),
+				Authorize: func(r *http.Request) error {
+					r.Header.Set("Authorization", "Bearer secret")
+					return nil
+				},
+			}
+			c := CryptoSigner{Signer: remote, KeyCreated: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+			pub, err := c.PublicKey("rpmpack test <test@example.com>")
+			if err != nil {
+				t.Fatalf("PublicKey returned error %v", err)
+			}
+			keyring, err := openpgp.ReadKeyRing(bytes.NewReader(pub))
+			if err != nil {
+				t.Fatalf("ReadKeyRing returned error %v", err)
+			}
+			sig, err := c.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign returned error %v", err)
+			}
+			if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig), nil); err != nil {
+				t.Errorf("CheckDetachedSignature returned error %v", err)
+			}
+
+			remote.Authorize = nil
+			if _, err := c.Sign(data); err == nil {
+				t.Errorf("Sign without authorization should have returned an error")
+			}
+		})
+	}
+}
@@ -20,15 +20,19 @@ package rpmpack
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"path"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/cavaliergopher/cpio"
 	"github.com/klauspost/compress/zstd"
 	gzip "github.com/klauspost/pgzip"
@@ -50,38 +54,137 @@ var (
 	ErrWriteAfterClose = errors.New("rpm write after close")
 	// ErrWrongFileOrder is returned when files are not sorted by name.
 	ErrWrongFileOrder = errors.New("wrong file addition order")
+	// ErrPayloadFinalized is returned when the rpm is changed in a way that requires
+	// rebuilding the payload, after the payload was written.
+	ErrPayloadFinalized = errors.New("rpm payload already finalized")
+	// ErrNotFinalized is returned when the header is requested before the rpm was
+	// finalized by Write or Finalize.
+	ErrNotFinalized = errors.New("rpm not finalized")
+	// ErrRootDir is reported by Warnings when the root directory was added, which rpm does
+	// not allow.
+	ErrRootDir = errors.New("the root directory can not be packaged")
+	// ErrNoOwner is reported by Warnings for a file without an owner or a group.
+	ErrNoOwner = errors.New("file without owner")
+	// ErrInvalidMetadata is returned by NewRPM for unknown or contradictory metadata values.
+	ErrInvalidMetadata = errors.New("invalid metadata")
+	// ErrUnsupportedCompressor is returned for an unknown compressor or compression level.
+	ErrUnsupportedCompressor = errors.New("unsupported compressor")
 )
 
 // RPMMetaData contains meta info about the whole package.
+// It can be read from JSON or YAML, see ReadManifest.
 type RPMMetaData struct {
-	Name,
-	Summary,
-	Description,
-	Version,
-	Release,
-	Arch,
-	OS,
-	Vendor,
-	URL,
-	Packager,
-	Group,
-	Licence,
-	BuildHost,
-	Compressor string
-	Epoch     uint32
-	BuildTime time.Time
+	Name        string `json:"name,omitempty"`
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Release     string `json:"release,omitempty"`
+	Arch        string `json:"arch,omitempty"`
+	OS          string `json:"os,omitempty"`
+	Vendor      string `json:"vendor,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Packager    string `json:"packager,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Licence     string `json:"licence,omitempty"`
+	// License is an alias of Licence. If both are set, they must be equal.
+	License    string    `json:"license,omitempty"`
+	BuildHost  string    `json:"build_host,omitempty"`
+	Compressor string    `json:"compressor,omitempty"`
+	Epoch      uint32    `json:"epoch"`
+	BuildTime  time.Time `json:"build_time"`
 	// Prefixes is used for relocatable packages, usually with a one item
 	// slice, e.g. `["/opt"]`.
-	Prefixes []string
-	Provides,
-	Obsoletes,
-	Suggests,
-	Recommends,
-	Requires,
-	Conflicts Relations
+	Prefixes    []string  `json:"prefixes,omitempty"`
+	Provides    Relations `json:"provides,omitempty"`
+	Obsoletes   Relations `json:"obsoletes,omitempty"`
+	Suggests    Relations `json:"suggests,omitempty"`
+	Recommends  Relations `json:"recommends,omitempty"`
+	Supplements Relations `json:"supplements,omitempty"`
+	Enhances    Relations `json:"enhances,omitempty"`
+	Requires    Relations `json:"requires,omitempty"`
+	Conflicts   Relations `json:"conflicts,omitempty"`
+	// WeakDependencies selects the tags used for the weak dependencies (Suggests,
+	// Recommends, Supplements and Enhances):
+	//   - "" or "modern": the tags of rpm >= 4.12.
+	//   - "legacy": the OLDSUGGESTS and OLDENHANCES tags read by older SUSE releases,
+	//     where Recommends and Supplements are flagged as strong.
+	//   - "both": both sets of tags.
+	WeakDependencies string `json:"weak_dependencies,omitempty"`
+	// Ldconfig runs ldconfig in the postin and postun scriptlets if the rpm has shared
+	// libraries in the standard library directories. This is not needed on distributions
+	// where glibc runs ldconfig with a file trigger, e.g. Fedora >= 28.
+	Ldconfig bool `json:"ldconfig,omitempty"`
+	// ExpandScriptletVariables expands %{name}, %{version}, %{release}, %{epoch} and
+	// %{prefix} in the scriptlet bodies when the rpm is written. "%%" is written as "%".
+	// %{epoch} is kept as it is if Epoch is NoEpoch.
+	ExpandScriptletVariables bool `json:"expand_scriptlet_variables,omitempty"`
+	// ValidateLua checks the syntax of the scriptlets using the <lua> interpreter when they
+	// are added with AddScriptlet, AddScriptletFromReader or SetScriptletInterpreter, and
+	// when the rpm is written, so broken lua fails the build instead of the installation.
+	ValidateLua bool `json:"validate_lua,omitempty"`
+	// NoInterpreterRequires disables the requires on the interpreters of scriptlets,
+	// e.g. Requires(post): /usr/bin/python3 for a postin scriptlet run by python.
+	NoInterpreterRequires bool `json:"no_interpreter_requires,omitempty"`
+	// ReservedSpace is the size of the RESERVEDSPACE padding in the signature header, so
+	// the rpm can be signed later in place with SignInPlace, without moving the header
+	// and the payload. rpmbuild reserves 4096 bytes.
+	ReservedSpace uint `json:"reserved_space,omitempty"`
+	// RPMBuildVersion writes the tags and formats of rpmbuild of that version, e.g.
+	// "4.18.0", so rpmbuild output can be compared tag by tag in conformance tests, e.g.
+	// with testutil.Compare:
+	//   - the rpmlib() requires added by rpmbuild, e.g. rpmlib(CompressedFileNames)
+	//   - the relations sorted by name, version and flags
+	//   - the RPMVERSION and ENCODING tags, and PAYLOADDIGESTALT since rpm 4.16
+	//   - the summary, description and group as i18n strings, with the "Unspecified" group
+	//   - a single FILEDIGESTALGO and zero FILERDEVS
+	//   - the SHA1HEADER and MD5 signatures before rpm 6, and a reserved space of 4096 bytes
+	// Tags which depend on the build host, like PLATFORM and OPTFLAGS, are not written, and
+	// tags rpmpack does not know, e.g. SOURCEPKGID, are missing, so the headers are not byte
+	// for byte identical.
+	RPMBuildVersion string `json:"rpmbuild_version,omitempty"`
+	// StrictPaths makes Write fail with ErrInvalidPath if a file was added with a name
+	// which rpm does not handle, see ValidatePath.
+	StrictPaths bool `json:"strict_paths,omitempty"`
+	// AllowUnknownArch allows an Arch which is not in the architecture list of rpm, e.g.
+	// for a new architecture. Otherwise NewRPM returns ErrUnknownArch, as dnf refuses
+	// to install such packages.
+	AllowUnknownArch bool `json:"allow_unknown_arch,omitempty"`
+	// PackageFormat is the version of the package format, 4 (the default) or 6. The v6
+	// format of rpm 6 adds:
+	//   - the RPMFORMAT tag
+	//   - the PAYLOADDIGESTALT digest of the uncompressed payload
+	// and never has the legacy SHA1HEADER and MD5 signatures. The SHA3-256 header digest is
+	// not written yet. v6 packages can be installed by rpm 4.
+	PackageFormat int `json:"package_format,omitempty"`
+	// CPIOFormat is the format of the cpio payload, "newc" (the default) or "crc", which
+	// has a checksum of the content of each file. The PAYLOADFORMAT tag is "cpio" for both,
+	// as rpm reads both and refuses other values.
+	CPIOFormat string `json:"cpio_format,omitempty"`
+	// NoPayloadNamePrefix writes the names of the payload members without the "./" prefix
+	// which rpmbuild writes, e.g. "/usr/bin/hello" instead of "./usr/bin/hello", like older
+	// versions of rpmpack. rpm installs both. The files of source rpms, which have no
+	// directory, never have the prefix.
+	NoPayloadNamePrefix bool `json:"no_payload_name_prefix,omitempty"`
+	// NoPayloadDigest omits the PAYLOADDIGEST, PAYLOADDIGESTALGO and PAYLOADDIGESTALT
+	// tags, which rpm knows since 4.14, for tools on very old platforms which refuse
+	// unknown tags. The payload is then only protected by the signatures.
+	NoPayloadDigest bool `json:"no_payload_digest,omitempty"`
+	// PayloadOrder is the order of the files in the payload, "name" (the default) or
+	// "extension", which groups files of the same kind to improve the compression of large
+	// packages with mixed content. The file lists in the header are always sorted by name.
+	PayloadOrder string `json:"payload_order,omitempty"`
+	// MaxFiles is the largest number of files Write accepts, unlimited if 0.
+	MaxFiles int `json:"max_files,omitempty"`
+	// MaxPayloadSize is the largest size of the compressed payload in bytes Write accepts,
+	// unlimited if 0. Write fails with ErrLimitExceeded as soon as it is exceeded.
+	MaxPayloadSize int64 `json:"max_payload_size,omitempty"`
 }
 
 // RPM holds the state of a particular rpm file. Please use NewRPM to instantiate it.
+//
+// AddFile can be called from several goroutines at once, e.g. to collect the outputs of
+// parallel build steps. Write and Finalize wait for running AddFile calls. The other
+// methods and the metadata fields must not be used concurrently.
 type RPM struct {
 	RPMMetaData
 	di                *dirIndex
@@ -100,23 +203,54 @@ type RPM struct {
 	fileflags         []uint32
 	closed            bool
 	compressedPayload io.WriteCloser
+	compressorSetting string
 	files             map[string]RPMFile
-	prein             string
-	postin            string
-	preun             string
-	postun            string
-	pretrans          string
-	posttrans         string
-	verifyscript      string
-	customTags        map[int]IndexEntry
-	customSigs        map[int]IndexEntry
-	pgpSigner         func([]byte) ([]byte, error)
+	scriptlets        map[string]*scriptlet
+	// customScriptletKinds are added with RegisterScriptletKind.
+	customScriptletKinds map[string]ScriptletTags
+	macros               map[string]string
+	// fileNameMacros maps expanded file names to the names with macros.
+	fileNameMacros map[string]string
+	// unexpandedRelations are the relations of relationSets before macro expansion.
+	unexpandedRelations []Relations
+	// scriptletValidators are keyed by interpreter, see AddScriptletValidator.
+	scriptletValidators map[string][]ScriptletValidator
+	customTags          map[int]IndexEntry
+	customSigs          map[int]IndexEntry
+	pgpSigner           func([]byte) ([]byte, error)
+	pgpCoSigners        []func([]byte) ([]byte, error)
+	depGenerators       []DependencyGenerator
+	headerHooks         []HeaderHook
+	// pgpReaderSigner is set by SetPGPReaderSigner, pgpSigner then calls it too.
+	pgpReaderSigner func(io.Reader) ([]byte, error)
+	// sourcePackage marks the rpm as a source rpm, see NewSourceRPM.
+	sourcePackage bool
+	sources       []string
+	patches       []string
+	// metaPackage marks the rpm as a package without files, see NewMetaRPM.
+	metaPackage bool
+	// payloadFinalized is set once all files were written to the payload.
+	payloadFinalized bool
+	payloadDigest    string
+	// uncompressedPayload hashes the cpio archive for the PAYLOADDIGESTALT tag, with
+	// RPMBuildVersion or the v6 format.
+	uncompressedPayload hash.Hash
+	// crc is set for the crc cpio format.
+	crc *crcWriter
+	// archive counts the size of the uncompressed payload.
+	archive *countingWriter
+	// mu guards files and warnings, so files can be added concurrently.
+	mu *sync.Mutex
+	// warnings are returned by Warnings and passed to warningHandler.
+	warnings       []error
+	warningHandler func(error)
+	// headerBytes and signatureBytes are set once the rpm is finalized.
+	headerBytes    []byte
+	signatureBytes []byte
 }
 
 // NewRPM creates and returns a new RPM struct.
 func NewRPM(m RPMMetaData) (*RPM, error) {
-	var err error
-
 	if m.OS == "" {
 		m.OS = "linux"
 	}
@@ -124,26 +258,54 @@ func NewRPM(m RPMMetaData) (*RPM, error) {
 	if m.Arch == "" {
 		m.Arch = "noarch"
 	}
+	if !m.AllowUnknownArch {
+		if err := checkArch(m.Arch); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkNEVR(m.Name, m.Version, m.Release); err != nil {
+		return nil, err
+	}
+	if err := checkPackageFormat(m); err != nil {
+		return nil, err
+	}
+	switch m.CPIOFormat {
+	case "", "newc", "crc":
+	default:
+		return nil, fmt.Errorf("%w: unknown cpio format %q", ErrInvalidMetadata, m.CPIOFormat)
+	}
 
-	p := &bytes.Buffer{}
+	switch {
+	case m.License == "":
+		m.License = m.Licence
+	case m.Licence == "":
+		m.Licence = m.License
+	case m.Licence != m.License:
+		return nil, fmt.Errorf("%w: licence %q and license %q differ, set only one of them", ErrInvalidMetadata, m.Licence, m.License)
+	}
 
-	z, compressorName, err := setupCompressor(m.Compressor, p)
-	if err != nil {
-		return nil, err
+	switch m.PayloadOrder {
+	case "", "name", "extension":
+	default:
+		return nil, fmt.Errorf("%w: unknown payload order %q", ErrInvalidMetadata, m.PayloadOrder)
 	}
 
-	// only use compressor name for the rpm tag, not the level
-	m.Compressor = compressorName
+	switch m.WeakDependencies {
+	case "", "modern", "legacy", "both":
+	default:
+		return nil, fmt.Errorf("%w: unknown weak dependencies format %q", ErrInvalidMetadata, m.WeakDependencies)
+	}
 
 	rpm := &RPM{
-		RPMMetaData:       m,
-		di:                newDirIndex(),
-		payload:           p,
-		compressedPayload: z,
-		cpio:              cpio.NewWriter(z),
-		files:             make(map[string]RPMFile),
-		customTags:        make(map[int]IndexEntry),
-		customSigs:        make(map[int]IndexEntry),
+		RPMMetaData: m,
+		di:          newDirIndex(),
+		files:       make(map[string]RPMFile),
+		customTags:  make(map[int]IndexEntry),
+		customSigs:  make(map[int]IndexEntry),
+		mu:          &sync.Mutex{},
+	}
+	if err := rpm.SetCompressor(m.Compressor); err != nil {
+		return nil, err
 	}
 
 	// A package must provide itself...
@@ -156,13 +318,44 @@ func NewRPM(m RPMMetaData) (*RPM, error) {
 	return rpm, nil
 }
 
+// SetCompressor changes the payload compressor, e.g. "xz" or "zstd:19". The syntax is the same
+// as for RPMMetaData.Compressor. It returns ErrPayloadFinalized if the payload was already
+// written.
+func (r *RPM) SetCompressor(compressorSetting string) error {
+	if r.payloadFinalized {
+		return ErrPayloadFinalized
+	}
+	p := &bytes.Buffer{}
+	z, compressorName, err := setupCompressor(compressorSetting, p)
+	if err != nil {
+		return err
+	}
+	// only use compressor name for the rpm tag, not the level
+	r.Compressor = compressorName
+	r.compressorSetting = compressorSetting
+	r.payload = p
+	r.compressedPayload = z
+	var cw io.Writer = z
+	if r.RPMBuildVersion != "" || r.PackageFormat == 6 {
+		r.uncompressedPayload = sha256.New()
+		cw = io.MultiWriter(z, r.uncompressedPayload)
+	}
+	if r.CPIOFormat == "crc" {
+		r.crc = &crcWriter{w: cw}
+		cw = r.crc
+	}
+	r.archive = &countingWriter{w: cw}
+	r.cpio = cpio.NewWriter(r.archive)
+	return nil
+}
+
 func setupCompressor(
 	compressorSetting string,
 	w io.Writer,
 ) (wc io.WriteCloser, compressorType string, err error) {
 	parts := strings.Split(compressorSetting, ":")
 	if len(parts) > 2 {
-		return nil, "", fmt.Errorf("malformed compressor setting: %s", compressorSetting)
+		return nil, "", fmt.Errorf("%w: malformed compressor setting: %s", ErrUnsupportedCompressor, compressorSetting)
 	}
 
 	compressorType = parts[0]
@@ -183,20 +376,22 @@ func setupCompressor(
 
 			level, err = strconv.Atoi(compressorLevel)
 			if err != nil {
-				return nil, "", fmt.Errorf("parse gzip compressor level: %w", err)
+				return nil, "", fmt.Errorf("%w: invalid gzip compressor level %s: %v", ErrUnsupportedCompressor, compressorLevel, err)
 			}
 		}
 
-		wc, err = gzip.NewWriterLevel(w, level)
+		if wc, err = gzip.NewWriterLevel(w, level); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedCompressor, err)
+		}
 	case "lzma":
 		if compressorLevel != "" {
-			return nil, "", fmt.Errorf("no compressor level supported for lzma: %s", compressorLevel)
+			return nil, "", fmt.Errorf("%w: no compressor level supported for lzma: %s", ErrUnsupportedCompressor, compressorLevel)
 		}
 
 		wc, err = lzma.NewWriter(w)
 	case "xz":
 		if compressorLevel != "" {
-			return nil, "", fmt.Errorf("no compressor level supported for xz: %s", compressorLevel)
+			return nil, "", fmt.Errorf("%w: no compressor level supported for xz: %s", ErrUnsupportedCompressor, compressorLevel)
 		}
 
 		wc, err = xz.NewWriter(w)
@@ -211,14 +406,14 @@ func setupCompressor(
 			} else {
 				ok, level = zstd.EncoderLevelFromString(compressorLevel)
 				if !ok {
-					return nil, "", fmt.Errorf("invalid zstd compressor level: %s", compressorLevel)
+					return nil, "", fmt.Errorf("%w: invalid zstd compressor level: %s", ErrUnsupportedCompressor, compressorLevel)
 				}
 			}
 		}
 
 		wc, err = zstd.NewWriter(w, zstd.WithEncoderLevel(level))
 	default:
-		return nil, "", fmt.Errorf("unknown compressor type: %s", compressorType)
+		return nil, "", fmt.Errorf("%w: unknown compressor type: %s", ErrUnsupportedCompressor, compressorType)
 	}
 
 	return wc, compressorType, err
@@ -235,44 +430,134 @@ func (r *RPM) FullVersion() string {
 
 // AllowListDirs removes all directories which are not explicitly allowlisted.
 func (r *RPM) AllowListDirs(allowList map[string]bool) {
+	allowed := make(map[string]bool, len(allowList))
+	for dir, ok := range allowList {
+		allowed[normalizePath(dir)] = ok
+	}
 	for fn, ff := range r.files {
 		if ff.Mode&040000 == 040000 {
-			if !allowList[fn] {
+			if !allowed[fn] {
 				delete(r.files, fn)
 			}
 		}
 	}
 }
 
-// Write closes the rpm and writes the whole rpm to an io.Writer
+// Write closes the rpm and writes the whole rpm to an io.Writer.
+// Write can be called several times, each call writes the same rpm. The rpm is finalized
+// by the first call, later changes to the metadata or files are not reflected.
 func (r *RPM) Write(w io.Writer) error {
 	if r.closed {
 		return ErrWriteAfterClose
 	}
-	// Add all of the files, sorted alphabetically.
-	fnames := []string{}
-	for fn := range r.files {
-		fnames = append(fnames, fn)
+	if err := r.finalize(); err != nil {
+		return err
 	}
-	sort.Strings(fnames)
-	for _, fn := range fnames {
-		if err := r.writeFile(r.files[fn]); err != nil {
-			return fmt.Errorf("failed to write file %q: %w", fn, err)
+
+	if _, err := w.Write(lead(r.Name, r.FullVersion(), r.sourcePackage)); err != nil {
+		return fmt.Errorf("failed to write lead: %w", err)
+	}
+	if _, err := w.Write(r.signatureBytes); err != nil {
+		return fmt.Errorf("failed to write signature bytes: %w", err)
+	}
+	// Signatures are padded to 8-byte boundaries
+	if _, err := w.Write(make([]byte, (8-len(r.signatureBytes)%8)%8)); err != nil {
+		return fmt.Errorf("failed to write signature padding: %w", err)
+	}
+	if _, err := w.Write(r.headerBytes); err != nil {
+		return fmt.Errorf("failed to write header body: %w", err)
+	}
+	// The payload is written straight from the buffer, it is never copied.
+	if _, err := w.Write(r.payload.Bytes()); err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	return nil
+}
+
+// Finalize builds the payload, the header and the signatures without writing the rpm, e.g.
+// to retrieve HeaderBytes before the rpm is written. Like after Write, later changes to the
+// metadata or files are not reflected.
+func (r *RPM) Finalize() error {
+	if r.closed {
+		return ErrWriteAfterClose
+	}
+	return r.finalize()
+}
+
+// HeaderBytes returns the header of the finalized rpm, the bytes between the signature
+// header and the payload, which the header-only signatures sign. It returns
+// ErrNotFinalized before Write or Finalize.
+func (r *RPM) HeaderBytes() ([]byte, error) {
+	if r.headerBytes == nil {
+		return nil, ErrNotFinalized
+	}
+	return append([]byte(nil), r.headerBytes...), nil
+}
+
+// SignatureBytes returns the signature header of the finalized rpm, without the padding
+// which follows it in the rpm. It returns ErrNotFinalized before Write or Finalize.
+func (r *RPM) SignatureBytes() ([]byte, error) {
+	if r.signatureBytes == nil {
+		return nil, ErrNotFinalized
+	}
+	return append([]byte(nil), r.signatureBytes...), nil
+}
+
+// finalize builds the payload, the header and the signatures. It is a no-op if the rpm
+// was already finalized.
+func (r *RPM) finalize() error {
+	var warnings []error
+	r.mu.Lock()
+	defer func() {
+		// Like for AddFile, the warning handler is called without holding the lock.
+		r.warnings = append(r.warnings, warnings...)
+		handler := r.warningHandler
+		r.mu.Unlock()
+		if handler != nil {
+			for _, w := range warnings {
+				handler(w)
+			}
 		}
+	}()
+	if r.headerBytes != nil {
+		return nil
 	}
-	if err := r.cpio.Close(); err != nil {
-		return fmt.Errorf("failed to close cpio payload: %w", err)
+	if err := r.requireNEVR(); err != nil {
+		return err
 	}
-	if err := r.compressedPayload.Close(); err != nil {
-		return fmt.Errorf("failed to close gzip payload: %w", err)
+	if err := r.finalizePayload(); err != nil {
+		return err
+	}
+	if err := r.expandMacrosInRelations(); err != nil {
+		return err
 	}
 
-	if _, err := w.Write(lead(r.Name, r.FullVersion())); err != nil {
-		return fmt.Errorf("failed to write lead: %w", err)
+	if err := r.runDependencyGenerators(); err != nil {
+		return err
+	}
+	if err := r.addLdconfigScriptlets(); err != nil {
+		return err
+	}
+	r.addInterpreterRequires()
+	var err error
+	if warnings, err = r.normalizeRelations(); err != nil {
+		return err
+	}
+	if r.RPMBuildVersion != "" {
+		r.addRPMLibRequires()
+		r.sortRelations()
 	}
+
 	// Write the regular header.
+	if err := r.validateScriptlets(); err != nil {
+		return err
+	}
+
 	h := newIndex(immutable)
 	r.writeGenIndexes(h)
+	if err := r.writeScriptletIndexes(h); err != nil {
+		return err
+	}
 
 	// do not write file indexes if there are no files (meta package)
 	// doing so will result in an invalid package
@@ -283,8 +568,20 @@ func (r *RPM) Write(w io.Writer) error {
 	if err := r.writeRelationIndexes(h); err != nil {
 		return err
 	}
+	if r.RPMBuildVersion != "" {
+		r.writeRPMBuildIndexes(h)
+	}
+	if r.PackageFormat == 6 {
+		r.writeFormatIndexes(h)
+	}
 	// CustomTags must be the last to be added, because they can overwrite values.
 	h.AddEntries(r.customTags)
+	if err := r.runHeaderHooks(h); err != nil {
+		return err
+	}
+	if err := checkFileIndex(h.entries); err != nil {
+		return err
+	}
 	hb, err := h.Bytes()
 	if err != nil {
 		return fmt.Errorf("failed to retrieve header: %w", err)
@@ -296,39 +593,123 @@ func (r *RPM) Write(w io.Writer) error {
 	}
 
 	s.AddEntries(r.customSigs)
+	if err := r.runHeaderHooks(s); err != nil {
+		return err
+	}
 	sb, err := s.Bytes()
 	if err != nil {
 		return fmt.Errorf("failed to retrieve signatures header: %w", err)
 	}
+	r.headerBytes = hb
+	r.signatureBytes = sb
+	return nil
+}
 
-	if _, err := w.Write(sb); err != nil {
-		return fmt.Errorf("failed to write signature bytes: %w", err)
+// finalizePayload writes all files to the payload and closes it. It is a no-op
+// if the payload was already finalized.
+func (r *RPM) finalizePayload() error {
+	if r.payloadFinalized {
+		return nil
 	}
-	// Signatures are padded to 8-byte boundaries
-	if _, err := w.Write(make([]byte, (8-len(sb)%8)%8)); err != nil {
-		return fmt.Errorf("failed to write signature padding: %w", err)
+	if r.metaPackage && len(r.files) > 0 {
+		return ErrFilesInMetaPackage
 	}
-	if _, err := w.Write(hb); err != nil {
-		return fmt.Errorf("failed to write header body: %w", err)
+	if err := r.expandMacrosInFiles(); err != nil {
+		return err
 	}
-	if _, err := w.Write(r.payload.Bytes()); err != nil {
-		return fmt.Errorf("failed to write payload: %w", err)
+	if r.StrictPaths {
+		for _, fn := range r.sortedFileNames() {
+			if err := ValidatePath(fn); err != nil {
+				return err
+			}
+		}
+	}
+	// Add all of the files, sorted alphabetically.
+	names := r.sortedFileNames()
+	if err := r.checkFileLimits(names); err != nil {
+		return err
+	}
+	r.growFileSlices(len(names))
+	for _, fn := range names {
+		r.writeFile(r.files[fn])
+	}
+	if r.PayloadOrder == "extension" {
+		names = sortByExtension(names)
+	}
+	for _, fn := range names {
+		if err := r.writePayload(r.files[fn]); err != nil {
+			return fmt.Errorf("failed to write file %q: %w", fn, err)
+		}
+		if err := r.checkPayloadLimit(); err != nil {
+			return err
+		}
+	}
+	r.crc.nextHeader(0)
+	if err := r.cpio.Close(); err != nil {
+		return fmt.Errorf("failed to close cpio payload: %w", err)
+	}
+	if err := r.compressedPayload.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip payload: %w", err)
 	}
+	if err := r.checkPayloadLimit(); err != nil {
+		return err
+	}
+	r.payloadDigest = fmt.Sprintf("%x", sha256.Sum256(r.payload.Bytes()))
+	r.payloadFinalized = true
 	return nil
 }
 
 // SetPGPSigner registers a function that will accept the header and payload as bytes,
 // and return a signature as bytes. The function should simulate what gpg does,
 // probably by using golang.org/x/crypto/openpgp or by forking a gpg process.
+// Like rpmsign, both a header-only and a header+payload signature are written, in the
+// RSAHEADER and PGP tags for RSA keys, or in the DSAHEADER and GPG tags for other keys.
+// The header and payload are copied to a single slice for the signer, use
+// SetPGPReaderSigner to sign them without the copy.
 func (r *RPM) SetPGPSigner(f func([]byte) ([]byte, error)) {
 	r.pgpSigner = f
+	r.pgpReaderSigner = nil
+}
+
+// SetPGPReaderSigner sets the signer like SetPGPSigner, with a function which reads the
+// signed data from a reader, e.g. KeySigner.SignReader. The header and payload are then
+// signed without copying the payload.
+func (r *RPM) SetPGPReaderSigner(f func(io.Reader) ([]byte, error)) {
+	r.pgpSigner = func(data []byte) ([]byte, error) {
+		return f(bytes.NewReader(data))
+	}
+	r.pgpReaderSigner = f
+}
+
+// AddPGPSigner adds a co-signer, e.g. a customer key in addition to the vendor key, or
+// sets the signer like SetPGPSigner if there is none yet.
+//
+// The legacy signature tags hold a single signature each, so they are only written by
+// the first signer. The header signatures of all signers are written to the OPENPGP tag
+// of rpm >= 6, which holds any number of signatures; older rpm versions only check the
+// signatures of the first signer. The signatures of co-signers must be OpenPGP signatures.
+func (r *RPM) AddPGPSigner(f func([]byte) ([]byte, error)) {
+	if r.pgpSigner == nil {
+		r.pgpSigner = f
+		return
+	}
+	r.pgpCoSigners = append(r.pgpCoSigners, f)
 }
 
 // Only call this after the payload and header were written.
 func (r *RPM) writeSignatures(sigHeader *index, regHeader []byte) error {
+	if size := uint64(r.payload.Len() + len(regHeader)); size > maxSize32 {
+		return fmt.Errorf("%w: the header and payload have %d bytes, the SIZE signature holds at most %d", ErrLimitExceeded, size, uint64(maxSize32))
+	}
 	sigHeader.Add(sigSize, EntryInt32([]int32{int32(r.payload.Len() + len(regHeader))}))
 	sigHeader.Add(sigSHA256, EntryString(fmt.Sprintf("%x", sha256.Sum256(regHeader))))
-	sigHeader.Add(sigPayloadSize, EntryInt32([]int32{int32(r.payloadSize)}))
+	sigHeader.Add(archiveSizeEntry(r.archive.n))
+	if r.RPMBuildVersion != "" {
+		r.writeRPMBuildSignatures(sigHeader, regHeader)
+	}
+	if r.ReservedSpace > 0 {
+		sigHeader.Add(sigReservedSpace, EntryBytes(make([]byte, r.ReservedSpace)))
+	}
 	if r.pgpSigner != nil {
 		// For sha 256 you need to sign the header and payload separately
 		header := append([]byte{}, regHeader...)
@@ -336,14 +717,40 @@ func (r *RPM) writeSignatures(sigHeader *index, regHeader []byte) error {
 		if err != nil {
 			return fmt.Errorf("call to signer failed: %w", err)
 		}
-		sigHeader.Add(sigRSA, EntryBytes(headerSig))
+		headerTag, _ := signatureTags(headerSig)
+		sigHeader.Add(headerTag, EntryBytes(headerSig))
 
-		body := append(header, r.payload.Bytes()...)
-		bodySig, err := r.pgpSigner(body)
+		var bodySig []byte
+		if r.pgpReaderSigner != nil {
+			bodySig, err = r.pgpReaderSigner(io.MultiReader(bytes.NewReader(header), bytes.NewReader(r.payload.Bytes())))
+		} else {
+			// The signer takes a single slice, so this is the one place the payload is copied.
+			bodySig, err = r.pgpSigner(append(header, r.payload.Bytes()...))
+		}
 		if err != nil {
 			return fmt.Errorf("call to signer failed: %w", err)
 		}
-		sigHeader.Add(sigPGP, EntryBytes(bodySig))
+		_, bodyTag := signatureTags(bodySig)
+		sigHeader.Add(bodyTag, EntryBytes(bodySig))
+
+		if len(r.pgpCoSigners) > 0 {
+			sigs := []string{base64.StdEncoding.EncodeToString(headerSig)}
+			for i, f := range r.pgpCoSigners {
+				sig, err := f(regHeader)
+				if err != nil {
+					return fmt.Errorf("call to co-signer %d failed: %w", i+1, err)
+				}
+				p, err := packet.Read(bytes.NewReader(sig))
+				if err != nil {
+					return fmt.Errorf("co-signer %d did not return an OpenPGP signature: %w", i+1, err)
+				}
+				if _, ok := p.(*packet.Signature); !ok {
+					return fmt.Errorf("co-signer %d returned a %T packet instead of an OpenPGP signature", i+1, p)
+				}
+				sigs = append(sigs, base64.StdEncoding.EncodeToString(sig))
+			}
+			sigHeader.Add(sigOpenPGP, EntryStringSlice(sigs))
+		}
 	}
 	return nil
 }
@@ -356,11 +763,8 @@ func (r *RPM) writeRelationIndexes(h *index) error {
 	if err := r.Obsoletes.AddToIndex(h, tagObsoletes, tagObsoleteVersion, tagObsoleteFlags); err != nil {
 		return fmt.Errorf("failed to add obsoletes: %w", err)
 	}
-	if err := r.Suggests.AddToIndex(h, tagSuggests, tagSuggestVersion, tagSuggestFlags); err != nil {
-		return fmt.Errorf("failed to add suggests: %w", err)
-	}
-	if err := r.Recommends.AddToIndex(h, tagRecommends, tagRecommendVersion, tagRecommendFlags); err != nil {
-		return fmt.Errorf("failed to add recommends: %w", err)
+	if err := r.writeWeakRelationIndexes(h); err != nil {
+		return err
 	}
 	if err := r.Requires.AddToIndex(h, tagRequires, tagRequireVersion, tagRequireFlags); err != nil {
 		return fmt.Errorf("failed to add requires: %w", err)
@@ -372,6 +776,35 @@ func (r *RPM) writeRelationIndexes(h *index) error {
 	return nil
 }
 
+func (r *RPM) writeWeakRelationIndexes(h *index) error {
+	if r.WeakDependencies != "legacy" {
+		if err := r.Suggests.AddToIndex(h, tagSuggests, tagSuggestVersion, tagSuggestFlags); err != nil {
+			return fmt.Errorf("failed to add suggests: %w", err)
+		}
+		if err := r.Recommends.AddToIndex(h, tagRecommends, tagRecommendVersion, tagRecommendFlags); err != nil {
+			return fmt.Errorf("failed to add recommends: %w", err)
+		}
+		if err := r.Supplements.AddToIndex(h, tagSupplements, tagSupplementVersion, tagSupplementFlags); err != nil {
+			return fmt.Errorf("failed to add supplements: %w", err)
+		}
+		if err := r.Enhances.AddToIndex(h, tagEnhances, tagEnhanceVersion, tagEnhanceFlags); err != nil {
+			return fmt.Errorf("failed to add enhances: %w", err)
+		}
+	}
+	if r.WeakDependencies == "legacy" || r.WeakDependencies == "both" {
+		// The old tags have no recommends and supplements, these are marked as strong instead.
+		oldSuggests := append(append(Relations(nil), r.Suggests...), strongRelations(r.Recommends)...)
+		if err := oldSuggests.AddToIndex(h, tagOldSuggests, tagOldSuggestVersion, tagOldSuggestFlags); err != nil {
+			return fmt.Errorf("failed to add legacy suggests: %w", err)
+		}
+		oldEnhances := append(append(Relations(nil), r.Enhances...), strongRelations(r.Supplements)...)
+		if err := oldEnhances.AddToIndex(h, tagOldEnhances, tagOldEnhanceVersion, tagOldEnhanceFlags); err != nil {
+			return fmt.Errorf("failed to add legacy enhances: %w", err)
+		}
+	}
+	return nil
+}
+
 // AddCustomTag adds or overwrites a tag value in the index.
 func (r *RPM) AddCustomTag(tag int, e IndexEntry) {
 	r.customTags[tag] = e
@@ -420,39 +853,23 @@ func (r *RPM) writeGenIndexes(h *index) {
 	if r.URL != "" {
 		h.Add(tagURL, EntryString(r.URL))
 	}
-	h.Add(tagPayloadDigest, EntryStringSlice([]string{fmt.Sprintf("%x", sha256.Sum256(r.payload.Bytes()))}))
-	h.Add(tagPayloadDigestAlgo, EntryInt32([]int32{hashAlgoSHA256}))
-
-	// rpm utilities look for the sourcerpm tag to deduce if this is not a source rpm (if it has a sourcerpm,
-	// it is NOT a source rpm).
-	h.Add(tagSourceRPM, EntryString(fmt.Sprintf("%s-%s.src.rpm", r.Name, r.FullVersion())))
-	if r.pretrans != "" {
-		h.Add(tagPretrans, EntryString(r.pretrans))
-		h.Add(tagPretransProg, EntryString("/bin/sh"))
-	}
-	if r.prein != "" {
-		h.Add(tagPrein, EntryString(r.prein))
-		h.Add(tagPreinProg, EntryString("/bin/sh"))
-	}
-	if r.postin != "" {
-		h.Add(tagPostin, EntryString(r.postin))
-		h.Add(tagPostinProg, EntryString("/bin/sh"))
-	}
-	if r.preun != "" {
-		h.Add(tagPreun, EntryString(r.preun))
-		h.Add(tagPreunProg, EntryString("/bin/sh"))
+	if !r.NoPayloadDigest {
+		h.Add(tagPayloadDigest, EntryStringSlice([]string{r.payloadDigest}))
+		h.Add(tagPayloadDigestAlgo, EntryInt32([]int32{hashAlgoSHA256}))
 	}
-	if r.postun != "" {
-		h.Add(tagPostun, EntryString(r.postun))
-		h.Add(tagPostunProg, EntryString("/bin/sh"))
-	}
-	if r.posttrans != "" {
-		h.Add(tagPosttrans, EntryString(r.posttrans))
-		h.Add(tagPosttransProg, EntryString("/bin/sh"))
-	}
-	if r.verifyscript != "" {
-		h.Add(tagVerifyScript, EntryString(r.verifyscript))
-		h.Add(tagVerifyScriptProg, EntryString("/bin/sh"))
+
+	if r.sourcePackage {
+		h.Add(tagSourcePackage, EntryInt32([]int32{1}))
+		if len(r.sources) != 0 {
+			h.Add(tagSource, EntryStringSlice(r.sources))
+		}
+		if len(r.patches) != 0 {
+			h.Add(tagPatch, EntryStringSlice(r.patches))
+		}
+	} else {
+		// rpm utilities look for the sourcerpm tag to deduce if this is not a source rpm (if it has a sourcerpm,
+		// it is NOT a source rpm).
+		h.Add(tagSourceRPM, EntryString(fmt.Sprintf("%s-%s.src.rpm", r.Name, r.FullVersion())))
 	}
 }
 
@@ -498,49 +915,122 @@ func (r *RPM) writeFileIndexes(h *index) {
 
 // AddPretrans adds a pretrans scriptlet
 func (r *RPM) AddPretrans(s string) {
-	r.pretrans = s
+	r.setScriptletBody(ScriptletPretrans, s)
 }
 
 // AddPrein adds a prein scriptlet
 func (r *RPM) AddPrein(s string) {
-	r.prein = s
+	r.setScriptletBody(ScriptletPrein, s)
 }
 
 // AddPostin adds a postin scriptlet
 func (r *RPM) AddPostin(s string) {
-	r.postin = s
+	r.setScriptletBody(ScriptletPostin, s)
 }
 
 // AddPreun adds a preun scriptlet
 func (r *RPM) AddPreun(s string) {
-	r.preun = s
+	r.setScriptletBody(ScriptletPreun, s)
 }
 
 // AddPostun adds a postun scriptlet
 func (r *RPM) AddPostun(s string) {
-	r.postun = s
+	r.setScriptletBody(ScriptletPostun, s)
 }
 
 // AddPosttrans adds a posttrans scriptlet
 func (r *RPM) AddPosttrans(s string) {
-	r.posttrans = s
+	r.setScriptletBody(ScriptletPosttrans, s)
 }
 
 // AddVerifyScript adds a verifyscript scriptlet
 func (r *RPM) AddVerifyScript(s string) {
-	r.verifyscript = s
+	r.setScriptletBody(ScriptletVerify, s)
+}
+
+// AddScriptRequires adds requires which are needed by scriptlets, like Requires(pre) and
+// Requires(post) in a spec file. scope is a combination of the SenseScript* flags, so rpm
+// installs the requirements before running the scriptlets, e.g.
+//
+//	r.AddScriptRequires(SenseScriptPre|SenseScriptPost, "shadow-utils", "systemd >= 239")
+func (r *RPM) AddScriptRequires(scope rpmSense, relations ...string) error {
+	for _, s := range relations {
+		rel, err := NewRelation(s)
+		if err != nil {
+			return err
+		}
+		rel.Sense |= scope
+		r.Requires.addIfMissing(rel)
+	}
+	return nil
 }
 
-// AddFile adds an RPMFile to an existing rpm.
+// AddFile adds an RPMFile to an existing rpm. Trailing and duplicate slashes are removed
+// from the name, otherwise it is not checked, unless StrictPaths is set.
+// A file with the same name as an earlier one replaces it.
 func (r *RPM) AddFile(f RPMFile) {
+	f.Name = normalizePath(f.Name)
+	var warnings []error
 	if f.Name == "/" { // rpm does not allow the root dir to be included.
+		warnings = append(warnings, fmt.Errorf("%w, it was not added", ErrRootDir))
+	} else if f.Owner == "" || f.Group == "" {
+		warnings = append(warnings, fmt.Errorf("%w: file %q has owner %q and group %q, rpm installs it as root", ErrNoOwner, f.Name, f.Owner, f.Group))
+	}
+	r.mu.Lock()
+	if f.Name != "/" {
+		if _, ok := r.files[f.Name]; ok {
+			warnings = append(warnings, fmt.Errorf("%w: %q replaces the file added before", ErrDuplicateFile, f.Name))
+		}
+		r.files[f.Name] = f
+	}
+	r.warnings = append(r.warnings, warnings...)
+	handler := r.warningHandler
+	r.mu.Unlock()
+	if handler != nil {
+		for _, w := range warnings {
+			handler(w)
+		}
+	}
+}
+
+// Warnings returns the problems which did not stop building the rpm, e.g. ErrRootDir when
+// the root directory of a tar was not added by FromTar.
+func (r *RPM) Warnings() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.warnings...)
+}
+
+// SetWarningHandler registers a function which is called with every warning as it occurs,
+// e.g. to log it. The warnings are returned by Warnings as well. With concurrent AddFile
+// calls the handler is called concurrently too.
+func (r *RPM) SetWarningHandler(f func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warningHandler = f
+}
+
+// growFileSlices makes room for n more files in the per-file header slices, so
+// packages with many files do not reallocate them over and over.
+func (r *RPM) growFileSlices(n int) {
+	if n <= cap(r.basenames)-len(r.basenames) {
 		return
 	}
-	r.files[f.Name] = f
+	l := len(r.basenames)
+	r.basenames = append(make([]string, 0, l+n), r.basenames...)
+	r.dirindexes = append(make([]uint32, 0, l+n), r.dirindexes...)
+	r.filesizes = append(make([]uint32, 0, l+n), r.filesizes...)
+	r.filemodes = append(make([]uint16, 0, l+n), r.filemodes...)
+	r.fileowners = append(make([]string, 0, l+n), r.fileowners...)
+	r.filegroups = append(make([]string, 0, l+n), r.filegroups...)
+	r.filemtimes = append(make([]uint32, 0, l+n), r.filemtimes...)
+	r.filedigests = append(make([]string, 0, l+n), r.filedigests...)
+	r.filelinktos = append(make([]string, 0, l+n), r.filelinktos...)
+	r.fileflags = append(make([]uint32, 0, l+n), r.fileflags...)
 }
 
-// writeFile writes the file to the indexes and cpio.
-func (r *RPM) writeFile(f RPMFile) error {
+// writeFile adds a file to the file lists of the header.
+func (r *RPM) writeFile(f RPMFile) {
 	dir, file := path.Split(f.Name)
 	r.dirindexes = append(r.dirindexes, r.di.Get(dir))
 	r.basenames = append(r.basenames, file)
@@ -549,39 +1039,63 @@ func (r *RPM) writeFile(f RPMFile) error {
 	r.filemtimes = append(r.filemtimes, f.MTime)
 	r.fileflags = append(r.fileflags, uint32(f.Type))
 
-	links := 1
 	switch {
 	case f.Mode&040000 != 0: // directory
 		r.filesizes = append(r.filesizes, 4096)
 		r.filedigests = append(r.filedigests, "")
 		r.filelinktos = append(r.filelinktos, "")
-		links = 2
 	case f.Mode&0120000 == 0120000: //  symlink
 		r.filesizes = append(r.filesizes, uint32(len(f.Body)))
 		r.filedigests = append(r.filedigests, "")
 		r.filelinktos = append(r.filelinktos, string(f.Body))
 	default: // regular file
-		f.Mode = f.Mode | 0100000
 		r.filesizes = append(r.filesizes, uint32(len(f.Body)))
-		r.filedigests = append(r.filedigests, fmt.Sprintf("%x", sha256.Sum256(f.Body)))
+		sum := sha256.Sum256(f.Body)
+		r.filedigests = append(r.filedigests, hex.EncodeToString(sum[:]))
 		r.filelinktos = append(r.filelinktos, "")
 	}
-	r.filemodes = append(r.filemodes, uint16(f.Mode))
+	mode, _ := fileMode(f)
+	r.filemodes = append(r.filemodes, uint16(mode))
+}
+
+// fileMode returns the mode of a file, with the type bits of regular files set, and
+// its number of links.
+func fileMode(f RPMFile) (uint, int) {
+	switch {
+	case f.Mode&040000 != 0: // directory
+		return f.Mode, 2
+	case f.Mode&0120000 == 0120000: //  symlink
+		return f.Mode, 1
+	default: // regular file
+		return f.Mode | 0100000, 1
+	}
+}
 
+// writePayload adds a file to the payload.
+func (r *RPM) writePayload(f RPMFile) error {
 	// Ghost files have no payload
-	if f.Type == GhostFile {
+	if f.Type&GhostFile != 0 {
 		return nil
 	}
-	return r.writePayload(f, links)
-}
-
-func (r *RPM) writePayload(f RPMFile, links int) error {
+	mode, links := fileMode(f)
+	name := f.Name
+	// The files of source rpms have no directory, and no prefix.
+	if !r.NoPayloadNamePrefix && strings.HasPrefix(name, "/") {
+		name = "." + name
+	}
 	hdr := &cpio.Header{
-		Name:  f.Name,
-		Mode:  cpio.FileMode(f.Mode),
+		Name:  name,
+		Mode:  cpio.FileMode(mode),
 		Size:  int64(len(f.Body)),
 		Links: links,
 	}
+	if r.crc != nil {
+		var checksum uint32
+		if hdr.Mode.IsRegular() {
+			checksum = cpioChecksum(f.Body)
+		}
+		r.crc.nextHeader(checksum)
+	}
 	if err := r.cpio.WriteHeader(hdr); err != nil {
 		return fmt.Errorf("failed to write payload file header: %w", err)
 	}
@@ -2,10 +2,17 @@ package rpmpack
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"reflect"
+	"sync"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/cavaliergopher/cpio"
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/klauspost/compress/zstd"
@@ -15,7 +22,7 @@ import (
 )
 
 func TestFileOwner(t *testing.T) {
-	r, err := NewRPM(RPMMetaData{})
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0"})
 	if err != nil {
 		t.Fatalf("NewRPM returned error %v", err)
 	}
@@ -42,7 +49,7 @@ func TestFileOwner(t *testing.T) {
 
 // https://github.com/google/rpmpack/issues/49
 func Test100644(t *testing.T) {
-	r, err := NewRPM(RPMMetaData{})
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0"})
 	if err != nil {
 		t.Fatalf("NewRPM returned error %v", err)
 	}
@@ -127,6 +134,9 @@ func TestCompression(t *testing.T) {
 				})
 				if err != nil {
 					if testCase.ExpectedWriter == nil {
+						if !errors.Is(err, ErrUnsupportedCompressor) {
+							t.Errorf("NewRPM returned error %v, want %v", err, ErrUnsupportedCompressor)
+						}
 						return // an error is expected
 					}
 
@@ -157,7 +167,7 @@ func TestCompression(t *testing.T) {
 }
 
 func TestAllowListDirs(t *testing.T) {
-	r, err := NewRPM(RPMMetaData{})
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0"})
 	if err != nil {
 		t.Fatalf("NewRPM returned error %v", err)
 	}
@@ -200,3 +210,418 @@ func TestMinimalSpec(t *testing.T) {
 		t.Errorf("Write returned error %v", err)
 	}
 }
+
+func TestWriteTwice(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "twice", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+	calls := 0
+	r.SetPGPSigner(func([]byte) ([]byte, error) {
+		calls++
+		return []byte(fmt.Sprintf("signature %d", calls)), nil
+	})
+
+	var b1, b2 bytes.Buffer
+	if err := r.Write(&b1); err != nil {
+		t.Fatalf("first Write returned error %v", err)
+	}
+	if err := r.Write(&b2); err != nil {
+		t.Fatalf("second Write returned error %v", err)
+	}
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Errorf("second Write produced a different rpm")
+	}
+	if calls != 2 {
+		t.Errorf("signer was called %d times, want 2 (header and header+payload once)", calls)
+	}
+	if len(r.basenames) != 1 {
+		t.Errorf("files were added %d times to the index, want 1", len(r.basenames))
+	}
+}
+
+func TestHeaderBytes(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "headerbytes", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+	if _, err := r.HeaderBytes(); !errors.Is(err, ErrNotFinalized) {
+		t.Errorf("HeaderBytes before Finalize returned %v, want ErrNotFinalized", err)
+	}
+	if _, err := r.SignatureBytes(); !errors.Is(err, ErrNotFinalized) {
+		t.Errorf("SignatureBytes before Finalize returned %v, want ErrNotFinalized", err)
+	}
+	if err := r.Finalize(); err != nil {
+		t.Fatalf("Finalize returned error %v", err)
+	}
+	hb, err := r.HeaderBytes()
+	if err != nil {
+		t.Fatalf("HeaderBytes returned error %v", err)
+	}
+	sb, err := r.SignatureBytes()
+	if err != nil {
+		t.Fatalf("SignatureBytes returned error %v", err)
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if !bytes.Equal(hb, pkg.Header.Raw()) {
+		t.Errorf("HeaderBytes returned a different header than the one written")
+	}
+	if !bytes.Equal(sb, pkg.Signature.Raw()) {
+		t.Errorf("SignatureBytes returned a different signature header than the one written")
+	}
+}
+
+func TestLicenseAlias(t *testing.T) {
+	testCases := []struct {
+		name             string
+		licence, license string
+		want             string
+		wantErr          bool
+	}{
+		{name: "licence", licence: "MIT", want: "MIT"},
+		{name: "license", license: "MIT", want: "MIT"},
+		{name: "both equal", licence: "MIT", license: "MIT", want: "MIT"},
+		{name: "both differ", licence: "MIT", license: "GPL", wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Licence: tc.licence, License: tc.license})
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("NewRPM should have returned an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			if r.Licence != tc.want || r.License != tc.want {
+				t.Errorf("Licence/License = %q/%q, want %q", r.Licence, r.License, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddScriptRequires(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "foo", Version: "1.2"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddScriptRequires(SenseScriptPre|SenseScriptPost, "shadow-utils", "systemd >= 239"); err != nil {
+		t.Fatalf("AddScriptRequires returned error %v", err)
+	}
+	if err := r.AddScriptRequires(SenseScriptPre, "bad <> 1"); err == nil {
+		t.Errorf("AddScriptRequires with an invalid relation should have returned an error")
+	}
+	want := Relations{
+		{Name: "shadow-utils", Sense: SenseScriptPre | SenseScriptPost},
+		{Name: "systemd", Version: "239", Sense: SenseGreater | SenseEqual | SenseScriptPre | SenseScriptPost},
+	}
+	if d := cmp.Diff(want, r.Requires); d != "" {
+		t.Errorf("Requires differ (want->got):\n%v", d)
+	}
+	if got := r.Requires.String(); got != "shadow-utils,systemd>=239" {
+		t.Errorf("Requires.String() = %q, want the scope to be omitted", got)
+	}
+}
+
+func TestWeakDependencies(t *testing.T) {
+	testCases := []struct {
+		format   string
+		wantTags []int
+	}{
+		{format: "", wantTags: []int{tagSuggests, tagRecommends, tagSupplements, tagEnhances}},
+		{format: "legacy", wantTags: []int{tagOldSuggests, tagOldEnhances}},
+		{format: "both", wantTags: []int{tagSuggests, tagRecommends, tagSupplements, tagEnhances, tagOldSuggests, tagOldEnhances}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.format, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{
+				Name:             "weak",
+				Suggests:         Relations{{Name: "a"}},
+				Recommends:       Relations{{Name: "b"}},
+				Supplements:      Relations{{Name: "c"}},
+				Enhances:         Relations{{Name: "d"}},
+				WeakDependencies: tc.format,
+			})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			h := newIndex(immutable)
+			if err := r.writeRelationIndexes(h); err != nil {
+				t.Fatalf("writeRelationIndexes returned error %v", err)
+			}
+			for _, tag := range tc.wantTags {
+				if _, ok := h.entries[tag]; !ok {
+					t.Errorf("tag %d is missing", tag)
+				}
+			}
+			if tc.format == "legacy" {
+				if _, ok := h.entries[tagSuggests]; ok {
+					t.Errorf("legacy format should not write the modern suggests tag")
+				}
+			}
+			if tc.format != "" {
+				want := EntryUint32([]uint32{0, uint32(senseStrong)})
+				if d := cmp.Diff(want, h.entries[tagOldSuggestFlags], cmp.AllowUnexported(IndexEntry{})); d != "" {
+					t.Errorf("legacy suggest flags differ (want->got):\n%v", d)
+				}
+			}
+		})
+	}
+	if _, err := NewRPM(RPMMetaData{Name: "weak", WeakDependencies: "ancient"}); err == nil {
+		t.Errorf("NewRPM with an unknown weak dependencies format should have returned an error")
+	}
+}
+
+func TestAddPGPSigner(t *testing.T) {
+	var keys []*KeySigner
+	for _, algo := range []packet.PublicKeyAlgorithm{packet.PubKeyAlgoRSA, packet.PubKeyAlgoEdDSA} {
+		entity, err := openpgp.NewEntity("rpmpack test", "", "test@example.com", &packet.Config{Algorithm: algo, RSABits: 2048})
+		if err != nil {
+			t.Fatalf("NewEntity returned error %v", err)
+		}
+		keys = append(keys, &KeySigner{entity: entity})
+	}
+	r, err := NewRPM(RPMMetaData{Name: "cosigned", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, k := range keys {
+		r.AddPGPSigner(k.Sign)
+	}
+	header := []byte("header")
+	s := newIndex(signatures)
+	if err := r.writeSignatures(s, header); err != nil {
+		t.Fatalf("writeSignatures returned error %v", err)
+	}
+	for _, tag := range []int{sigRSA, sigPGP} {
+		if _, ok := s.entries[tag]; !ok {
+			t.Errorf("signature tag %d of the first signer is missing", tag)
+		}
+	}
+	for _, tag := range []int{sigDSA, sigGPG} {
+		if _, ok := s.entries[tag]; ok {
+			t.Errorf("co-signer wrote legacy signature tag %d", tag)
+		}
+	}
+	sigs := s.entries[sigOpenPGP].strings()
+	if len(sigs) != len(keys) {
+		t.Fatalf("OPENPGP tag has %d signatures, want %d", len(sigs), len(keys))
+	}
+	for i, sig := range sigs {
+		b, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			t.Fatalf("signature %d is not base64: %v", i, err)
+		}
+		if _, err := openpgp.CheckDetachedSignature(openpgp.EntityList{keys[i].entity}, bytes.NewReader(header), bytes.NewReader(b), nil); err != nil {
+			t.Errorf("signature %d: CheckDetachedSignature returned error %v", i, err)
+		}
+	}
+
+	r.AddPGPSigner(func([]byte) ([]byte, error) { return []byte("this is not a signature"), nil })
+	if err := r.writeSignatures(newIndex(signatures), header); err == nil {
+		t.Errorf("writeSignatures with a co-signer returning garbage should have returned an error")
+	}
+}
+
+func TestSetPGPReaderSigner(t *testing.T) {
+	entity, err := openpgp.NewEntity("rpmpack test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("NewEntity returned error %v", err)
+	}
+	k := &KeySigner{entity: entity}
+	r, err := NewRPM(RPMMetaData{Name: "streamed", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/streamed", Body: []byte("content")})
+	var signed []string
+	r.SetPGPReaderSigner(func(rd io.Reader) ([]byte, error) {
+		signed = append(signed, fmt.Sprintf("%T", rd))
+		return k.SignReader(rd)
+	})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	// The header and payload are read one after the other, not copied to one slice.
+	if d := cmp.Diff([]string{"*bytes.Reader", "*io.multiReader"}, signed); d != "" {
+		t.Errorf("signed readers differ (want->got):\n%s", d)
+	}
+	var pub bytes.Buffer
+	if err := entity.Serialize(&pub); err != nil {
+		t.Fatalf("Serialize returned error %v", err)
+	}
+	if _, err := VerifySignatures(bytes.NewReader(b.Bytes()), pub.Bytes()); err != nil {
+		t.Errorf("VerifySignatures returned error %v", err)
+	}
+}
+
+func TestPayloadNamePrefix(t *testing.T) {
+	for _, tc := range []struct {
+		noPrefix bool
+		want     string
+	}{
+		{want: "./usr/local/hello"},
+		{noPrefix: true, want: "/usr/local/hello"},
+	} {
+		r, err := NewRPM(RPMMetaData{Name: "prefix", Version: "1.0", NoPayloadNamePrefix: tc.noPrefix})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+		var b bytes.Buffer
+		if err := r.Write(&b); err != nil {
+			t.Fatalf("Write returned error %v", err)
+		}
+		pkg, err := ReadPackage(&b)
+		if err != nil {
+			t.Fatalf("ReadPackage returned error %v", err)
+		}
+		z, err := pkg.PayloadReader()
+		if err != nil {
+			t.Fatalf("PayloadReader returned error %v", err)
+		}
+		hdr, err := cpio.NewReader(z).Next()
+		z.Close()
+		if err != nil {
+			t.Fatalf("reading the payload returned error %v", err)
+		}
+		if hdr.Name != tc.want {
+			t.Errorf("payload member is named %q, want %q", hdr.Name, tc.want)
+		}
+		files, err := pkg.Files()
+		if err != nil {
+			t.Fatalf("Files returned error %v", err)
+		}
+		if len(files) != 1 || files[0].Name != "/usr/local/hello" {
+			t.Errorf("Files returned %v, want /usr/local/hello", files)
+		}
+	}
+}
+
+func TestNoPayloadDigest(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		md   RPMMetaData
+	}{
+		{name: "default", md: RPMMetaData{}},
+		{name: "omitted", md: RPMMetaData{NoPayloadDigest: true}},
+		{name: "omitted with rpmbuild layout", md: RPMMetaData{NoPayloadDigest: true, RPMBuildVersion: "4.18.0"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.md.Name = "digest"
+			tc.md.Version = "1.0"
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+				t.Errorf("VerifyDigests returned error %v", err)
+			}
+			pkg, err := ReadPackage(&b)
+			if err != nil {
+				t.Fatalf("ReadPackage returned error %v", err)
+			}
+			for _, tag := range []int{tagPayloadDigest, tagPayloadDigestAlgo, tagPayloadDigestAlt} {
+				want := !tc.md.NoPayloadDigest && (tag != tagPayloadDigestAlt || tc.md.RPMBuildVersion != "")
+				if _, ok := pkg.Header.entries[tag]; ok != want {
+					t.Errorf("tag %d is present: %t, want %t", tag, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentAddFile(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "concurrent", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.AddFile(RPMFile{Name: fmt.Sprintf("/step%d/file%d", i, j), Body: []byte("out"), Mode: 0644, Owner: "root", Group: "root"})
+			}
+			r.AddFile(RPMFile{Name: "/"})
+		}(i)
+	}
+	wg.Wait()
+	if err := r.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if got := len(r.basenames); got != 800 {
+		t.Errorf("rpm has %d files, want 800", got)
+	}
+	if got := len(r.Warnings()); got != 8 {
+		t.Errorf("rpm has %d warnings, want 8", got)
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "warnings", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	var got []error
+	r.SetWarningHandler(func(err error) { got = append(got, err) })
+	r.AddFile(RPMFile{Name: "/"})
+	r.AddFile(RPMFile{Name: "/etc/hello", Owner: "root", Group: "root"})
+	r.AddFile(RPMFile{Name: "/etc/hello", Owner: "root", Group: "root"})
+	r.AddFile(RPMFile{Name: "/etc/nobody", Owner: "root"})
+	want := []error{ErrRootDir, ErrDuplicateFile, ErrNoOwner}
+	if len(got) != len(want) {
+		t.Fatalf("handler was called with %v, want %v", got, want)
+	}
+	for i, err := range got {
+		if !errors.Is(err, want[i]) {
+			t.Errorf("warning %d is %v, want %v", i, err, want[i])
+		}
+	}
+	if d := cmp.Diff(got, r.Warnings(), cmp.Comparer(func(a, b error) bool { return a == b })); d != "" {
+		t.Errorf("Warnings returned unexpected warnings (want->got):\n%s", d)
+	}
+}
+
+func TestGhostConfigFile(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "ghost", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/ghost.conf", Body: []byte("content"), Mode: 0644, Owner: "root", Group: "root", Type: GhostFile | ConfigFile})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	pkg, err := ReadPackage(&b)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	files, err := pkg.Files()
+	if err != nil {
+		t.Fatalf("Files returned error %v", err)
+	}
+	if len(files) != 1 || files[0].Body != nil {
+		t.Errorf("Files returned %v, want a ghost file without content", files)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+)
+
+// rpmbuildReservedSpace is the default size of the RESERVEDSPACE tag of rpmbuild, the
+// %_gpg_reserved_space macro.
+const rpmbuildReservedSpace = 4096
+
+// addRPMLibRequires adds the rpmlib() requires which rpmbuild adds for the features of
+// the payload.
+func (r *RPM) addRPMLibRequires() {
+	type feature struct{ name, version string }
+	var features []feature
+	if !r.NoPayloadNamePrefix && !r.sourcePackage {
+		features = append(features, feature{"PayloadFilesHavePrefix", "4.0-1"})
+	}
+	if len(r.files) > 0 {
+		features = append(features, feature{"CompressedFileNames", "3.0.4-1"}, feature{"FileDigests", "4.6.0-1"})
+	}
+	switch r.Compressor {
+	case "xz":
+		features = append(features, feature{"PayloadIsXz", "5.2-1"})
+	case "lzma":
+		features = append(features, feature{"PayloadIsLzma", "4.4.2-1"})
+	case "zstd":
+		features = append(features, feature{"PayloadIsZstd", "5.4.18-1"})
+	}
+	for _, f := range features {
+		r.Requires.addIfMissing(&Relation{
+			Name:    fmt.Sprintf("rpmlib(%s)", f.name),
+			Version: f.version,
+			Sense:   SenseLess | SenseEqual | SenseRPMLIB,
+		})
+	}
+}
+
+// sortRelations sorts the relations like rpmbuild's dependency sets.
+func (r *RPM) sortRelations() {
+	for _, rels := range []Relations{r.Provides, r.Obsoletes, r.Suggests, r.Recommends, r.Supplements, r.Enhances, r.Requires, r.Conflicts} {
+		sort.SliceStable(rels, func(i, j int) bool {
+			a, b := rels[i], rels[j]
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			if a.Version != b.Version {
+				return a.Version < b.Version
+			}
+			return a.Sense < b.Sense
+		})
+	}
+}
+
+// writeRPMBuildIndexes adds and changes the header tags which differ from rpmbuild.
+func (r *RPM) writeRPMBuildIndexes(h *index) {
+	h.Add(tagRPMVersion, EntryString(r.RPMBuildVersion))
+	h.Add(tagEncoding, EntryString("utf-8"))
+	group := r.Group
+	if group == "" {
+		group = "Unspecified"
+	}
+	h.Add(tagSummary, entryI18NString(r.Summary))
+	h.Add(tagDescription, entryI18NString(r.Description))
+	h.Add(tagGroup, entryI18NString(group))
+	if r.uncompressedPayload != nil && !r.NoPayloadDigest && rpmvercmp(r.RPMBuildVersion, "4.16") >= 0 {
+		h.Add(tagPayloadDigestAlt, EntryStringSlice([]string{fmt.Sprintf("%x", r.uncompressedPayload.Sum(nil))}))
+	}
+	if _, ok := h.entries[tagFileDigestAlgo]; ok {
+		h.Add(tagFileDigestAlgo, EntryInt32([]int32{hashAlgoSHA256}))
+		h.Add(tagFileRDevs, EntryInt16(make([]int16, len(r.dirindexes))))
+	}
+}
+
+// writeRPMBuildSignatures adds the signature header tags which rpmbuild adds.
+func (r *RPM) writeRPMBuildSignatures(sigHeader *index, regHeader []byte) {
+	if rpmvercmp(r.RPMBuildVersion, "6") < 0 {
+		sigHeader.Add(sigSHA1, EntryString(fmt.Sprintf("%x", sha1.Sum(regHeader))))
+		m := md5.New()
+		m.Write(regHeader)
+		m.Write(r.payload.Bytes())
+		sigHeader.Add(sigMD5, EntryBytes(m.Sum(nil)))
+	}
+	if r.ReservedSpace == 0 {
+		sigHeader.Add(sigReservedSpace, EntryBytes(make([]byte, rpmbuildReservedSpace)))
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRPMBuildVersion(t *testing.T) {
+	testCases := []struct {
+		name        string
+		version     string
+		wantSigTags []int
+	}{{
+		name:        "rpm 4.18",
+		version:     "4.18.0",
+		wantSigTags: []int{sigSHA1, sigSHA256, sigSize, sigMD5, sigPayloadSize, sigReservedSpace},
+	}, {
+		name:        "rpm 6",
+		version:     "6.0.0",
+		wantSigTags: []int{sigSHA256, sigSize, sigPayloadSize, sigReservedSpace},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{
+				Name:            "layout",
+				Version:         "1.0",
+				Summary:         "A summary",
+				Compressor:      "zstd",
+				Requires:        Relations{{Name: "zlib"}, {Name: "bash"}},
+				RPMBuildVersion: tc.version,
+			})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/layout/a", Body: []byte("a")})
+			r.AddFile(RPMFile{Name: "/usr/share/layout/b", Body: []byte("b")})
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+				t.Errorf("VerifyDigests returned error %v", err)
+			}
+			pkg, err := ReadPackage(bytes.NewReader(b.Bytes()))
+			if err != nil {
+				t.Fatalf("ReadPackage returned error %v", err)
+			}
+			if d := cmp.Diff(tc.wantSigTags, pkg.Signature.Tags()); d != "" {
+				t.Errorf("unexpected signature tags (want->got):\n%s", d)
+			}
+
+			got, err := pkg.QueryFormat(`%{RPMVERSION} %{ENCODING} %{GROUP} %{FILEDIGESTALGO:arraysize} [%{FILERDEVS}]` +
+				`[%{REQUIRENAME}%{REQUIREFLAGS:depflags}%{REQUIREVERSION},]`)
+			if err != nil {
+				t.Fatalf("QueryFormat returned error %v", err)
+			}
+			want := tc.version + " utf-8 Unspecified 1 00" +
+				"bash,rpmlib(CompressedFileNames)<=3.0.4-1,rpmlib(FileDigests)<=4.6.0-1," +
+				"rpmlib(PayloadFilesHavePrefix)<=4.0-1,rpmlib(PayloadIsZstd)<=5.4.18-1,zlib,"
+			if got != want {
+				t.Errorf("QueryFormat returned %q, want %q", got, want)
+			}
+			for _, tag := range []int{tagSummary, tagDescription, tagGroup} {
+				if e := pkg.Header.entries[tag]; e.rpmtype != typeI18NString {
+					t.Errorf("tag %d has type %d, want I18NSTRING", tag, e.rpmtype)
+				}
+			}
+
+			// PAYLOADDIGESTALT is the digest of the uncompressed payload.
+			z, err := pkg.PayloadReader()
+			if err != nil {
+				t.Fatalf("PayloadReader returned error %v", err)
+			}
+			defer z.Close()
+			cpioBytes, err := io.ReadAll(z)
+			if err != nil {
+				t.Fatalf("reading the payload returned error %v", err)
+			}
+			alt, err := pkg.Header.Strings(tagPayloadDigestAlt)
+			if err != nil {
+				t.Fatalf("Strings(tagPayloadDigestAlt) returned error %v", err)
+			}
+			if want := fmt.Sprintf("%x", sha256.Sum256(cpioBytes)); len(alt) != 1 || alt[0] != want {
+				t.Errorf("PAYLOADDIGESTALT is %v, want %s", alt, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ScriptRequires returns a DependencyGenerator which adds a require on the interpreter
+// of executable scripts, taken from their "#!" line, e.g. "/bin/bash" or "/usr/bin/python3".
+// Like rpmbuild's script.req, only the interpreter path is required, so scripts using
+// "#!/usr/bin/env python3" require "/usr/bin/env".
+// Files matching one of the exclude patterns (see path.Match) are skipped.
+func ScriptRequires(exclude ...string) DependencyGenerator {
+	return func(f RPMFile) (Relations, Relations, error) {
+		if f.Mode&0111 == 0 || excludedPath(f.Name, exclude) {
+			return nil, nil, nil
+		}
+		interp := scriptInterpreter(f.Body)
+		if interp == "" {
+			return nil, nil, nil
+		}
+		return nil, Relations{&Relation{Name: interp}}, nil
+	}
+}
+
+// scriptInterpreter returns the interpreter path of the "#!" line of body, if any.
+func scriptInterpreter(body []byte) string {
+	if !bytes.HasPrefix(body, []byte("#!")) {
+		return ""
+	}
+	line := body[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+)
+
+func TestScriptRequires(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    RPMFile
+		exclude []string
+		want    string
+	}{{
+		name: "bash",
+		file: RPMFile{Name: "/usr/bin/a", Body: []byte("#!/bin/bash -e\necho hi\n"), Mode: 0100755},
+		want: "/bin/bash",
+	}, {
+		name: "env",
+		file: RPMFile{Name: "/usr/bin/b", Body: []byte("#! /usr/bin/env python3\n"), Mode: 0100755},
+		want: "/usr/bin/env",
+	}, {
+		name: "not executable",
+		file: RPMFile{Name: "/usr/share/c", Body: []byte("#!/bin/sh\n"), Mode: 0100644},
+	}, {
+		name: "no shebang",
+		file: RPMFile{Name: "/usr/bin/d", Body: []byte("echo hi\n"), Mode: 0100755},
+	}, {
+		name: "relative interpreter",
+		file: RPMFile{Name: "/usr/bin/e", Body: []byte("#!sh\n"), Mode: 0100755},
+	}, {
+		name:    "excluded",
+		file:    RPMFile{Name: "/usr/share/doc/f", Body: []byte("#!/usr/bin/perl\n"), Mode: 0100755},
+		exclude: []string{"/usr/share/doc/*"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, requires, err := ScriptRequires(tc.exclude...)(tc.file)
+			if err != nil {
+				t.Fatalf("ScriptRequires returned error %v", err)
+			}
+			if got := requires.String(); got != tc.want {
+				t.Errorf("ScriptRequires requires = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
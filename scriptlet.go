@@ -0,0 +1,446 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrUnknownScriptlet is returned for a scriptlet kind that is neither built in nor registered.
+	ErrUnknownScriptlet = errors.New("unknown scriptlet")
+	// ErrNotShellScriptlet is returned when rpmpack adds shell commands to a scriptlet run
+	// by another interpreter, e.g. <lua>, or when the interpreter of such a scriptlet is
+	// changed to one which is not a shell.
+	ErrNotShellScriptlet = errors.New("scriptlet interpreter is not a shell")
+)
+
+// The built in scriptlet kinds, as used by AddScriptlet, SetScriptletInterpreter and
+// SetScriptletFlags. More kinds can be added with RegisterScriptletKind.
+const (
+	ScriptletPretrans  = "pretrans"
+	ScriptletPrein     = "prein"
+	ScriptletPostin    = "postin"
+	ScriptletPreun     = "preun"
+	ScriptletPostun    = "postun"
+	ScriptletPosttrans = "posttrans"
+	ScriptletVerify    = "verifyscript"
+)
+
+// ScriptletFlags are the RPMSCRIPT_FLAG_* flags of a scriptlet.
+type ScriptletFlags uint32
+
+const (
+	// ScriptletExpand expands macros in the scriptlet body at install time.
+	ScriptletExpand ScriptletFlags = 1 << iota
+	// ScriptletQueryFormat expands query format tags in the scriptlet body at install time.
+	ScriptletQueryFormat
+	// ScriptletCritical makes a failure of the scriptlet abort the transaction element.
+	ScriptletCritical
+)
+
+// defaultInterpreter is the interpreter of scriptlets without an explicit one.
+const defaultInterpreter = "/bin/sh"
+
+// shellInterpreters are the interpreters which run the shell commands added by rpmpack,
+// e.g. by AddAlternative or AddSystemUser.
+var shellInterpreters = map[string]bool{
+	"/bin/sh":       true,
+	"/usr/bin/sh":   true,
+	"/bin/bash":     true,
+	"/usr/bin/bash": true,
+	"/bin/dash":     true,
+	"/usr/bin/dash": true,
+}
+
+// isShell reports whether a scriptlet interpreter is a POSIX shell. The empty interpreter
+// is the default /bin/sh.
+func isShell(interpreter string) bool {
+	fields := strings.Fields(interpreter)
+	return len(fields) == 0 || shellInterpreters[fields[0]]
+}
+
+// ScriptletTags are the header tags of a scriptlet kind, see RegisterScriptletKind.
+type ScriptletTags struct {
+	// Script is the tag of the scriptlet body, e.g. 1023 (RPMTAG_PREIN).
+	Script int
+	// Prog is the tag of the interpreter, e.g. 1085 (RPMTAG_PREINPROG).
+	Prog int
+	// Flags is the tag of the scriptlet flags, e.g. 5020 (RPMTAG_PREINFLAGS).
+	// It may be 0 if the scriptlet has no flags.
+	Flags int
+	// Sense is the flag of the requires needed by the scriptlet, e.g. SenseScriptPre.
+	Sense rpmSense
+}
+
+var scriptletKinds = map[string]ScriptletTags{
+	ScriptletPretrans:  {tagPretrans, tagPretransProg, tagPretransFlags, SenseScriptPretrans},
+	ScriptletPrein:     {tagPrein, tagPreinProg, tagPreinFlags, SenseScriptPre},
+	ScriptletPostin:    {tagPostin, tagPostinProg, tagPostinFlags, SenseScriptPost},
+	ScriptletPreun:     {tagPreun, tagPreunProg, tagPreunFlags, SenseScriptPreUn},
+	ScriptletPostun:    {tagPostun, tagPostunProg, tagPostunFlags, SenseScriptPostUn},
+	ScriptletPosttrans: {tagPosttrans, tagPosttransProg, tagPosttransFlags, SenseScriptPosttrans},
+	ScriptletVerify:    {tagVerifyScript, tagVerifyScriptProg, tagVerifyScriptFlags, SenseScriptVerify},
+}
+
+type scriptlet struct {
+	body        string
+	interpreter string
+	flags       ScriptletFlags
+	// shellCommands is set once rpmpack added shell commands to the body, the
+	// interpreter must then stay a shell.
+	shellCommands bool
+}
+
+// RegisterScriptletKind makes a scriptlet kind known to the rpm, so it can be used with
+// AddScriptlet, SetScriptletInterpreter and SetScriptletFlags. This allows to write
+// scriptlet types which rpmpack does not support yet. The built in kinds
+// (ScriptletPrein, ...) can not be registered again.
+func (r *RPM) RegisterScriptletKind(kind string, tags ScriptletTags) error {
+	if _, ok := r.scriptletTags(kind); ok {
+		return fmt.Errorf("scriptlet %q is already registered", kind)
+	}
+	if kind == "" || tags.Script == 0 || tags.Prog == 0 {
+		return fmt.Errorf("scriptlet %q needs a name, a script tag and a prog tag", kind)
+	}
+	if r.customScriptletKinds == nil {
+		r.customScriptletKinds = make(map[string]ScriptletTags)
+	}
+	r.customScriptletKinds[kind] = tags
+	return nil
+}
+
+// AddScriptlet sets the body of a scriptlet of a built in or registered kind.
+func (r *RPM) AddScriptlet(kind, content string) error {
+	s, err := r.scriptlet(kind)
+	if err != nil {
+		return err
+	}
+	if err := r.checkLuaScriptlet(kind, s.interpreter, content); err != nil {
+		return err
+	}
+	s.body = content
+	return nil
+}
+
+func (r *RPM) scriptletTags(kind string) (ScriptletTags, bool) {
+	if tags, ok := scriptletKinds[kind]; ok {
+		return tags, true
+	}
+	tags, ok := r.customScriptletKinds[kind]
+	return tags, ok
+}
+
+// scriptlet returns the scriptlet of the given kind, creating it if needed.
+func (r *RPM) scriptlet(kind string) (*scriptlet, error) {
+	if _, ok := r.scriptletTags(kind); !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownScriptlet, kind)
+	}
+	if r.scriptlets == nil {
+		r.scriptlets = make(map[string]*scriptlet)
+	}
+	s, ok := r.scriptlets[kind]
+	if !ok {
+		s = &scriptlet{}
+		r.scriptlets[kind] = s
+	}
+	return s, nil
+}
+
+func (r *RPM) setScriptletBody(kind, body string) {
+	s, err := r.scriptlet(kind)
+	if err != nil {
+		// The built in kinds always exist.
+		panic(err)
+	}
+	s.body = body
+}
+
+// appendScriptletBody appends the shell commands in script to the body of a scriptlet, on
+// a new line. It fails with ErrNotShellScriptlet if the scriptlet is not run by a shell.
+func (r *RPM) appendScriptletBody(kind, script string) error {
+	s, err := r.shellScriptlet(kind)
+	if err != nil {
+		return err
+	}
+	if s.body != "" && !strings.HasSuffix(s.body, "\n") {
+		s.body += "\n"
+	}
+	s.body += script
+	return nil
+}
+
+// shellScriptlet returns the scriptlet of the given kind for adding shell commands.
+func (r *RPM) shellScriptlet(kind string) (*scriptlet, error) {
+	if err := r.checkShellScriptlets(kind); err != nil {
+		return nil, err
+	}
+	s, err := r.scriptlet(kind)
+	if err != nil {
+		return nil, err
+	}
+	s.shellCommands = true
+	return s, nil
+}
+
+// checkShellScriptlets checks that shell commands can be added to the scriptlets of the
+// given kinds, so callers adding to several scriptlets can fail before changing any.
+func (r *RPM) checkShellScriptlets(kinds ...string) error {
+	for _, kind := range kinds {
+		if _, ok := r.scriptletTags(kind); !ok {
+			return fmt.Errorf("%w %q", ErrUnknownScriptlet, kind)
+		}
+		if s, ok := r.scriptlets[kind]; ok && !isShell(s.interpreter) {
+			return fmt.Errorf("%w: can not add shell commands to the %s scriptlet run by %s", ErrNotShellScriptlet, kind, s.interpreter)
+		}
+	}
+	return nil
+}
+
+// prependScriptletBody adds the shell commands in script before the body of a scriptlet.
+// It fails with ErrNotShellScriptlet if the scriptlet is not run by a shell.
+func (r *RPM) prependScriptletBody(kind, script string) error {
+	s, err := r.shellScriptlet(kind)
+	if err != nil {
+		return err
+	}
+	if s.body != "" && !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	s.body = script + s.body
+	return nil
+}
+
+// AddScriptletFromReader sets the body of a scriptlet to the content of rd, e.g.
+// r.AddScriptletFromReader(ScriptletPostin, f). Like rpmbuild, trailing whitespace
+// (including the final newline) is removed.
+func (r *RPM) AddScriptletFromReader(kind string, rd io.Reader) error {
+	s, err := r.scriptlet(kind)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(rd)
+	if err != nil {
+		return fmt.Errorf("failed to read %s scriptlet: %w", kind, err)
+	}
+	body := strings.TrimRightFunc(string(b), unicode.IsSpace)
+	if err := r.checkLuaScriptlet(kind, s.interpreter, body); err != nil {
+		return err
+	}
+	s.body = body
+	return nil
+}
+
+// AddScriptletFile sets the body of a scriptlet to the content of a file,
+// see AddScriptletFromReader.
+func (r *RPM) AddScriptletFile(kind, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s scriptlet: %w", kind, err)
+	}
+	defer f.Close()
+	return r.AddScriptletFromReader(kind, f)
+}
+
+// SetScriptletInterpreter sets the interpreter of a scriptlet, e.g. "/usr/bin/python3" or
+// "<lua>" for rpm's embedded lua. The interpreter may include arguments, e.g. "/bin/bash -e".
+// A scriptlet with an interpreter is written even if its body is empty, like
+// "%post -p /sbin/ldconfig" in a spec file. The default interpreter is /bin/sh.
+// Scriptlets with shell commands added by rpmpack, e.g. by AddAlternative, must keep a
+// shell as interpreter, otherwise ErrNotShellScriptlet is returned.
+func (r *RPM) SetScriptletInterpreter(kind, interpreter string) error {
+	s, err := r.scriptlet(kind)
+	if err != nil {
+		return err
+	}
+	if s.shellCommands && !isShell(interpreter) {
+		return fmt.Errorf("%w: the %s scriptlet has shell commands, it can not be run by %s", ErrNotShellScriptlet, kind, interpreter)
+	}
+	if err := r.checkLuaScriptlet(kind, interpreter, s.body); err != nil {
+		return err
+	}
+	s.interpreter = interpreter
+	return nil
+}
+
+// SetScriptletFlags sets the flags of a scriptlet.
+func (r *RPM) SetScriptletFlags(kind string, flags ScriptletFlags) error {
+	s, err := r.scriptlet(kind)
+	if err != nil {
+		return err
+	}
+	s.flags = flags
+	return nil
+}
+
+// addInterpreterRequires requires the interpreters of the scriptlets which do not use
+// /bin/sh or the embedded lua, scoped to the scriptlets using them, e.g.
+// Requires(post): /usr/bin/python3. It can be disabled with
+// RPMMetaData.NoInterpreterRequires.
+func (r *RPM) addInterpreterRequires() {
+	if r.NoInterpreterRequires {
+		return
+	}
+	scopes := map[string]rpmSense{}
+	var interpreters []string
+	for kind, s := range r.scriptlets {
+		if s.body == "" && s.interpreter == "" {
+			continue
+		}
+		fields := strings.Fields(s.interpreter)
+		if len(fields) == 0 || fields[0] == defaultInterpreter || fields[0] == luaInterpreter {
+			continue
+		}
+		if _, ok := scopes[fields[0]]; !ok {
+			interpreters = append(interpreters, fields[0])
+		}
+		tags, _ := r.scriptletTags(kind)
+		scopes[fields[0]] |= tags.Sense
+	}
+	sort.Strings(interpreters)
+interpreters:
+	for _, interpreter := range interpreters {
+		scope := scopes[interpreter]
+		for _, req := range r.Requires {
+			if req.Name == interpreter && req.Version == "" && req.Sense&scope == scope {
+				// Already required, e.g. by AddScriptRequires.
+				continue interpreters
+			}
+		}
+		r.Requires = append(r.Requires, &Relation{Name: interpreter, Sense: scope})
+	}
+}
+
+// writeScriptletIndexes adds the body, interpreter and flags tags of all scriptlets.
+func (r *RPM) writeScriptletIndexes(h *index) error {
+	macros := r.macroTable()
+	for kind, s := range r.scriptlets {
+		if s.body == "" && s.interpreter == "" {
+			continue
+		}
+		tags, _ := r.scriptletTags(kind)
+		if s.body != "" {
+			body, err := r.expandScriptlet(kind, s.body, macros)
+			if err != nil {
+				return err
+			}
+			// rpm runs scriptlets of any size from a temporary file, the only limit is the
+			// size of the header. Report it for the scriptlet rather than for the header.
+			if len(body)+1 > headerMaxData {
+				return fmt.Errorf("%w: the %s scriptlet has %d bytes, rpm reads at most %d bytes of header data", ErrHeaderTooLarge, kind, len(body), headerMaxData)
+			}
+			h.Add(tags.Script, EntryString(body))
+		}
+		interpreter := s.interpreter
+		if interpreter == "" {
+			interpreter = defaultInterpreter
+		}
+		// Like rpmbuild, interpreters with arguments are written as a string array.
+		if args := strings.Fields(interpreter); len(args) > 1 {
+			h.Add(tags.Prog, EntryStringSlice(args))
+		} else {
+			h.Add(tags.Prog, EntryString(interpreter))
+		}
+		if s.flags != 0 && tags.Flags != 0 {
+			h.Add(tags.Flags, EntryUint32([]uint32{uint32(s.flags)}))
+		}
+	}
+	return nil
+}
+
+// expandScriptlet returns the body of a scriptlet as it is written to the header, with
+// macros or variables expanded. macros is the result of r.macroTable().
+func (r *RPM) expandScriptlet(kind, body string, macros map[string]string) (string, error) {
+	switch {
+	case macros != nil:
+		expanded, err := expandMacros(body, macros)
+		if err != nil {
+			return "", fmt.Errorf("failed to expand %s scriptlet: %w", kind, err)
+		}
+		return expanded, nil
+	case r.ExpandScriptletVariables:
+		return expandVariables(body, r.scriptletVariables()), nil
+	}
+	return body, nil
+}
+
+// scriptletVariables returns the variables expanded in scriptlets, see
+// RPMMetaData.ExpandScriptletVariables.
+func (r *RPM) scriptletVariables() map[string]string {
+	vars := map[string]string{
+		"name":    r.Name,
+		"version": r.Version,
+		"release": r.Release,
+	}
+	// Like in rpm, %{epoch} is undefined for packages without an epoch tag.
+	if r.Epoch != NoEpoch {
+		vars["epoch"] = fmt.Sprint(r.Epoch)
+	}
+	if len(r.Prefixes) > 0 {
+		vars["prefix"] = r.Prefixes[0]
+	}
+	return vars
+}
+
+// expandVariables replaces %{var} in s with the value of var. Unknown variables are kept
+// as they are, and "%%" is replaced with "%".
+func expandVariables(s string, vars map[string]string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		switch {
+		case s[1] == '%':
+			b.WriteByte('%')
+			s = s[2:]
+		case s[1] == '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				b.WriteString(s)
+				return b.String()
+			}
+			if v, ok := vars[s[2:end]]; ok {
+				b.WriteString(v)
+			} else {
+				b.WriteString(s[:end+1])
+			}
+			s = s[end+1:]
+		default:
+			b.WriteByte('%')
+			s = s[1:]
+		}
+	}
+}
+
+// copyScriptlets returns a deep copy of the scriptlets of r.
+func (r *RPM) copyScriptlets() map[string]*scriptlet {
+	c := make(map[string]*scriptlet, len(r.scriptlets))
+	for kind, s := range r.scriptlets {
+		sc := *s
+		c[kind] = &sc
+	}
+	return c
+}
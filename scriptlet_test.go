@@ -0,0 +1,262 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScriptletIndexes(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "scripts"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPrein("echo prein")
+	r.AddVerifyScript("print('ok')")
+	if err := r.SetScriptletInterpreter(ScriptletVerify, "/usr/bin/python3 -s"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	if err := r.SetScriptletFlags(ScriptletVerify, ScriptletExpand|ScriptletCritical); err != nil {
+		t.Fatalf("SetScriptletFlags returned error %v", err)
+	}
+	if err := r.SetScriptletInterpreter(ScriptletPostin, "/sbin/ldconfig"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	if err := r.SetScriptletFlags("postinstall", ScriptletExpand); err == nil {
+		t.Errorf("SetScriptletFlags with an unknown kind should have returned an error")
+	}
+
+	h := newIndex(immutable)
+	if err := r.writeScriptletIndexes(h); err != nil {
+		t.Fatalf("writeScriptletIndexes returned error %v", err)
+	}
+	want := map[int]IndexEntry{
+		tagPrein:             EntryString("echo prein"),
+		tagPreinProg:         EntryString("/bin/sh"),
+		tagPostinProg:        EntryString("/sbin/ldconfig"),
+		tagVerifyScript:      EntryString("print('ok')"),
+		tagVerifyScriptProg:  EntryStringSlice([]string{"/usr/bin/python3", "-s"}),
+		tagVerifyScriptFlags: EntryUint32([]uint32{5}),
+	}
+	if d := cmp.Diff(want, h.entries, cmp.AllowUnexported(IndexEntry{})); d != "" {
+		t.Errorf("scriptlet entries differ (want->got):\n%v", d)
+	}
+}
+
+func TestExpandScriptletVariables(t *testing.T) {
+	for _, expand := range []bool{false, true} {
+		r, err := NewRPM(RPMMetaData{
+			Name:                     "hello",
+			Version:                  "1.0",
+			Release:                  "2",
+			Epoch:                    3,
+			Prefixes:                 []string{"/opt/hello"},
+			ExpandScriptletVariables: expand,
+		})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		body := `echo %{name}-%{epoch}:%{version}-%{release} in %{prefix} %{unknown} 100%% %d %{open`
+		r.AddPostin(body)
+		h := newIndex(immutable)
+		if err := r.writeScriptletIndexes(h); err != nil {
+			t.Fatalf("writeScriptletIndexes returned error %v", err)
+		}
+		want := body
+		if expand {
+			want = `echo hello-3:1.0-2 in /opt/hello %{unknown} 100% %d %{open`
+		}
+		if d := cmp.Diff(EntryString(want), h.entries[tagPostin], cmp.AllowUnexported(IndexEntry{})); d != "" {
+			t.Errorf("postin with expand=%v differs (want->got):\n%v", expand, d)
+		}
+	}
+}
+
+func TestExpandScriptletVariablesNoEpoch(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello", Version: "1.0", Epoch: NoEpoch, ExpandScriptletVariables: true})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPostin(`echo %{name} %{epoch}`)
+	h := newIndex(immutable)
+	if err := r.writeScriptletIndexes(h); err != nil {
+		t.Fatalf("writeScriptletIndexes returned error %v", err)
+	}
+	if d := cmp.Diff(EntryString(`echo hello %{epoch}`), h.entries[tagPostin], cmp.AllowUnexported(IndexEntry{})); d != "" {
+		t.Errorf("postin differs (want->got):\n%v", d)
+	}
+	if err := r.DefineMacro("greeting", "hi"); err != nil {
+		t.Fatalf("DefineMacro returned error %v", err)
+	}
+	if epoch, ok := r.macroTable()["epoch"]; ok {
+		t.Errorf("the epoch macro is defined as %q without an epoch", epoch)
+	}
+}
+
+func TestAddScriptletFromReader(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "scripts"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddScriptletFromReader(ScriptletPostin, strings.NewReader("echo one\necho two  \n\n\t\n")); err != nil {
+		t.Fatalf("AddScriptletFromReader returned error %v", err)
+	}
+	if got, want := r.scriptlets[ScriptletPostin].body, "echo one\necho two"; got != want {
+		t.Errorf("postin = %q, want %q", got, want)
+	}
+	name := filepath.Join(t.TempDir(), "preun.sh")
+	if err := os.WriteFile(name, []byte("echo preun\r\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile returned error %v", err)
+	}
+	if err := r.AddScriptletFile(ScriptletPreun, name); err != nil {
+		t.Fatalf("AddScriptletFile returned error %v", err)
+	}
+	if got, want := r.scriptlets[ScriptletPreun].body, "echo preun"; got != want {
+		t.Errorf("preun = %q, want %q", got, want)
+	}
+	if err := r.AddScriptletFile(ScriptletPreun, filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("AddScriptletFile with a missing file should have returned an error")
+	}
+	if err := r.AddScriptletFromReader("postinstall", strings.NewReader("")); err == nil {
+		t.Errorf("AddScriptletFromReader with an unknown kind should have returned an error")
+	}
+}
+
+func TestInterpreterRequires(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		r, err := NewRPM(RPMMetaData{Name: "scripts", NoInterpreterRequires: disabled})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddPrein("echo shell")
+		r.AddPostin("print('post')")
+		r.AddPostun("print('postun')")
+		r.AddPosttrans("print('lua')")
+		for kind, interpreter := range map[string]string{
+			ScriptletPostin:    "/usr/bin/python3 -s",
+			ScriptletPostun:    "/usr/bin/python3",
+			ScriptletPosttrans: "<lua>",
+		} {
+			if err := r.SetScriptletInterpreter(kind, interpreter); err != nil {
+				t.Fatalf("SetScriptletInterpreter returned error %v", err)
+			}
+		}
+		r.addInterpreterRequires()
+		var want Relations
+		if !disabled {
+			want = Relations{{Name: "/usr/bin/python3", Sense: SenseScriptPost | SenseScriptPostUn}}
+		}
+		if d := cmp.Diff(want, r.Requires); d != "" {
+			t.Errorf("Requires with NoInterpreterRequires=%v differ (want->got):\n%v", disabled, d)
+		}
+	}
+}
+
+func TestRegisterScriptletKind(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "scripts"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	// RPMTAG_PREUNTRANS and friends of rpm 4.20.
+	tags := ScriptletTags{Script: 5104, Prog: 5106, Flags: 5108, Sense: SenseScriptPreUn}
+	if err := r.RegisterScriptletKind("preuntrans", tags); err != nil {
+		t.Fatalf("RegisterScriptletKind returned error %v", err)
+	}
+	if err := r.RegisterScriptletKind(ScriptletPrein, tags); err == nil {
+		t.Errorf("RegisterScriptletKind of a built in kind should have returned an error")
+	}
+	if err := r.RegisterScriptletKind("nothing", ScriptletTags{}); err == nil {
+		t.Errorf("RegisterScriptletKind without tags should have returned an error")
+	}
+	if err := r.AddScriptlet("preuntrans", "echo preuntrans"); err != nil {
+		t.Fatalf("AddScriptlet returned error %v", err)
+	}
+	if err := r.SetScriptletFlags("preuntrans", ScriptletCritical); err != nil {
+		t.Fatalf("SetScriptletFlags returned error %v", err)
+	}
+	if err := r.AddScriptlet(ScriptletPrein, "echo prein"); err != nil {
+		t.Fatalf("AddScriptlet returned error %v", err)
+	}
+	if err := r.AddScriptlet("postuntrans", "echo"); err == nil {
+		t.Errorf("AddScriptlet with an unregistered kind should have returned an error")
+	}
+
+	h := newIndex(immutable)
+	if err := r.writeScriptletIndexes(h); err != nil {
+		t.Fatalf("writeScriptletIndexes returned error %v", err)
+	}
+	want := map[int]IndexEntry{
+		tagPrein:     EntryString("echo prein"),
+		tagPreinProg: EntryString("/bin/sh"),
+		5104:         EntryString("echo preuntrans"),
+		5106:         EntryString("/bin/sh"),
+		5108:         EntryUint32([]uint32{uint32(ScriptletCritical)}),
+	}
+	if d := cmp.Diff(want, h.entries, cmp.AllowUnexported(IndexEntry{})); d != "" {
+		t.Errorf("scriptlet entries differ (want->got):\n%v", d)
+	}
+}
+
+func TestShellCommands(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "vim"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.SetScriptletInterpreter(ScriptletPreun, "<lua>"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	alt := Alternative{Link: "/usr/bin/editor", Path: "/usr/bin/vim", Priority: 50}
+	if err := r.AddAlternative(alt); !errors.Is(err, ErrNotShellScriptlet) {
+		t.Errorf("AddAlternative with a <lua> preun returned %v, want %v", err, ErrNotShellScriptlet)
+	}
+	if len(r.Files()) != 0 || r.scriptlets[ScriptletPostin] != nil {
+		t.Errorf("failed AddAlternative changed the rpm: files %v, postin %v", r.Files(), r.scriptlets[ScriptletPostin])
+	}
+	if err := r.SetScriptletInterpreter(ScriptletPreun, "/bin/bash"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	if err := r.AddAlternative(alt); err != nil {
+		t.Fatalf("AddAlternative returned error %v", err)
+	}
+	if err := r.SetScriptletInterpreter(ScriptletPostin, "<lua>"); !errors.Is(err, ErrNotShellScriptlet) {
+		t.Errorf("SetScriptletInterpreter(<lua>) after AddAlternative returned %v, want %v", err, ErrNotShellScriptlet)
+	}
+}
+
+func TestScriptletTooLarge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the scriptlet has the maximum size of a header")
+	}
+	r, err := NewRPM(RPMMetaData{Name: "scripts"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPostin(strings.Repeat("#", headerMaxData))
+	h := newIndex(immutable)
+	err = r.writeScriptletIndexes(h)
+	if !errors.Is(err, ErrHeaderTooLarge) || !strings.Contains(err.Error(), ScriptletPostin) {
+		t.Errorf("writeScriptletIndexes returned %v, want ErrHeaderTooLarge for the postin scriptlet", err)
+	}
+	r.AddPostin(strings.Repeat("#", 1<<20))
+	if err := r.writeScriptletIndexes(h); err != nil {
+		t.Errorf("writeScriptletIndexes returned error %v for a 1 MiB scriptlet", err)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// luaInterpreter is the interpreter of scriptlets run by rpm's embedded lua.
+const luaInterpreter = "<lua>"
+
+// luaKeywords are the reserved words of lua, which can not end an expression.
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"for": true, "function": true, "goto": true, "if": true, "in": true, "local": true,
+	"not": true, "or": true, "repeat": true, "return": true, "then": true, "until": true,
+	"while": true,
+}
+
+// ValidateLua checks the syntax of a lua scriptlet. rpm embeds lua 5.3 or 5.4, while the
+// parser implements lua 5.1, so the integer division and bitwise operators and the
+// <const> and <close> attributes of local variables are accepted by rewriting them to
+// lua 5.1 before parsing. Other additions, e.g. the \z escape in strings and hexadecimal
+// floats, are still reported as errors.
+func ValidateLua(body string) error {
+	if _, err := parse.Parse(strings.NewReader(lua51(body)), "scriptlet"); err != nil {
+		return fmt.Errorf("invalid lua: %w", err)
+	}
+	return nil
+}
+
+// lua51 rewrites the lua 5.3 and 5.4 syntax of body which lua 5.1 does not have, keeping
+// the positions of the tokens for the errors of the parser: binary operators become "+",
+// unary "~" becomes "#" and the attributes of local variables are removed. Strings and
+// comments are not changed.
+func lua51(body string) string {
+	b := []byte(body)
+	// operand is set after a token ending an expression, where an operator is binary.
+	operand := false
+	// last are the last two names or punctuation characters, for attributes.
+	var last [2]string
+	push := func(tok string) { last[0], last[1] = last[1], tok }
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+		case c == '-' && luaPeek(b, i+1) == '-':
+			if end := luaLongBracket(b, i+2); end >= 0 {
+				i = end
+			} else {
+				for i < len(b) && b[i] != '\n' {
+					i++
+				}
+			}
+			continue
+		case c == '"' || c == '\'':
+			i = luaQuoted(b, i)
+			operand = true
+			push(`""`)
+			continue
+		case c == '[' && luaLongBracket(b, i) >= 0:
+			i = luaLongBracket(b, i)
+			operand = true
+			push(`""`)
+			continue
+		case isLuaNameByte(c) && (c < '0' || c > '9'):
+			j := i
+			for j < len(b) && isLuaNameByte(b[j]) {
+				j++
+			}
+			name := string(b[i:j])
+			operand = !luaKeywords[name]
+			push(name)
+			i = j
+			continue
+		case c >= '0' && c <= '9' || c == '.' && luaPeek(b, i+1) >= '0' && luaPeek(b, i+1) <= '9':
+			j := i + 1
+			for j < len(b) && (isLuaNameByte(b[j]) || b[j] == '.' ||
+				(b[j] == '+' || b[j] == '-') && strings.IndexByte("eEpP", b[j-1]) >= 0) {
+				j++
+			}
+			operand = true
+			push("0")
+			i = j
+			continue
+		case c == '.' && luaPeek(b, i+1) == '.' && luaPeek(b, i+2) == '.':
+			operand = true
+			push("...")
+			i += 3
+			continue
+		case c == '/' && luaPeek(b, i+1) == '/',
+			(c == '<' || c == '>') && luaPeek(b, i+1) == c:
+			b[i], b[i+1] = '+', ' '
+			i += 2
+		case c == '<' && last[1] != "" && isLuaNameByte(last[1][0]) && !luaKeywords[last[1]] &&
+			(last[0] == "local" || last[0] == ","):
+			if end := luaAttribute(b, i); end > 0 {
+				for ; i < end; i++ {
+					b[i] = ' '
+				}
+				continue
+			}
+			i++
+		case c == '&' || c == '|':
+			b[i] = '+'
+			i++
+		case c == '~' && luaPeek(b, i+1) != '=':
+			if operand {
+				b[i] = '+'
+			} else {
+				b[i] = '#'
+			}
+			i++
+		case c == '~' || c == '=' || c == '<' || c == '>':
+			// ~=, ==, <= and >= are a single token.
+			if luaPeek(b, i+1) == '=' {
+				i++
+			}
+			i++
+		default:
+			i++
+		}
+		operand = c == ')' || c == ']' || c == '}'
+		push(string(c))
+	}
+	return string(b)
+}
+
+// luaPeek returns b[i], or 0 after the end of b.
+func luaPeek(b []byte, i int) byte {
+	if i < len(b) {
+		return b[i]
+	}
+	return 0
+}
+
+func isLuaNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// luaQuoted returns the end of the quoted string starting at b[i]. An unterminated string
+// ends at the end of the line, where the parser reports it.
+func luaQuoted(b []byte, i int) int {
+	quote := b[i]
+	for i++; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+	return i
+}
+
+// luaLongBracket returns the end of the long string or comment starting at b[i], e.g.
+// [[...]] or [==[...]==], or -1 if there is none at b[i].
+func luaLongBracket(b []byte, i int) int {
+	if luaPeek(b, i) != '[' {
+		return -1
+	}
+	j := i + 1
+	for j < len(b) && b[j] == '=' {
+		j++
+	}
+	if luaPeek(b, j) != '[' {
+		return -1
+	}
+	closing := "]" + strings.Repeat("=", j-i-1) + "]"
+	if end := bytes.Index(b[j+1:], []byte(closing)); end >= 0 {
+		return j + 1 + end + len(closing)
+	}
+	return len(b)
+}
+
+// luaAttribute returns the end of the <const> or <close> attribute of a local variable
+// starting at b[i], or 0 if there is none.
+func luaAttribute(b []byte, i int) int {
+	j := i + 1
+	for luaPeek(b, j) == ' ' || luaPeek(b, j) == '\t' {
+		j++
+	}
+	start := j
+	for j < len(b) && isLuaNameByte(b[j]) {
+		j++
+	}
+	if name := string(b[start:j]); name != "const" && name != "close" {
+		return 0
+	}
+	for luaPeek(b, j) == ' ' || luaPeek(b, j) == '\t' {
+		j++
+	}
+	if luaPeek(b, j) != '>' {
+		return 0
+	}
+	return j + 1
+}
+
+// ScriptletValidator checks the body of a scriptlet, kind is e.g. ScriptletPostin.
+type ScriptletValidator func(kind, body string) error
+
+// AddScriptletValidator registers a validator for the scriptlets run by interpreter, e.g.
+// "/bin/sh" (the default interpreter) or "<lua>". Arguments of the scriptlet interpreter
+// are ignored for the lookup. The validators run before the rpm is written, and their
+// errors fail Write.
+func (r *RPM) AddScriptletValidator(interpreter string, v ScriptletValidator) {
+	if r.scriptletValidators == nil {
+		r.scriptletValidators = make(map[string][]ScriptletValidator)
+	}
+	r.scriptletValidators[interpreter] = append(r.scriptletValidators[interpreter], v)
+}
+
+// CommandValidator returns a ScriptletValidator which runs a command with the scriptlet
+// body as standard input, e.g. CommandValidator("bash", "-n") to check the syntax of
+// bash scriptlets. The scriptlet is invalid if the command fails.
+func CommandValidator(name string, args ...string) ScriptletValidator {
+	return func(kind, body string) error {
+		cmd := exec.Command(name, args...)
+		cmd.Stdin = strings.NewReader(body)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+}
+
+func luaValidator(kind, body string) error {
+	return ValidateLua(body)
+}
+
+// checkLuaScriptlet validates the body of a scriptlet run by interpreter when it is added,
+// if ValidateLua is set. The scriptlets are validated again when the rpm is written, with
+// the macros defined by then.
+func (r *RPM) checkLuaScriptlet(kind, interpreter, body string) error {
+	if !r.ValidateLua || body == "" {
+		return nil
+	}
+	if fields := strings.Fields(interpreter); len(fields) == 0 || fields[0] != luaInterpreter {
+		return nil
+	}
+	expanded, err := r.expandScriptlet(kind, body, r.macroTable())
+	if err != nil {
+		// The macros may still be defined before Write, which reports the error.
+		return nil
+	}
+	if err := ValidateLua(expanded); err != nil {
+		return fmt.Errorf("%s scriptlet: %w", kind, err)
+	}
+	return nil
+}
+
+// validateScriptlets runs the validators of the scriptlets before they are written.
+func (r *RPM) validateScriptlets() error {
+	if len(r.scriptletValidators) == 0 && !r.ValidateLua {
+		return nil
+	}
+	macros := r.macroTable()
+	kinds := make([]string, 0, len(r.scriptlets))
+	for kind := range r.scriptlets {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		s := r.scriptlets[kind]
+		if s.body == "" {
+			continue
+		}
+		interpreter := defaultInterpreter
+		if fields := strings.Fields(s.interpreter); len(fields) > 0 {
+			interpreter = fields[0]
+		}
+		validators := r.scriptletValidators[interpreter]
+		if r.ValidateLua && interpreter == luaInterpreter {
+			validators = append([]ScriptletValidator{luaValidator}, validators...)
+		}
+		if len(validators) == 0 {
+			continue
+		}
+		body, err := r.expandScriptlet(kind, s.body, macros)
+		if err != nil {
+			return err
+		}
+		for _, v := range validators {
+			if err := v(kind, body); err != nil {
+				return fmt.Errorf("%s scriptlet: %w", kind, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateLua(t *testing.T) {
+	testCases := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "valid", body: `if posix.access("/etc/foo") then print("ok") end`},
+		{name: "invalid", body: `if posix.access("/etc/foo") print("ok") end`, wantErr: true},
+		{name: "integer division", body: `local n = 7 // 2`},
+		{name: "bitwise operators", body: `local m = (mode & 0x1ff) | 0x100 ~ 1 << 2 >> 1`},
+		{name: "bitwise not", body: `local m = ~mode & -~1`},
+		{name: "not equal", body: `if a ~= b then print(a) end`},
+		{name: "goto", body: "for i = 1, 3 do\n  if i == 2 then goto continue end\n  print(i)\n  ::continue::\nend"},
+		{name: "local attributes", body: `local x <const>, f < close > = 1, io.open("/etc/foo")`},
+		{name: "comparison", body: `local ok = a < b and c > d`},
+		{name: "operators in strings", body: `print("a // b & c", 'x ~ y', [==[ 1 | 2 ]==]) -- 3 & 4`},
+		{name: "operator in long comment", body: "--[[ a & b\n]] print(1)"},
+		{name: "broken bitwise", body: `local m = mode & `, wantErr: true},
+		{name: "attribute outside local", body: `print(x <const> = 1)`, wantErr: true},
+		{name: "unterminated string", body: `print("a & b)`, wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLua(tc.body)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("ValidateLua(%q) returned error %v, want error: %v", tc.body, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLua51(t *testing.T) {
+	body := `local x <const> = a // b & ~c -- d | e`
+	want := `local x         = a +  b + #c -- d | e`
+	if got := lua51(body); got != want {
+		t.Errorf("lua51(%q) = %q, want %q", body, got, want)
+	}
+}
+
+func TestValidateLuaScriptlets(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		validate bool
+		wantErr  bool
+	}{
+		{name: "valid", body: `if posix.access("/etc/foo") then print("ok") end`, validate: true},
+		{name: "invalid", body: `if posix.access("/etc/foo") print("ok") end`, validate: true, wantErr: true},
+		{name: "lua 5.3", body: `print(7 // 2, 6 & 3)`, validate: true},
+		{name: "not validated", body: `if then`},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "lua", Version: "1.0", ValidateLua: tc.validate})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddPosttrans(tc.body)
+			// The lua is checked when the interpreter is set.
+			err = r.SetScriptletInterpreter(ScriptletPosttrans, "<lua>")
+			if tc.wantErr != (err != nil) {
+				t.Errorf("SetScriptletInterpreter returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err := r.SetScriptletInterpreter(ScriptletPostin, "<lua>"); err != nil {
+				t.Fatalf("SetScriptletInterpreter returned error %v", err)
+			}
+			// And when the body is set.
+			err = r.AddScriptlet(ScriptletPostin, tc.body)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("AddScriptlet returned error %v, want error: %v", err, tc.wantErr)
+			}
+			err = r.AddScriptletFromReader(ScriptletPostin, strings.NewReader(tc.body))
+			if tc.wantErr != (err != nil) {
+				t.Errorf("AddScriptletFromReader returned error %v, want error: %v", err, tc.wantErr)
+			}
+			// Shell scriptlets are not checked.
+			r.AddPrein("if then")
+			// The scriptlets set without a check are checked by Write.
+			if err := r.SetScriptletInterpreter(ScriptletPreun, "<lua>"); err != nil {
+				t.Fatalf("SetScriptletInterpreter returned error %v", err)
+			}
+			r.AddPreun(tc.body)
+			err = r.Write(io.Discard)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("Write returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestScriptletValidators(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "validators"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	var checked []string
+	r.AddScriptletValidator("/bin/sh", func(kind, body string) error {
+		checked = append(checked, kind)
+		if strings.Contains(body, "broken") {
+			return errors.New("broken script")
+		}
+		return nil
+	})
+	r.AddPrein("echo prein")
+	r.AddPostin("echo post")
+	r.AddPreun("print('not shell')")
+	if err := r.SetScriptletInterpreter(ScriptletPreun, "/usr/bin/python3 -s"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	if err := r.validateScriptlets(); err != nil {
+		t.Errorf("validateScriptlets returned error %v", err)
+	}
+	if d := cmp.Diff([]string{ScriptletPostin, ScriptletPrein}, checked); d != "" {
+		t.Errorf("validated scriptlets differ (want->got):\n%v", d)
+	}
+	r.AddPostin("broken")
+	if err := r.Write(io.Discard); err == nil {
+		t.Errorf("Write with a broken scriptlet should have returned an error")
+	}
+}
+
+func TestCommandValidator(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	v := CommandValidator("sh", "-n")
+	if err := v(ScriptletPostin, "if true; then echo ok; fi\n"); err != nil {
+		t.Errorf("CommandValidator returned error %v for a valid script", err)
+	}
+	if err := v(ScriptletPostin, "if true; then echo ok\n"); err == nil {
+		t.Errorf("CommandValidator should have returned an error for an invalid script")
+	}
+}
@@ -1,6 +1,7 @@
 package rpmpack
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -13,14 +14,29 @@ type rpmSense uint32
 // SenseLess (2) specifies less then the specified version
 // SenseGreater (4) specifies greater then the specified version
 // SenseEqual (8) specifies equal to the specified version
+// The SenseScript* flags mark requires which are needed by a scriptlet, see AddScriptRequires.
 const (
 	SenseAny  rpmSense = 0
 	SenseLess          = 1 << iota
 	SenseGreater
 	SenseEqual
-	SenseRPMLIB rpmSense = 1 << 24
+	SenseScriptPosttrans rpmSense = 1 << 5
+	SensePreReq          rpmSense = 1 << 6
+	SenseScriptPretrans  rpmSense = 1 << 7
+	SenseScriptPre       rpmSense = 1 << 9
+	SenseScriptPost      rpmSense = 1 << 10
+	SenseScriptPreUn     rpmSense = 1 << 11
+	SenseScriptPostUn    rpmSense = 1 << 12
+	SenseScriptVerify    rpmSense = 1 << 13
+	SenseRPMLIB          rpmSense = 1 << 24
+	senseStrong          rpmSense = 1 << 27
+
+	senseCompareMask = SenseLess | SenseGreater | SenseEqual
 )
 
+// ErrInvalidRelation is returned when a relation string cannot be parsed.
+var ErrInvalidRelation = errors.New("invalid relation")
+
 var relationMatch = regexp.MustCompile(`([^=<>\s]*)\s*((?:=|>|<)*)\s*(.*)?`)
 
 // Relation is the structure of rpm sense relationships
@@ -28,6 +44,10 @@ type Relation struct {
 	Name    string
 	Version string
 	Sense   rpmSense
+	// EVR is Version split into epoch, version and release by NewRelation, for relations
+	// with a comparison. It is not written to the header, and empty for relations which
+	// were not created by NewRelation.
+	EVR EVR
 }
 
 // String return the string representation of the Relation
@@ -35,6 +55,21 @@ func (r *Relation) String() string {
 	return fmt.Sprintf("%s%v%s", r.Name, r.Sense, r.Version)
 }
 
+// MarshalText implements encoding.TextMarshaler, the format is the one parsed by NewRelation.
+func (r *Relation) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using NewRelation.
+func (r *Relation) UnmarshalText(text []byte) error {
+	rel, err := NewRelation(string(text))
+	if err != nil {
+		return err
+	}
+	*r = *rel
+	return nil
+}
+
 // Equal compare the equality of two relations
 func (r *Relation) Equal(o *Relation) bool {
 	return r.Name == o.Name && r.Version == o.Version && r.Sense == o.Sense
@@ -74,6 +109,17 @@ func (r *Relations) addIfMissing(value *Relation) {
 	*r = append(*r, value)
 }
 
+// strongRelations returns copies of the relations with the legacy strong flag.
+func strongRelations(rels Relations) Relations {
+	strong := make(Relations, len(rels))
+	for i, rel := range rels {
+		c := *rel
+		c.Sense |= senseStrong
+		strong[i] = &c
+	}
+	return strong
+}
+
 // AddToIndex add the relations to the specified category on the index
 func (r *Relations) AddToIndex(h *index, nameTag, versionTag, flagsTag int) error {
 	var (
@@ -105,6 +151,7 @@ func NewRelation(related string) (*Relation, error) {
 	var (
 		err   error
 		sense rpmSense
+		evr   EVR
 		name,
 		version string
 	)
@@ -121,12 +168,22 @@ func NewRelation(related string) (*Relation, error) {
 		}
 		name = parts[1]
 		version = parts[3]
+		// A version without a comparison, e.g. "python 3.7", is kept as it is.
+		if sense != SenseAny {
+			version = strings.TrimSpace(version)
+		}
+		if sense != SenseAny && version != "" {
+			if evr, err = ParseEVR(version); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return &Relation{
 		Name:    name,
 		Version: version,
 		Sense:   sense,
+		EVR:     evr,
 	}, nil
 }
 
@@ -146,6 +203,8 @@ func (r rpmSense) String() string {
 		ret string
 	)
 
+	// Only the comparison is part of the string, not the scriptlet and rpmlib flags.
+	r &= senseCompareMask
 	for ret, val = range stringToSense {
 		if r == val {
 			return ret
@@ -161,7 +220,7 @@ func parseSense(sense string) (rpmSense, error) {
 		ok  bool
 	)
 	if ret, ok = stringToSense[sense]; !ok {
-		return SenseAny, fmt.Errorf("unknown sense value: %s", sense)
+		return SenseAny, fmt.Errorf("%w: unknown sense value: %s", ErrInvalidRelation, sense)
 	}
 
 	return ret, nil
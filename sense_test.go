@@ -1,6 +1,7 @@
 package rpmpack
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -25,6 +26,27 @@ func TestNewRelation(t *testing.T) {
 			input:  "python >=3.5",
 			output: "python>=3.5",
 		},
+		{
+			input:  "python >= 2:3.7-1",
+			output: "python>=2:3.7-1",
+		},
+		{
+			input:  "python = 0:3.7",
+			output: "python=0:3.7",
+		},
+		{
+			input:       "python >= a:3.7",
+			errExpected: true,
+		},
+		{
+			// A version without a comparison is kept, as rpmpack always did.
+			input:  "python 3.7",
+			output: "python3.7",
+		},
+		{
+			input:       "python >= 3.7 4",
+			errExpected: true,
+		},
 		{
 			input:       "python >< 3.5",
 			output:      "",
@@ -64,6 +86,9 @@ func TestNewRelation(t *testing.T) {
 				tt.Errorf("%s should not have returned an error: %v", testCase.input, err)
 				return
 			case testCase.errExpected && err != nil:
+				if !errors.Is(err, ErrInvalidRelation) && !errors.Is(err, ErrInvalidVersion) {
+					tt.Errorf("%s returned error %v, want %v or %v", testCase.input, err, ErrInvalidRelation, ErrInvalidVersion)
+				}
 				return
 			}
 
@@ -79,3 +104,23 @@ func TestNewRelation(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRelationEVR(t *testing.T) {
+	for input, want := range map[string]EVR{
+		"python":              {},
+		"python 3.7":          {},
+		"python >= 3.7":       {Version: "3.7"},
+		"python >= 2:3.7-1":   {Epoch: 2, Version: "3.7", Release: "1"},
+		"python = 0:3.7":      {Version: "3.7"},
+		"(python or python3)": {},
+	} {
+		r, err := NewRelation(input)
+		if err != nil {
+			t.Errorf("NewRelation(%q) returned error %v", input, err)
+			continue
+		}
+		if r.EVR != want {
+			t.Errorf("NewRelation(%q).EVR = %+v, want %+v", input, r.EVR, want)
+		}
+	}
+}
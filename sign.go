@@ -0,0 +1,225 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// GPGSigner signs rpms with an external gpg command, like rpmsign does. The private key
+// stays in the gpg keyring (or the gpg-agent), and is never read by rpmpack.
+// Use it with r.SetPGPReaderSigner(GPGSigner{KeyID: "..."}.SignReader).
+type GPGSigner struct {
+	// Path is the gpg command, "gpg" if empty. Use "gpg2" on systems where gpg is gpg 1.
+	Path string
+	// KeyID selects the signing key (gpg --local-user), e.g. a key id, fingerprint or
+	// email address. If empty, gpg uses its default key.
+	KeyID string
+	// HomeDir is the gpg home directory (gpg --homedir). If empty, gpg uses $GNUPGHOME
+	// or ~/.gnupg.
+	HomeDir string
+	// Args are additional gpg arguments, e.g. "--pinentry-mode", "loopback".
+	Args []string
+}
+
+// Sign returns a binary detached OpenPGP signature of data.
+func (g GPGSigner) Sign(data []byte) ([]byte, error) {
+	return g.SignReader(bytes.NewReader(data))
+}
+
+// SignReader returns a binary detached OpenPGP signature of the data read from r.
+func (g GPGSigner) SignReader(r io.Reader) ([]byte, error) {
+	path := g.Path
+	if path == "" {
+		path = "gpg"
+	}
+	args := []string{"--batch", "--no-verbose", "--no-armor", "--no-secmem-warning", "--digest-algo", "sha256"}
+	if g.HomeDir != "" {
+		args = append(args, "--homedir", g.HomeDir)
+	}
+	if g.KeyID != "" {
+		args = append(args, "--local-user", g.KeyID)
+	}
+	args = append(args, g.Args...)
+	args = append(args, "--detach-sign", "--output", "-")
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = r
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to sign with %s: %w: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// KeySigner signs rpms in process with an OpenPGP private key. RSA, DSA, ECDSA (NIST
+// curves) and EdDSA (ed25519) keys are supported, and the signatures are v4 signatures
+// with a sha256 digest, which rpmkeys accepts.
+// Use it with r.SetPGPReaderSigner(k.SignReader).
+type KeySigner struct {
+	entity *openpgp.Entity
+	// keyID selects the signing (sub)key, 0 selects the newest signing key of the entity.
+	keyID uint64
+}
+
+// NewKeySigner reads an armored or binary OpenPGP private key, e.g. the output of
+// gpg --export-secret-keys. A protected key is decrypted with passphrase. If the key
+// has a signing subkey, the signatures are made with the subkey, like gpg does.
+func NewKeySigner(key, passphrase []byte) (*KeySigner, error) {
+	return NewKeySignerByID(key, passphrase, "")
+}
+
+// NewKeySignerByID is like NewKeySigner, but selects the signing key in a keyring with
+// several keys, like rpmsign --key-id and gpg --local-user. id is a fingerprint or a
+// long or short key id, in hex with an optional "0x" prefix. If it is the id of a primary
+// key, its newest signing subkey is used, unless id ends with "!". If it is the id of a
+// subkey, that subkey is used. An empty id requires a single key in the keyring.
+func NewKeySignerByID(key, passphrase []byte, id string) (*KeySigner, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	k := &KeySigner{}
+	if id == "" {
+		if len(entities) != 1 {
+			return nil, fmt.Errorf("expected a single private key, got %d keys", len(entities))
+		}
+		k.entity = entities[0]
+	} else if k.entity, k.keyID, err = selectKey(entities, id); err != nil {
+		return nil, err
+	}
+	if k.entity.PrivateKey == nil {
+		return nil, errors.New("the key is a public key, a private key is required")
+	}
+	if err := k.entity.DecryptPrivateKeys(passphrase); err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	signingKey, ok := k.entity.SigningKeyById(time.Now(), k.keyID)
+	if !ok {
+		return nil, fmt.Errorf("key %s has no valid signing key", id)
+	}
+	if signingKey.PrivateKey == nil || signingKey.PrivateKey.Dummy() {
+		return nil, fmt.Errorf("the secret part of signing key %X is not available", signingKey.PublicKey.Fingerprint)
+	}
+	return k, nil
+}
+
+// selectKey returns the entity with the key of the given id, and the id of the signing
+// key to use, see NewKeySignerByID.
+func selectKey(entities openpgp.EntityList, id string) (*openpgp.Entity, uint64, error) {
+	hexID := strings.TrimPrefix(strings.TrimPrefix(id, "0x"), "0X")
+	exact := strings.HasSuffix(hexID, "!")
+	hexID = strings.TrimSuffix(hexID, "!")
+	b, err := hex.DecodeString(hexID)
+	if err != nil || (len(b) != 4 && len(b) != 8 && len(b) != 20) {
+		return nil, 0, fmt.Errorf("invalid key id %q, want a fingerprint or a key id in hex", id)
+	}
+	matches := func(pk *packet.PublicKey) bool {
+		switch len(b) {
+		case 20:
+			return bytes.Equal(pk.Fingerprint, b)
+		case 8:
+			return bytes.Equal(pk.Fingerprint[len(pk.Fingerprint)-8:], b)
+		default:
+			return bytes.Equal(pk.Fingerprint[len(pk.Fingerprint)-4:], b)
+		}
+	}
+	var (
+		entity *openpgp.Entity
+		keyID  uint64
+		found  int
+	)
+	for _, e := range entities {
+		if matches(e.PrimaryKey) {
+			entity, keyID, found = e, 0, found+1
+			if exact {
+				keyID = e.PrimaryKey.KeyId
+			}
+		}
+		for _, sub := range e.Subkeys {
+			if matches(sub.PublicKey) {
+				entity, keyID, found = e, sub.PublicKey.KeyId, found+1
+			}
+		}
+	}
+	switch found {
+	case 0:
+		return nil, 0, fmt.Errorf("no key with id %s", id)
+	case 1:
+		return entity, keyID, nil
+	default:
+		return nil, 0, fmt.Errorf("key id %s is ambiguous, it matches %d keys", id, found)
+	}
+}
+
+// Fingerprint returns the hex fingerprint of the (sub)key which makes the signatures.
+func (k *KeySigner) Fingerprint() string {
+	signingKey, ok := k.entity.SigningKeyById(time.Now(), k.keyID)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%X", signingKey.PublicKey.Fingerprint)
+}
+
+// Sign returns a binary detached OpenPGP signature of data. The signature has the
+// fingerprint and the key id of the signing key as issuer.
+func (k *KeySigner) Sign(data []byte) ([]byte, error) {
+	return k.SignReader(bytes.NewReader(data))
+}
+
+// SignReader returns a binary detached OpenPGP signature of the data read from r, see Sign.
+func (k *KeySigner) SignReader(r io.Reader) ([]byte, error) {
+	var sig bytes.Buffer
+	config := &packet.Config{DefaultHash: crypto.SHA256, SigningKeyId: k.keyID}
+	if err := openpgp.DetachSign(&sig, k.entity, r, config); err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return sig.Bytes(), nil
+}
+
+// signatureTags returns the signature tags of a header-only and a header+payload
+// signature, which depend on the public key algorithm like in rpmsign: RSA signatures
+// use RSAHEADER and PGP, the other algorithms (DSA, ECDSA and EdDSA) use DSAHEADER and
+// GPG. Signatures which cannot be parsed are assumed to be RSA signatures.
+func signatureTags(sig []byte) (headerTag, bodyTag int) {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return sigRSA, sigPGP
+	}
+	s, ok := p.(*packet.Signature)
+	if !ok {
+		return sigRSA, sigPGP
+	}
+	switch s.PubKeyAlgo {
+	case packet.PubKeyAlgoDSA, packet.PubKeyAlgoECDSA, packet.PubKeyAlgoEdDSA:
+		return sigDSA, sigGPG
+	default:
+		return sigRSA, sigPGP
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// testGPGHome creates a gpg home directory with an unprotected signing key of the
+// given algorithm (e.g. "rsa2048"), skipping the test if gpg is not available.
+func testGPGHome(t *testing.T, algo string) string {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not available")
+	}
+	// gpg-agent sockets must fit in a unix socket path, t.TempDir() may be too long.
+	home, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		t.Fatalf("MkdirTemp returned error %v", err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		os.RemoveAll(home)
+	})
+	out, err := exec.Command("gpg", "--homedir", home, "--batch", "--passphrase", "",
+		"--quick-gen-key", "rpmpack test <test@example.com>", algo, "sign", "never").CombinedOutput()
+	if err != nil {
+		t.Fatalf("gpg --quick-gen-key failed: %v: %s", err, out)
+	}
+	return home
+}
+
+func TestGPGSigner(t *testing.T) {
+	home := testGPGHome(t, "rsa2048")
+	data := []byte("header and payload")
+	sig, err := GPGSigner{KeyID: "test@example.com", HomeDir: home}.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign returned error %v", err)
+	}
+	dir := t.TempDir()
+	sigFile, dataFile := filepath.Join(dir, "sig"), filepath.Join(dir, "data")
+	if err := os.WriteFile(sigFile, sig, 0o644); err != nil {
+		t.Fatalf("WriteFile returned error %v", err)
+	}
+	if err := os.WriteFile(dataFile, data, 0o644); err != nil {
+		t.Fatalf("WriteFile returned error %v", err)
+	}
+	if out, err := exec.Command("gpg", "--homedir", home, "--verify", sigFile, dataFile).CombinedOutput(); err != nil {
+		t.Errorf("gpg --verify failed: %v: %s", err, out)
+	}
+
+	if _, err := (GPGSigner{KeyID: "nobody@example.com", HomeDir: home}).Sign(data); err == nil {
+		t.Errorf("Sign with an unknown key should have returned an error")
+	}
+}
+
+func TestKeySigner(t *testing.T) {
+	data := []byte("header and payload")
+	for _, tc := range []struct {
+		name   string
+		config *packet.Config
+	}{
+		{name: "rsa", config: &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}},
+		{name: "ecdsa", config: &packet.Config{Algorithm: packet.PubKeyAlgoECDSA, Curve: packet.CurveNistP256}},
+		{name: "eddsa", config: &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entity, err := openpgp.NewEntity("rpmpack test", "", "test@example.com", tc.config)
+			if err != nil {
+				t.Fatalf("NewEntity returned error %v", err)
+			}
+			if err := entity.EncryptPrivateKeys([]byte("secret"), nil); err != nil {
+				t.Fatalf("EncryptPrivateKeys returned error %v", err)
+			}
+			var key bytes.Buffer
+			w, err := armor.Encode(&key, openpgp.PrivateKeyType, nil)
+			if err != nil {
+				t.Fatalf("armor.Encode returned error %v", err)
+			}
+			if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+				t.Fatalf("SerializePrivate returned error %v", err)
+			}
+			w.Close()
+
+			if _, err := NewKeySigner(key.Bytes(), []byte("wrong")); err == nil {
+				t.Errorf("NewKeySigner with a wrong passphrase should have returned an error")
+			}
+			k, err := NewKeySigner(key.Bytes(), []byte("secret"))
+			if err != nil {
+				t.Fatalf("NewKeySigner returned error %v", err)
+			}
+			sig, err := k.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign returned error %v", err)
+			}
+			p, err := packet.Read(bytes.NewReader(sig))
+			if err != nil {
+				t.Fatalf("packet.Read returned error %v", err)
+			}
+			s, ok := p.(*packet.Signature)
+			if !ok {
+				t.Fatalf("signature packet is a %T", p)
+			}
+			if s.Version != 4 || s.PubKeyAlgo != tc.config.Algorithm || s.Hash != crypto.SHA256 {
+				t.Errorf("got a v%d signature with algorithm %d and hash %v, want v4 with %d and SHA256", s.Version, s.PubKeyAlgo, s.Hash, tc.config.Algorithm)
+			}
+			if _, err := openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(data), bytes.NewReader(sig), nil); err != nil {
+				t.Errorf("CheckDetachedSignature returned error %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySignerGPGKey(t *testing.T) {
+	home := testGPGHome(t, "ed25519")
+	key, err := exec.Command("gpg", "--homedir", home, "--batch", "--pinentry-mode", "loopback", "--passphrase", "",
+		"--export-secret-keys", "test@example.com").Output()
+	if err != nil {
+		t.Fatalf("gpg --export-secret-keys failed: %v", err)
+	}
+	k, err := NewKeySigner(key, nil)
+	if err != nil {
+		t.Fatalf("NewKeySigner returned error %v", err)
+	}
+	data := []byte("header and payload")
+	sig, err := k.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign returned error %v", err)
+	}
+	dir := t.TempDir()
+	sigFile, dataFile := filepath.Join(dir, "sig"), filepath.Join(dir, "data")
+	if err := os.WriteFile(sigFile, sig, 0o644); err != nil {
+		t.Fatalf("WriteFile returned error %v", err)
+	}
+	if err := os.WriteFile(dataFile, data, 0o644); err != nil {
+		t.Fatalf("WriteFile returned error %v", err)
+	}
+	if out, err := exec.Command("gpg", "--homedir", home, "--verify", sigFile, dataFile).CombinedOutput(); err != nil {
+		t.Errorf("gpg --verify failed: %v: %s", err, out)
+	}
+}
+
+func TestSignatureTags(t *testing.T) {
+	for _, tc := range []struct {
+		name                          string
+		config                        *packet.Config
+		wantHeader, wantHeaderPayload int
+	}{
+		{name: "rsa", config: &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}, wantHeader: sigRSA, wantHeaderPayload: sigPGP},
+		{name: "ecdsa", config: &packet.Config{Algorithm: packet.PubKeyAlgoECDSA, Curve: packet.CurveNistP256}, wantHeader: sigDSA, wantHeaderPayload: sigGPG},
+		{name: "eddsa", config: &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}, wantHeader: sigDSA, wantHeaderPayload: sigGPG},
+		{name: "not a signature", wantHeader: sigRSA, wantHeaderPayload: sigPGP},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+			if tc.config == nil {
+				r.SetPGPSigner(func([]byte) ([]byte, error) { return []byte("this is not a signature"), nil })
+			} else {
+				entity, err := openpgp.NewEntity("rpmpack test", "", "test@example.com", tc.config)
+				if err != nil {
+					t.Fatalf("NewEntity returned error %v", err)
+				}
+				r.SetPGPSigner((&KeySigner{entity: entity}).Sign)
+			}
+			s := newIndex(signatures)
+			if err := r.writeSignatures(s, []byte("header")); err != nil {
+				t.Fatalf("writeSignatures returned error %v", err)
+			}
+			for _, tag := range []int{sigRSA, sigDSA, sigPGP, sigGPG} {
+				_, got := s.entries[tag]
+				want := tag == tc.wantHeader || tag == tc.wantHeaderPayload
+				if got != want {
+					t.Errorf("signature tag %d present: %v, want %v", tag, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewKeySignerByID(t *testing.T) {
+	a, err := openpgp.NewEntity("a", "", "a@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("NewEntity returned error %v", err)
+	}
+	if err := a.AddSigningSubkey(&packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}); err != nil {
+		t.Fatalf("AddSigningSubkey returned error %v", err)
+	}
+	b, err := openpgp.NewEntity("b", "", "b@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("NewEntity returned error %v", err)
+	}
+	var keyring bytes.Buffer
+	for _, e := range []*openpgp.Entity{a, b} {
+		if err := e.SerializePrivateWithoutSigning(&keyring, nil); err != nil {
+			t.Fatalf("SerializePrivate returned error %v", err)
+		}
+	}
+	aSub := a.Subkeys[len(a.Subkeys)-1].PublicKey
+
+	for _, tc := range []struct {
+		name    string
+		id      string
+		want    *packet.PublicKey
+		wantErr bool
+	}{
+		{name: "primary fingerprint uses the signing subkey", id: fmt.Sprintf("%X", a.PrimaryKey.Fingerprint), want: aSub},
+		{name: "exact primary key", id: fmt.Sprintf("%X!", a.PrimaryKey.Fingerprint), want: a.PrimaryKey},
+		{name: "subkey long id", id: fmt.Sprintf("0x%016X", aSub.KeyId), want: aSub},
+		{name: "short id", id: fmt.Sprintf("%08x", uint32(b.PrimaryKey.KeyId)), want: b.PrimaryKey},
+		{name: "no id with several keys", wantErr: true},
+		{name: "unknown id", id: "0123456789ABCDEF", wantErr: true},
+		{name: "invalid id", id: "b@example.com", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			k, err := NewKeySignerByID(keyring.Bytes(), nil, tc.id)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("NewKeySignerByID should have returned an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewKeySignerByID returned error %v", err)
+			}
+			if got, want := k.Fingerprint(), fmt.Sprintf("%X", tc.want.Fingerprint); got != want {
+				t.Errorf("Fingerprint returned %s, want %s", got, want)
+			}
+			sig, err := k.Sign([]byte("header"))
+			if err != nil {
+				t.Fatalf("Sign returned error %v", err)
+			}
+			p, err := packet.Read(bytes.NewReader(sig))
+			if err != nil {
+				t.Fatalf("packet.Read returned error %v", err)
+			}
+			s := p.(*packet.Signature)
+			if s.IssuerKeyId == nil || *s.IssuerKeyId != tc.want.KeyId || !bytes.Equal(s.IssuerFingerprint, tc.want.Fingerprint) {
+				t.Errorf("signature issuer is %X, want %X", s.IssuerFingerprint, tc.want.Fingerprint)
+			}
+			h := crypto.SHA256.New()
+			h.Write([]byte("header"))
+			if err := tc.want.VerifySignature(h, s); err != nil {
+				t.Errorf("VerifySignature returned error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrDuplicateFile is returned when a file is added twice to a source rpm. For other rpms,
+// AddFile replaces the earlier file and reports it in Warnings.
+var ErrDuplicateFile = errors.New("duplicate file")
+
+// SourceRPM holds the state of a source rpm (.src.rpm). Please use NewSourceRPM to instantiate it.
+//
+// A source rpm contains a spec file, source tarballs and patches, all stored
+// without a directory. The Requires of the metadata are written as the
+// BuildRequires of the package.
+type SourceRPM struct {
+	rpm *RPM
+}
+
+// NewSourceRPM creates and returns a new SourceRPM struct.
+func NewSourceRPM(m RPMMetaData) (*SourceRPM, error) {
+	r, err := NewRPM(m)
+	if err != nil {
+		return nil, err
+	}
+	r.sourcePackage = true
+	// Source rpms do not provide anything, not even themselves.
+	r.Provides = nil
+	return &SourceRPM{rpm: r}, nil
+}
+
+// BuildRequires returns the build requirements of the source rpm. New relations can be added with Set.
+func (s *SourceRPM) BuildRequires() *Relations {
+	return &s.rpm.Requires
+}
+
+// SetSpec sets the spec file of the source rpm.
+func (s *SourceRPM) SetSpec(name string, body []byte) error {
+	return s.add(name, body, SpecFile)
+}
+
+// AddSource adds a source file (usually a tarball). Sources are listed in the order they were added.
+func (s *SourceRPM) AddSource(name string, body []byte) error {
+	if err := s.add(name, body, GenericFile); err != nil {
+		return err
+	}
+	s.rpm.sources = append(s.rpm.sources, name)
+	return nil
+}
+
+// AddPatch adds a patch file. Patches are listed in the order they were added.
+func (s *SourceRPM) AddPatch(name string, body []byte) error {
+	if err := s.add(name, body, GenericFile); err != nil {
+		return err
+	}
+	s.rpm.patches = append(s.rpm.patches, name)
+	return nil
+}
+
+func (s *SourceRPM) add(name string, body []byte, t FileType) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("%w: source rpm file name %q must be a plain file name", ErrInvalidPath, name)
+	}
+	if _, ok := s.rpm.files[name]; ok {
+		return fmt.Errorf("%w: %q was already added to the source rpm", ErrDuplicateFile, name)
+	}
+	s.rpm.AddFile(RPMFile{
+		Name:  name,
+		Body:  body,
+		Mode:  0100644,
+		Owner: "root",
+		Group: "root",
+		Type:  t,
+	})
+	return nil
+}
+
+// Write closes the source rpm and writes it to an io.Writer
+func (s *SourceRPM) Write(w io.Writer) error {
+	hasSpec := false
+	for _, f := range s.rpm.files {
+		if f.Type&SpecFile != 0 {
+			hasSpec = true
+			break
+		}
+	}
+	if !hasSpec {
+		return fmt.Errorf("source rpm %q has no spec file", s.rpm.Name)
+	}
+	return s.rpm.Write(w)
+}
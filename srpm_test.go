@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSourceRPM(t *testing.T) {
+	s, err := NewSourceRPM(RPMMetaData{
+		Name:    "hello",
+		Version: "1.0",
+		Release: "1",
+	})
+	if err != nil {
+		t.Fatalf("NewSourceRPM returned error %v", err)
+	}
+	if err := s.BuildRequires().Set("gcc >= 8"); err != nil {
+		t.Fatalf("BuildRequires().Set returned error %v", err)
+	}
+	if err := s.SetSpec("hello.spec", []byte("Name: hello\n")); err != nil {
+		t.Errorf("SetSpec returned error %v", err)
+	}
+	if err := s.AddSource("hello-1.0.tar.gz", []byte("tarball")); err != nil {
+		t.Errorf("AddSource returned error %v", err)
+	}
+	if err := s.AddPatch("fix.patch", []byte("patch")); err != nil {
+		t.Errorf("AddPatch returned error %v", err)
+	}
+	if err := s.AddPatch("dir/fix.patch", []byte("patch")); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("AddPatch with a directory returned error %v, want %v", err, ErrInvalidPath)
+	}
+	if err := s.AddSource("hello-1.0.tar.gz", []byte("tarball")); !errors.Is(err, ErrDuplicateFile) {
+		t.Errorf("AddSource of a duplicate returned error %v, want %v", err, ErrDuplicateFile)
+	}
+
+	var b bytes.Buffer
+	if err := s.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if got := b.Bytes()[7]; got != 1 {
+		t.Errorf("lead type = %d, want 1 (source)", got)
+	}
+	r := s.rpm
+	if d := cmp.Diff([]string{"fix.patch", "hello-1.0.tar.gz", "hello.spec"}, r.basenames); d != "" {
+		t.Errorf("basenames differ (want->got):\n%v", d)
+	}
+	if d := cmp.Diff([]string{""}, r.di.AllDirs()); d != "" {
+		t.Errorf("dirnames differ (want->got):\n%v", d)
+	}
+	if d := cmp.Diff([]uint32{0, 0, uint32(SpecFile)}, r.fileflags); d != "" {
+		t.Errorf("fileflags differ (want->got):\n%v", d)
+	}
+	if len(r.Provides) != 0 {
+		t.Errorf("source rpm should not provide anything, got %v", r.Provides.String())
+	}
+
+	// The payload names are the plain file names, like the header names.
+	if err := VerifyDigests(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("VerifyDigests returned error %v", err)
+	}
+	pkg, err := ReadPackage(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	files, err := pkg.Files()
+	if err != nil {
+		t.Fatalf("Files returned error %v", err)
+	}
+	bodies := make(map[string]string)
+	for _, f := range files {
+		bodies[f.Name] = string(f.Body)
+	}
+	want := map[string]string{"fix.patch": "patch", "hello-1.0.tar.gz": "tarball", "hello.spec": "Name: hello\n"}
+	if d := cmp.Diff(want, bodies); d != "" {
+		t.Errorf("files differ (want->got):\n%v", d)
+	}
+}
+
+func TestSourceRPMWithoutSpec(t *testing.T) {
+	s, err := NewSourceRPM(RPMMetaData{Name: "hello", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewSourceRPM returned error %v", err)
+	}
+	if err := s.Write(io.Discard); err == nil {
+		t.Errorf("Write without a spec file should have returned an error")
+	}
+}
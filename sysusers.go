@@ -0,0 +1,194 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const sysusersDir = "/usr/lib/sysusers.d"
+
+// AddSysusers adds a sysusers.d(5) configuration as /usr/lib/sysusers.d/<name>.conf, e.g.
+//
+//	g hello -
+//	u hello - "Hello daemon" /var/lib/hello /usr/sbin/nologin
+//	m hello wheel
+//
+// Like rpmbuild with the Fedora packaging guidelines, the rpm provides "user(foo)" and
+// "group(foo)" for the declared users and groups, and a %pre scriptlet creates them with
+// useradd and groupadd for systems where systemd-sysusers does not run on install
+// (%sysusers_create_compat). The scriptlet is prepended to an existing prein scriptlet,
+// which must be run by a shell. The whole configuration is checked before the rpm is
+// changed, so r is unchanged if AddSysusers returns an error.
+func (r *RPM) AddSysusers(name string, config []byte) error {
+	if err := r.checkShellScriptlets(ScriptletPrein); err != nil {
+		return err
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid sysusers name %q", name)
+	}
+	var (
+		script   strings.Builder
+		provides Relations
+		usermod  bool
+	)
+	s := bufio.NewScanner(bytes.NewReader(config))
+	for line := 1; s.Scan(); line++ {
+		fields, err := splitSysusersLine(s.Text())
+		if err != nil {
+			return fmt.Errorf("sysusers %s line %d: %w", name, line, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("sysusers %s line %d: missing name", name, line)
+		}
+		for len(fields) < 6 {
+			fields = append(fields, "-")
+		}
+		typ, user, id, gecos, home, shell := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+		switch typ {
+		case "g":
+			provides.addIfMissing(&Relation{Name: fmt.Sprintf("group(%s)", user)})
+			fmt.Fprintf(&script, "getent group %s >/dev/null || groupadd -r%s %s || :\n",
+				shellQuote(user), sysusersIDArg("-g", id), shellQuote(user))
+		case "u":
+			uid, group := id, user
+			if i := strings.IndexByte(id, ':'); i >= 0 {
+				uid, group = id[:i], id[i+1:]
+			}
+			if strings.HasPrefix(uid, "/") {
+				// The uid is taken from the owner of a path, which is not known at build time.
+				uid = "-"
+			}
+			provides.addIfMissing(&Relation{Name: fmt.Sprintf("user(%s)", user)})
+			if group == user {
+				provides.addIfMissing(&Relation{Name: fmt.Sprintf("group(%s)", user)})
+				gid := "-"
+				if uid != "-" {
+					gid = uid
+				}
+				fmt.Fprintf(&script, "getent group %s >/dev/null || groupadd -f%s -r %s || :\n",
+					shellQuote(user), sysusersIDArg("-g", gid), shellQuote(user))
+			}
+			args := sysusersIDArg("-u", uid) + " -g " + shellQuote(group)
+			if home == "-" {
+				home = "/"
+			}
+			if shell == "-" {
+				shell = "/usr/sbin/nologin"
+			}
+			args += " -d " + shellQuote(home) + " -s " + shellQuote(shell)
+			if gecos != "-" {
+				args += " -c " + shellQuote(gecos)
+			}
+			fmt.Fprintf(&script, "if ! getent passwd %s >/dev/null; then\n    useradd -r%s %s || :\nfi\n",
+				shellQuote(user), args, shellQuote(user))
+		case "m":
+			usermod = true
+			provides.addIfMissing(&Relation{Name: fmt.Sprintf("groupmember(%s/%s)", user, id)})
+			fmt.Fprintf(&script, "if getent group %s >/dev/null; then\n    usermod -a -G %s %s || :\nfi\n",
+				shellQuote(id), shellQuote(id), shellQuote(user))
+		case "r":
+			// id ranges only matter to systemd-sysusers.
+		default:
+			return fmt.Errorf("sysusers %s line %d: unsupported type %q", name, line, typ)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to read sysusers %s: %w", name, err)
+	}
+	if script.Len() > 0 {
+		if err := r.prependScriptletBody(ScriptletPrein, script.String()); err != nil {
+			return err
+		}
+	}
+	for _, p := range provides {
+		r.Provides.addIfMissing(p)
+	}
+
+	r.AddFile(RPMFile{
+		Name:  path.Join(sysusersDir, name+".conf"),
+		Body:  config,
+		Mode:  0100644,
+		Owner: "root",
+		Group: "root",
+	})
+	if script.Len() == 0 {
+		return nil
+	}
+	tools := []string{"/usr/bin/getent", "/usr/sbin/groupadd", "/usr/sbin/useradd"}
+	if usermod {
+		tools = append(tools, "/usr/sbin/usermod")
+	}
+	return r.AddScriptRequires(SenseScriptPre, tools...)
+}
+
+// splitSysusersLine splits a sysusers.d line into its fields, handling quotes and comments.
+func splitSysusersLine(line string) ([]string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	var (
+		fields []string
+		cur    strings.Builder
+		quote  rune
+		inWord bool
+	)
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+func sysusersIDArg(flag, id string) string {
+	if id == "-" || id == "" {
+		return ""
+	}
+	return " " + flag + " " + shellQuote(id)
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddSysusers(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPrein("echo existing\n")
+	config := []byte(`# hello users
+g hellogrp 950
+u hello - "Hello's daemon" /var/lib/hello
+m hello hellogrp
+`)
+	if err := r.AddSysusers("hello", config); err != nil {
+		t.Fatalf("AddSysusers returned error %v", err)
+	}
+	if _, ok := r.files["/usr/lib/sysusers.d/hello.conf"]; !ok {
+		t.Errorf("sysusers file was not added")
+	}
+	if got, want := r.Provides.String(), "hello=,group(hellogrp),user(hello),group(hello),groupmember(hello/hellogrp)"; got != want {
+		t.Errorf("Provides = %q, want %q", got, want)
+	}
+	wantScript := `getent group 'hellogrp' >/dev/null || groupadd -r -g '950' 'hellogrp' || :
+getent group 'hello' >/dev/null || groupadd -f -r 'hello' || :
+if ! getent passwd 'hello' >/dev/null; then
+    useradd -r -g 'hello' -d '/var/lib/hello' -s '/usr/sbin/nologin' -c 'Hello'\''s daemon' 'hello' || :
+fi
+if getent group 'hellogrp' >/dev/null; then
+    usermod -a -G 'hellogrp' 'hello' || :
+fi
+echo existing
+`
+	if d := cmp.Diff(wantScript, r.scriptlets[ScriptletPrein].body); d != "" {
+		t.Errorf("prein differs (want->got):\n%v", d)
+	}
+	if got, want := r.Requires.String(), "/usr/bin/getent,/usr/sbin/groupadd,/usr/sbin/useradd,/usr/sbin/usermod"; got != want {
+		t.Errorf("Requires = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"x foo", "u", `u foo - "unterminated`, "g badgrp\nu baduser\nx foo"} {
+		provides, prein := r.Provides.String(), r.scriptlets[ScriptletPrein].body
+		if err := r.AddSysusers("bad", []byte(bad)); err == nil {
+			t.Errorf("AddSysusers(%q) should have returned an error", bad)
+		}
+		if r.Provides.String() != provides || r.scriptlets[ScriptletPrein].body != prein {
+			t.Errorf("failed AddSysusers(%q) changed the rpm: provides %q", bad, r.Provides.String())
+		}
+	}
+	if _, ok := r.files["/usr/lib/sysusers.d/bad.conf"]; ok {
+		t.Errorf("failed AddSysusers added the sysusers file")
+	}
+}
+
+func TestAddSysusersNotShell(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.SetScriptletInterpreter(ScriptletPrein, "/usr/bin/python3"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	provides := len(r.Provides)
+	if err := r.AddSysusers("hello", []byte("u hello -\n")); !errors.Is(err, ErrNotShellScriptlet) {
+		t.Errorf("AddSysusers with a python prein returned %v, want %v", err, ErrNotShellScriptlet)
+	}
+	if len(r.Files()) != 0 || len(r.Provides) != provides {
+		t.Errorf("failed AddSysusers changed the rpm: files %v, provides %q", r.Files(), r.Provides.String())
+	}
+}
@@ -19,14 +19,25 @@ package rpmpack
 const (
 	tagHeaderI18NTable = 0x64 // 100
 	// Signature tags are obiously overlapping regular header tags..
-	sigRSA         = 0x010c // 256
-	sigSHA256      = 0x0111 // 273
-	sigSize        = 0x03e8 // 1000
-	sigPGP         = 0x03ea // 1002
-	sigPayloadSize = 0x03ef // 1007
+	sigDSA           = 0x010b // 267
+	sigRSA           = 0x010c // 268
+	sigSHA1          = 0x010d // 269
+	sigLongArchive   = 0x010f // 271
+	sigSHA256        = 0x0111 // 273
+	sigOpenPGP       = 0x0116 // 278
+	sigSize          = 0x03e8 // 1000
+	sigPGP           = 0x03ea // 1002
+	sigMD5           = 0x03ec // 1004
+	sigGPG           = 0x03ed // 1005
+	sigPayloadSize   = 0x03ef // 1007
+	sigReservedSpace = 0x03f0 // 1008
 
 	// https://github.com/rpm-software-management/rpm/blob/92eadae94c48928bca90693ad63c46ceda37d81f/rpmio/rpmpgp.h#L258
+	hashAlgoMD5    = 0x0001 // 1
+	hashAlgoSHA1   = 0x0002 // 2
 	hashAlgoSHA256 = 0x0008 // 8
+	hashAlgoSHA384 = 0x0009 // 9
+	hashAlgoSHA512 = 0x000a // 10
 
 	tagName        = 0x03e8 // 1000
 	tagVersion     = 0x03e9 // 1001
@@ -41,6 +52,8 @@ const (
 	tagLicence     = 0x03f6 // 1014
 	tagPackager    = 0x03f7 // 1015
 	tagGroup       = 0x03f8 // 1016
+	tagSource      = 0x03fa // 1018
+	tagPatch       = 0x03fb // 1019
 	tagURL         = 0x03fc // 1020
 	tagOS          = 0x03fd // 1021
 	tagArch        = 0x03fe // 1022
@@ -68,6 +81,7 @@ const (
 	tagConflictFlags     = 0x041d // 1053
 	tagConflicts         = 0x041e // 1054
 	tagConflictVersion   = 0x041f // 1055
+	tagRPMVersion        = 0x0428 // 1064
 	tagVerifyScript      = 0x0437 // 1079
 	tagPreinProg         = 0x043d // 1085
 	tagPostinProg        = 0x043e // 1086
@@ -79,6 +93,7 @@ const (
 	tagFileINodes        = 0x0448 // 1096
 	tagFileLangs         = 0x0449 // 1097
 	tagPrefixes          = 0x044a // 1098
+	tagSourcePackage     = 0x0452 // 1106
 	tagProvideFlags      = 0x0458 // 1112
 	tagProvideVersion    = 0x0459 // 1113
 	tagObsoleteFlags     = 0x045a // 1114
@@ -93,13 +108,35 @@ const (
 	tagPosttrans         = 0x0480 // 1152
 	tagPretransProg      = 0x0481 // 1153
 	tagPosttransProg     = 0x0482 // 1154
+	tagOldSuggests       = 0x0484 // 1156
+	tagOldSuggestVersion = 0x0485 // 1157
+	tagOldSuggestFlags   = 0x0486 // 1158
+	tagOldEnhances       = 0x0487 // 1159
+	tagOldEnhanceVersion = 0x0488 // 1160
+	tagOldEnhanceFlags   = 0x0489 // 1161
 	tagFileDigestAlgo    = 0x1393 // 5011
+	tagPreinFlags        = 0x139c // 5020
+	tagPostinFlags       = 0x139d // 5021
+	tagPreunFlags        = 0x139e // 5022
+	tagPostunFlags       = 0x139f // 5023
+	tagPretransFlags     = 0x13a0 // 5024
+	tagPosttransFlags    = 0x13a1 // 5025
+	tagVerifyScriptFlags = 0x13a2 // 5026
 	tagRecommends        = 0x13b6 // 5046
 	tagRecommendVersion  = 0x13b7 // 5047
 	tagRecommendFlags    = 0x13b8 // 5048
 	tagSuggests          = 0x13b9 // 5049
 	tagSuggestVersion    = 0x13ba // 5050
 	tagSuggestFlags      = 0x13bb // 5051
+	tagSupplements       = 0x13bc // 5052
+	tagSupplementVersion = 0x13bd // 5053
+	tagSupplementFlags   = 0x13be // 5054
+	tagEnhances          = 0x13bf // 5055
+	tagEnhanceVersion    = 0x13c0 // 5056
+	tagEnhanceFlags      = 0x13c1 // 5057
+	tagEncoding          = 0x13c6 // 5062
 	tagPayloadDigest     = 0x13e4 // 5092
 	tagPayloadDigestAlgo = 0x13e5 // 5093
+	tagPayloadDigestAlt  = 0x13e9 // 5097
+	tagRPMFormat         = 0x13fa // 5114
 )
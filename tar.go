@@ -19,6 +19,11 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cavaliergopher/cpio"
 )
 
 // FromTar reads a tar file and creates an rpm stuct.
@@ -74,3 +79,129 @@ func FromTar(inp io.Reader, md RPMMetaData) (*RPM, error) {
 			})
 	}
 }
+
+// ToTar reads an rpm and writes its payload to w as a tar stream, the inverse of FromTar.
+// The owners, groups and mtimes of the files are taken from the rpm header, and hard links
+// are written as tar hard links. Ghost files are not part of the payload and are skipped.
+func ToTar(w io.Writer, rpm io.Reader) error {
+	pkg, err := ReadPackage(rpm)
+	if err != nil {
+		return err
+	}
+	type fileInfo struct {
+		owner, group string
+		mtime        int32
+	}
+	names, err := pkg.Header.fileNames()
+	if err != nil {
+		return err
+	}
+	var (
+		owners = pkg.Header.entries[tagFileUserName].strings()
+		groups = pkg.Header.entries[tagFileGroupName].strings()
+		mtimes = pkg.Header.entries[tagFileMTimes].int32s()
+	)
+	if len(owners) != len(names) || len(groups) != len(names) || len(mtimes) != len(names) {
+		return fmt.Errorf("%w: header has %d files, %d owners, %d groups and %d mtimes",
+			ErrInconsistentFileIndex, len(names), len(owners), len(groups), len(mtimes))
+	}
+	files := make(map[string]fileInfo, len(names))
+	for i, name := range names {
+		files[name] = fileInfo{owners[i], groups[i], mtimes[i]}
+	}
+
+	z, err := pkg.PayloadReader()
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	c := cpio.NewReader(z)
+	t := tar.NewWriter(w)
+	// Only the last entry of a set of hard links has the content, the others wait for it.
+	pendingLinks := make(map[int64][]*tar.Header)
+	for {
+		hdr, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %w", err)
+		}
+		name := headerFileName(hdr.Name)
+		if name == "/" {
+			continue
+		}
+		info, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%w: payload file %q is not in the header", ErrInconsistentFileIndex, name)
+		}
+		th := &tar.Header{
+			Name:    strings.TrimPrefix(name, "/"),
+			Mode:    int64(hdr.Mode &^ cpio.ModeType),
+			Uname:   info.owner,
+			Gname:   info.group,
+			ModTime: time.Unix(int64(uint32(info.mtime)), 0),
+		}
+		switch hdr.Mode & cpio.ModeType {
+		case cpio.TypeDir:
+			th.Typeflag = tar.TypeDir
+			th.Name += "/"
+		case cpio.TypeSymlink:
+			th.Typeflag = tar.TypeSymlink
+			th.Linkname = hdr.Linkname
+		case cpio.TypeReg:
+			th.Typeflag = tar.TypeReg
+			th.Size = hdr.Size
+			if hdr.Links > 1 && hdr.Size == 0 {
+				pendingLinks[hdr.Inode] = append(pendingLinks[hdr.Inode], th)
+				continue
+			}
+		default:
+			return fmt.Errorf("unsupported file type %o (%q)", hdr.Mode&cpio.ModeType, name)
+		}
+		if err := t.WriteHeader(th); err != nil {
+			return fmt.Errorf("failed to write tar header (%q): %w", name, err)
+		}
+		if th.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(t, c); err != nil {
+				return fmt.Errorf("failed to copy file (%q): %w", name, err)
+			}
+			if err := writeTarLinks(t, th.Name, pendingLinks[hdr.Inode]); err != nil {
+				return err
+			}
+			delete(pendingLinks, hdr.Inode)
+		}
+	}
+	// Hard links to an empty file never get content.
+	inodes := make([]int64, 0, len(pendingLinks))
+	for inode := range pendingLinks {
+		inodes = append(inodes, inode)
+	}
+	sort.Slice(inodes, func(i, j int) bool { return inodes[i] < inodes[j] })
+	for _, inode := range inodes {
+		links := pendingLinks[inode]
+		if err := t.WriteHeader(links[0]); err != nil {
+			return fmt.Errorf("failed to write tar header (%q): %w", links[0].Name, err)
+		}
+		if err := writeTarLinks(t, links[0].Name, links[1:]); err != nil {
+			return err
+		}
+	}
+	if err := t.Close(); err != nil {
+		return fmt.Errorf("failed to close tar: %w", err)
+	}
+	return nil
+}
+
+// writeTarLinks writes the headers of hard links to target.
+func writeTarLinks(t *tar.Writer, target string, links []*tar.Header) error {
+	for _, l := range links {
+		l.Typeflag = tar.TypeLink
+		l.Linkname = target
+		l.Size = 0
+		if err := t.WriteHeader(l); err != nil {
+			return fmt.Errorf("failed to write tar header (%q): %w", l.Name, err)
+		}
+	}
+	return nil
+}
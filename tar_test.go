@@ -17,6 +17,7 @@ package rpmpack
 import (
 	"archive/tar"
 	"bytes"
+	"errors"
 	"io"
 	"testing"
 
@@ -80,7 +81,7 @@ func TestFromTar(t *testing.T) {
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			r, err := FromTar(tc.input, RPMMetaData{})
+			r, err := FromTar(tc.input, RPMMetaData{Name: "fromtar", Version: "1.0"})
 			if err != nil {
 				t.Errorf("FromTar returned err: %v", err)
 			}
@@ -99,3 +100,90 @@ func TestFromTar(t *testing.T) {
 		})
 	}
 }
+
+func TestFromTarRoot(t *testing.T) {
+	b := &bytes.Buffer{}
+	ta := tar.NewWriter(b)
+	for _, name := range []string{"./", "./etc/"} {
+		if err := ta.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755}); err != nil {
+			t.Fatalf("failed to write header %s: %v", name, err)
+		}
+	}
+	ta.Close()
+	r, err := FromTar(b, RPMMetaData{Name: "fromtar", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("FromTar returned error %v", err)
+	}
+	warnings := r.Warnings()
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrRootDir) {
+		t.Errorf("Warnings returned %v, want ErrRootDir", warnings)
+	}
+	if files := r.Files(); len(files) != 1 || files[0].Name != "/etc" {
+		t.Errorf("FromTar added %v, want only /etc", files)
+	}
+}
+
+func TestToTar(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "totar", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/totar", Mode: 040750, Owner: "root", Group: "wheel", MTime: 1000})
+	r.AddFile(RPMFile{Name: "/etc/totar/config", Body: []byte("content1"), Mode: 0640, Owner: "daemon", Group: "daemon", MTime: 2000})
+	r.AddFile(RPMFile{Name: "/etc/totar/link", Body: []byte("config"), Mode: 0120777, Owner: "root", Group: "root", MTime: 3000})
+	r.AddFile(RPMFile{Name: "/var/log/totar.log", Mode: 0644, Owner: "root", Group: "root", Type: GhostFile})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	var out bytes.Buffer
+	if err := ToTar(&out, &b); err != nil {
+		t.Fatalf("ToTar returned error %v", err)
+	}
+
+	type entry struct {
+		Typeflag     byte
+		Name         string
+		Linkname     string
+		Mode         int64
+		Uname, Gname string
+		MTime        int64
+		Body         string
+	}
+	want := []entry{
+		{tar.TypeDir, "etc/totar/", "", 0750, "root", "wheel", 1000, ""},
+		{tar.TypeReg, "etc/totar/config", "", 0640, "daemon", "daemon", 2000, "content1"},
+		{tar.TypeSymlink, "etc/totar/link", "config", 0777, "root", "root", 3000, ""},
+	}
+	var got []entry
+	tr := tar.NewReader(bytes.NewReader(out.Bytes()))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the tar returned error %v", err)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading the tar returned error %v", err)
+		}
+		got = append(got, entry{h.Typeflag, h.Name, h.Linkname, h.Mode, h.Uname, h.Gname, h.ModTime.Unix(), string(body)})
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("ToTar wrote unexpected entries (want->got):\n%s", d)
+	}
+
+	// The tar converts back to the same files.
+	r2, err := FromTar(bytes.NewReader(out.Bytes()), RPMMetaData{Name: "totar", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("FromTar returned error %v", err)
+	}
+	if err := r2.Write(io.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"totar", "config", "link"}, r2.basenames); d != "" {
+		t.Errorf("FromTar(ToTar()) basenames differ (want->got):\n%s", d)
+	}
+}
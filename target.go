@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownTarget is returned by ForTarget for a distribution without settings.
+var ErrUnknownTarget = errors.New("unknown target")
+
+// targets are the settings of the packages built by rpmbuild on each distribution:
+//   - el8 has rpm 4.14, whose packages are compressed with xz. rpmbuild uses level 2
+//     (w2.xzdio), the xz writer of rpmpack has no levels.
+//   - el9 and fedora compress with zstd at level 19.
+//
+// All of them write v4 packages with the payload digest, and reserve 4096 bytes in the
+// signature header, so rpmsign can sign the packages in place.
+var targets = map[string]RPMMetaData{
+	"el8":    {Compressor: "xz", PackageFormat: 4, ReservedSpace: 4096},
+	"el9":    {Compressor: "zstd:19", PackageFormat: 4, ReservedSpace: 4096},
+	"fedora": {Compressor: "zstd:19", PackageFormat: 4, ReservedSpace: 4096},
+}
+
+// Targets returns the names of the distributions known by ForTarget.
+func Targets() []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForTarget returns md with the settings of a target distribution, see Targets, e.g.
+// "el9": the compressor, the package format and the reserved space of the signature
+// header. Only the fields which are empty in md are set, so explicit settings win.
+func ForTarget(target string, md RPMMetaData) (RPMMetaData, error) {
+	t, ok := targets[target]
+	if !ok {
+		return md, fmt.Errorf("%w %q, known targets are %v", ErrUnknownTarget, target, Targets())
+	}
+	if md.Compressor == "" {
+		md.Compressor = t.Compressor
+	}
+	if md.PackageFormat == 0 {
+		md.PackageFormat = t.PackageFormat
+	}
+	if md.ReservedSpace == 0 {
+		md.ReservedSpace = t.ReservedSpace
+	}
+	return md, nil
+}
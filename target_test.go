@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestForTarget(t *testing.T) {
+	testCases := []struct {
+		name   string
+		target string
+		md     RPMMetaData
+		want   RPMMetaData
+	}{
+		{
+			name:   "el8",
+			target: "el8",
+			want:   RPMMetaData{Compressor: "xz", PackageFormat: 4, ReservedSpace: 4096},
+		},
+		{
+			name:   "el9",
+			target: "el9",
+			want:   RPMMetaData{Compressor: "zstd:19", PackageFormat: 4, ReservedSpace: 4096},
+		},
+		{
+			name:   "fedora",
+			target: "fedora",
+			want:   RPMMetaData{Compressor: "zstd:19", PackageFormat: 4, ReservedSpace: 4096},
+		},
+		{
+			name:   "explicit settings win",
+			target: "el9",
+			md:     RPMMetaData{Compressor: "gzip", PackageFormat: 6, ReservedSpace: 1024},
+			want:   RPMMetaData{Compressor: "gzip", PackageFormat: 6, ReservedSpace: 1024},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ForTarget(tc.target, tc.md)
+			if err != nil {
+				t.Fatalf("ForTarget(%q) returned error: %v", tc.target, err)
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("ForTarget(%q) returned unexpected metadata (want->got):\n%s", tc.target, d)
+			}
+			got.Name, got.Version = "hello", "1.0"
+			r, err := NewRPM(got)
+			if err != nil {
+				t.Fatalf("NewRPM with the %s settings returned error: %v", tc.target, err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/hello", Body: []byte("hello"), Mode: 0100644})
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write with the %s settings returned error: %v", tc.target, err)
+			}
+			pkg, err := ReadPackage(&b)
+			if err != nil {
+				t.Fatalf("ReadPackage returned error: %v", err)
+			}
+			if got := pkg.Format(); got != tc.want.PackageFormat {
+				t.Errorf("Format() = %d, want %d", got, tc.want.PackageFormat)
+			}
+			if _, ok := pkg.Header.Entry(tagPayloadDigest); !ok {
+				t.Error("the rpm has no PAYLOADDIGEST")
+			}
+			if space, err := pkg.Signature.Bytes(sigReservedSpace); err != nil || uint(len(space)) != tc.want.ReservedSpace {
+				t.Errorf("RESERVEDSPACE has %d bytes, %v, want %d", len(space), err, tc.want.ReservedSpace)
+			}
+			if _, err := pkg.Files(); err != nil {
+				t.Errorf("Files returned error: %v", err)
+			}
+		})
+	}
+}
+
+func TestForTargetUnknown(t *testing.T) {
+	if _, err := ForTarget("el5", RPMMetaData{}); !errors.Is(err, ErrUnknownTarget) {
+		t.Errorf("ForTarget(el5) returned %v, want %v", err, ErrUnknownTarget)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil helps to write regression tests for code which builds rpms with
+// rpmpack, by comparing rpms semantically instead of byte by byte.
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/rpmpack"
+)
+
+// Options configures Compare.
+type Options struct {
+	// IgnoreTags are the header tags which are not compared, by name like in
+	// rpm --querytags, e.g. "BUILDTIME", or by number, e.g. "1006".
+	IgnoreTags []string
+	// IgnoreFiles are path.Match patterns of the files which are not compared.
+	IgnoreFiles []string
+	// IgnoreFileFields are the fields of the files which are not compared: "mode",
+	// "owner", "group", "mtime", "type" or "body".
+	IgnoreFileFields []string
+	// CompareSignature also compares the signature header tags, which change with every
+	// change of the header.
+	CompareSignature bool
+}
+
+// DefaultOptions ignores the fields which change on every build.
+var DefaultOptions = Options{
+	IgnoreTags:       []string{"BUILDTIME", "BUILDHOST"},
+	IgnoreFileFields: []string{"mtime"},
+}
+
+// Compare compares two rpms tag by tag and file by file, and returns the differences one
+// per line, or "" if the rpms are equal. The file tags of the header, like FILEMODES, are
+// compared file by file, with the content of the files.
+func Compare(want, got []byte, opts Options) (string, error) {
+	wantPkg, err := rpmpack.ReadPackage(bytes.NewReader(want))
+	if err != nil {
+		return "", fmt.Errorf("failed to read wanted rpm: %w", err)
+	}
+	gotPkg, err := rpmpack.ReadPackage(bytes.NewReader(got))
+	if err != nil {
+		return "", fmt.Errorf("failed to read rpm: %w", err)
+	}
+	wantSignature, wantHeader := wantPkg.Dump()
+	gotSignature, gotHeader := gotPkg.Dump()
+	var diffs []string
+	diffs = append(diffs, compareTags("header", wantHeader, gotHeader, func(e rpmpack.DumpEntry) bool {
+		return isFileTag(e.Name) || matchTag(opts.IgnoreTags, e)
+	})...)
+	if opts.CompareSignature {
+		diffs = append(diffs, compareTags("signature", wantSignature, gotSignature, func(rpmpack.DumpEntry) bool {
+			return false
+		})...)
+	}
+
+	wantFiles, err := wantPkg.Files()
+	if err != nil {
+		return "", fmt.Errorf("failed to read files of wanted rpm: %w", err)
+	}
+	gotFiles, err := gotPkg.Files()
+	if err != nil {
+		return "", fmt.Errorf("failed to read files of rpm: %w", err)
+	}
+	fileDiffs, err := compareFiles(wantFiles, gotFiles, opts)
+	if err != nil {
+		return "", err
+	}
+	diffs = append(diffs, fileDiffs...)
+	return strings.Join(diffs, "\n"), nil
+}
+
+// AssertEqual fails the test if the rpms are not equal, see Compare.
+func AssertEqual(t testing.TB, want, got []byte, opts Options) {
+	t.Helper()
+	d, err := Compare(want, got, opts)
+	if err != nil {
+		t.Fatalf("Compare returned error %v", err)
+	}
+	if d != "" {
+		t.Errorf("rpms differ (want->got):\n%s", d)
+	}
+}
+
+// isFileTag reports whether a tag holds a value per file, compared by compareFiles.
+func isFileTag(name string) bool {
+	return strings.HasPrefix(name, "FILE") || name == "BASENAMES" || name == "DIRNAMES" || name == "DIRINDEXES"
+}
+
+func matchTag(tags []string, e rpmpack.DumpEntry) bool {
+	for _, t := range tags {
+		if n, err := strconv.Atoi(t); err == nil && n == e.Tag {
+			return true
+		}
+		if e.Name != "" && strings.EqualFold(t, e.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareTags(what string, want, got []rpmpack.DumpEntry, ignore func(rpmpack.DumpEntry) bool) []string {
+	byTag := func(entries []rpmpack.DumpEntry) map[int]rpmpack.DumpEntry {
+		m := make(map[int]rpmpack.DumpEntry)
+		for _, e := range entries {
+			if !ignore(e) {
+				m[e.Tag] = e
+			}
+		}
+		return m
+	}
+	wantTags, gotTags := byTag(want), byTag(got)
+	var tags []int
+	for tag := range wantTags {
+		tags = append(tags, tag)
+	}
+	for tag := range gotTags {
+		if _, ok := wantTags[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Ints(tags)
+	var diffs []string
+	for _, tag := range tags {
+		w, wok := wantTags[tag]
+		g, gok := gotTags[tag]
+		name := w.Name
+		if !wok {
+			name = g.Name
+		}
+		if name == "" {
+			name = strconv.Itoa(tag)
+		}
+		switch {
+		case !gok:
+			diffs = append(diffs, fmt.Sprintf("%s tag %s: missing, want %v", what, name, w.Value))
+		case !wok:
+			diffs = append(diffs, fmt.Sprintf("%s tag %s: unexpected %v", what, name, g.Value))
+		case w.Type != g.Type || !reflect.DeepEqual(w.Value, g.Value):
+			diffs = append(diffs, fmt.Sprintf("%s tag %s: %s %v, want %s %v", what, name, g.Type, g.Value, w.Type, w.Value))
+		}
+	}
+	return diffs
+}
+
+func compareFiles(want, got []rpmpack.RPMFile, opts Options) ([]string, error) {
+	ignored := func(name string) (bool, error) {
+		for _, p := range opts.IgnoreFiles {
+			ok, err := path.Match(p, name)
+			if err != nil {
+				return false, fmt.Errorf("bad file pattern %q: %w", p, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	byName := func(files []rpmpack.RPMFile) (map[string]rpmpack.RPMFile, error) {
+		m := make(map[string]rpmpack.RPMFile)
+		for _, f := range files {
+			ok, err := ignored(f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				m[f.Name] = f
+			}
+		}
+		return m, nil
+	}
+	wantFiles, err := byName(want)
+	if err != nil {
+		return nil, err
+	}
+	gotFiles, err := byName(got)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for name := range wantFiles {
+		names[name] = true
+	}
+	for name := range gotFiles {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	ignoreField := make(map[string]bool)
+	for _, f := range opts.IgnoreFileFields {
+		ignoreField[f] = true
+	}
+	var diffs []string
+	for _, name := range sorted {
+		w, wok := wantFiles[name]
+		g, gok := gotFiles[name]
+		if !gok {
+			diffs = append(diffs, fmt.Sprintf("file %s: missing", name))
+			continue
+		}
+		if !wok {
+			diffs = append(diffs, fmt.Sprintf("file %s: unexpected", name))
+			continue
+		}
+		fields := []struct {
+			name      string
+			want, got interface{}
+		}{
+			{"mode", fmt.Sprintf("%o", w.Mode), fmt.Sprintf("%o", g.Mode)},
+			{"owner", w.Owner, g.Owner},
+			{"group", w.Group, g.Group},
+			{"mtime", w.MTime, g.MTime},
+			{"type", w.Type, g.Type},
+		}
+		for _, f := range fields {
+			if !ignoreField[f.name] && f.want != f.got {
+				diffs = append(diffs, fmt.Sprintf("file %s %s: %v, want %v", name, f.name, f.got, f.want))
+			}
+		}
+		if !ignoreField["body"] && !bytes.Equal(w.Body, g.Body) {
+			diffs = append(diffs, fmt.Sprintf("file %s body: %d bytes %q, want %d bytes %q",
+				name, len(g.Body), abbreviate(g.Body), len(w.Body), abbreviate(w.Body)))
+		}
+	}
+	return diffs, nil
+}
+
+// abbreviate returns the start of a file body, for error messages.
+func abbreviate(b []byte) string {
+	if len(b) > 40 {
+		return string(b[:40]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/rpmpack"
+)
+
+func buildRPM(t *testing.T, md rpmpack.RPMMetaData, files ...rpmpack.RPMFile) []byte {
+	t.Helper()
+	r, err := rpmpack.NewRPM(md)
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range files {
+		r.AddFile(f)
+	}
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestCompare(t *testing.T) {
+	md := rpmpack.RPMMetaData{Name: "golden", Version: "1.0", BuildTime: time.Unix(1000, 0)}
+	files := []rpmpack.RPMFile{
+		{Name: "/usr/bin/golden", Body: []byte("binary"), Mode: 0755, Owner: "root", Group: "root", MTime: 1},
+		{Name: "/var/cache/golden/index", Body: []byte("cache"), Mode: 0644, Owner: "root", Group: "root", MTime: 1},
+	}
+	want := buildRPM(t, md, files...)
+
+	otherMD := md
+	otherMD.BuildTime = time.Unix(2000, 0)
+	otherMD.Vendor = "Example"
+	otherFiles := []rpmpack.RPMFile{
+		{Name: "/usr/bin/golden", Body: []byte("binary2"), Mode: 0750, Owner: "root", Group: "root", MTime: 2},
+		{Name: "/var/cache/golden/index", Body: []byte("other cache"), Mode: 0644, Owner: "root", Group: "root", MTime: 2},
+		{Name: "/etc/golden.conf", Body: []byte("a=1"), Mode: 0644, Owner: "root", Group: "root", MTime: 2},
+	}
+	got := buildRPM(t, otherMD, otherFiles...)
+
+	testCases := []struct {
+		name string
+		opts Options
+		want string
+	}{{
+		name: "default",
+		opts: Options{
+			IgnoreTags:       append(DefaultOptions.IgnoreTags, "1009", "PAYLOADDIGEST"),
+			IgnoreFiles:      []string{"/var/cache/*/*"},
+			IgnoreFileFields: DefaultOptions.IgnoreFileFields,
+		},
+		want: "header tag VENDOR: unexpected Example\n" +
+			"file /etc/golden.conf: unexpected\n" +
+			"file /usr/bin/golden mode: 100750, want 100755\n" +
+			`file /usr/bin/golden body: 7 bytes "binary2", want 6 bytes "binary"`,
+	}, {
+		name: "ignore everything",
+		opts: Options{
+			IgnoreTags:       []string{"buildtime", "buildhost", "vendor", "size", "payloaddigest"},
+			IgnoreFiles:      []string{"/*/*/*", "/etc/*"},
+			IgnoreFileFields: []string{"mode", "body", "mtime"},
+		},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := Compare(want, got, tc.opts)
+			if err != nil {
+				t.Fatalf("Compare returned error %v", err)
+			}
+			if diff := cmp.Diff(tc.want, d); diff != "" {
+				t.Errorf("Compare returned unexpected differences (want->got):\n%s", diff)
+			}
+		})
+	}
+
+	AssertEqual(t, want, buildRPM(t, md, files...), Options{CompareSignature: true})
+}
+
+func TestCompareExactValues(t *testing.T) {
+	md := rpmpack.RPMMetaData{Name: "golden", Version: "1.0", BuildTime: time.Unix(1000, 0)}
+	build := func(v int64) []byte {
+		t.Helper()
+		r, err := rpmpack.NewRPM(md)
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddCustomTag(5000, rpmpack.EntryInt64([]int64{v}))
+		var b bytes.Buffer
+		if err := r.Write(&b); err != nil {
+			t.Fatalf("Write returned error %v", err)
+		}
+		return b.Bytes()
+	}
+	// The values are equal as float64.
+	d, err := Compare(build(1<<60), build(1<<60+1), Options{})
+	if err != nil {
+		t.Fatalf("Compare returned error %v", err)
+	}
+	want := "header tag 5000: INT64 [1152921504606846977], want INT64 [1152921504606846976]"
+	if diff := cmp.Diff(want, d); diff != "" {
+		t.Errorf("Compare returned unexpected differences (want->got):\n%s", diff)
+	}
+}
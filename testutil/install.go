@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	// ErrNoContainerEngine is returned by Install when neither podman nor docker is found.
+	ErrNoContainerEngine = errors.New("no container engine found")
+	// ErrInstallFailed is returned by Install when the rpm could not be installed.
+	ErrInstallFailed = errors.New("rpm installation failed")
+	// ErrVerifyFailed is returned by Install when rpm -Vp reports differences after the
+	// installation.
+	ErrVerifyFailed = errors.New("rpm verification failed")
+)
+
+// InstallOptions configures Install.
+type InstallOptions struct {
+	// Image is the container image of the distribution, e.g. "fedora:40" or
+	// "registry.suse.com/bci/bci-base:15.6".
+	Image string
+	// Engine is the container engine command. It defaults to podman, or docker if
+	// podman is not found.
+	Engine string
+	// InstallCommand installs the rpm, which is given as the last argument. It
+	// defaults to dnf, yum or zypper, which install the dependencies from the
+	// repositories of the image, and to rpm -i if none of them is found.
+	InstallCommand string
+}
+
+// InstallResult is the output of Install.
+type InstallResult struct {
+	// InstallOutput is the output of the installation command.
+	InstallOutput string
+	// VerifyOutput is the output of rpm -Vp, the differences between the installed
+	// files and the rpm.
+	VerifyOutput string
+}
+
+const (
+	installMarker = "--- rpmpack install"
+	verifyMarker  = "--- rpmpack verify"
+	// The exit codes of the container script, the other exit codes come from the engine.
+	installFailed = 10
+	verifyFailed  = 11
+)
+
+// defaultInstallCommand installs the rpm "$1" with the package manager of the image.
+const defaultInstallCommand = `install_rpm() {
+	if command -v dnf >/dev/null 2>&1; then dnf install -y "$1"
+	elif command -v yum >/dev/null 2>&1; then yum install -y "$1"
+	elif command -v zypper >/dev/null 2>&1; then zypper --non-interactive install --allow-unsigned-rpm "$1"
+	else rpm -i "$1"
+	fi
+}
+`
+
+// Install installs the rpm in a new container of opts.Image with podman or docker, and
+// checks the installed files with rpm -Vp. It returns an error wrapping ErrInstallFailed
+// or ErrVerifyFailed with the output if either fails, so it can be tested whether an rpm
+// actually installs on a distribution.
+func Install(rpm []byte, opts InstallOptions) (*InstallResult, error) {
+	if opts.Image == "" {
+		return nil, errors.New("no container image given")
+	}
+	engine := opts.Engine
+	if engine == "" {
+		for _, e := range []string{"podman", "docker"} {
+			if _, err := exec.LookPath(e); err == nil {
+				engine = e
+				break
+			}
+		}
+		if engine == "" {
+			return nil, ErrNoContainerEngine
+		}
+	}
+	dir, err := os.MkdirTemp("", "rpmpack-install")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "package.rpm"), rpm, 0644); err != nil {
+		return nil, err
+	}
+
+	install := "install_rpm"
+	script := defaultInstallCommand
+	if opts.InstallCommand != "" {
+		install, script = opts.InstallCommand, ""
+	}
+	script += fmt.Sprintf("echo '%s'\n%s /rpms/package.rpm 2>&1 || exit %d\necho '%s'\nrpm -Vp /rpms/package.rpm 2>&1 || exit %d\n",
+		installMarker, install, installFailed, verifyMarker, verifyFailed)
+	cmd := exec.Command(engine, "run", "--rm", "-v", dir+":/rpms:ro,Z", opts.Image, "sh", "-c", script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	res := parseInstallOutput(string(out))
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return res, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == installFailed:
+		return res, fmt.Errorf("%w in %s:\n%s", ErrInstallFailed, opts.Image, res.InstallOutput)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == verifyFailed:
+		return res, fmt.Errorf("%w in %s:\n%s", ErrVerifyFailed, opts.Image, res.VerifyOutput)
+	default:
+		return res, fmt.Errorf("%s run %s failed: %w: %s", engine, opts.Image, err, strings.TrimSpace(stderr.String()))
+	}
+}
+
+// AssertInstalls fails the test if the rpm does not install in opts.Image, see Install.
+// The test is skipped if no container engine is found.
+func AssertInstalls(t testing.TB, rpm []byte, opts InstallOptions) {
+	t.Helper()
+	_, err := Install(rpm, opts)
+	if errors.Is(err, ErrNoContainerEngine) {
+		t.Skip("install test needs podman or docker")
+	}
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// parseInstallOutput splits the output of the container script at the markers.
+func parseInstallOutput(out string) *InstallResult {
+	res := &InstallResult{}
+	_, out, _ = strings.Cut(out, installMarker+"\n")
+	res.InstallOutput, res.VerifyOutput, _ = strings.Cut(out, verifyMarker+"\n")
+	return res
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeEngine writes a container engine which runs the container script on the host, with
+// a fake dnf, and a fake rpm command which fails verification if FAKE_RPM_VERIFY is set.
+func fakeEngine(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"engine": "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n",
+		"dnf":    "#!/bin/sh\necho dnf \"$@\"\n",
+		"rpm":    "#!/bin/sh\nif [ -n \"$FAKE_RPM_VERIFY\" ]; then echo \"$FAKE_RPM_VERIFY\"; exit 1; fi\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatalf("WriteFile returned error %v", err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return filepath.Join(dir, "engine")
+}
+
+func TestInstall(t *testing.T) {
+	engine := fakeEngine(t)
+	testCases := []struct {
+		name    string
+		install string
+		verify  string
+		want    *InstallResult
+		wantErr error
+	}{{
+		name: "default install command",
+		want: &InstallResult{InstallOutput: "dnf install -y /rpms/package.rpm\n"},
+	}, {
+		name:    "installs",
+		install: "echo installing",
+		want:    &InstallResult{InstallOutput: "installing /rpms/package.rpm\n"},
+	}, {
+		name:    "install fails",
+		install: "false",
+		want:    &InstallResult{},
+		wantErr: ErrInstallFailed,
+	}, {
+		name:    "verify fails",
+		install: "echo installing",
+		verify:  "missing   /usr/bin/hello",
+		want:    &InstallResult{InstallOutput: "installing /rpms/package.rpm\n", VerifyOutput: "missing   /usr/bin/hello\n"},
+		wantErr: ErrVerifyFailed,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("FAKE_RPM_VERIFY", tc.verify)
+			got, err := Install([]byte("rpm"), InstallOptions{Image: "fedora:40", Engine: engine, InstallCommand: tc.install})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Install returned error %v, want %v", err, tc.wantErr)
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("Install returned unexpected result (want->got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestInstallNoEngine(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := Install([]byte("rpm"), InstallOptions{Image: "fedora:40"}); !errors.Is(err, ErrNoContainerEngine) {
+		t.Errorf("Install returned %v, want ErrNoContainerEngine", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SystemUser is a system account created by AddSystemUser.
+type SystemUser struct {
+	Name string
+	// Group is the primary group of the user, created if it does not exist.
+	// It defaults to Name.
+	Group string
+	// Home is the home directory, defaulting to "/". It is not created.
+	Home string
+	// Shell defaults to /usr/sbin/nologin.
+	Shell string
+	// Comment is the GECOS field, e.g. "Hello daemon".
+	Comment string
+}
+
+// AddSystemUser creates a system user in the %pre scriptlet with groupadd and useradd,
+// for systems without systemd-sysusers (see AddSysusers otherwise). This is the scriptlet
+// of the classic Fedora packaging guidelines:
+//
+//	getent group hello >/dev/null || groupadd -r hello
+//	getent passwd hello >/dev/null || useradd -r -g hello -d / -s /usr/sbin/nologin hello
+//
+// Like AddSysusers, the %pre scriptlet requires the paths of getent, groupadd and useradd,
+// so any package providing them works. The scriptlet is prepended to an existing prein
+// scriptlet, which must be run by a shell, and never fails the installation.
+func (r *RPM) AddSystemUser(u SystemUser) error {
+	if err := r.checkShellScriptlets(ScriptletPrein); err != nil {
+		return err
+	}
+	if u.Name == "" {
+		return fmt.Errorf("system user needs a name")
+	}
+	if u.Group == "" {
+		u.Group = u.Name
+	}
+	if u.Home == "" {
+		u.Home = "/"
+	}
+	if u.Shell == "" {
+		u.Shell = "/usr/sbin/nologin"
+	}
+	for _, v := range []string{u.Name, u.Group, u.Home, u.Shell} {
+		if strings.ContainsAny(v, " \t\n:") {
+			return fmt.Errorf("invalid system user %q: name, group, home and shell may not contain spaces or colons", u.Name)
+		}
+	}
+	var script strings.Builder
+	fmt.Fprintf(&script, "getent group %s >/dev/null || groupadd -r %s || :\n", shellQuote(u.Group), shellQuote(u.Group))
+	fmt.Fprintf(&script, "getent passwd %s >/dev/null || useradd -r -g %s -d %s -s %s",
+		shellQuote(u.Name), shellQuote(u.Group), shellQuote(u.Home), shellQuote(u.Shell))
+	if u.Comment != "" {
+		fmt.Fprintf(&script, " -c %s", shellQuote(u.Comment))
+	}
+	fmt.Fprintf(&script, " %s || :\n", shellQuote(u.Name))
+	if err := r.prependScriptletBody(ScriptletPrein, script.String()); err != nil {
+		return err
+	}
+	return r.AddScriptRequires(SenseScriptPre, "/usr/bin/getent", "/usr/sbin/groupadd", "/usr/sbin/useradd")
+}
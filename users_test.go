@@ -0,0 +1,69 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddSystemUser(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPrein("echo existing")
+	if err := r.AddSystemUser(SystemUser{Name: "hello", Home: "/var/lib/hello", Comment: "Hello daemon"}); err != nil {
+		t.Fatalf("AddSystemUser returned error %v", err)
+	}
+	want := `getent group 'hello' >/dev/null || groupadd -r 'hello' || :
+getent passwd 'hello' >/dev/null || useradd -r -g 'hello' -d '/var/lib/hello' -s '/usr/sbin/nologin' -c 'Hello daemon' 'hello' || :
+echo existing`
+	if d := cmp.Diff(want, r.scriptlets[ScriptletPrein].body); d != "" {
+		t.Errorf("prein differs (want->got):\n%v", d)
+	}
+	wantReq := Relations{
+		{Name: "/usr/bin/getent", Sense: SenseScriptPre},
+		{Name: "/usr/sbin/groupadd", Sense: SenseScriptPre},
+		{Name: "/usr/sbin/useradd", Sense: SenseScriptPre},
+	}
+	if d := cmp.Diff(wantReq, r.Requires); d != "" {
+		t.Errorf("Requires differ (want->got):\n%v", d)
+	}
+	for _, u := range []SystemUser{{}, {Name: "bad user"}, {Name: "x", Home: "/a:b"}} {
+		if err := r.AddSystemUser(u); err == nil {
+			t.Errorf("AddSystemUser(%+v) should have returned an error", u)
+		}
+	}
+}
+
+func TestAddSystemUserNotShell(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "hello"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPrein(`print("hi")`)
+	if err := r.SetScriptletInterpreter(ScriptletPrein, "<lua>"); err != nil {
+		t.Fatalf("SetScriptletInterpreter returned error %v", err)
+	}
+	if err := r.AddSystemUser(SystemUser{Name: "hello"}); !errors.Is(err, ErrNotShellScriptlet) {
+		t.Errorf("AddSystemUser with a <lua> prein returned %v, want %v", err, ErrNotShellScriptlet)
+	}
+	if got := r.scriptlets[ScriptletPrein].body; got != `print("hi")` {
+		t.Errorf("prein = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidVersion is returned when an EVR string cannot be parsed.
+var ErrInvalidVersion = errors.New("invalid version")
+
+// rpmvercmp compares two version (or release) strings the way rpm does, returning
+// -1, 0 or 1. It is a port of rpmvercmp from rpm's rpmvercmp.c, including the
+// handling of "~" (sorts before anything) and "^" (sorts after the base version).
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isAlnum := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	isAlpha := func(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+	for len(a) > 0 || len(b) > 0 {
+		for len(a) > 0 && !isAlnum(a[0]) && a[0] != '~' && a[0] != '^' {
+			a = a[1:]
+		}
+		for len(b) > 0 && !isAlnum(b[0]) && b[0] != '~' && b[0] != '^' {
+			b = b[1:]
+		}
+
+		// Tilde separators sort before everything else.
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		// Caret separators sort after the end of the version, but before anything else.
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if len(a) == 0 {
+				return -1
+			}
+			if len(b) == 0 {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if len(a) == 0 || len(b) == 0 {
+			break
+		}
+
+		// Grab the first completely numeric or alpha segment of both.
+		class := isAlpha
+		isNum := isDigit(a[0])
+		if isNum {
+			class = isDigit
+		}
+		i := 0
+		for i < len(a) && class(a[i]) {
+			i++
+		}
+		j := 0
+		for j < len(b) && class(b[j]) {
+			j++
+		}
+		segA, segB := a[:i], b[:j]
+		a, b = a[i:], b[j:]
+
+		// Numeric segments are newer than alpha segments.
+		if len(segB) == 0 {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+		if isNum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			// The longer number is the newer one.
+			if len(segA) != len(segB) {
+				if len(segA) > len(segB) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) > 0:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// EVR is a version of the form "[epoch:]version[-release]", as used in relations.
+type EVR struct {
+	// Epoch is 0 if the version has no epoch.
+	Epoch   uint32
+	Version string
+	// Release is empty if the version has no release.
+	Release string
+}
+
+// ParseEVR parses a "[epoch:]version[-release]" string, e.g. "2:1.0-1". The epoch
+// must be numeric, and neither the version nor the release may be empty, contain
+// whitespace or another ":" or "-".
+func ParseEVR(s string) (EVR, error) {
+	var evr EVR
+	rest := s
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		epoch, err := strconv.ParseUint(rest[:i], 10, 32)
+		if err != nil {
+			return EVR{}, fmt.Errorf("%w: invalid epoch in %q", ErrInvalidVersion, s)
+		}
+		evr.Epoch = uint32(epoch)
+		rest = rest[i+1:]
+	}
+	evr.Version = rest
+	if i := strings.LastIndexByte(rest, '-'); i >= 0 {
+		evr.Version, evr.Release = rest[:i], rest[i+1:]
+		if evr.Release == "" {
+			return EVR{}, fmt.Errorf("%w: empty release in %q", ErrInvalidVersion, s)
+		}
+	}
+	if evr.Version == "" {
+		return EVR{}, fmt.Errorf("%w: empty version in %q", ErrInvalidVersion, s)
+	}
+	if strings.ContainsAny(evr.Version, ":-") || strings.ContainsAny(evr.Release, ":") || strings.IndexFunc(rest, unicode.IsSpace) >= 0 {
+		return EVR{}, fmt.Errorf("%w %q", ErrInvalidVersion, s)
+	}
+	return evr, nil
+}
+
+// String returns the "[epoch:]version[-release]" form of the EVR. A zero epoch is omitted.
+func (e EVR) String() string {
+	s := e.Version
+	if e.Epoch > 0 {
+		s = fmt.Sprintf("%d:%s", e.Epoch, s)
+	}
+	if e.Release != "" {
+		s += "-" + e.Release
+	}
+	return s
+}
+
+// Compare compares two EVRs the way rpm does, returning -1, 0 or 1. Like rpm, the
+// releases are only compared if both are present.
+func (e EVR) Compare(o EVR) int {
+	if e.Epoch != o.Epoch {
+		if e.Epoch < o.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := rpmvercmp(e.Version, o.Version); c != 0 {
+		return c
+	}
+	if e.Release == "" || o.Release == "" {
+		return 0
+	}
+	return rpmvercmp(e.Release, o.Release)
+}
+
+// compareEVR compares two "[epoch:]version[-release]" strings. Unparsable versions are
+// compared as a plain version.
+func compareEVR(a, b string) int {
+	ea, err := ParseEVR(a)
+	if err != nil {
+		ea = EVR{Version: a}
+	}
+	eb, err := ParseEVR(b)
+	if err != nil {
+		eb = EVR{Version: b}
+	}
+	return ea.Compare(eb)
+}
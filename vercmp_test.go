@@ -0,0 +1,122 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRPMVerCmp(t *testing.T) {
+	// A selection of the cases of rpm's rpmvercmp.at.
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "8", -1},
+		{"5.5p1", "5.5.p1", 0},
+		{"1.0aa", "1.0a", 1},
+		{"10.0001", "10.1", 0},
+		{"10.0001", "10.0039", -1},
+		{"4.999.9", "5.0", -1},
+		{"20101121", "20101122", -1},
+		{"2_0", "2_0", 0},
+		{"2.0", "2_0", 0},
+		{"a", "a", 0},
+		{"a+", "a_", 0},
+		{"+", "_", 0},
+		{"1.0~rc1", "1.0~rc1", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^20160101", "1.0.1", -1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+	}
+	for _, tc := range testCases {
+		if got := rpmvercmp(tc.a, tc.b); got != tc.want {
+			t.Errorf("rpmvercmp(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := rpmvercmp(tc.b, tc.a); got != -tc.want {
+			t.Errorf("rpmvercmp(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestCompareEVR(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0-1", "1.0-2", -1},
+		{"1.0", "1.0-2", 0},
+		{"1:1.0", "2.0", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0-1.fc30", "1.0-1.fc31", -1},
+	}
+	for _, tc := range testCases {
+		if got := compareEVR(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareEVR(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestParseEVR(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    EVR
+		wantErr bool
+	}{
+		{input: "1.0", want: EVR{Version: "1.0"}},
+		{input: "1.0-1.fc30", want: EVR{Version: "1.0", Release: "1.fc30"}},
+		{input: "2:1.0-1", want: EVR{Epoch: 2, Version: "1.0", Release: "1"}},
+		{input: "0:1.0", want: EVR{Version: "1.0"}},
+		{input: "", wantErr: true},
+		{input: "a:1.0", wantErr: true},
+		{input: "1:", wantErr: true},
+		{input: "1.0-", wantErr: true},
+		{input: "1-0-1", wantErr: true},
+		{input: "1:2:3", wantErr: true},
+		{input: "1.0 1", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseEVR(tc.input)
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidVersion) {
+				t.Errorf("ParseEVR(%q) returned error %v, want %v", tc.input, err, ErrInvalidVersion)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseEVR(%q) returned error %v", tc.input, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseEVR(%q) = %+v, want %+v", tc.input, got, tc.want)
+		}
+	}
+	if got := (EVR{Epoch: 2, Version: "1.0", Release: "1"}).String(); got != "2:1.0-1" {
+		t.Errorf("EVR.String() = %q, want 2:1.0-1", got)
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/cavaliergopher/cpio"
+)
+
+var (
+	// ErrDigestMismatch is returned by VerifyDigests when a digest does not match the content.
+	ErrDigestMismatch = errors.New("digest mismatch")
+	// ErrNotSigned is returned by VerifySignatures when the rpm has no signature.
+	ErrNotSigned = errors.New("rpm is not signed")
+	// ErrBadSignature is returned by VerifySignatures when a signature does not verify.
+	ErrBadSignature = errors.New("bad signature")
+	// ErrBadLead is returned by VerifyDigests when the lead is not one rpm accepts.
+	ErrBadLead = errors.New("bad lead")
+	// ErrInconsistentFileIndex is returned by VerifyDigests and Write when the file tags
+	// of the header do not describe the same files, e.g. after a custom tag replaced one.
+	ErrInconsistentFileIndex = errors.New("inconsistent file index")
+	// ErrUnsupportedDigest is returned for a digest algorithm rpmpack does not implement.
+	ErrUnsupportedDigest = errors.New("unsupported digest algorithm")
+)
+
+// fileIndexTags are the tags with one value per file.
+var fileIndexTags = []int{
+	tagFileSizes, tagFileModes, tagFileRDevs, tagFileMTimes, tagFileDigests, tagFileLinkTos,
+	tagFileFlags, tagFileUserName, tagFileGroupName, tagFileVerifyFlags, tagFileDevices,
+	tagFileINodes, tagFileLangs, tagDirindexes,
+}
+
+var digestAlgos = map[int32]func() hash.Hash{
+	hashAlgoMD5:    md5.New,
+	hashAlgoSHA1:   sha1.New,
+	hashAlgoSHA256: sha256.New,
+	hashAlgoSHA384: sha512.New384,
+	hashAlgoSHA512: sha512.New,
+}
+
+// VerifyDigests reads an rpm and checks that it is internally consistent: the lead, the
+// file tags of the header, the sha256 digest of the header and the sizes in the signature
+// header, the payload digest, and the digests of all the files in the payload. Signatures
+// are not checked. Mismatches are reported as errors wrapping ErrDigestMismatch,
+// ErrBadLead or ErrInconsistentFileIndex.
+func VerifyDigests(r io.Reader) error {
+	pkg, err := ReadPackage(r)
+	if err != nil {
+		return err
+	}
+	if err := checkLead(pkg.Lead); err != nil {
+		return err
+	}
+	if err := checkFileIndex(pkg.Header.entries); err != nil {
+		return err
+	}
+	if e, ok := pkg.Signature.entries[sigSHA256]; ok {
+		if err := checkDigest("header sha256", sha256.New, pkg.Header.raw, e.strings()); err != nil {
+			return err
+		}
+	}
+	if e, ok := pkg.Signature.entries[sigSize]; ok {
+		if got, want := len(pkg.Header.raw)+len(pkg.payload), e.int32s(); len(want) != 1 || int32(got) != want[0] {
+			return fmt.Errorf("%w: header and payload size is %d, the signature header has %v", ErrDigestMismatch, got, want)
+		}
+	}
+	if e, ok := pkg.Header.entries[tagPayloadDigest]; ok {
+		newHash, err := digestAlgo(pkg.Header.entries, tagPayloadDigestAlgo, hashAlgoSHA256)
+		if err != nil {
+			return err
+		}
+		if err := checkDigest("payload", newHash, pkg.payload, e.strings()); err != nil {
+			return err
+		}
+	}
+	return verifyFileDigests(pkg)
+}
+
+// VerifySignatures reads an rpm and checks its OpenPGP signatures with the given public
+// keys, armored or binary, like rpmkeys --checksig: the header-only signature, the header
+// and payload signature, and the signatures of co-signers (see RPM.AddPGPSigner). Every
+// signature must be made by one of the keys. It returns the fingerprints of the keys
+// which made the signatures. Use VerifyDigests to check the digests.
+func VerifySignatures(rpm io.Reader, keys ...[]byte) ([]string, error) {
+	var keyring openpgp.EntityList
+	for i, k := range keys {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k))
+		if err != nil {
+			entities, err = openpgp.ReadKeyRing(bytes.NewReader(k))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key %d: %w", i+1, err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	pkg, err := ReadPackage(rpm)
+	if err != nil {
+		return nil, err
+	}
+	headerPayload := append(append([]byte{}, pkg.Header.raw...), pkg.payload...)
+	type signature struct {
+		name string
+		sig  []byte
+		data []byte
+	}
+	var sigs []signature
+	for _, tag := range []int{sigRSA, sigDSA} {
+		if e, ok := pkg.Signature.entries[tag]; ok {
+			sigs = append(sigs, signature{fmt.Sprintf("header signature (tag %d)", tag), e.data, pkg.Header.raw})
+		}
+	}
+	for _, tag := range []int{sigPGP, sigGPG} {
+		if e, ok := pkg.Signature.entries[tag]; ok {
+			sigs = append(sigs, signature{fmt.Sprintf("header and payload signature (tag %d)", tag), e.data, headerPayload})
+		}
+	}
+	for i, s := range pkg.Signature.entries[sigOpenPGP].strings() {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: OPENPGP signature %d is not base64: %v", ErrBadSignature, i+1, err)
+		}
+		sigs = append(sigs, signature{fmt.Sprintf("OPENPGP signature %d", i+1), b, pkg.Header.raw})
+	}
+	if len(sigs) == 0 {
+		return nil, ErrNotSigned
+	}
+	var fingerprints []string
+	seen := make(map[string]bool)
+	for _, s := range sigs {
+		signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(s.data), bytes.NewReader(s.sig), nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrBadSignature, s.name, err)
+		}
+		fp := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+		if !seen[fp] {
+			seen[fp] = true
+			fingerprints = append(fingerprints, fp)
+		}
+	}
+	return fingerprints, nil
+}
+
+// checkLead checks the fields of the lead which rpm still checks.
+func checkLead(l Lead) error {
+	switch {
+	case l.Major < 3 || l.Major > 4:
+		return fmt.Errorf("%w: unsupported version %d.%d", ErrBadLead, l.Major, l.Minor)
+	case l.Type > 1:
+		return fmt.Errorf("%w: unknown package type %d", ErrBadLead, l.Type)
+	case l.SignatureType != 5:
+		// Only header-style signatures are supported since rpm 3.
+		return fmt.Errorf("%w: unsupported signature type %d", ErrBadLead, l.SignatureType)
+	}
+	return nil
+}
+
+// checkFileIndex checks that the file tags of a header have a value for each basename,
+// and that the dirindexes are within the dirnames.
+func checkFileIndex(h map[int]IndexEntry) error {
+	files := h[tagBasenames].count
+	for _, tag := range fileIndexTags {
+		if e, ok := h[tag]; ok && e.count != files {
+			return fmt.Errorf("%w: tag %d has %d values for %d files", ErrInconsistentFileIndex, tag, e.count, files)
+		}
+	}
+	if files == 0 {
+		return nil
+	}
+	if _, ok := h[tagDirindexes]; !ok {
+		return fmt.Errorf("%w: %d files without dirindexes", ErrInconsistentFileIndex, files)
+	}
+	dirs := int32(h[tagDirnames].count)
+	for i, d := range h[tagDirindexes].int32s() {
+		if d < 0 || d >= dirs {
+			return fmt.Errorf("%w: file %d has dirindex %d, there are %d dirnames", ErrInconsistentFileIndex, i, d, dirs)
+		}
+	}
+	return nil
+}
+
+// verifyFileDigests checks the digests of the regular files in the payload.
+func verifyFileDigests(pkg *Package) error {
+	names, err := pkg.Header.fileNames()
+	if err != nil || len(names) == 0 {
+		return err
+	}
+	var (
+		digests = pkg.Header.entries[tagFileDigests].strings()
+		flags   = pkg.Header.entries[tagFileFlags].int32s()
+	)
+	if len(digests) != len(names) {
+		return fmt.Errorf("%w: header has %d files and %d file digests", ErrInconsistentFileIndex, len(names), len(digests))
+	}
+	// Like rpm, assume md5 for old packages without a file digest algorithm.
+	newHash, err := digestAlgo(pkg.Header.entries, tagFileDigestAlgo, hashAlgoMD5)
+	if err != nil {
+		return err
+	}
+	want := make(map[string]string)
+	for i, name := range names {
+		if digests[i] == "" || (i < len(flags) && FileType(flags[i])&GhostFile != 0) {
+			continue
+		}
+		want[name] = digests[i]
+	}
+
+	z, err := pkg.PayloadReader()
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	c := cpio.NewReader(z)
+	for {
+		hdr, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %w", err)
+		}
+		name := headerFileName(hdr.Name)
+		digest, ok := want[name]
+		if !ok || !hdr.Mode.IsRegular() || (hdr.Size == 0 && hdr.Links > 1) {
+			// Only the last entry of a set of hard links has the content.
+			continue
+		}
+		h := newHash()
+		if _, err := io.Copy(h, c); err != nil {
+			return fmt.Errorf("failed to read payload file %q: %w", name, err)
+		}
+		if got := fmt.Sprintf("%x", h.Sum(nil)); got != digest {
+			return fmt.Errorf("%w: file %q has digest %s, the header has %s", ErrDigestMismatch, name, got, digest)
+		}
+		delete(want, name)
+	}
+	if len(want) > 0 {
+		missing := make([]string, 0, len(want))
+		for name := range want {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("%w: files %v are missing from the payload", ErrDigestMismatch, missing)
+	}
+	return nil
+}
+
+// digestAlgo returns the hash function of a digest algorithm tag, or of algo if the tag is missing.
+func digestAlgo(h map[int]IndexEntry, tag int, algo int32) (func() hash.Hash, error) {
+	if e, ok := h[tag]; ok {
+		if v := e.int32s(); len(v) > 0 {
+			algo = v[0]
+		}
+	}
+	newHash, ok := digestAlgos[algo]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedDigest, algo)
+	}
+	return newHash, nil
+}
+
+func checkDigest(what string, newHash func() hash.Hash, data []byte, want []string) error {
+	h := newHash()
+	h.Write(data)
+	got := fmt.Sprintf("%x", h.Sum(nil))
+	if len(want) != 1 || want[0] != got {
+		return fmt.Errorf("%w: %s digest is %s, the rpm has %v", ErrDigestMismatch, what, got, want)
+	}
+	return nil
+}
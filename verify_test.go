@@ -0,0 +1,220 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/google/go-cmp/cmp"
+)
+
+func testVerifyRPM(t *testing.T, compressor string) []byte {
+	t.Helper()
+	r, err := NewRPM(RPMMetaData{Name: "verify", Version: "1.0", Compressor: compressor})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/verify", Mode: 040755})
+	r.AddFile(RPMFile{Name: "/usr/share/verify/a", Body: []byte("content of a")})
+	r.AddFile(RPMFile{Name: "/usr/share/verify/b", Body: []byte("content of b"), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/usr/share/verify/link", Body: []byte("a"), Mode: 0120777})
+	r.AddFile(RPMFile{Name: "/var/log/verify.log", Body: []byte("not in the payload"), Type: GhostFile})
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestVerifyDigests(t *testing.T) {
+	for _, compressor := range []string{"gzip", "lzma", "xz", "zstd"} {
+		t.Run(compressor, func(t *testing.T) {
+			if err := VerifyDigests(bytes.NewReader(testVerifyRPM(t, compressor))); err != nil {
+				t.Errorf("VerifyDigests returned error %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyDigestsMismatch(t *testing.T) {
+	b := testVerifyRPM(t, "gzip")
+	pkg, err := ReadPackage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("readRPM returned error %v", err)
+	}
+	headerStart := pkg.headerOffset()
+
+	t.Run("header", func(t *testing.T) {
+		c := append([]byte{}, b...)
+		// Change the last byte of the header data, the end of the region entry.
+		c[headerStart+len(pkg.Header.raw)-1] ^= 0xff
+		if err := VerifyDigests(bytes.NewReader(c)); !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("VerifyDigests returned %v, want ErrDigestMismatch", err)
+		}
+	})
+	t.Run("payload", func(t *testing.T) {
+		c := append([]byte{}, b...)
+		c[len(c)-10] ^= 0xff
+		if err := VerifyDigests(bytes.NewReader(c)); !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("VerifyDigests returned %v, want ErrDigestMismatch", err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		if err := VerifyDigests(bytes.NewReader(b[:len(b)-1])); !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("VerifyDigests returned %v, want ErrDigestMismatch", err)
+		}
+	})
+	t.Run("lead", func(t *testing.T) {
+		c := append([]byte{}, b...)
+		// The signature type.
+		c[79] = 1
+		if err := VerifyDigests(bytes.NewReader(c)); !errors.Is(err, ErrBadLead) {
+			t.Errorf("VerifyDigests returned %v, want ErrBadLead", err)
+		}
+	})
+	t.Run("file", func(t *testing.T) {
+		digests := pkg.Header.entries[tagFileDigests].strings()
+		for i, d := range digests {
+			if d != "" {
+				digests[i] = "0" + d[1:]
+				if digests[i] == d {
+					digests[i] = "1" + d[1:]
+				}
+				break
+			}
+		}
+		pkg.Header.entries[tagFileDigests] = EntryStringSlice(digests)
+		if err := verifyFileDigests(pkg); !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("verifyFileDigests returned %v, want ErrDigestMismatch", err)
+		}
+	})
+}
+
+func TestVerifySignatures(t *testing.T) {
+	var (
+		entities []*openpgp.Entity
+		keys     [][]byte
+	)
+	for _, name := range []string{"vendor", "customer"} {
+		e, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+		if err != nil {
+			t.Fatalf("NewEntity returned error %v", err)
+		}
+		var pub bytes.Buffer
+		w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatalf("armor.Encode returned error %v", err)
+		}
+		if err := e.Serialize(w); err != nil {
+			t.Fatalf("Serialize returned error %v", err)
+		}
+		w.Close()
+		entities = append(entities, e)
+		keys = append(keys, pub.Bytes())
+	}
+	write := func(signers ...*openpgp.Entity) []byte {
+		r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/local/hello", Body: []byte("content of the file")})
+		for _, e := range signers {
+			r.AddPGPSigner((&KeySigner{entity: e}).Sign)
+		}
+		var b bytes.Buffer
+		if err := r.Write(&b); err != nil {
+			t.Fatalf("Write returned error %v", err)
+		}
+		return b.Bytes()
+	}
+	cosigned := write(entities...)
+	tampered := append([]byte{}, cosigned...)
+	tampered[len(tampered)-10] ^= 0xff
+
+	for _, tc := range []struct {
+		name    string
+		rpm     []byte
+		keys    [][]byte
+		want    []string
+		wantErr error
+	}{
+		{name: "single signer", rpm: write(entities[0]), keys: keys, want: []string{fmt.Sprintf("%X", entities[0].PrimaryKey.Fingerprint)}},
+		{name: "co-signed", rpm: cosigned, keys: keys, want: []string{fmt.Sprintf("%X", entities[0].PrimaryKey.Fingerprint), fmt.Sprintf("%X", entities[1].PrimaryKey.Fingerprint)}},
+		{name: "missing co-signer key", rpm: cosigned, keys: keys[:1], wantErr: ErrBadSignature},
+		{name: "wrong key", rpm: write(entities[0]), keys: keys[1:], wantErr: ErrBadSignature},
+		{name: "tampered payload", rpm: tampered, keys: keys, wantErr: ErrBadSignature},
+		{name: "unsigned", rpm: write(), keys: keys, wantErr: ErrNotSigned},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := VerifySignatures(bytes.NewReader(tc.rpm), tc.keys...)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("VerifySignatures returned %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifySignatures returned error %v", err)
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("VerifySignatures returned unexpected fingerprints (want->got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestCheckFileIndex(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tag  int
+		e    IndexEntry
+	}{
+		{name: "modes", tag: tagFileModes, e: EntryUint16([]uint16{0100644})},
+		{name: "owners", tag: tagFileUserName, e: EntryStringSlice([]string{"root", "root", "root"})},
+		{name: "dirindexes", tag: tagDirindexes, e: EntryUint32([]uint32{0, 5})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "index", Version: "1.0"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/index/a", Body: []byte("a")})
+			r.AddFile(RPMFile{Name: "/usr/share/index/b", Body: []byte("b")})
+			r.AddCustomTag(tc.tag, tc.e)
+			if err := r.Write(&bytes.Buffer{}); !errors.Is(err, ErrInconsistentFileIndex) {
+				t.Errorf("Write returned %v, want ErrInconsistentFileIndex", err)
+			}
+		})
+	}
+
+	pkg, err := ReadPackage(bytes.NewReader(testVerifyRPM(t, "gzip")))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	pkg.Header.Set(tagFileSizes, EntryUint32([]uint32{1}))
+	var b bytes.Buffer
+	if err := pkg.Write(&b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if err := VerifyDigests(&b); !errors.Is(err, ErrInconsistentFileIndex) {
+		t.Errorf("VerifyDigests returned %v, want ErrInconsistentFileIndex", err)
+	}
+}